@@ -5,11 +5,22 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/metrics"
+	"github.com/Asif-Faizal/Gommerce/openapi"
+	"github.com/Asif-Faizal/Gommerce/services/analytics"
 	"github.com/Asif-Faizal/Gommerce/services/cart"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/services/features"
 	"github.com/Asif-Faizal/Gommerce/services/products"
 	"github.com/Asif-Faizal/Gommerce/services/user"
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
 	"github.com/gorilla/mux" // Popular HTTP router for Go
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // APIServer represents our main server structure
@@ -31,30 +42,106 @@ func NewAPIServer(listenAddress string, db *sql.DB) *APIServer {
 // Run starts the HTTP server and sets up all routes
 // Returns an error if the server fails to start
 func (s *APIServer) Run() error {
+	log.Println("Starting server on", s.listenAddress)
+
+	router, stop := s.newRouter()
+	defer stop()
+
+	// Wrap the router so every request gets a trace span, and expose its trace ID to clients
+	handler := otelhttp.NewHandler(tracing.Middleware(router), tracing.ServiceName)
+
+	// Start the HTTP server and listen for incoming requests
+	return http.ListenAndServe(s.listenAddress, handler)
+}
+
+// newRouter registers every route and starts the background workers the handlers rely on
+// The returned function stops the workers
+func (s *APIServer) newRouter() (*mux.Router, func()) {
 	// Create a new router instance
 	router := mux.NewRouter()
 
+	// Count requests and their latency, and expose them for Prometheus outside the versioned API
+	requestMetrics := metrics.New()
+	router.Use(requestMetrics.Middleware)
+	router.Handle(metrics.Path, requestMetrics.Handler()).Methods(http.MethodGet)
+
+	// Serve the OpenAPI description of the API outside the versioned API
+	router.Handle(openapi.Path, openapi.Handler()).Methods(http.MethodGet)
+
+	// Serve uploaded avatars outside the versioned API
+	router.PathPrefix(user.AvatarPath).Handler(user.AvatarHandler(config.Envs.AvatarDir))
+
 	// Create a subrouter for API versioning
 	// All routes will be prefixed with /api/v1
-	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	subrouter := router.PathPrefix(utils.APIPrefix).Subrouter()
 
-	log.Println("Starting server on", s.listenAddress)
+	// Count hits per API route and day for the admin analytics, written every few seconds so requests never wait on the database
+	analyticsStore := analytics.NewStore(s.db)
+	countHits, stopHitCounter := utils.MetricsMiddleware(analyticsStore, 5*time.Second)
+	subrouter.Use(countHits)
+
+	// Answer in MessagePack when clients ask for it with Accept: application/msgpack
+	subrouter.Use(utils.NegotiateContent)
+
+	// Turn requests away while admins have the API in maintenance mode
+	subrouter.Use(utils.MaintenanceMiddleware)
+
+	// Round prices in responses to the configured number of decimals
+	types.PriceDecimals = int(config.Envs.PriceDecimals)
+	types.DefaultCurrency = config.Envs.DefaultCurrency
 
 	// Initialize user handler and register its routes
-	userStore := user.NewStore(s.db)
-	userHandler := user.NewHandler(userStore)
+	// The cart store backs the admin lookup of a user's orders
+	userStore := user.NewStore(s.db, utils.NewDBCircuitBreaker())
+	cartStore := cart.NewStore(s.db)
+	userHandler := user.NewHandler(userStore, userStore, userStore, userStore, cartStore)
 	userHandler.RegisterRoutes(subrouter)
 
+	// Let admins see which routes are used the most
+	analytics.NewHandler(analyticsStore, userStore).RegisterRoutes(subrouter)
+
+	// Let server-to-server clients authenticate with API keys as well as JWTs
+	utils.SetAPIKeyStore(userStore)
+
+	// Initialize feature flags, read through utils.GetFlag and managed by admins
+	flagStore := features.NewStore(s.db)
+	utils.SetFeatureFlagStore(flagStore)
+	features.NewHandler(flagStore, userStore).RegisterRoutes(subrouter)
+
+	// Stream the stock changes the cart store makes to the admin inventory dashboard
+	inventory := events.NewInventoryBus()
+	cartStore.SetInventoryBus(inventory)
+
 	// Initialize product handler and register its routes
+	// The cart store doubles as the order store for admin order lookups
+	// The handler reads the product listing through a cache, which its product writes invalidate
 	productStore := products.NewStore(s.db)
-	productHandler := products.NewHandler(productStore)
+	cachedProducts := products.NewCachedStore(productStore, time.Second*time.Duration(config.Envs.ProductCacheTTL))
+	priceAlerts := events.NewPriceAlertNotifier(userStore, productStore, events.LogMailer{}, 100)
+	productHandler := products.NewHandler(cachedProducts, cartStore, userStore, productStore, productStore, productStore, productStore, priceAlerts, inventory)
 	productHandler.ProductRoutes(subrouter)
 
+	// Fan out order events to the notification subscribers
+	bus := events.NewEventBus(100)
+	bus.Subscribe(events.NewEmailSubscriber(userStore, events.LogMailer{}).Handle)
+	bus.Subscribe(events.SMSSubscriber{}.Handle)
+
 	// Initialize cart handler and register its routes
-	cartStore := cart.NewStore(s.db)
-	cartHandler := cart.NewHandler(cartStore, productStore)
+	// The user store resolves saved addresses referenced at checkout and holds guest accounts
+	cartHandler := cart.NewHandler(cartStore, productStore, productStore, cartStore, userStore, userStore, bus)
 	cartHandler.OrderRoutes(subrouter)
 
-	// Start the HTTP server and listen for incoming requests
-	return http.ListenAndServe(s.listenAddress, router)
+	// Release expired stock reservations in the background
+	stopSweeper := cart.StartReservationSweeper(cartStore, time.Second*time.Duration(config.Envs.ReservationSweepInterval))
+
+	// Clean up guest accounts once their retention period is over
+	stopGuestSweeper := cart.StartGuestSweeper(userStore, time.Second*time.Duration(config.Envs.GuestRetention), time.Second*time.Duration(config.Envs.GuestSweepInterval))
+
+	return router, func() {
+		stopGuestSweeper()
+		stopSweeper()
+		bus.Close()
+		priceAlerts.Close()
+		stopHitCounter()
+	}
 }
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/openapi"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+// TestOpenAPICoversRoutes checks openapi.json documents every API route and nothing that isn't registered
+func TestOpenAPICoversRoutes(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+	t.Cleanup(func() {
+		utils.SetAPIKeyStore(nil)
+		utils.SetFeatureFlagStore(nil)
+	})
+
+	router, stop := NewAPIServer(":0", db).newRouter()
+	defer stop()
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	// Methods registered for each API path, an empty list means any method is accepted
+	registered := make(map[string][]string)
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, utils.APIPrefix+"/") {
+			return nil
+		}
+		path := strings.TrimPrefix(template, utils.APIPrefix)
+		methods, _ := route.GetMethods()
+		registered[path] = append(registered[path], methods...)
+		if len(methods) == 0 && registered[path] == nil {
+			registered[path] = []string{}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+	if len(registered) == 0 {
+		t.Fatal("Expected API routes to be registered")
+	}
+
+	for path, methods := range registered {
+		operations, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("Route %s is not documented in openapi.json", path)
+			continue
+		}
+		for _, method := range methods {
+			if _, ok := operations[strings.ToLower(method)]; !ok && method != http.MethodHead {
+				t.Errorf("Route %s %s is not documented in openapi.json", method, path)
+			}
+		}
+	}
+
+	for path, operations := range doc.Paths {
+		methods, ok := registered[path]
+		if !ok {
+			t.Errorf("Documented path %s is not registered", path)
+			continue
+		}
+		if len(methods) == 0 {
+			continue
+		}
+		for method := range operations {
+			if !contains(methods, strings.ToUpper(method)) {
+				t.Errorf("Documented operation %s %s is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,24 +3,56 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log" // Standard library for logging
+	"time"
 
 	"github.com/Asif-Faizal/Gommerce/cmd/api"
+	"github.com/Asif-Faizal/Gommerce/cmd/migrate/migrations"
 	"github.com/Asif-Faizal/Gommerce/config"
 	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
 	"github.com/go-sql-driver/mysql"
 )
 
 // main is the entry point function that gets called when the program starts
 // It initializes the database connection and starts the API server
 func main() {
+	if err := config.InitConfig(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
 	// Log the configuration being used
 	log.Printf("Starting server with configuration:")
 	log.Printf("Host: %s", config.Envs.PublicHost)
 	log.Printf("Port: %s", config.Envs.Port)
 	log.Printf("Database: %s@%s/%s", config.Envs.DBUser, config.Envs.DBAddress, config.Envs.DBName)
 
+	// Products created without a currency take the default, so it must be one prices can be in
+	if !types.Currencies[config.Envs.DefaultCurrency] {
+		log.Fatalf("DEFAULT_CURRENCY %q is not a supported currency", config.Envs.DefaultCurrency)
+	}
+
+	// Hash new passwords with the configured algorithm, existing hashes are moved to it as users log in
+	hasher, err := auth.NewPasswordHasher(config.Envs.PasswordHashAlgo)
+	if err != nil {
+		log.Fatalf("Invalid PASSWORD_HASH_ALGO: %v", err)
+	}
+	if err := auth.SetPasswordHasher(hasher); err != nil {
+		log.Fatalf("Failed to initialize password hashing: %v", err)
+	}
+
+	// Initialize distributed tracing, exporting spans when an OTLP endpoint is configured
+	shutdownTracer, err := tracing.InitTracer(context.Background(), config.Envs.OTELExporterEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracer(context.Background())
+
 	// Initialize MySQL database connection using environment configuration
 	db, err := db.MySQLStorage(mysql.Config{
 		User:                 config.Envs.DBUser,
@@ -36,7 +68,14 @@ func main() {
 		log.Fatal(err)
 	}
 
-	initStorage(db)
+	if err := initStorage(db); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Refuse to start against a schema the code doesn't match
+	if err := migrations.CheckVersion(db); err != nil {
+		log.Fatal(err)
+	}
 
 	// Create a new API server instance with the configured port and database connection
 	server := api.NewAPIServer(config.Envs.Port, db)
@@ -46,11 +85,29 @@ func main() {
 	}
 }
 
+// initStorage verifies the database connection, retrying with exponential backoff
+// This gives the database time to come up when both are started together (e.g. Docker Compose)
 func initStorage(db *sql.DB) error {
-	err := db.Ping()
-	if err != nil {
-		return err
+	maxRetries := int(config.Envs.DBMaxRetries)
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
+	backoff := time.Second
+
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		// pinged directly rather than through the circuit breaker, which would open after a few attempts and fail the rest without trying
+		if err = db.Ping(); err == nil {
+			log.Println("Successfully connected to database")
+			return nil
+		}
+		log.Printf("Database connection attempt %d/%d failed: %v", attempt, maxRetries, err)
+
+		if attempt < maxRetries {
+			log.Printf("Retrying in %s", backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
 	}
-	log.Println("Successfully connected to database")
-	return nil
+	return fmt.Errorf("could not connect to database after %d attempts: %w", maxRetries, err)
 }
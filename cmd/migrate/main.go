@@ -4,15 +4,18 @@ import (
 	"log"
 	"os"
 
+	"github.com/Asif-Faizal/Gommerce/cmd/migrate/migrations"
 	"github.com/Asif-Faizal/Gommerce/config"
 	"github.com/Asif-Faizal/Gommerce/db"
 	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate/v4"
-	mysqlmigrate "github.com/golang-migrate/migrate/v4/database/mysql"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
 func main() {
+	if err := config.InitConfig(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
 	log.Printf("Starting server with configuration:")
 	log.Printf("Host: %s", config.Envs.PublicHost)
 	log.Printf("Port: %s", config.Envs.Port)
@@ -27,19 +30,14 @@ func main() {
 		DBName:               config.Envs.DBName,
 		AllowNativePasswords: true,
 		ParseTime:            true,
+		MultiStatements:      true, // Allow migrations with more than one statement
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create MySQL migration driver
-	driver, err := mysqlmigrate.WithInstance(db, &mysqlmigrate.Config{})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Create new migration instance
-	m, err := migrate.NewWithDatabaseInstance("file://cmd/migrate/migrations", "mysql", driver)
+	// Create a migration instance that reads the files embedded in the binary
+	m, err := migrations.New(db)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS login_events (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `ipAddress` VARCHAR(64) NOT NULL,
+  `userAgent` TEXT NOT NULL,
+  `success` BOOLEAN NOT NULL,
+  `loginAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
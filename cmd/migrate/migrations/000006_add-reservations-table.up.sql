@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS reservations (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `status` ENUM('active', 'consumed', 'released') NOT NULL DEFAULT 'active',
+  `expiresAt` TIMESTAMP NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  INDEX (`status`, `expiresAt`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS reservation_items (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `reservationId` INT UNSIGNED NOT NULL,
+  `productId` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (`reservationId`) REFERENCES reservations(`id`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
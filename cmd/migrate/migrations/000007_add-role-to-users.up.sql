@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `role` ENUM('user', 'admin') NOT NULL DEFAULT 'user' AFTER `password`;
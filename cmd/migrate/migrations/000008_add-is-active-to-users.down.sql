@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `isActive`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `isActive` BOOLEAN NOT NULL DEFAULT TRUE AFTER `role`;
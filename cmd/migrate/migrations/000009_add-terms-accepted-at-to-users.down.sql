@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `termsAcceptedAt`;
\ No newline at end of file
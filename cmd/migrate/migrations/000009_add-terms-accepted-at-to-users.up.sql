@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `termsAcceptedAt` TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE users RENAME INDEX idx_users_email TO email;
+
+DROP INDEX idx_products_name ON products;
+
+-- The foreign keys need an index on their column, so add a plain one back before dropping ours
+ALTER TABLE order_items ADD INDEX (orderId), DROP INDEX idx_order_items_orderId;
+ALTER TABLE orders ADD INDEX (userId), DROP INDEX idx_orders_userId;
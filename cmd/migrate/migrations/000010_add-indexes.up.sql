@@ -0,0 +1,14 @@
+-- Migration: Add indexes for common lookups
+-- Description: Speeds up order listing, order item loading and product lookups by name
+
+-- GetOrders filters on userId and sorts by createdAt, so both columns go in one index
+CREATE INDEX idx_orders_userId ON orders (userId, createdAt);
+
+-- Order items are always loaded by their order
+CREATE INDEX idx_order_items_orderId ON order_items (orderId);
+
+-- Products are looked up and searched by name
+CREATE INDEX idx_products_name ON products (name);
+
+-- users.email is already unique, give the index a consistent name instead of duplicating it
+ALTER TABLE users RENAME INDEX email TO idx_users_email;
@@ -0,0 +1 @@
+ALTER TABLE products DROP INDEX idx_products_name, ADD UNIQUE INDEX idx_products_name (name);
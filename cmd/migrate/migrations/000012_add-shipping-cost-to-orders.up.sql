@@ -0,0 +1 @@
+ALTER TABLE orders ADD COLUMN `shippingCost` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `total`;
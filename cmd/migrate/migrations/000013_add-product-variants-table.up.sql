@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS product_variants (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `productId` INT UNSIGNED NOT NULL,
+  `sku` VARCHAR(64) NOT NULL,
+  `attributes` JSON NOT NULL,
+  `price` DECIMAL(10, 2) NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_product_variants_sku` (`sku`),
+  INDEX `idx_product_variants_productId` (`productId`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
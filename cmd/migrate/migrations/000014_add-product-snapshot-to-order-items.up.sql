@@ -0,0 +1,12 @@
+-- Migration: Snapshot product details on order items
+-- Description: Keeps the name and image a product had at purchase time, so renaming or
+-- deleting a product doesn't change historical orders
+
+ALTER TABLE order_items
+  ADD COLUMN `productName` VARCHAR(255) NOT NULL DEFAULT '' AFTER `productId`,
+  ADD COLUMN `productImage` VARCHAR(255) NOT NULL DEFAULT '' AFTER `productName`;
+
+-- Existing items take the current product details, the best snapshot still available
+UPDATE order_items oi
+JOIN products p ON oi.productId = p.id
+SET oi.productName = p.name, oi.productImage = p.image;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `keyHash` CHAR(64) NOT NULL,
+  `label` VARCHAR(100) NOT NULL,
+  `lastUsedAt` TIMESTAMP NULL DEFAULT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_api_keys_keyHash` (`keyHash`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS reviews (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `productId` INT UNSIGNED NOT NULL,
+  `rating` TINYINT UNSIGNED NOT NULL,
+  `comment` TEXT NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  -- A user can review each product once
+  UNIQUE KEY `idx_reviews_productId_userId` (`productId`, `userId`),
+  CHECK (`rating` BETWEEN 1 AND 5),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
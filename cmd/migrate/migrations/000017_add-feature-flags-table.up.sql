@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS feature_flags (
+  `name` VARCHAR(100) NOT NULL,
+  `enabled` BOOLEAN NOT NULL DEFAULT FALSE,
+  `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`name`)
+);
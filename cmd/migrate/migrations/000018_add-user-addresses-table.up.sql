@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_addresses (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `line` TEXT NOT NULL,
+  `country` CHAR(2) NOT NULL DEFAULT '',
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS product_images (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `productId` INT UNSIGNED NOT NULL,
+  `url` VARCHAR(2048) NOT NULL,
+  `sortOrder` INT UNSIGNED NOT NULL DEFAULT 0,
+  `isPrimary` BOOLEAN NOT NULL DEFAULT FALSE,
+
+  PRIMARY KEY (`id`),
+  INDEX `idx_product_images_productId` (`productId`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
@@ -0,0 +1 @@
+ALTER TABLE orders DROP COLUMN `taxAmount`, DROP COLUMN `taxRate`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE orders ADD COLUMN `taxRate` DECIMAL(5, 4) NOT NULL DEFAULT 0 AFTER `shippingCost`, ADD COLUMN `taxAmount` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `taxRate`;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX idx_products_createdAt ON products;
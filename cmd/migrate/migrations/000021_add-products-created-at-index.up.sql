@@ -0,0 +1,2 @@
+-- The product listing is ordered and paged by (createdAt, id)
+CREATE INDEX idx_products_createdAt ON products (createdAt, id);
@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `avatarUrl`;
\ No newline at end of file
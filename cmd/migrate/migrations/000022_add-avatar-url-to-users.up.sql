@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `avatarUrl` VARCHAR(255) NOT NULL DEFAULT '' AFTER `isActive`;
\ No newline at end of file
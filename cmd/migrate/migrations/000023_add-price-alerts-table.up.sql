@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS price_alerts (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `userId` INT UNSIGNED NOT NULL,
+  `productId` INT UNSIGNED NOT NULL,
+  `targetPrice` DECIMAL(10, 2) NOT NULL,
+  `notified` BOOLEAN NOT NULL DEFAULT FALSE,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  -- A user has one alert per product, setting a new target replaces it
+  UNIQUE KEY `idx_price_alerts_user_product` (`userId`, `productId`),
+  INDEX `idx_price_alerts_productId` (`productId`, `notified`, `targetPrice`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
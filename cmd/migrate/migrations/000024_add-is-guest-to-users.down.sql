@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN `isGuest`;
\ No newline at end of file
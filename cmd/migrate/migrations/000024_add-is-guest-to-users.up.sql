@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN `isGuest` BOOLEAN NOT NULL DEFAULT FALSE AFTER `isActive`;
\ No newline at end of file
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS warehouses (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(255) NOT NULL,
+  `latitude` DECIMAL(9, 6) NOT NULL,
+  `longitude` DECIMAL(9, 6) NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_warehouses_name` (`name`)
+);
+
+CREATE TABLE IF NOT EXISTS warehouse_products (
+  `warehouseId` INT UNSIGNED NOT NULL,
+  `productId` INT UNSIGNED NOT NULL,
+  `quantity` INT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`warehouseId`, `productId`),
+  INDEX `idx_warehouse_products_productId` (`productId`),
+  FOREIGN KEY (`warehouseId`) REFERENCES warehouses(`id`),
+  FOREIGN KEY (`productId`) REFERENCES products(`id`)
+);
@@ -0,0 +1,7 @@
+-- Migration: Record the currency of products and orders
+-- Description: ISO 4217 code of the currency a product's price and an order's totals are in,
+-- existing rows were priced before currencies were tracked and are taken to be in USD
+
+ALTER TABLE products ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD' AFTER `price`;
+
+ALTER TABLE orders ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'USD' AFTER `total`;
@@ -0,0 +1,14 @@
+-- Migration: Create audit_log table
+-- Description: Compliance record of account events such as user creation,
+-- there is no foreign key on userId so entries outlive the account they are about
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `event` VARCHAR(64) NOT NULL,
+  `userId` INT UNSIGNED NOT NULL,
+  `metadata` JSON NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  INDEX (`userId`, `createdAt`)
+);
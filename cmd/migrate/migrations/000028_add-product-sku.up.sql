@@ -0,0 +1,7 @@
+-- Migration: Add a SKU to products
+-- Description: Stock keeping unit for warehouse management, unique across products;
+-- existing products have none, so the column is nullable and NULLs don't collide in the unique index
+
+ALTER TABLE products ADD COLUMN `sku` VARCHAR(50) NULL AFTER `name`;
+
+CREATE UNIQUE INDEX idx_products_sku ON products(`sku`);
@@ -0,0 +1 @@
+DROP INDEX idx_products_fulltext ON products;
\ No newline at end of file
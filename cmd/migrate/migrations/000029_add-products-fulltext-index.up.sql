@@ -0,0 +1,4 @@
+-- Migration: Full-text index on products
+-- Description: Lets product search use MATCH ... AGAINST instead of scanning every row with LIKE
+
+CREATE FULLTEXT INDEX idx_products_fulltext ON products(`name`, `description`);
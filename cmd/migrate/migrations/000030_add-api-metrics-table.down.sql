@@ -0,0 +1 @@
+DROP TABLE IF EXISTS api_metrics;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- Migration: Create api_metrics table
+-- Description: Daily hit count of every API route, written by the analytics middleware
+
+CREATE TABLE IF NOT EXISTS api_metrics (
+  `route` VARCHAR(255) NOT NULL,
+  `method` VARCHAR(10) NOT NULL,
+  `date` DATE NOT NULL,
+  `hitCount` INT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`route`, `method`, `date`),
+  INDEX (`date`, `hitCount`)
+);
@@ -0,0 +1,7 @@
+-- Migration: Add a category to products
+-- Description: Category a product is listed under, used to suggest related products;
+-- existing products are uncategorized, so the column is nullable
+
+ALTER TABLE products ADD COLUMN `category` VARCHAR(50) NULL AFTER `sku`;
+
+CREATE INDEX idx_products_category ON products(`category`, `createdAt`);
@@ -0,0 +1,2 @@
+DROP INDEX idx_products_featured ON products;
+ALTER TABLE products DROP COLUMN `featuredAt`, DROP COLUMN `isFeatured`;
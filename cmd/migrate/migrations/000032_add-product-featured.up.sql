@@ -0,0 +1,9 @@
+-- Migration: Add a featured flag to products
+-- Description: Products marketing highlights; featuredAt records when a product was featured
+-- so the featured listing can show the most recently featured first
+
+ALTER TABLE products
+    ADD COLUMN `isFeatured` BOOLEAN NOT NULL DEFAULT FALSE AFTER `category`,
+    ADD COLUMN `featuredAt` TIMESTAMP NULL AFTER `isFeatured`;
+
+CREATE INDEX idx_products_featured ON products(`isFeatured`, `featuredAt`);
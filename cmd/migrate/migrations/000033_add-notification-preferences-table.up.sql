@@ -0,0 +1,14 @@
+-- Migration: Add notification preferences
+-- Description: Which notifications each user opted in to; users without a row get the defaults,
+-- so the table only holds users who changed their preferences
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  `userId` INT UNSIGNED NOT NULL,
+  `orderUpdates` BOOLEAN NOT NULL DEFAULT TRUE,
+  `priceAlerts` BOOLEAN NOT NULL DEFAULT TRUE,
+  `newsletter` BOOLEAN NOT NULL DEFAULT FALSE,
+  `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`userId`),
+  FOREIGN KEY (`userId`) REFERENCES users(`id`)
+);
@@ -0,0 +1 @@
+ALTER TABLE orders DROP COLUMN `country`, DROP COLUMN `shippingMethod`;
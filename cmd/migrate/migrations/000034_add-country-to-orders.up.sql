@@ -0,0 +1,5 @@
+-- Migration: Record the destination country and shipping method of orders
+-- Description: Reorders are priced for the country and shipping method of the original order;
+-- existing orders were placed before these were recorded and are left empty
+
+ALTER TABLE orders ADD COLUMN `shippingMethod` VARCHAR(20) NOT NULL DEFAULT '' AFTER `shippingCost`, ADD COLUMN `country` CHAR(2) NOT NULL DEFAULT '' AFTER `address`;
@@ -0,0 +1,2 @@
+ALTER TABLE reservation_items DROP FOREIGN KEY `fk_reservation_items_variantId`, DROP COLUMN `variantId`;
+ALTER TABLE order_items DROP FOREIGN KEY `fk_order_items_variantId`, DROP COLUMN `variantId`;
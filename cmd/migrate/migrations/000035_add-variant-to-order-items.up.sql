@@ -0,0 +1,10 @@
+-- Migration: Record the variant of order and reservation items
+-- Description: Items of a variant take their stock from product_variants instead of products;
+-- existing items were placed before variants were tracked and have none.
+-- Deleting a variant only unlinks its past order items, while stock still held for it goes with it
+
+ALTER TABLE order_items ADD COLUMN `variantId` INT UNSIGNED NULL AFTER `productId`,
+  ADD CONSTRAINT `fk_order_items_variantId` FOREIGN KEY (`variantId`) REFERENCES product_variants(`id`) ON DELETE SET NULL;
+
+ALTER TABLE reservation_items ADD COLUMN `variantId` INT UNSIGNED NULL AFTER `productId`,
+  ADD CONSTRAINT `fk_reservation_items_variantId` FOREIGN KEY (`variantId`) REFERENCES product_variants(`id`) ON DELETE CASCADE;
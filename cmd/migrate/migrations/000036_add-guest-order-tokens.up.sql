@@ -0,0 +1,16 @@
+-- Migration: Store the tokens guests view their orders with
+-- Description: Only the SHA-256 hash of a token is kept; each token works once and is replaced by a new one
+-- with the same expiry when it is used. Tokens go with their order
+
+CREATE TABLE IF NOT EXISTS guest_order_tokens (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `orderId` INT UNSIGNED NOT NULL,
+  `tokenHash` CHAR(64) NOT NULL,
+  `expiresAt` TIMESTAMP NOT NULL,
+  `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_guest_order_tokens_tokenHash` (`tokenHash`),
+  INDEX `idx_guest_order_tokens_expiresAt` (`expiresAt`),
+  FOREIGN KEY (`orderId`) REFERENCES orders(`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- The removed emails can't be restored, rolling back leaves the audit log as it is
+DO 0;
@@ -0,0 +1,5 @@
+-- Migration: Remove emails from the audit log
+-- Description: Audit entries identify the account by userId only, so the emails recorded in user_created
+-- metadata are dropped; they would otherwise outlive guest accounts purged for privacy
+
+UPDATE audit_log SET metadata = JSON_REMOVE(metadata, '$.email') WHERE JSON_CONTAINS_PATH(metadata, 'one', '$.email');
@@ -0,0 +1,80 @@
+// Package migrations embeds the SQL migration files so the migrate binary
+// can run from any working directory without the source tree
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	mysqlmigrate "github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// FS holds every up and down migration in this directory
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Version is the schema version the application expects, the number of the newest migration
+// Bump it whenever a migration is added
+const Version = 37
+
+// New creates a migrator for db using the embedded migration files
+// Closing the migrator closes db as well
+func New(db *sql.DB) (*migrate.Migrate, error) {
+	driver, err := mysqlmigrate.WithInstance(db, &mysqlmigrate.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return withDriver(driver)
+}
+
+// CheckVersion returns an error if the schema in db isn't at Version or a migration was left half applied
+// It runs on a connection of its own so db stays open for the application
+func CheckVersion(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	driver, err := mysqlmigrate.WithConnection(ctx, conn, &mysqlmigrate.Config{})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	m, err := withDriver(driver)
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading DB schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("DB schema version %d is dirty; fix the failed migration and run migrations", version)
+	}
+	if version != Version {
+		return fmt.Errorf("DB schema version %d does not match required version %d; run migrations", version, Version)
+	}
+	return nil
+}
+
+// withDriver pairs a database driver with the embedded migration files
+func withDriver(driver database.Driver) (*migrate.Migrate, error) {
+	source, err := iofs.New(FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", source, "mysql", driver)
+}
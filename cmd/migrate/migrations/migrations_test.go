@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// TestEmbeddedMigrations checks every embedded migration parses and has both directions
+func TestEmbeddedMigrations(t *testing.T) {
+	if _, err := iofs.New(FS, "."); err != nil {
+		t.Fatalf("Failed to open embedded migrations: %v", err)
+	}
+
+	files, err := fs.Glob(FS, "*.sql")
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected migrations to be embedded")
+	}
+
+	embedded := make(map[string]bool, len(files))
+	for _, name := range files {
+		embedded[name] = true
+	}
+	for _, name := range files {
+		if strings.HasSuffix(name, ".up.sql") && !embedded[strings.TrimSuffix(name, ".up.sql")+".down.sql"] {
+			t.Errorf("Migration %s has no down migration", name)
+		}
+		if strings.HasSuffix(name, ".down.sql") && !embedded[strings.TrimSuffix(name, ".down.sql")+".up.sql"] {
+			t.Errorf("Migration %s has no up migration", name)
+		}
+	}
+}
+
+// TestVersionMatchesNewestMigration checks Version was bumped along with the newest migration
+func TestVersionMatchesNewestMigration(t *testing.T) {
+	files, err := fs.Glob(FS, "*.up.sql")
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+
+	newest := 0
+	for _, name := range files {
+		number, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			t.Fatalf("Migration %s has no version number: %v", name, err)
+		}
+		newest = max(newest, number)
+	}
+	if newest != Version {
+		t.Errorf("Expected Version to be %d, the newest migration, got %d", newest, Version)
+	}
+}
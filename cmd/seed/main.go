@@ -0,0 +1,116 @@
+// Command seed fills the database with demo data for local development and demos
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/products"
+	"github.com/Asif-Faizal/Gommerce/services/user"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/go-sql-driver/mysql"
+)
+
+// The test user can log in with these credentials once the database is seeded
+const (
+	testUserEmail    = "demo@gommerce.dev"
+	testUserPassword = "password123"
+)
+
+func main() {
+	productCount := flag.Int("products", 20, "number of demo products to create")
+	flag.Parse()
+
+	if err := config.InitConfig(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	log.Printf("Database: %s@%s/%s", config.Envs.DBUser, config.Envs.DBAddress, config.Envs.DBName)
+
+	// Initialize MySQL database connection using environment configuration
+	db, err := db.MySQLStorage(mysql.Config{
+		User:                 config.Envs.DBUser,
+		Passwd:               config.Envs.DBPassword,
+		Net:                  "tcp",
+		Addr:                 config.Envs.DBAddress,
+		DBName:               config.Envs.DBName,
+		AllowNativePasswords: true,
+		ParseTime:            true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	seeded, err := seed(context.Background(), user.NewStore(db, utils.NewDBCircuitBreaker()), products.NewStore(db), *productCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !seeded {
+		log.Printf("Test user %s already exists, skipping seeding", testUserEmail)
+		return
+	}
+	log.Printf("Seeded %d products and test user %s (password %q)", *productCount, testUserEmail, testUserPassword)
+}
+
+// seed creates the test user and productCount demo products
+// It returns false without changing anything if the test user already exists, so it is safe to run repeatedly
+func seed(ctx context.Context, userStore types.UserStore, productStore types.ProductStore, productCount int) (bool, error) {
+	if productCount < 0 {
+		return false, fmt.Errorf("product count must not be negative, got %d", productCount)
+	}
+
+	_, err := userStore.GetUserByEmail(ctx, testUserEmail)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("error looking up test user: %w", err)
+	}
+
+	// products go in first, so a failure part way leaves no test user and the next run tries again
+	for i := 1; i <= productCount; i++ {
+		product := &types.Product{
+			Name:        fmt.Sprintf("Demo Product %d", i),
+			Description: fmt.Sprintf("Demo product number %d, created by the seed command", i),
+			Image:       fmt.Sprintf("https://picsum.photos/seed/gommerce-%d/600/600", i),
+			Price:       types.Price(float64(i%10)*5 + 4.99),
+			Quantity:    10 * (i%5 + 1),
+		}
+		err := productStore.CreateProduct(ctx, product)
+		if errors.Is(err, products.ErrProductNameTaken) {
+			continue // left behind by an earlier run that failed part way
+		}
+		if err != nil {
+			return false, fmt.Errorf("error creating %s: %w", product.Name, err)
+		}
+	}
+
+	hashedPassword, err := auth.HashPassword(testUserPassword)
+	if err != nil {
+		return false, fmt.Errorf("error hashing password: %w", err)
+	}
+	now := time.Now()
+	if err := userStore.CreateUser(ctx, &types.User{
+		FirstName:       "Demo",
+		LastName:        "User",
+		Email:           testUserEmail,
+		Password:        hashedPassword,
+		Role:            types.RoleUser,
+		IsActive:        true,
+		CreatedAt:       now,
+		TermsAcceptedAt: &now,
+	}); err != nil {
+		return false, fmt.Errorf("error creating test user: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/products"
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+func TestSeed(t *testing.T) {
+	t.Run("creates the test user and products", func(t *testing.T) {
+		userStore := &mockUserStore{}
+		productStore := &mockProductStore{}
+
+		seeded, err := seed(context.Background(), userStore, productStore, 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !seeded {
+			t.Fatal("Expected the database to be seeded")
+		}
+		if len(productStore.created) != 3 {
+			t.Errorf("Expected 3 products, got %d", len(productStore.created))
+		}
+		if userStore.created == nil || userStore.created.Email != testUserEmail || !userStore.created.IsActive {
+			t.Fatalf("Unexpected test user: %+v", userStore.created)
+		}
+		if !auth.ComparePasswords(userStore.created.Password, testUserPassword) {
+			t.Error("Expected the test user password to be hashed from the known password")
+		}
+	})
+
+	t.Run("skips when the test user exists", func(t *testing.T) {
+		userStore := &mockUserStore{existing: &types.User{ID: 1, Email: testUserEmail}}
+		productStore := &mockProductStore{}
+
+		seeded, err := seed(context.Background(), userStore, productStore, 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if seeded || len(productStore.created) != 0 || userStore.created != nil {
+			t.Errorf("Expected nothing to be seeded, got %d products and user %+v", len(productStore.created), userStore.created)
+		}
+	})
+
+	t.Run("skips products left by an earlier run", func(t *testing.T) {
+		userStore := &mockUserStore{}
+		productStore := &mockProductStore{taken: map[string]bool{"Demo Product 1": true}}
+
+		if _, err := seed(context.Background(), userStore, productStore, 2); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(productStore.created) != 1 || userStore.created == nil {
+			t.Errorf("Expected the remaining product and the test user, got %d products and user %+v", len(productStore.created), userStore.created)
+		}
+	})
+
+	t.Run("returns lookup errors", func(t *testing.T) {
+		userStore := &mockUserStore{lookupErr: errors.New("connection refused")}
+		if _, err := seed(context.Background(), userStore, &mockProductStore{}, 1); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+type mockUserStore struct {
+	existing  *types.User
+	lookupErr error
+	created   *types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	if m.lookupErr != nil {
+		return nil, m.lookupErr
+	}
+	if m.existing != nil && m.existing.Email == email {
+		return m.existing, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(ctx context.Context, user *types.User) error {
+	m.created = user
+	return nil
+}
+
+func (m *mockUserStore) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	return nil
+}
+
+func (m *mockUserStore) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockUserStore) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) CountUsers(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) DeactivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) ActivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+type mockProductStore struct {
+	taken   map[string]bool
+	created []types.Product
+}
+
+func (m *mockProductStore) GetProducts(ctx context.Context, filter types.ProductFilter) ([]types.Product, error) {
+	return m.created, nil
+}
+
+func (m *mockProductStore) GetProductByID(ctx context.Context, id int) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductByName(ctx context.Context, name string) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductBySKU(ctx context.Context, sku string) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetRelatedProducts(ctx context.Context, productID, limit int) ([]types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) SearchProducts(ctx context.Context, query string, page, limit int) ([]types.Product, int, error) {
+	return []types.Product{}, 0, nil
+}
+
+func (m *mockProductStore) GetProductSummaries(ctx context.Context, page, limit int) ([]types.ProductSummary, int, error) {
+	return []types.ProductSummary{}, 0, nil
+}
+
+func (m *mockProductStore) GetFeaturedProducts(ctx context.Context, limit int) ([]types.Product, error) {
+	return []types.Product{}, nil
+}
+
+func (m *mockProductStore) SetFeatured(ctx context.Context, productID int, featured bool) error {
+	return nil
+}
+
+func (m *mockProductStore) CreateProduct(ctx context.Context, product *types.Product) error {
+	if m.taken[product.Name] {
+		return products.ErrProductNameTaken
+	}
+	m.created = append(m.created, *product)
+	return nil
+}
+
+func (m *mockProductStore) CreateProducts(ctx context.Context, products []*types.Product) error {
+	for _, product := range products {
+		if err := m.CreateProduct(ctx, product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockProductStore) AdjustStockBatch(ctx context.Context, adjustments []types.StockAdjustment) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductsByIDs(ctx context.Context, ids []int) ([]types.Product, error) {
+	return nil, nil
+}
+
+func (m *mockProductStore) UpdateProductPrice(ctx context.Context, id int, price types.Price) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductStock(ctx context.Context, id int) (int, error) {
+	return 0, sql.ErrNoRows
+}
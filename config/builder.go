@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Bounds for integer settings that have no natural limit on one side
+const (
+	noMin = math.MinInt64
+	noMax = math.MaxInt64
+)
+
+// configBuilder reads settings from environment variables and collects every problem it finds
+// Reading carries on after a problem so that all of them can be reported at once, see Err
+type configBuilder struct {
+	lookup func(key string) string // Returns the value of an environment variable, empty when unset
+	errs   []string
+}
+
+// newConfigBuilder creates a builder reading variables with lookup, usually os.Getenv
+func newConfigBuilder(lookup func(key string) string) *configBuilder {
+	return &configBuilder{lookup: lookup}
+}
+
+// addError records a problem with the configuration
+func (b *configBuilder) addError(format string, args ...any) {
+	b.errs = append(b.errs, fmt.Sprintf(format, args...))
+}
+
+// getEnv retrieves a variable or returns defaultValue when it is unset or empty
+func (b *configBuilder) getEnv(key, defaultValue string) string {
+	if value := b.lookup(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// placeholderValues are values, in lower case, left in from examples and defaults that must never be used for a required variable
+var placeholderValues = map[string]bool{
+	"secret": true, "your_jwt_secret": true, "jwt_secret": true, "changeme": true, "change_me": true,
+	"password": true, "your_password": true, "example": true, "default": true, "placeholder": true, "todo": true,
+}
+
+// required retrieves a variable that has no default
+// A missing or blank value, or one of the placeholderValues, is recorded as an error
+func (b *configBuilder) required(key string) string {
+	value := b.lookup(key)
+	switch trimmed := strings.TrimSpace(value); {
+	case trimmed == "":
+		b.addError("%s is required", key)
+	case placeholderValues[strings.ToLower(trimmed)]:
+		b.addError("%s must be set to a real value, not the placeholder %q", key, trimmed)
+	}
+	return value
+}
+
+// getInt retrieves an integer variable or returns defaultValue when it is unset
+// A value that isn't an integer or lies outside [min, max] is recorded as an error, and defaultValue is returned instead
+func (b *configBuilder) getInt(key string, defaultValue, min, max int64) int64 {
+	value := b.lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		b.addError("%s must be an integer, got %q", key, value)
+		return defaultValue
+	}
+	switch {
+	case i < min && max == noMax:
+		b.addError("%s must be at least %d, got %d", key, min, i)
+	case i > max && min == noMin:
+		b.addError("%s must be at most %d, got %d", key, max, i)
+	case i < min || i > max:
+		b.addError("%s must be between %d and %d, got %d", key, min, max, i)
+	default:
+		return i
+	}
+	return defaultValue
+}
+
+// getBool retrieves a boolean variable or returns defaultValue when it is unset
+// Accepts the values understood by strconv.ParseBool (1, t, true, 0, f, false, ...), anything else is recorded as an error
+func (b *configBuilder) getBool(key string, defaultValue bool) bool {
+	value := b.lookup(key)
+	if value == "" {
+		return defaultValue
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		b.addError("%s must be true or false, got %q", key, value)
+		return defaultValue
+	}
+	return v
+}
+
+// getList retrieves a comma-separated variable as a list
+// Entries are trimmed and empty entries dropped, so an unset variable gives an empty list
+func (b *configBuilder) getList(key string) []string {
+	var list []string
+	for _, entry := range strings.Split(b.lookup(key), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// getNetworks retrieves a comma-separated list of IP addresses and CIDR ranges, or parses defaultValue when it is unset
+// A single address is a network of just that address; an entry that is neither is recorded as an error and left out
+func (b *configBuilder) getNetworks(key, defaultValue string) []*net.IPNet {
+	value := b.getEnv(key, defaultValue)
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			b.addError("%s must list IP addresses or CIDR ranges, got %q", key, entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Err returns every recorded problem, one per line, or nil if there were none
+func (b *configBuilder) Err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return errors.New("  - " + strings.Join(b.errs, "\n  - "))
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// validEnv returns the required variables, which tests then remove or override
+func validEnv() map[string]string {
+	return map[string]string{
+		"DB_USER":     "gommerce",
+		"DB_PASSWORD": "s3cret",
+		"DB_NAME":     "gommerce",
+		"JWT_SECRET":  "a-long-random-secret",
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		env        func(env map[string]string)
+		wantErrors []string
+	}{
+		{name: "required variables set", env: func(env map[string]string) {}},
+		{
+			name:       "missing JWT secret",
+			env:        func(env map[string]string) { delete(env, "JWT_SECRET") },
+			wantErrors: []string{"JWT_SECRET is required"},
+		},
+		{
+			name: "every required variable missing",
+			env: func(env map[string]string) {
+				for key := range env {
+					delete(env, key)
+				}
+			},
+			wantErrors: []string{"DB_USER is required", "DB_PASSWORD is required", "DB_NAME is required", "JWT_SECRET is required"},
+		},
+		{
+			name:       "blank required variable",
+			env:        func(env map[string]string) { env["DB_PASSWORD"] = "   " },
+			wantErrors: []string{"DB_PASSWORD is required"},
+		},
+		{
+			name:       "placeholder values",
+			env:        func(env map[string]string) { env["JWT_SECRET"] = "your_jwt_secret"; env["DB_PASSWORD"] = " Password " },
+			wantErrors: []string{`JWT_SECRET must be set to a real value, not the placeholder "your_jwt_secret"`, `DB_PASSWORD must be set to a real value, not the placeholder "Password"`},
+		},
+		{
+			name:       "value that isn't an integer",
+			env:        func(env map[string]string) { env["JWT_EXPIRATION"] = "1h" },
+			wantErrors: []string{`JWT_EXPIRATION must be an integer, got "1h"`},
+		},
+		{
+			name:       "out of range values",
+			env:        func(env map[string]string) { env["PORT"] = "70000"; env["RESERVATION_SWEEP_INTERVAL"] = "0" },
+			wantErrors: []string{"PORT must be between 1 and 65535, got 70000", "RESERVATION_SWEEP_INTERVAL must be at least 1, got 0"},
+		},
+		{
+			name:       "invalid boolean",
+			env:        func(env map[string]string) { env["PASSWORD_REQUIRE_SPECIAL"] = "sometimes" },
+			wantErrors: []string{`PASSWORD_REQUIRE_SPECIAL must be true or false, got "sometimes"`},
+		},
+		{
+			name:       "invalid trusted proxy",
+			env:        func(env map[string]string) { env["TRUSTED_PROXIES"] = "10.0.0.1, proxy.internal" },
+			wantErrors: []string{`TRUSTED_PROXIES must list IP addresses or CIDR ranges, got "proxy.internal"`},
+		},
+		{
+			name:       "password lengths out of order",
+			env:        func(env map[string]string) { env["PASSWORD_MIN_LEN"] = "20"; env["PASSWORD_MAX_LEN"] = "10" },
+			wantErrors: []string{"PASSWORD_MAX_LEN (10) must not be less than PASSWORD_MIN_LEN (20)"},
+		},
+		{
+			name: "missing and invalid variables together",
+			env: func(env map[string]string) {
+				delete(env, "DB_USER")
+				env["PRICE_DECIMALS"] = "12"
+				env["DB_QUERY_TIMEOUT"] = "ten"
+			},
+			wantErrors: []string{"DB_USER is required", "PRICE_DECIMALS must be between 0 and 8, got 12", `DB_QUERY_TIMEOUT must be an integer, got "ten"`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := validEnv()
+			tc.env(env)
+
+			_, err := loadConfig(func(key string) string { return env[key] })
+			if len(tc.wantErrors) == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected errors %q, got none", tc.wantErrors)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tc.wantErrors) {
+				t.Errorf("Expected %d errors, got %d:\n%v", len(tc.wantErrors), len(lines), err)
+			}
+			for _, want := range tc.wantErrors {
+				if !strings.Contains(err.Error(), "- "+want) {
+					t.Errorf("Expected error %q in:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	env := validEnv()
+	config, err := loadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Port != ":8080" || config.DBAddress != "127.0.0.1:3306" || config.MaxBulkOrders != 10 || config.PasswordHashAlgo != "bcrypt" {
+		t.Errorf("Expected defaults for unset variables, got %+v", config)
+	}
+	if config.DBUser != "gommerce" || config.JWTSecret != "a-long-random-secret" {
+		t.Errorf("Expected the required variables to be read, got %+v", config)
+	}
+	if len(config.TrustedProxies) != 6 || !config.TrustedProxies[2].Contains(net.ParseIP("10.1.2.3")) {
+		t.Errorf("Expected the loopback and private networks to be trusted by default, got %v", config.TrustedProxies)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	env := validEnv()
+	env["TRUSTED_PROXIES"] = "203.0.113.7, 198.51.100.0/24, 2001:db8::1"
+	config, err := loadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		ip      string
+		trusted bool
+	}{
+		{ip: "203.0.113.7", trusted: true},
+		{ip: "203.0.113.8", trusted: false},
+		{ip: "198.51.100.42", trusted: true},
+		{ip: "2001:db8::1", trusted: true},
+		{ip: "2001:db8::2", trusted: false},
+		{ip: "10.0.0.1", trusted: false},
+	}
+	for _, tc := range testCases {
+		trusted := false
+		for _, network := range config.TrustedProxies {
+			trusted = trusted || network.Contains(net.ParseIP(tc.ip))
+		}
+		if trusted != tc.trusted {
+			t.Errorf("Expected %s trusted to be %v", tc.ip, tc.trusted)
+		}
+	}
+}
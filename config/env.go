@@ -4,14 +4,16 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration values for the application
-// These values can be set through environment variables or will use defaults
+// These values are set through environment variables, the optional ones fall back to defaults
 type Config struct {
 	PublicHost    string // The public host URL for the API
 	Port          string // The port number the server will listen on
@@ -19,51 +21,190 @@ type Config struct {
 	DBPassword    string // Database password
 	DBAddress     string // Database host address and port
 	DBName        string // Database name
+	DBMaxRetries  int64  // Number of times to retry connecting to the database at startup
 	JWTExpiration int64  // JWT expiration time in seconds
 	JWTSecret     string // JWT secret key
+	JWTIssuer     string // Issuer (iss) set on and required of tokens, not checked when empty
+	JWTAudience   string // Audience (aud) set on and required of tokens, not checked when empty
+
+	DBQueryTimeout int64 // How long a single store query or transaction may run, in seconds
+	SlowQueryMS    int64 // Product and cart store queries taking longer are logged, in milliseconds, 0 disables the log
+
+	DBCircuitFailureThreshold int64 // Consecutive database failures that open the circuit breaker
+	DBCircuitRecoveryTimeout  int64 // How long the circuit stays open before a trial call, in seconds
+
+	LoginMaxAttempts     int64 // Consecutive failed logins allowed before an account is locked
+	LoginLockoutDuration int64 // How long a locked account stays locked, in seconds
+	LoginMaxBodyBytes    int64 // Largest login request body accepted, in bytes
+
+	ReservationTTL           int64 // How long reserved stock is held, in seconds
+	ReservationSweepInterval int64 // How often expired reservations are released, in seconds
+
+	GuestRetention     int64 // How long guest accounts and their order links are kept, in seconds
+	GuestSweepInterval int64 // How often expired guest accounts are cleaned up, in seconds
+
+	MaxBulkOrders int64 // Most orders a single bulk order request may place
+
+	ProductCacheTTL int64 // How long the first page of the product listing is served from memory, in seconds, 0 turns the cache off
+
+	OTELExporterEndpoint string // OTLP/HTTP endpoint traces are exported to, tracing is disabled when empty
+
+	PriceDecimals   int64  // Decimal places prices are rounded to in JSON responses
+	DefaultCurrency string // ISO 4217 currency of products created without one
+
+	AvatarDir string // Directory uploaded avatars are saved to and served from
+
+	PasswordMinLength      int64 // Minimum password length on registration
+	PasswordMaxLength      int64 // Maximum password length on registration
+	PasswordRequireSpecial bool  // Whether passwords must contain a special character
+	RejectCommonPasswords  bool  // Whether passwords from the bundled common-password list are rejected
+
+	PasswordHashAlgo string // Algorithm new passwords are hashed with, bcrypt or argon2id
+
+	RegisterAllowedDomains []string // Email domains accounts may be registered with, any domain when empty
+	RejectDisposableEmails bool     // Whether emails from the bundled disposable-email domain list are rejected on registration
+
+	TrustProxy     bool         // Whether X-Forwarded-For and X-Real-IP are trusted for the client IP, only enable behind a proxy that sets them
+	TrustedProxies []*net.IPNet // Networks of the proxies in front of the API, their hops are skipped when finding the client IP
 }
 
+// DefaultTrustedProxies are the loopback and private networks, where a reverse proxy in front of the API usually runs
+const DefaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,fc00::/7"
+
+// Bounds JWT_EXPIRATION is clamped to, in seconds
+// A huge value would make effectively permanent tokens, a tiny one would log users out constantly
+const (
+	MinJWTExpiration = 60 * 5
+	MaxJWTExpiration = 60 * 60 * 24 * 30
+)
+
 // Envs is a global variable that holds the application configuration
-// It's initialized when the package is imported
-var Envs = InitConfig()
+// It holds the defaults, with the required values empty, until InitConfig loads the environment
+var Envs = defaultConfig()
 
-// InitConfig initializes the configuration with environment variables or default values
-// Returns a Config struct with all necessary settings
-func InitConfig() Config {
+// InitConfig loads the configuration from environment variables into Envs, using defaults for the optional ones
+// Returns every configuration error at once, one per line, when a required variable is missing or a value is invalid;
+// Envs is left unchanged then and the caller should exit
+func InitConfig() error {
 	// Load environment variables from .env file if it exists
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found: %v", err)
 	}
 
-	return Config{
-		PublicHost:    getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:          ":" + getEnv("PORT", "8080"), // Add colon prefix for proper port format
-		DBUser:        getEnv("DB_USER", "root"),
-		DBPassword:    getEnv("DB_PASSWORD", "root"),
-		DBAddress:     fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
-		DBName:        getEnv("DB_NAME", "gommerce"),
-		JWTExpiration: getEnvInt("JWT_EXPIRATION", 60*60*24*7),
-		JWTSecret:     getEnv("JWT_SECRET", "secret"),
+	config, err := loadConfig(os.Getenv)
+	if err != nil {
+		return err
+	}
+	Envs = config
+	return nil
+}
+
+// defaultConfig returns the configuration of an empty environment, every optional setting at its default
+func defaultConfig() Config {
+	config, _ := loadConfig(func(string) string { return "" })
+	return config
+}
+
+// loadConfig builds a Config from the variables lookup returns
+// Returns every missing or invalid variable in a single error, one per line
+func loadConfig(lookup func(key string) string) (Config, error) {
+	b := newConfigBuilder(lookup)
+
+	config := Config{
+		PublicHost:    b.getEnv("PUBLIC_HOST", "http://localhost"),
+		Port:          fmt.Sprintf(":%d", b.getInt("PORT", 8080, 1, 65535)), // Add colon prefix for proper port format
+		DBUser:        b.required("DB_USER"),
+		DBPassword:    b.required("DB_PASSWORD"),
+		DBAddress:     fmt.Sprintf("%s:%d", b.getEnv("DB_HOST", "127.0.0.1"), b.getInt("DB_PORT", 3306, 1, 65535)),
+		DBName:        b.required("DB_NAME"),
+		DBMaxRetries:  b.getInt("DB_MAX_RETRIES", 5, 0, noMax),
+		JWTExpiration: clampJWTExpiration(b.getInt("JWT_EXPIRATION", 60*60*24*7, noMin, noMax)),
+		JWTSecret:     b.required("JWT_SECRET"),
+		JWTIssuer:     b.getEnv("JWT_ISSUER", ""),
+		JWTAudience:   b.getEnv("JWT_AUDIENCE", ""),
+
+		DBQueryTimeout: b.getInt("DB_QUERY_TIMEOUT", 10, 1, noMax),
+		SlowQueryMS:    b.getInt("SLOW_QUERY_MS", 500, 0, noMax),
+
+		DBCircuitFailureThreshold: b.getInt("DB_CIRCUIT_FAILURE_THRESHOLD", 5, 1, noMax),
+		DBCircuitRecoveryTimeout:  b.getInt("DB_CIRCUIT_RECOVERY_TIMEOUT", 30, 1, noMax),
+
+		LoginMaxAttempts:     b.getInt("LOGIN_MAX_ATTEMPTS", 5, 1, noMax),
+		LoginLockoutDuration: b.getInt("LOGIN_LOCKOUT_DURATION", 60*15, 1, noMax),
+		LoginMaxBodyBytes:    b.getInt("LOGIN_MAX_BODY_BYTES", 4096, 1, noMax),
+
+		ReservationTTL:           b.getInt("RESERVATION_TTL", 60*15, 1, noMax),
+		ReservationSweepInterval: b.getInt("RESERVATION_SWEEP_INTERVAL", 60, 1, noMax),
+
+		GuestRetention:     b.getInt("GUEST_RETENTION", 60*60*24*30, 1, noMax),
+		GuestSweepInterval: b.getInt("GUEST_SWEEP_INTERVAL", 60*60, 1, noMax),
+
+		MaxBulkOrders: b.getInt("MAX_BULK_ORDERS", 10, 1, noMax),
+
+		ProductCacheTTL: b.getInt("PRODUCT_CACHE_TTL", 30, 0, noMax),
+
+		OTELExporterEndpoint: b.getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+
+		PriceDecimals:   b.getInt("PRICE_DECIMALS", 2, 0, 8),
+		DefaultCurrency: b.getEnv("DEFAULT_CURRENCY", "USD"),
+
+		AvatarDir: b.getEnv("AVATAR_DIR", "uploads/avatars"),
+
+		PasswordMinLength:      b.getInt("PASSWORD_MIN_LEN", 8, 1, noMax),
+		PasswordMaxLength:      b.getInt("PASSWORD_MAX_LEN", 32, 1, noMax),
+		PasswordRequireSpecial: b.getBool("PASSWORD_REQUIRE_SPECIAL", false),
+		RejectCommonPasswords:  b.getBool("REJECT_COMMON_PASSWORDS", false),
+
+		PasswordHashAlgo: b.getEnv("PASSWORD_HASH_ALGO", "bcrypt"),
+
+		RegisterAllowedDomains: b.getList("REGISTER_ALLOWED_DOMAINS"),
+		RejectDisposableEmails: b.getBool("REJECT_DISPOSABLE_EMAILS", false),
+
+		TrustProxy:     b.getBool("TRUST_PROXY", false),
+		TrustedProxies: b.getNetworks("TRUSTED_PROXIES", DefaultTrustedProxies),
+	}
+	if config.PasswordMaxLength < config.PasswordMinLength {
+		b.addError("PASSWORD_MAX_LEN (%d) must not be less than PASSWORD_MIN_LEN (%d)", config.PasswordMaxLength, config.PasswordMinLength)
 	}
+
+	return config, b.Err()
 }
 
-// getEnv retrieves an environment variable or returns a default value
-// key: The name of the environment variable to look for
-// defaultValue: The value to return if the environment variable is not set
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// clampJWTExpiration keeps a JWT expiration, in seconds, within MinJWTExpiration and MaxJWTExpiration
+// A warning is logged when the configured value is out of range
+func clampJWTExpiration(seconds int64) int64 {
+	switch {
+	case seconds < MinJWTExpiration:
+		log.Printf("Warning: JWT_EXPIRATION of %ds is below the minimum, using %ds", seconds, MinJWTExpiration)
+		return MinJWTExpiration
+	case seconds > MaxJWTExpiration:
+		log.Printf("Warning: JWT_EXPIRATION of %ds is above the maximum, using %ds", seconds, MaxJWTExpiration)
+		return MaxJWTExpiration
 	}
-	return defaultValue
+	return seconds
 }
 
-func getEnvInt(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
-		i, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			return defaultValue
-		}
-		return i
+// BaseURL returns the canonical public base URL of the API, e.g. http://localhost:8080
+// PublicHost defaults to http when it has no scheme, and Port is left out when
+// PublicHost already names a port or when it is the default port for the scheme
+func (c Config) BaseURL() string {
+	host := strings.TrimRight(c.PublicHost, "/")
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return host
+	}
+
+	port := strings.TrimPrefix(c.Port, ":")
+	if u.Port() != "" || port == "" {
+		return u.String()
+	}
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		return u.String()
 	}
-	return defaultValue
+	u.Host = net.JoinHostPort(u.Hostname(), port)
+	return u.String()
 }
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		publicHost string
+		port       string
+		expected   string
+	}{
+		{name: "host with scheme and port", publicHost: "http://localhost", port: ":8080", expected: "http://localhost:8080"},
+		{name: "port without colon prefix", publicHost: "http://localhost", port: "8080", expected: "http://localhost:8080"},
+		{name: "host without scheme", publicHost: "api.example.com", port: ":8080", expected: "http://api.example.com:8080"},
+		{name: "trailing slash", publicHost: "https://api.example.com/", port: ":8443", expected: "https://api.example.com:8443"},
+		{name: "default http port", publicHost: "http://api.example.com", port: ":80", expected: "http://api.example.com"},
+		{name: "default https port", publicHost: "https://api.example.com", port: ":443", expected: "https://api.example.com"},
+		{name: "host already has a port", publicHost: "https://api.example.com:9000", port: ":8080", expected: "https://api.example.com:9000"},
+		{name: "empty port", publicHost: "https://api.example.com", port: "", expected: "https://api.example.com"},
+		{name: "ipv6 host", publicHost: "http://[::1]", port: ":8080", expected: "http://[::1]:8080"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Config{PublicHost: tc.publicHost, Port: tc.port}
+			if got := c.BaseURL(); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestClampJWTExpiration(t *testing.T) {
+	testCases := []struct {
+		name     string
+		seconds  int64
+		expected int64
+	}{
+		{name: "too short", seconds: 30, expected: MinJWTExpiration},
+		{name: "negative", seconds: -1, expected: MinJWTExpiration},
+		{name: "too long", seconds: 60 * 60 * 24 * 365, expected: MaxJWTExpiration},
+		{name: "in range", seconds: 60 * 60 * 24 * 7, expected: 60 * 60 * 24 * 7},
+		{name: "at minimum", seconds: MinJWTExpiration, expected: MinJWTExpiration},
+		{name: "at maximum", seconds: MaxJWTExpiration, expected: MaxJWTExpiration},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := clampJWTExpiration(tc.seconds); got != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	defaults := Envs
+	defer func() { Envs = defaults }()
+
+	for key, value := range validEnv() {
+		t.Setenv(key, value)
+	}
+	t.Setenv("JWT_SECRET", "secret")
+	if err := InitConfig(); err == nil || !strings.Contains(err.Error(), "JWT_SECRET") {
+		t.Fatalf("Expected the placeholder JWT secret to be rejected, got %v", err)
+	}
+	if Envs.JWTSecret != defaults.JWTSecret {
+		t.Errorf("Expected Envs to be left unchanged on error, got JWT secret %q", Envs.JWTSecret)
+	}
+
+	t.Setenv("JWT_SECRET", "a-long-random-secret")
+	if err := InitConfig(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if Envs.JWTSecret != "a-long-random-secret" || Envs.DBUser != "gommerce" {
+		t.Errorf("Expected Envs to be loaded from the environment, got %+v", Envs)
+	}
+}
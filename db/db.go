@@ -3,10 +3,31 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"strings"
 
 	"github.com/go-sql-driver/mysql"
 )
 
+// MySQL error number for a duplicate key in a unique index
+const errDuplicateEntry = 1062
+
+// MySQL error number for a syntax error, also raised by a boolean mode full-text query that doesn't parse
+const errParse = 1064
+
+// MySQL error numbers for a value that doesn't fit its column, such as a negative value in an UNSIGNED column
+const (
+	errOutOfRangeValue    = 1264
+	errDataOutOfRange     = 1690
+	errCheckConstraintBad = 3819
+)
+
+// MySQL error numbers for losing a lock race, worth retrying because the same transaction can succeed a moment later
+const (
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+)
+
 // MySQLStorage creates and returns a new MySQL database connection
 // It takes a mysql.Config struct containing all necessary connection parameters
 // Returns a *sql.DB connection and any potential error
@@ -19,3 +40,59 @@ func MySQLStorage(cfg mysql.Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// IsDuplicateEntry reports whether err is a MySQL duplicate key error (1062)
+// Stores use it to turn unique index violations into their own sentinel errors
+func IsDuplicateEntry(err error) bool {
+	return errors.Is(err, &mysql.MySQLError{Number: errDuplicateEntry})
+}
+
+// IsDuplicateKey reports whether err is a MySQL duplicate key error (1062) raised by the unique index named key
+// Stores with several unique indexes on a table use it to tell which one rejected the write
+func IsDuplicateKey(err error, key string) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != errDuplicateEntry {
+		return false
+	}
+	// MySQL 8 qualifies the key with its table, e.g. for key 'products.idx_products_sku'
+	return strings.HasSuffix(mysqlErr.Message, "'"+key+"'") || strings.HasSuffix(mysqlErr.Message, "."+key+"'")
+}
+
+// IsParseError reports whether err is a MySQL syntax error (1064)
+// The statements stores write always parse, so stores use it to spot user input MySQL parses itself,
+// such as a full-text search query with unbalanced quotes or operators
+func IsParseError(err error) bool {
+	return errors.Is(err, &mysql.MySQLError{Number: errParse})
+}
+
+// IsOutOfRange reports whether err is a MySQL error for a value its column can't hold:
+// an out of range value (1264), an out of range result such as an UNSIGNED subtraction below zero (1690)
+// or a violated CHECK constraint (3819)
+// Stores use it as a backstop for guards the database enforces, such as stock never going negative
+func IsOutOfRange(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errOutOfRangeValue, errDataOutOfRange, errCheckConstraintBad:
+		return true
+	}
+	return false
+}
+
+// IsTransient reports whether err is a MySQL error that may go away if the transaction is retried:
+// a lock wait timeout (1205) or a deadlock (1213)
+// Only a transaction that was rolled back as a whole is safe to retry. A lost connection isn't transient,
+// as a write may have been committed before the connection dropped and a retry would apply it twice
+func IsTransient(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errLockWaitTimeout, errLockDeadlock:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+)
+
+// quotedLiteral matches a single or double quoted SQL string, including escaped quotes within it
+var quotedLiteral = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+
+// LogSlowQueries makes d log every query, exec and transaction statement that takes longer than threshold
+// A threshold of zero or less turns the log off
+func (d *DB) LogSlowQueries(threshold time.Duration) *DB {
+	d.slowQuery = threshold
+	return d
+}
+
+// LogConfiguredSlowQueries makes d log slow queries using the SLOW_QUERY_MS setting
+func (d *DB) LogConfiguredSlowQueries() *DB {
+	return d.LogSlowQueries(time.Millisecond * time.Duration(config.Envs.SlowQueryMS))
+}
+
+// logIfSlow logs query when it started longer than threshold ago
+// Only the number of arguments is logged, never their values, as they can hold emails, addresses or tokens
+func logIfSlow(threshold time.Duration, start time.Time, query string, args []any) {
+	if threshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > threshold {
+		log.Printf("Slow query took %s (threshold %s, %d args redacted): %s", elapsed.Round(time.Millisecond), threshold, len(args), redactQuery(query))
+	}
+}
+
+// redactQuery replaces the string literals written into query with ? and collapses its whitespace onto one line
+func redactQuery(query string) string {
+	return strings.Join(strings.Fields(quotedLiteral.ReplaceAllString(query, "?")), " ")
+}
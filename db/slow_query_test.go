@@ -0,0 +1,80 @@
+package db
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestLogSlowQueries checks a query slower than the threshold is logged with its text and duration but without its values
+func TestLogSlowQueries(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer conn.Close()
+	slowDB := WithTimeout(conn, 0).LogSlowQueries(20 * time.Millisecond)
+
+	mock.ExpectQuery("SELECT id FROM users").
+		WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	var id int
+	if err := slowDB.QueryRow("SELECT id FROM users WHERE email = ?", "jane@example.com").Scan(&id); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected a fast query not to be logged, got %q", logs.String())
+	}
+
+	mock.ExpectQuery("SELECT id FROM users").
+		WithArgs("jane@example.com").
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rows, err := slowDB.Query(`SELECT id FROM users
+		WHERE email = ? AND status = 'active'`, "jane@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows.Close()
+
+	line := logs.String()
+	if !strings.Contains(line, "Slow query took") || !strings.Contains(line, "threshold 20ms, 1 args redacted") {
+		t.Errorf("Expected a slow query log line with the duration, got %q", line)
+	}
+	if !strings.Contains(line, "SELECT id FROM users WHERE email = ? AND status = ?") {
+		t.Errorf("Expected the redacted query on one line, got %q", line)
+	}
+	if strings.Contains(line, "jane@example.com") || strings.Contains(line, "active") {
+		t.Errorf("Expected the values to be redacted, got %q", line)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	testCases := []struct {
+		query string
+		want  string
+	}{
+		{query: "SELECT * FROM products WHERE id = ?", want: "SELECT * FROM products WHERE id = ?"},
+		{query: "UPDATE orders SET status = 'paid'\n\tWHERE id = ?", want: "UPDATE orders SET status = ? WHERE id = ?"},
+		{query: `SELECT 'it''s', "a \"b\"" FROM dual`, want: "SELECT ?, ? FROM dual"},
+	}
+
+	for _, tc := range testCases {
+		if got := redactQuery(tc.query); got != tc.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+)
+
+// DB wraps a *sql.DB so every query, exec and transaction runs with a timeout
+// Stores only pass the request context to their tracing spans, so this keeps a stuck query from hanging a request forever
+// Methods other than Query, QueryRow, Exec and Begin are those of the wrapped *sql.DB
+type DB struct {
+	*sql.DB
+	timeout   time.Duration // Zero or negative disables the timeout
+	slowQuery time.Duration // Statements taking longer are logged, zero or negative disables the log
+}
+
+// WithTimeout wraps conn so each of its operations is cancelled once timeout has passed
+func WithTimeout(conn *sql.DB, timeout time.Duration) *DB {
+	return &DB{DB: conn, timeout: timeout}
+}
+
+// WithQueryTimeout wraps conn using the DB_QUERY_TIMEOUT setting
+func WithQueryTimeout(conn *sql.DB) *DB {
+	return WithTimeout(conn, time.Second*time.Duration(config.Envs.DBQueryTimeout))
+}
+
+// context returns a context that expires after the timeout, and the function releasing it
+func (d *DB) context() (context.Context, context.CancelFunc) {
+	if d.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), d.timeout)
+}
+
+// Query runs a query that returns rows, the timeout covers reading the rows until they are closed
+func (d *DB) Query(query string, args ...any) (*Rows, error) {
+	ctx, cancel := d.context()
+	defer logIfSlow(d.slowQuery, time.Now(), query, args)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Rows{Rows: rows, cancel: cancel}, nil
+}
+
+// QueryRow runs a query that returns at most one row, the timeout covers scanning it
+func (d *DB) QueryRow(query string, args ...any) *Row {
+	ctx, cancel := d.context()
+	defer logIfSlow(d.slowQuery, time.Now(), query, args)
+	return &Row{Row: d.DB.QueryRowContext(ctx, query, args...), cancel: cancel}
+}
+
+// Exec runs a query that doesn't return rows
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	ctx, cancel := d.context()
+	defer cancel()
+	defer logIfSlow(d.slowQuery, time.Now(), query, args)
+	return d.DB.ExecContext(ctx, query, args...)
+}
+
+// Begin starts a transaction, the timeout covers the whole transaction until it commits or rolls back
+func (d *DB) Begin() (*Tx, error) {
+	ctx, cancel := d.context()
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Tx{Tx: tx, cancel: cancel, slowQuery: d.slowQuery}, nil
+}
+
+// Rows is the result of DB.Query, closing it releases its timeout
+type Rows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+// Close closes the rows and releases their timeout
+func (r *Rows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+// Row is the result of DB.QueryRow, scanning it releases its timeout
+type Row struct {
+	*sql.Row
+	cancel context.CancelFunc
+}
+
+// Scan copies the row into dest and releases its timeout
+func (r *Row) Scan(dest ...any) error {
+	defer r.cancel()
+	return r.Row.Scan(dest...)
+}
+
+// Tx is a transaction started by DB.Begin, committing or rolling it back releases its timeout
+type Tx struct {
+	*sql.Tx
+	cancel    context.CancelFunc
+	slowQuery time.Duration // Statements taking longer are logged, zero or negative disables the log
+}
+
+// Query runs a query that returns rows within the transaction
+func (t *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	defer logIfSlow(t.slowQuery, time.Now(), query, args)
+	return t.Tx.Query(query, args...)
+}
+
+// QueryRow runs a query that returns at most one row within the transaction
+func (t *Tx) QueryRow(query string, args ...any) *sql.Row {
+	defer logIfSlow(t.slowQuery, time.Now(), query, args)
+	return t.Tx.QueryRow(query, args...)
+}
+
+// Exec runs a query that doesn't return rows within the transaction
+func (t *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	defer logIfSlow(t.slowQuery, time.Now(), query, args)
+	return t.Tx.Exec(query, args...)
+}
+
+// Commit commits the transaction and releases its timeout
+func (t *Tx) Commit() error {
+	defer t.cancel()
+	return t.Tx.Commit()
+}
+
+// Rollback aborts the transaction and releases its timeout
+func (t *Tx) Rollback() error {
+	defer t.cancel()
+	return t.Tx.Rollback()
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingDriver opens connections whose queries block until their context is done
+type blockingDriver struct{}
+
+func (blockingDriver) Open(name string) (driver.Conn, error) {
+	return blockingConn{}, nil
+}
+
+type blockingConn struct{}
+
+func (blockingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (blockingConn) Close() error {
+	return nil
+}
+
+func (blockingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (blockingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func init() {
+	sql.Register("blocking", blockingDriver{})
+}
+
+func TestWithTimeout(t *testing.T) {
+	conn, err := sql.Open("blocking", "")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer conn.Close()
+	timeoutDB := WithTimeout(conn, 50*time.Millisecond)
+
+	testCases := []struct {
+		name string
+		run  func() error
+	}{
+		{name: "query", run: func() error {
+			rows, err := timeoutDB.Query("SELECT SLEEP(60)")
+			if err == nil {
+				rows.Close()
+			}
+			return err
+		}},
+		{name: "query row", run: func() error {
+			var value int
+			return timeoutDB.QueryRow("SELECT SLEEP(60)").Scan(&value)
+		}},
+		{name: "exec", run: func() error {
+			_, err := timeoutDB.Exec("DO SLEEP(60)")
+			return err
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			err := tc.run()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Expected a deadline exceeded error, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected the query to be cut off after the timeout, took %v", elapsed)
+			}
+		})
+	}
+}
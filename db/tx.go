@@ -0,0 +1,29 @@
+package db
+
+// Txn is a transaction that can be committed or rolled back, such as a *Tx or a *sql.Tx
+type Txn interface {
+	Commit() error
+	Rollback() error
+}
+
+// Beginner starts transactions of type T, it is satisfied by *DB and *sql.DB
+type Beginner[T Txn] interface {
+	Begin() (T, error)
+}
+
+// WithTransaction runs fn in a transaction started on conn
+// The transaction is committed if fn succeeds and rolled back if it returns an error or panics
+// Returns the error of fn, or of beginning or committing the transaction
+func WithTransaction[T Txn](conn Beginner[T], fn func(tx T) error) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	// rolling back a committed transaction does nothing, so this only undoes a failed one
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWithTransaction(t *testing.T) {
+	errFn := errors.New("fn failed")
+	errCommit := errors.New("commit failed")
+
+	testCases := []struct {
+		name        string
+		fnErr       error
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectedErr error
+	}{
+		{
+			name: "commits when fn succeeds",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:  "rolls back when fn fails",
+			fnErr: errFn,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectRollback()
+			},
+			expectedErr: errFn,
+		},
+		{
+			name: "returns the commit error",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit().WillReturnError(errCommit)
+			},
+			expectedErr: errCommit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer conn.Close()
+			tc.setupMock(mock)
+
+			err = WithTransaction(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec("UPDATE products SET quantity = 1"); err != nil {
+					return err
+				}
+				return tc.fnErr
+			})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestWithTransactionTimeoutDB(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer conn.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	errFn := errors.New("fn failed")
+	err = WithTransaction(WithTimeout(conn, time.Second), func(tx *Tx) error {
+		return errFn
+	})
+	if !errors.Is(err, errFn) {
+		t.Errorf("Expected error %v, got %v", errFn, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package metrics collects HTTP request metrics and exposes them in the Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Path is where the metrics are served, outside the versioned API prefix
+const Path = "/metrics"
+
+// DefaultBuckets are the upper bounds in seconds of the request duration histogram buckets
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies one request_total series
+type requestKey struct {
+	method, route, status string
+}
+
+// durationKey identifies one request_duration_seconds series
+type durationKey struct {
+	method, route string
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	counts []uint64 // Observations at or below each bucket bound
+	count  uint64   // Total number of observations
+	sum    float64  // Sum of all observed values
+}
+
+// Metrics counts requests by route and status and records how long they take
+// The zero value is not usable, create one with New
+type Metrics struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[durationKey]*histogram
+}
+
+// New creates an empty set of request metrics using DefaultBuckets
+func New() *Metrics {
+	return &Metrics{
+		buckets:   DefaultBuckets,
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[durationKey]*histogram),
+	}
+}
+
+// Middleware records every request handled by the router it is attached to with router.Use
+// Requests are labelled with the route template, e.g. /api/v1/products/{id}, so IDs don't create new series
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		m.observe(r.Method, routeTemplate(r), recorder.status, time.Since(start))
+	})
+}
+
+// Handler serves the collected metrics in the Prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+}
+
+// observe records one finished request
+func (m *Metrics) observe(method, route string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, route: route, status: strconv.Itoa(status)}]++
+
+	key := durationKey{method: method, route: route}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[key] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// write renders every series, sorted so scrapes are stable
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	fmt.Fprintln(w, "# HELP request_total Total number of HTTP requests by route and status.")
+	fmt.Fprintln(w, "# TYPE request_total counter")
+	for _, key := range requestKeys {
+		fmt.Fprintf(w, "request_total{method=%s,route=%s,status=%s} %d\n",
+			labelValue(key.method), labelValue(key.route), labelValue(key.status), m.requests[key])
+	}
+
+	durationKeys := make([]durationKey, 0, len(m.durations))
+	for key := range m.durations {
+		durationKeys = append(durationKeys, key)
+	}
+	sort.Slice(durationKeys, func(i, j int) bool {
+		a, b := durationKeys[i], durationKeys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.method < b.method
+	})
+
+	fmt.Fprintln(w, "# HELP request_duration_seconds HTTP request latency by route.")
+	fmt.Fprintln(w, "# TYPE request_duration_seconds histogram")
+	for _, key := range durationKeys {
+		h := m.durations[key]
+		labels := fmt.Sprintf("method=%s,route=%s", labelValue(key.method), labelValue(key.route))
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+// routeTemplate returns the path template of the matched route, or the raw path if there is none
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// labelEscaper escapes the characters the Prometheus text format requires escaping in label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes a label value for the Prometheus text format
+func labelValue(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+// statusRecorder remembers the status code written by the wrapped handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status before passing it on
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection over to the handler, as WebSocket upgrades need
+// The upgrade is recorded as 101 Switching Protocols
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
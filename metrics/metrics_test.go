@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	router := mux.NewRouter()
+	router.Use(m.Middleware)
+	router.Handle(Path, m.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "0" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "ok")
+	}).Methods(http.MethodGet)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	serve("/api/v1/products/1")
+	serve("/api/v1/products/2")
+	serve("/api/v1/products/0")
+
+	rr := serve(Path)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE request_total counter",
+		`request_total{method="GET",route="/api/v1/products/{id}",status="200"} 2`,
+		`request_total{method="GET",route="/api/v1/products/{id}",status="400"} 1`,
+		"# TYPE request_duration_seconds histogram",
+		`request_duration_seconds_bucket{method="GET",route="/api/v1/products/{id}",le="+Inf"} 3`,
+		`request_duration_seconds_count{method="GET",route="/api/v1/products/{id}"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	// the counters keep increasing between scrapes, and the scrape itself is counted
+	serve("/api/v1/products/3")
+	body = serve(Path).Body.String()
+	for _, want := range []string{
+		`request_total{method="GET",route="/api/v1/products/{id}",status="200"} 3`,
+		`request_total{method="GET",route="/metrics",status="200"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSpec checks the document is valid JSON, declares OpenAPI 3 and every reference resolves
+func TestSpec(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", version)
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	if len(paths) == 0 {
+		t.Fatal("Expected the document to describe some paths")
+	}
+
+	var checkRefs func(v interface{})
+	checkRefs = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok && !resolves(doc, ref) {
+				t.Errorf("Reference %s does not resolve", ref)
+			}
+			for _, child := range v {
+				checkRefs(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				checkRefs(child)
+			}
+		}
+	}
+	checkRefs(doc)
+}
+
+// resolves reports whether a local reference such as #/components/schemas/Product points at something
+func resolves(doc map[string]interface{}, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var node interface{} = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if node, ok = object[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected JSON, got %q", contentType)
+	}
+	if rr.Body.String() != string(Spec) {
+		t.Error("Expected the embedded document to be served unchanged")
+	}
+}
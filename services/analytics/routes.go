@@ -0,0 +1,52 @@
+package analytics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// TopRoutesLimit is how many routes GET /admin/analytics/routes returns
+const TopRoutesLimit = 20
+
+// Handler represents the analytics HTTP handlers
+type Handler struct {
+	store     types.MetricsStore // Interface for analytics data operations
+	userStore types.UserStore    // Interface for user lookups in admin-only routes
+}
+
+// NewHandler creates a new instance of the analytics Handler
+func NewHandler(store types.MetricsStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+// RegisterRoutes sets up the admin-only analytics routes
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	requireAdmin := utils.RequireRole(h.userStore, types.RoleAdmin)
+	router.Handle("/admin/analytics/routes", requireAdmin(http.HandlerFunc(h.handleGetTopRoutes))).Methods(http.MethodGet)
+}
+
+// handleGetTopRoutes lists the most requested routes of a day, ?date=YYYY-MM-DD, today by default
+func (h *Handler) handleGetTopRoutes(w http.ResponseWriter, r *http.Request) {
+	date := utils.GetStringParam(r, "date", time.Now().Format(time.DateOnly))
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("date must be in YYYY-MM-DD format"))
+		return
+	}
+
+	metrics, err := h.store.GetTopRoutes(r.Context(), date, TopRoutesLimit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "route analytics fetched successfully",
+		"data":    metrics,
+	})
+}
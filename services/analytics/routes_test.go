@@ -0,0 +1,174 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/gorilla/mux"
+)
+
+// TestGetTopRoutes checks only admins can see the most requested routes of a day
+func TestGetTopRoutes(t *testing.T) {
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	store := &mockMetricsStore{metrics: []types.APIMetrics{
+		{Route: "/api/v1/products", Method: http.MethodGet, Date: "2024-05-01", HitCount: 40},
+		{Route: "/api/v1/products/{id}", Method: http.MethodGet, Date: "2024-05-01", HitCount: 12},
+		{Route: "/api/v1/login", Method: http.MethodPost, Date: "2024-05-02", HitCount: 7},
+	}}
+	router := mux.NewRouter()
+	NewHandler(store, userStore).RegisterRoutes(router)
+
+	testCases := []struct {
+		name           string
+		userID         int
+		query          string
+		expectedStatus int
+		expectedDate   string
+		expectedRoutes int
+	}{
+		{name: "admin lists a day", userID: 1, query: "?date=2024-05-01", expectedStatus: http.StatusOK, expectedDate: "2024-05-01", expectedRoutes: 2},
+		{name: "date defaults to today", userID: 1, expectedStatus: http.StatusOK, expectedDate: time.Now().Format(time.DateOnly)},
+		{name: "invalid date", userID: 1, query: "?date=05/01/2024", expectedStatus: http.StatusBadRequest},
+		{name: "regular user", userID: 2, query: "?date=2024-05-01", expectedStatus: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store.date, store.limit = "", 0
+			req, err := http.NewRequest(http.MethodGet, "/admin/analytics/routes"+tc.query, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Authorization", authHeader(t, tc.userID))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if store.date != tc.expectedDate || store.limit != TopRoutesLimit {
+				t.Errorf("Expected the top %d routes of %s, got the top %d of %s", TopRoutesLimit, tc.expectedDate, store.limit, store.date)
+			}
+			var response struct {
+				Data []types.APIMetrics `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Data) != tc.expectedRoutes {
+				t.Fatalf("Expected %d routes, got %+v", tc.expectedRoutes, response.Data)
+			}
+			if tc.expectedRoutes > 0 && response.Data[0].Route != "/api/v1/products" {
+				t.Errorf("Expected the most requested route first, got %+v", response.Data)
+			}
+		})
+	}
+}
+
+// mockMetricsStore implements the types.MetricsStore interface in memory
+// It records the day and limit of the last GetTopRoutes call
+type mockMetricsStore struct {
+	metrics []types.APIMetrics
+	date    string
+	limit   int
+}
+
+func (m *mockMetricsStore) AddHits(ctx context.Context, hits []types.APIMetrics) error {
+	m.metrics = append(m.metrics, hits...)
+	return nil
+}
+
+func (m *mockMetricsStore) GetTopRoutes(ctx context.Context, date string, limit int) ([]types.APIMetrics, error) {
+	m.date, m.limit = date, limit
+	metrics := []types.APIMetrics{}
+	for _, metric := range m.metrics {
+		if metric.Date == date && len(metrics) < limit {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+// mockUserStore implements the types.UserStore interface for testing
+// Only GetUserByID is backed by data, which is all the role middleware needs
+type mockUserStore struct {
+	users map[int]*types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	return nil
+}
+
+func (m *mockUserStore) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	return []types.LoginEvent{}, 0, nil
+}
+
+func (m *mockUserStore) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	return []types.User{}, nil
+}
+
+func (m *mockUserStore) CountUsers(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) DeactivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) ActivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+// authHeader returns a valid Authorization header value for the given user ID
+func authHeader(t *testing.T, userID int) string {
+	t.Helper()
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return "Bearer " + token
+}
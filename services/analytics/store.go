@@ -0,0 +1,69 @@
+// Package analytics contains the API usage analytics database operations and admin routes
+package analytics
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// Store represents the API usage analytics data store
+// It implements the types.MetricsStore interface
+type Store struct {
+	db *db.DB // Database connection, every query runs with DB_QUERY_TIMEOUT
+}
+
+// NewStore creates a new instance of the analytics Store
+// Takes a database connection as a parameter
+func NewStore(conn *sql.DB) *Store {
+	return &Store{db: db.WithQueryTimeout(conn)}
+}
+
+// AddHits adds the hit count of each route, method and day to the stored count, in a single transaction
+// Callers should pass the hits in a consistent order, so concurrent batches lock the rows in the same order
+func (s *Store) AddHits(ctx context.Context, hits []types.APIMetrics) error {
+	defer tracing.StartDBSpan(ctx, "AddHits").End()
+
+	query := `
+		INSERT INTO api_metrics (route, method, date, hitCount) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE hitCount = hitCount + ?
+	`
+	return db.WithTransaction(s.db, func(tx *db.Tx) error {
+		for _, hit := range hits {
+			if _, err := tx.Exec(query, hit.Route, hit.Method, hit.Date, hit.HitCount, hit.HitCount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetTopRoutes retrieves up to limit routes requested on date, a YYYY-MM-DD day, most requested first
+func (s *Store) GetTopRoutes(ctx context.Context, date string, limit int) ([]types.APIMetrics, error) {
+	defer tracing.StartDBSpan(ctx, "GetTopRoutes").End()
+
+	query := `
+		SELECT route, method, DATE_FORMAT(date, '%Y-%m-%d'), hitCount FROM api_metrics
+		WHERE date = ?
+		ORDER BY hitCount DESC, route ASC, method ASC
+		LIMIT ?
+	`
+	rows, err := s.db.Query(query, date, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []types.APIMetrics{}
+	for rows.Next() {
+		var metric types.APIMetrics
+		if err := rows.Scan(&metric.Route, &metric.Method, &metric.Date, &metric.HitCount); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, rows.Err()
+}
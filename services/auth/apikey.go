@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// APIKeyPrefix marks generated API keys so they are easy to recognise, e.g. in secret scanners
+const APIKeyPrefix = "gmk_"
+
+// GenerateAPIKey returns a new random API key
+// The key is shown to its owner once; only its hash is stored
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash an API key is stored and looked up by
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// commonPasswordsList is a bundled list of widely used passwords, one per line
+//
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// commonPasswords is the lookup set built from commonPasswordsList
+var commonPasswords = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordsList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// IsCommonPassword reports whether the password appears in the bundled list of common passwords
+// The comparison is case-insensitive, so "Password123" is treated the same as "password123"
+func IsCommonPassword(password string) bool {
+	_, found := commonPasswords[strings.ToLower(password)]
+	return found
+}
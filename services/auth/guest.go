@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// GuestOrderTokenPrefix marks guest order tokens so they are easy to recognise, e.g. in secret scanners
+const GuestOrderTokenPrefix = "gog_"
+
+// GenerateGuestOrderToken returns a new random token that lets a guest view one order
+// The token is handed to the guest once; only its hash is stored and it can be used a single time
+func GenerateGuestOrderToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return GuestOrderTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// HashGuestOrderToken returns the hex-encoded SHA-256 hash a guest order token is stored and looked up by
+func HashGuestOrderToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuestOrderToken(t *testing.T) {
+	token, err := GenerateGuestOrderToken()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(token, GuestOrderTokenPrefix) {
+		t.Errorf("Expected the token to start with %q, got %q", GuestOrderTokenPrefix, token)
+	}
+	other, err := GenerateGuestOrderToken()
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if token == other {
+		t.Error("Expected every token to be different")
+	}
+
+	hash := HashGuestOrderToken(token)
+	if len(hash) != 64 || hash != HashGuestOrderToken(token) || hash == HashGuestOrderToken(other) {
+		t.Errorf("Expected a stable SHA-256 hash per token, got %q", hash)
+	}
+	if _, err := VerifyJWT(token, []byte("test-secret")); err == nil {
+		t.Error("Expected a guest order token to be rejected as a login token")
+	}
+}
@@ -11,10 +11,17 @@ import (
 
 func CreateJWT(secret []byte, userId int) (string, error) {
 	expiration := time.Second * time.Duration(config.Envs.JWTExpiration)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"userId":    strconv.Itoa(userId),
 		"expiredAt": time.Now().Add(expiration).Unix(),
-	})
+	}
+	if config.Envs.JWTIssuer != "" {
+		claims["iss"] = config.Envs.JWTIssuer
+	}
+	if config.Envs.JWTAudience != "" {
+		claims["aud"] = config.Envs.JWTAudience
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(secret)
 	if err != nil {
 		return "", err
@@ -23,14 +30,23 @@ func CreateJWT(secret []byte, userId int) (string, error) {
 }
 
 // VerifyJWT verifies a JWT token and returns the user ID if valid
+// When an issuer or audience is configured, tokens must carry a matching iss or aud claim
 func VerifyJWT(tokenString string, secret []byte) (int, error) {
+	var options []jwt.ParserOption
+	if config.Envs.JWTIssuer != "" {
+		options = append(options, jwt.WithIssuer(config.Envs.JWTIssuer))
+	}
+	if config.Envs.JWTAudience != "" {
+		options = append(options, jwt.WithAudience(config.Envs.JWTAudience))
+	}
+
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Validate the signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return secret, nil
-	})
+	}, options...)
 
 	if err != nil {
 		return 0, fmt.Errorf("invalid token: %w", err)
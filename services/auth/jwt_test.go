@@ -1,83 +1,99 @@
 package auth
 
 import (
+	"os"
 	"testing"
 
 	"github.com/Asif-Faizal/Gommerce/config"
-	"github.com/golang-jwt/jwt"
 )
 
-func TestCreateJWT(t *testing.T) {
-	// Test cases
-	tests := []struct {
-		name     string
-		secret   []byte
-		userId   int
-		wantErr  bool
-		validate func(t *testing.T, token string)
-	}{
-		{
-			name:    "successful token creation",
-			secret:  []byte("test-secret"),
-			userId:  123,
-			wantErr: false,
-			validate: func(t *testing.T, token string) {
-				if token == "" {
-					t.Error("expected non-empty token")
-				}
-				// Parse the token to verify its contents
-				parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-					return []byte("test-secret"), nil
-				})
-				if err != nil {
-					t.Errorf("failed to parse token: %v", err)
-				}
-				if !parsedToken.Valid {
-					t.Error("expected valid token")
-				}
+// TestMain gives every test and benchmark in the package a fixed token lifetime
+// Tests that change other token settings still restore them themselves
+func TestMain(m *testing.M) {
+	config.Envs.JWTExpiration = 60 * 60
+	os.Exit(m.Run())
+}
 
-				claims, ok := parsedToken.Claims.(jwt.MapClaims)
-				if !ok {
-					t.Error("failed to parse claims")
-				}
-				if claims["userId"] != "123" {
-					t.Errorf("expected userId to be 123, got %v", claims["userId"])
-				}
-				if claims["expiredAt"] == nil {
-					t.Error("expected expiredAt to be set")
-				}
-			},
-		},
-		{
-			name:    "empty secret",
-			secret:  []byte(""),
-			userId:  123,
-			wantErr: false,
-			validate: func(t *testing.T, token string) {
-				if token == "" {
-					t.Error("expected non-empty token")
-				}
-			},
-		},
+func TestJWTIssuerAndAudience(t *testing.T) {
+	secret := []byte("test-secret")
+
+	// setClaims configures the issuer and audience for the rest of the subtest
+	setClaims := func(t *testing.T, issuer, audience string) {
+		t.Helper()
+		previousIssuer, previousAudience := config.Envs.JWTIssuer, config.Envs.JWTAudience
+		config.Envs.JWTIssuer, config.Envs.JWTAudience = issuer, audience
+		t.Cleanup(func() {
+			config.Envs.JWTIssuer, config.Envs.JWTAudience = previousIssuer, previousAudience
+		})
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Set a fixed expiration time for testing
-			config.Envs.JWTExpiration = 3600 // 1 hour
+	testCases := []struct {
+		name                        string
+		issuedBy, issuedFor         string
+		expectedIssuer, expectedAud string
+		wantErr                     bool
+	}{
+		{name: "no issuer or audience configured", wantErr: false},
+		{name: "matching issuer and audience", issuedBy: "gommerce", issuedFor: "orders", expectedIssuer: "gommerce", expectedAud: "orders", wantErr: false},
+		{name: "mismatched audience", issuedBy: "gommerce", issuedFor: "billing", expectedIssuer: "gommerce", expectedAud: "orders", wantErr: true},
+		{name: "mismatched issuer", issuedBy: "other", issuedFor: "orders", expectedIssuer: "gommerce", expectedAud: "orders", wantErr: true},
+		{name: "missing audience", expectedAud: "orders", wantErr: true},
+		{name: "verifier without audience accepts audience-bound tokens", issuedFor: "orders", wantErr: false},
+	}
 
-			token, err := CreateJWT(tt.secret, tt.userId)
-			if tt.wantErr {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setClaims(t, tc.issuedBy, tc.issuedFor)
+			token, err := CreateJWT(secret, 7)
+			if err != nil {
+				t.Fatalf("Failed to create token: %v", err)
+			}
+
+			setClaims(t, tc.expectedIssuer, tc.expectedAud)
+			userID, err := VerifyJWT(token, secret)
+			if tc.wantErr {
 				if err == nil {
-					t.Error("expected error, got nil")
+					t.Error("Expected token to be rejected")
 				}
 				return
 			}
-
 			if err != nil {
-				t.Errorf("unexpected error: %v", err)
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if userID != 7 {
+				t.Errorf("Expected user ID 7, got %d", userID)
 			}
-			tt.validate(t, token)
 		})
 	}
 }
+
+// BenchmarkCreateJWT measures signing login tokens with HMAC-SHA256
+func BenchmarkCreateJWT(b *testing.B) {
+	secret := []byte("benchmark-secret")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := CreateJWT(secret, 7); err != nil {
+			b.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
+
+// BenchmarkVerifyJWT measures verifying an HMAC-SHA256 login token and reading its user ID
+func BenchmarkVerifyJWT(b *testing.B) {
+	secret := []byte("benchmark-secret")
+	token, err := CreateJWT(secret, 7)
+	if err != nil {
+		b.Fatalf("Failed to create token: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := VerifyJWT(token, secret); err != nil {
+			b.Fatalf("Failed to verify token: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginAttempt tracks the consecutive failed logins for a single email
+type loginAttempt struct {
+	failures    int       // Number of consecutive failed logins
+	lastFailure time.Time // When the latest failed login happened
+	lockedUntil time.Time // Zero unless the account is currently locked
+}
+
+// expired reports whether the attempt can be forgotten: its lock has run out,
+// or it never locked and its latest failure is older than the cooldown
+func (a *loginAttempt) expired(now time.Time, cooldown time.Duration) bool {
+	if !a.lockedUntil.IsZero() {
+		return !now.Before(a.lockedUntil)
+	}
+	return now.Sub(a.lastFailure) >= cooldown
+}
+
+// LoginLimiter keeps an in-memory record of failed logins per email
+// After maxAttempts consecutive failures the email is locked for the cooldown window
+type LoginLimiter struct {
+	mu          sync.Mutex
+	attempts    map[string]*loginAttempt
+	maxAttempts int
+	cooldown    time.Duration
+	lastPrune   time.Time        // When expired attempts were last swept from the map
+	now         func() time.Time // Overridable clock, used by tests
+}
+
+// NewLoginLimiter creates a new LoginLimiter
+// maxAttempts is the number of failures allowed before locking, cooldown is the lock duration
+func NewLoginLimiter(maxAttempts int, cooldown time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		attempts:    make(map[string]*loginAttempt),
+		maxAttempts: maxAttempts,
+		cooldown:    cooldown,
+		now:         time.Now,
+	}
+}
+
+// IsLocked reports whether the given email is currently locked
+// Expired locks are cleared so the account starts again with a fresh counter
+func (l *LoginLimiter) IsLocked(email string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	key := normalizeEmail(email)
+	attempt, ok := l.attempts[key]
+	if !ok || attempt.lockedUntil.IsZero() {
+		return false
+	}
+	if now.Before(attempt.lockedUntil) {
+		return true
+	}
+	delete(l.attempts, key)
+	return false
+}
+
+// RecordFailure registers a failed login for the given email
+// Failures more than the cooldown apart don't add up, the counter starts over
+// Returns true if this failure caused the account to be locked
+func (l *LoginLimiter) RecordFailure(email string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	key := normalizeEmail(email)
+	attempt, ok := l.attempts[key]
+	if !ok || attempt.expired(now, l.cooldown) {
+		attempt = &loginAttempt{}
+		l.attempts[key] = attempt
+	}
+	attempt.failures++
+	attempt.lastFailure = now
+	if attempt.failures >= l.maxAttempts {
+		attempt.lockedUntil = now.Add(l.cooldown)
+		return true
+	}
+	return false
+}
+
+// prune forgets every expired attempt so emails that stop failing don't stay in memory forever
+// The map is swept at most once per cooldown to keep logins cheap; the caller must hold l.mu
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.cooldown {
+		return
+	}
+	l.lastPrune = now
+	for key, attempt := range l.attempts {
+		if attempt.expired(now, l.cooldown) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// Reset clears the failure counter for the given email, e.g. after a successful login
+func (l *LoginLimiter) Reset(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, normalizeEmail(email))
+}
+
+// normalizeEmail makes sure "User@Example.com" and "user@example.com" share a counter
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	t.Run("locks after max attempts", func(t *testing.T) {
+		limiter := NewLoginLimiter(3, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			if locked := limiter.RecordFailure("test@example.com"); locked {
+				t.Fatalf("expected account to stay unlocked after %d failures", i+1)
+			}
+		}
+		if limiter.IsLocked("test@example.com") {
+			t.Fatal("expected account to be unlocked before reaching max attempts")
+		}
+
+		if locked := limiter.RecordFailure("test@example.com"); !locked {
+			t.Error("expected third failure to lock the account")
+		}
+		if !limiter.IsLocked("test@example.com") {
+			t.Error("expected account to be locked")
+		}
+		if !limiter.IsLocked("TEST@example.com") {
+			t.Error("expected lock to ignore email case")
+		}
+		if limiter.IsLocked("other@example.com") {
+			t.Error("expected other accounts to be unaffected")
+		}
+	})
+
+	t.Run("unlocks after cooldown", func(t *testing.T) {
+		now := time.Now()
+		limiter := NewLoginLimiter(2, time.Minute)
+		limiter.now = func() time.Time { return now }
+
+		limiter.RecordFailure("test@example.com")
+		limiter.RecordFailure("test@example.com")
+		if !limiter.IsLocked("test@example.com") {
+			t.Fatal("expected account to be locked")
+		}
+
+		now = now.Add(time.Minute + time.Second)
+		if limiter.IsLocked("test@example.com") {
+			t.Error("expected account to be unlocked after cooldown")
+		}
+
+		// The counter starts over once the lock has expired
+		if locked := limiter.RecordFailure("test@example.com"); locked {
+			t.Error("expected counter to be reset after cooldown")
+		}
+	})
+
+	t.Run("prunes expired attempts", func(t *testing.T) {
+		now := time.Now()
+		limiter := NewLoginLimiter(2, time.Minute)
+		limiter.now = func() time.Time { return now }
+
+		limiter.RecordFailure("locked@example.com")
+		limiter.RecordFailure("locked@example.com")
+		limiter.RecordFailure("failed@example.com")
+
+		now = now.Add(time.Minute + time.Second)
+		limiter.RecordFailure("new@example.com")
+		if len(limiter.attempts) != 1 {
+			t.Errorf("expected only the latest failure to be tracked, got %d emails", len(limiter.attempts))
+		}
+		// a failure older than the cooldown doesn't count towards a lock
+		if locked := limiter.RecordFailure("failed@example.com"); locked {
+			t.Error("expected an old failure not to count")
+		}
+	})
+
+	t.Run("reset clears failures", func(t *testing.T) {
+		limiter := NewLoginLimiter(2, time.Minute)
+
+		limiter.RecordFailure("test@example.com")
+		limiter.Reset("test@example.com")
+		if locked := limiter.RecordFailure("test@example.com"); locked {
+			t.Error("expected reset to clear previous failures")
+		}
+	})
+}
@@ -1,24 +1,180 @@
 // Package auth handles authentication-related functionality
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
 
-// HashPassword takes a plain text password and returns a bcrypt hashed version
-// Uses bcrypt's default cost for hashing
-// Returns the hashed password as a string and any potential error
-func HashPassword(password string) (string, error) {
-	// Generate a bcrypt hash of the password using the default cost
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms PASSWORD_HASH_ALGO can select
+const (
+	HashAlgoBCrypt   = "bcrypt"
+	HashAlgoArgon2ID = "argon2id"
+)
+
+// PasswordHasher hashes passwords and checks them against their hashes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) bool
+}
+
+// BCryptHasher hashes passwords with bcrypt
+type BCryptHasher struct {
+	Cost int // bcrypt cost factor, bcrypt.DefaultCost is used when 0
+}
+
+// Hash returns the bcrypt hash of the password
+func (h BCryptHasher) Hash(password string) (string, error) {
+	cost := h.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", err
 	}
-	// Convert the byte slice to string before returning
 	return string(hashedPassword), nil
 }
 
+// Compare reports whether the password matches the bcrypt hash
+func (h BCryptHasher) Compare(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// argon2IDPrefix starts every hash made by Argon2IDHasher
+const argon2IDPrefix = "$argon2id$"
+
+// Argon2IDHasher hashes passwords with argon2id
+// Hashes use the PHC string format, $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>,
+// so they carry the parameters they were made with and can be checked after the parameters change
+type Argon2IDHasher struct {
+	Time       uint32 // Number of passes over the memory
+	Memory     uint32 // Memory used, in KiB
+	Threads    uint8  // Degree of parallelism
+	SaltLength uint32 // Length of the random salt, in bytes
+	KeyLength  uint32 // Length of the derived key, in bytes
+}
+
+// NewArgon2IDHasher returns an Argon2IDHasher with the parameters recommended by golang.org/x/crypto/argon2
+func NewArgon2IDHasher() Argon2IDHasher {
+	return Argon2IDHasher{Time: 1, Memory: 64 * 1024, Threads: 4, SaltLength: 16, KeyLength: 32}
+}
+
+// Hash returns the argon2id hash of the password with a random salt
+func (h Argon2IDHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2IDPrefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Compare reports whether the password matches the argon2id hash, using the parameters stored in the hash
+// Malformed hashes never match
+func (h Argon2IDHasher) Compare(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashAlgoArgon2ID {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1
+}
+
+// NewPasswordHasher returns the hasher for one of the HashAlgo names
+func NewPasswordHasher(algo string) (PasswordHasher, error) {
+	switch algo {
+	case HashAlgoBCrypt:
+		return BCryptHasher{Cost: bcrypt.DefaultCost}, nil
+	case HashAlgoArgon2ID:
+		return NewArgon2IDHasher(), nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm %q", algo)
+}
+
+// passwordHasher hashes new passwords, it is set from PASSWORD_HASH_ALGO at startup
+var passwordHasher PasswordHasher = BCryptHasher{Cost: bcrypt.DefaultCost}
+
+// dummyHash is a bcrypt hash, at the default cost, of a random password nobody knows
+const dummyHash = "$2a$10$sBiic7.fX8EOrirt5bSixup0Ka80s0rL5RJoGRqNzc1arUjZz/14y"
+
+// dummyPasswordHash is a hash made by passwordHasher of a random password nobody knows
+var dummyPasswordHash = dummyHash
+
+// SetPasswordHasher makes hasher the one new passwords are hashed with
+// Passwords hashed with another algorithm still verify and are rehashed on the user's next login
+func SetPasswordHasher(hasher PasswordHasher) error {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	dummy, err := hasher.Hash(hex.EncodeToString(secret))
+	if err != nil {
+		return err
+	}
+	passwordHasher, dummyPasswordHash = hasher, dummy
+	return nil
+}
+
+// hashAlgo returns the algorithm a stored password hash was made with
+func hashAlgo(hash string) string {
+	if strings.HasPrefix(hash, argon2IDPrefix) {
+		return HashAlgoArgon2ID
+	}
+	return HashAlgoBCrypt
+}
+
+// HashPassword takes a plain text password and returns its hash, made by the configured hasher
+// Returns the hashed password as a string and any potential error
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
 // ComparePasswords compares a hashed password with a plain text password
+// The hash is checked with the algorithm that made it, whichever hasher is configured
 // Returns true if the passwords match, false otherwise
 func ComparePasswords(hashedPassword, plainPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	return err == nil
+	if hashAlgo(hashedPassword) == HashAlgoArgon2ID {
+		return Argon2IDHasher{}.Compare(hashedPassword, plainPassword)
+	}
+	return BCryptHasher{}.Compare(hashedPassword, plainPassword)
+}
+
+// NeedsRehash reports whether a stored hash was made with another algorithm than the configured hasher's
+// The dummy hash is always made by the configured hasher, so it names the current algorithm
+func NeedsRehash(hashedPassword string) bool {
+	return hashAlgo(hashedPassword) != hashAlgo(dummyPasswordHash)
+}
+
+// DummyCompare runs a password comparison whose result is thrown away
+// Logins for unknown emails call it so they take as long as a wrong password and don't reveal which emails exist
+func DummyCompare() {
+	ComparePasswords(dummyPasswordHash, "not the password")
 }
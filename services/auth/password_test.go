@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -93,3 +96,87 @@ func TestComparePasswords(t *testing.T) {
 		})
 	}
 }
+
+func TestDummyHash(t *testing.T) {
+	// The hash must be well formed or bcrypt returns before doing the expensive work
+	if _, err := bcrypt.Cost([]byte(dummyHash)); err != nil {
+		t.Fatalf("dummyHash is not a valid bcrypt hash: %v", err)
+	}
+	DummyCompare()
+}
+
+func TestArgon2IDHasher(t *testing.T) {
+	hasher := NewArgon2IDHasher()
+	hash, err := hasher.Hash("testPassword123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+	if other, _ := hasher.Hash("testPassword123"); other == hash {
+		t.Error("expected a random salt per hash")
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{name: "matching password", hash: hash, password: "testPassword123", want: true},
+		{name: "wrong password", hash: hash, password: "wrongPassword", want: false},
+		{name: "bcrypt hash", hash: dummyHash, password: "testPassword123", want: false},
+		{name: "truncated hash", hash: hash[:strings.LastIndex(hash, "$")], password: "testPassword123", want: false},
+		{name: "other version", hash: strings.Replace(hash, "v=19", "v=16", 1), password: "testPassword123", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasher.Compare(tt.hash, tt.password); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	for _, algo := range []string{HashAlgoBCrypt, HashAlgoArgon2ID} {
+		if _, err := NewPasswordHasher(algo); err != nil {
+			t.Errorf("unexpected error for %q: %v", algo, err)
+		}
+	}
+	if _, err := NewPasswordHasher("md5"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+// TestSwitchPasswordHasher checks old hashes keep verifying and are flagged for rehashing after the algorithm changes
+func TestSwitchPasswordHasher(t *testing.T) {
+	bcryptHash, err := HashPassword("testPassword123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if NeedsRehash(bcryptHash) {
+		t.Error("bcrypt hash shouldn't need rehashing while bcrypt is configured")
+	}
+
+	if err := SetPasswordHasher(Argon2IDHasher{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}); err != nil {
+		t.Fatalf("failed to set hasher: %v", err)
+	}
+	t.Cleanup(func() { SetPasswordHasher(BCryptHasher{}) })
+
+	argonHash, err := HashPassword("testPassword123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(argonHash, argon2IDPrefix) {
+		t.Errorf("expected an argon2id hash, got %q", argonHash)
+	}
+	if !ComparePasswords(bcryptHash, "testPassword123") || !ComparePasswords(argonHash, "testPassword123") {
+		t.Error("expected both hashes to verify")
+	}
+	if !NeedsRehash(bcryptHash) || NeedsRehash(argonHash) {
+		t.Error("expected only the bcrypt hash to need rehashing")
+	}
+	DummyCompare()
+}
@@ -0,0 +1,98 @@
+package cart
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+)
+
+// handleBulkCheckout places several orders at once, one per cart, for B2B clients
+// Every order is placed in a single transaction, so if any fails none are placed
+// Errors carry the index of the order that failed
+func (h *Handler) handleBulkCheckout(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	var carts []types.CartCheckoutPayload
+	if err := utils.ParseJSON(r, &carts); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(carts) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at least one order is required"))
+		return
+	}
+	if int64(len(carts)) > config.Envs.MaxBulkOrders {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at most %d orders can be placed at once", config.Envs.MaxBulkOrders))
+		return
+	}
+
+	// price every order before touching stock, so a bad order is reported without a transaction
+	orders := make([]*types.Order, len(carts))
+	for i, cart := range carts {
+		if err := utils.Validate.Struct(cart); err != nil {
+			writeBulkOrderError(w, http.StatusBadRequest, i, utils.ValidationError(err))
+			return
+		}
+		// a reservation is consumed outside the transaction, so it couldn't be rolled back
+		if cart.ReservationID != nil {
+			writeBulkOrderError(w, http.StatusBadRequest, i, fmt.Errorf("bulk orders can't use reservations"))
+			return
+		}
+		if status, err := h.resolveAddress(r.Context(), userId, &cart); err != nil {
+			writeBulkOrderError(w, status, i, err)
+			return
+		}
+		summary, status, err := h.priceCart(r.Context(), cart, true)
+		if err != nil {
+			writeBulkOrderError(w, status, i, err)
+			return
+		}
+
+		orders[i] = newOrder(userId, cart, summary)
+	}
+
+	err = h.store.CreateOrders(r.Context(), orders)
+	var bulkErr *BulkOrderError
+	switch {
+	case errors.As(err, &bulkErr) && errors.Is(err, ErrInsufficientStock):
+		writeBulkOrderError(w, http.StatusConflict, bulkErr.Index, bulkErr.Err)
+		return
+	case errors.As(err, &bulkErr):
+		writeBulkOrderError(w, http.StatusInternalServerError, bulkErr.Index, bulkErr.Err)
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	orderIDs := make([]int, len(orders))
+	for i, order := range orders {
+		orderIDs[i] = order.ID
+		h.events.Publish(events.OrderEvent{Type: events.OrderPlaced, Order: *order})
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "orders created successfully",
+		"data":    orderIDs,
+	})
+}
+
+// writeBulkOrderError writes the error of one order of a bulk checkout, recording its index
+func writeBulkOrderError(w http.ResponseWriter, status, index int, err error) {
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = types.APIError{Code: utils.ErrorCodeForStatus(status), Message: err.Error()}
+	}
+	apiErr.Message = fmt.Sprintf("order %d: %s", index, apiErr.Message)
+	apiErr.Index = &index
+	utils.WriteError(w, status, apiErr)
+}
@@ -0,0 +1,89 @@
+package cart
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+)
+
+// exportDateLayout is the format of the from and to query parameters of an order export
+const exportDateLayout = "2006-01-02"
+
+// exportHeader is the first row of an order export
+var exportHeader = []string{"order id", "createdAt", "status", "total", "item count"}
+
+// handleExportOrders downloads the user's orders as CSV, oldest first
+// The optional from and to query parameters are dates (YYYY-MM-DD) limiting the export to orders placed on or between them
+// Rows are written as they are read from the store, so once the download has started errors can only be logged
+func (h *Handler) handleExportOrders(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	from, err := parseExportDate(r, "from")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseExportDate(r, "to")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("from must not be after to"))
+		return
+	}
+	// to is inclusive, so the range ends at the start of the following day
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="orders.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportHeader); err != nil {
+		log.Printf("Error writing order export for user %d: %v", userId, err)
+		return
+	}
+	err = h.store.ExportOrders(r.Context(), userId, from, to, func(order types.OrderSummary) error {
+		return writer.Write([]string{
+			strconv.Itoa(order.ID),
+			order.CreatedAt.UTC().Format(time.RFC3339),
+			order.Status,
+			strconv.FormatFloat(float64(order.Total), 'f', types.PriceDecimals, 64),
+			strconv.Itoa(order.ItemCount),
+		})
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		log.Printf("Error writing order export for user %d: %v", userId, err)
+	}
+}
+
+// parseExportDate reads the date query parameter key of an order export
+// Returns the zero time when the parameter is absent
+func parseExportDate(r *http.Request, key string) (time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(exportDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date in the format YYYY-MM-DD", key)
+	}
+	return date, nil
+}
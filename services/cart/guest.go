@@ -0,0 +1,148 @@
+package cart
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// handleGuestCheckout places an order without an account
+// The order is stored under a guest account, and the response carries a single-use token the guest can view it with
+func (h *Handler) handleGuestCheckout(w http.ResponseWriter, r *http.Request) {
+	var payload types.GuestCheckoutPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+	// saved addresses and reservations belong to registered users
+	if payload.AddressID != nil || payload.ReservationID != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("guest checkouts can't use saved addresses or reservations"))
+		return
+	}
+
+	guest, ok := h.guestUser(r.Context(), w, payload)
+	if !ok {
+		return
+	}
+
+	order, ok := h.checkout(r.Context(), w, guest.ID, payload.CartCheckoutPayload)
+	if !ok {
+		return
+	}
+
+	// only the hash of the token is stored, the token itself is only handed out here
+	token, err := auth.GenerateGuestOrderToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	expiresAt := time.Now().Add(time.Second * time.Duration(config.Envs.GuestRetention))
+	if err := h.guestStore.CreateGuestOrderToken(r.Context(), order.ID, auth.HashGuestOrderToken(token), expiresAt); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/guest/orders/%s", config.Envs.BaseURL(), utils.APIPrefix, token))
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "order created successfully",
+		"data": map[string]interface{}{
+			"order": order,
+			"token": token,
+		},
+	})
+}
+
+// guestUser finds or creates the guest account to place a guest checkout under
+// Guests who give the same email share one account until registering the email claims it; the email of a registered user must log in instead
+// Writes the error response and returns false if there is no account to use
+func (h *Handler) guestUser(ctx context.Context, w http.ResponseWriter, payload types.GuestCheckoutPayload) (*types.User, bool) {
+	if payload.Email != "" {
+		existing, err := h.guestStore.GetUserByEmail(ctx, payload.Email)
+		if err == nil && existing.IsGuest {
+			return existing, true
+		}
+		if err == nil {
+			utils.WriteError(w, http.StatusConflict, fmt.Errorf("an account with this email already exists, log in to check out"))
+			return nil, false
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+	}
+
+	guest := &types.User{
+		FirstName: payload.FirstName,
+		LastName:  payload.LastName,
+		Email:     payload.Email,
+		CreatedAt: time.Now(),
+	}
+	// the email column is unique, so guests who don't give one get a placeholder nobody can receive mail at
+	if guest.Email == "" {
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		guest.Email = fmt.Sprintf("guest-%s@guest.invalid", hex.EncodeToString(suffix))
+	}
+	if err := h.guestStore.CreateGuestUser(ctx, guest); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return guest, true
+}
+
+// handleGetGuestOrder shows a guest the order their checkout token was issued for
+// A token works once, the response carries the token to view the order with next time
+func (h *Handler) handleGetGuestOrder(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GenerateGuestOrderToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	orderID, err := h.guestStore.RotateGuestOrderToken(r.Context(), auth.HashGuestOrderToken(mux.Vars(r)["token"]), auth.HashGuestOrderToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	order, err := h.store.GetOrderByID(r.Context(), orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "order fetched successfully",
+		"data": map[string]interface{}{
+			"order": order,
+			"token": token,
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package cart
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// invoiceTemplate renders an order as a standalone HTML invoice
+// html/template escapes the product names and address, which come from user input
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": func(amount types.Price) string { return fmt.Sprintf("%.2f", float64(amount)) },
+	"lineTotal": func(item types.OrderItem) types.Price {
+		return item.Price * types.Price(item.Quantity)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice #{{.ID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.5em; text-align: left; }
+td.amount, th.amount { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Invoice #{{.ID}}</h1>
+<p>Date: {{.CreatedAt.Format "2006-01-02"}}</p>
+<p>Ship to: {{.Address}}</p>
+<table>
+<tr><th>Product</th><th class="amount">Quantity</th><th class="amount">Price</th><th class="amount">Total</th></tr>
+{{range .Items}}<tr><td>{{.ProductName}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{money .Price}}</td><td class="amount">{{money (lineTotal .)}}</td></tr>
+{{end}}<tr><td colspan="3">Shipping</td><td class="amount">{{money .ShippingCost}}</td></tr>
+<tr><td colspan="3">Tax</td><td class="amount">{{money .TaxAmount}}</td></tr>
+<tr><th colspan="3">Total</th><th class="amount">{{money .Total}} {{.Currency}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+// renderInvoice writes the HTML invoice for an order to w
+func renderInvoice(w io.Writer, order *types.Order) error {
+	return invoiceTemplate.Execute(w, order)
+}
@@ -1,10 +1,21 @@
 package cart
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/services/shipping"
+	"github.com/Asif-Faizal/Gommerce/services/tax"
 	"github.com/Asif-Faizal/Gommerce/types"
 	"github.com/Asif-Faizal/Gommerce/utils"
 	"github.com/gorilla/mux"
@@ -13,130 +24,641 @@ import (
 // Handler represents the user-related HTTP handlers
 // It contains methods to handle different user-related endpoints
 type Handler struct {
-	store        types.OrderStore   // Interface for user data operations
-	productStore types.ProductStore // Interface for product data operations
+	store            types.OrderStore       // Interface for user data operations
+	productStore     types.ProductStore     // Interface for product data operations
+	variantStore     types.VariantStore     // Interface for product variant data operations
+	reservationStore types.ReservationStore // Interface for stock reservation operations
+	addressStore     types.AddressStore     // Interface for looking up saved addresses
+	guestStore       types.GuestStore       // Interface for the accounts guest checkouts are placed under
+	events           *events.EventBus       // Bus order events are published on
 }
 
 // NewHandler creates a new instance of the user Handler
 // This is a constructor function for the Handler struct
-func NewHandler(store types.OrderStore, productStore types.ProductStore) *Handler {
-	return &Handler{store: store, productStore: productStore}
+func NewHandler(store types.OrderStore, productStore types.ProductStore, variantStore types.VariantStore, reservationStore types.ReservationStore, addressStore types.AddressStore, guestStore types.GuestStore, bus *events.EventBus) *Handler {
+	return &Handler{store: store, productStore: productStore, variantStore: variantStore, reservationStore: reservationStore, addressStore: addressStore, guestStore: guestStore, events: bus}
 }
 
 func (h *Handler) OrderRoutes(router *mux.Router) {
 	router.HandleFunc("/order", h.handleCheckout).Methods(http.MethodPost)
-	router.HandleFunc("/orders", h.handleGetOrders).Methods(http.MethodGet)
+	router.HandleFunc("/orders", utils.AllowHead(h.handleGetOrders)).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/orders/bulk", h.handleBulkCheckout).Methods(http.MethodPost)
+	router.HandleFunc("/orders/export", h.handleExportOrders).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{id}/items", h.handleUpdateOrderItem).Methods(http.MethodPatch)
+	router.HandleFunc("/orders/{id}/invoice", h.handleGetInvoice).Methods(http.MethodGet)
+	router.HandleFunc("/orders/{id}/reorder", h.handleReorder).Methods(http.MethodPost)
+	router.HandleFunc("/cart/reserve", h.handleReserve).Methods(http.MethodPost)
+	router.HandleFunc("/cart/summary", h.handleCartSummary).Methods(http.MethodPost)
+	router.HandleFunc("/guest/checkout", h.handleGuestCheckout).Methods(http.MethodPost)
+	router.HandleFunc("/guest/orders/{token}", h.handleGetGuestOrder).Methods(http.MethodGet)
+}
+
+// handleReserve holds stock for the requested items for the configured reservation TTL
+// The returned reservation ID can be passed to checkout instead of the items
+func (h *Handler) handleReserve(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	var payload types.ReservationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+	for _, item := range payload.Items {
+		if item.Quantity <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("quantity for product %d must be greater than 0", item.ProductID))
+			return
+		}
+	}
+
+	ttl := time.Second * time.Duration(config.Envs.ReservationTTL)
+	reservation, err := h.reservationStore.CreateReservation(r.Context(), userId, payload.Items, ttl)
+	if errors.Is(err, ErrInsufficientStock) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "stock reserved successfully",
+		"data":    reservation,
+	})
 }
 
 func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 	userId, err := utils.AuthenticateRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
 	var cart types.CartCheckoutPayload
 	if err := utils.ParseJSON(r, &cart); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 	if err := utils.Validate.Struct(cart); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
 		return
 	}
 
-	// get products
-	productIDs := make([]int, len(cart.Items))
-	for i, item := range cart.Items {
-		productIDs[i] = item.ProductID
+	order, ok := h.checkout(r.Context(), w, userId, cart)
+	if !ok {
+		return
 	}
-	products, err := h.productStore.GetProductsByIDs(productIDs)
+
+	// return success response
+	w.Header().Set("Location", fmt.Sprintf("%s%s/orders/%d", config.Envs.BaseURL(), utils.APIPrefix, order.ID))
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "order created successfully",
+		"data":    order,
+	})
+}
+
+// handleReorder places a new order with the items and address of one of the user's past orders
+// Items are charged at their current prices; if any product is gone or out of stock nothing is ordered
+// and the 409 lists the unavailable products under error.productIDs
+func (h *Handler) handleReorder(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
 
-	// validate products exist
-	if len(products) != len(productIDs) {
-		http.Error(w, "one or more products not found", http.StatusBadRequest)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("order ID must be a positive integer"))
 		return
 	}
 
-	// calculate total and validate quantities
-	total := 0.0
-	productMap := make(map[int]types.Product)
+	previous, ok := h.getUserOrder(r.Context(), w, id, userId)
+	if !ok {
+		return
+	}
+	if len(previous.Items) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("order %d has no items to reorder", id))
+		return
+	}
+
+	cart := types.CartCheckoutPayload{
+		Address:        previous.Address,
+		Country:        previous.Country,
+		ShippingMethod: previous.ShippingMethod,
+		Items:          make([]types.CartItem, len(previous.Items)),
+	}
+	for i, item := range previous.Items {
+		cart.Items[i] = types.CartItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+	}
+
+	unavailable, err := h.unavailableProducts(r.Context(), cart.Items)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(unavailable) > 0 {
+		utils.WriteError(w, http.StatusConflict, types.APIError{
+			Code:       types.ErrCodeConflict,
+			Message:    "some products of the order are no longer available",
+			ProductIDs: unavailable,
+		})
+		return
+	}
+
+	order, ok := h.checkout(r.Context(), w, userId, cart)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/orders/%d", config.Envs.BaseURL(), utils.APIPrefix, order.ID))
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "order created successfully",
+		"data":    order,
+	})
+}
+
+// unavailableProducts returns the products of items that no longer exist or don't have enough stock, in item order
+// Items of a variant are checked against the variant's stock; quantities of items for the same product or variant are added up
+func (h *Handler) unavailableProducts(ctx context.Context, items []types.CartItem) ([]int, error) {
+	productIDs := []int{}
+	variantIDs := []int{}
+	needed := make(map[int]int)
+	neededVariants := make(map[int]int)
+	for _, item := range items {
+		if item.VariantID != nil {
+			if _, seen := neededVariants[*item.VariantID]; !seen {
+				variantIDs = append(variantIDs, *item.VariantID)
+			}
+			neededVariants[*item.VariantID] += item.Quantity
+		}
+		if _, seen := needed[item.ProductID]; !seen {
+			productIDs = append(productIDs, item.ProductID)
+			needed[item.ProductID] = 0
+		}
+		if item.VariantID == nil {
+			needed[item.ProductID] += item.Quantity
+		}
+	}
+
+	products, err := h.productStore.GetProductsByIDs(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	inStock := make(map[int]int)
 	for _, product := range products {
-		productMap[product.ID] = product
+		inStock[product.ID] = product.Quantity
+	}
+	variants, err := h.variantStore.GetVariantsByIDs(ctx, variantIDs)
+	if err != nil {
+		return nil, err
+	}
+	variantMap := make(map[int]types.ProductVariant)
+	for _, variant := range variants {
+		variantMap[variant.ID] = variant
 	}
 
-	for _, item := range cart.Items {
-		product, exists := productMap[item.ProductID]
-		if !exists {
-			http.Error(w, fmt.Sprintf("product with ID %d not found", item.ProductID), http.StatusBadRequest)
-			return
+	short := make(map[int]bool)
+	for _, item := range items {
+		if item.VariantID == nil {
+			continue
 		}
-		if item.Quantity > product.Quantity {
-			http.Error(w, fmt.Sprintf("insufficient quantity for product %d", item.ProductID), http.StatusBadRequest)
-			return
+		variant, ok := variantMap[*item.VariantID]
+		if !ok || variant.ProductID != item.ProductID || variant.Quantity < neededVariants[variant.ID] {
+			short[item.ProductID] = true
+		}
+	}
+
+	unavailable := []int{}
+	for _, id := range productIDs {
+		if quantity, ok := inStock[id]; !ok || quantity < needed[id] || short[id] {
+			unavailable = append(unavailable, id)
+		}
+	}
+	return unavailable, nil
+}
+
+// checkout places an order for the user from a validated cart
+// Writes the error response and returns false if the order can't be placed
+func (h *Handler) checkout(ctx context.Context, w http.ResponseWriter, userId int, cart types.CartCheckoutPayload) (*types.Order, bool) {
+	// resolve the saved address, if any - it must belong to the user checking out
+	if status, err := h.resolveAddress(ctx, userId, &cart); err != nil {
+		utils.WriteError(w, status, err)
+		return nil, false
+	}
+
+	// load the reservation, if any - its stock is already held for this user
+	// it is only consumed together with the order, so a failed checkout keeps the stock held
+	reserved := false
+	if cart.ReservationID != nil {
+		reservation, err := h.reservationStore.GetReservation(ctx, *cart.ReservationID, userId)
+		if errors.Is(err, ErrReservationNotFound) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return nil, false
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
 		}
-		total += product.Price * float64(item.Quantity)
+		cart.Items = make([]types.CartItem, len(reservation.Items))
+		for i, item := range reservation.Items {
+			cart.Items[i] = types.CartItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity}
+		}
+		reserved = true
+	}
+
+	summary, ok := h.summarizeCart(ctx, w, cart, !reserved)
+	if !ok {
+		return nil, false
+	}
+
+	// hold the stock - a checkout without a reservation reserves its items now,
+	// so two concurrent checkouts can't both sell the last units of a product
+	reservationID, heldReservation := 0, false
+	if reserved {
+		reservationID = *cart.ReservationID
+	} else {
+		ttl := time.Second * time.Duration(config.Envs.ReservationTTL)
+		reservation, err := h.reservationStore.CreateReservation(ctx, userId, cart.Items, ttl)
+		if errors.Is(err, ErrInsufficientStock) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return nil, false
+		}
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		reservationID, heldReservation = reservation.ID, true
 	}
 
 	// create order
+	order := newOrder(userId, cart, summary)
+
+	// the reservation is consumed in the same transaction that stores the order and its items,
+	// so the held stock either belongs to the order or is still held
+	if err := h.store.CreateReservedOrder(ctx, order, reservationID); err != nil {
+		// stock held by this checkout is given back, a reservation sent by the client stays held for a retry
+		if heldReservation {
+			if err := h.reservationStore.ReleaseReservation(ctx, reservationID, userId); err != nil {
+				log.Printf("Error releasing reservation %d: %v", reservationID, err)
+			}
+		}
+		if errors.Is(err, ErrReservationNotFound) && !heldReservation {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return nil, false
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	// notify subscribers asynchronously - the order is already stored
+	h.events.Publish(events.OrderEvent{Type: events.OrderPlaced, Order: *order})
+
+	return order, true
+}
+
+// newOrder builds a pending order for the user from a priced cart
+// The country and shipping method are kept so a reorder is priced the same way
+func newOrder(userId int, cart types.CartCheckoutPayload, summary *types.CartSummary) *types.Order {
 	order := &types.Order{
-		UserID:    userId,
-		Total:     total,
-		Status:    "pending",
-		Address:   cart.Address,
-		CreatedAt: time.Now(),
+		UserID:         userId,
+		Total:          summary.Total,
+		Currency:       summary.Currency,
+		ShippingCost:   summary.ShippingCost,
+		ShippingMethod: summary.ShippingMethod,
+		TaxRate:        summary.TaxRate,
+		TaxAmount:      summary.Tax,
+		Status:         "pending",
+		Address:        cart.Address,
+		Country:        strings.ToUpper(strings.TrimSpace(cart.Country)),
+		CreatedAt:      time.Now(),
+		Items:          make([]types.OrderItem, len(summary.Items)),
 	}
+	for i, item := range summary.Items {
+		order.Items[i] = types.OrderItem{
+			ProductID:    item.ProductID,
+			VariantID:    item.VariantID,
+			ProductName:  item.Name,
+			ProductImage: item.Image,
+			Quantity:     item.Quantity,
+			Price:        item.Price,
+		}
+	}
+	return order
+}
+
+// resolveAddress replaces the saved address of a cart, if any, with its line and country
+// The address must belong to the user checking out
+// Returns the status to report alongside any error
+func (h *Handler) resolveAddress(ctx context.Context, userId int, cart *types.CartCheckoutPayload) (int, error) {
+	if cart.AddressID == nil {
+		return 0, nil
+	}
+	address, err := h.addressStore.GetAddressByID(ctx, *cart.AddressID, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusBadRequest, fmt.Errorf("address %d not found", *cart.AddressID)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	cart.Address = address.Line
+	if cart.Country == "" {
+		cart.Country = address.Country
+	}
+	return 0, nil
+}
 
-	// create order in database
-	orderID, err := h.store.CreateOrder(order)
+// handleGetOrders lists a page of the user's orders, only those with the status given by ?status= when it is set
+// Pages are chosen with ?page= and ?limit=, 10 orders per page by default and at most 50
+func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
-	order.ID = orderID
 
-	// create order items
-	for _, item := range cart.Items {
-		product := productMap[item.ProductID]
-		orderItem := &types.OrderItem{
-			OrderID:   order.ID,
-			ProductID: product.ID,
-			Quantity:  item.Quantity,
-			Price:     product.Price,
-		}
-		if err := h.store.CreateOrderItem(orderItem); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	status := r.URL.Query().Get("status")
+	if status != "" && !types.OrderStatuses[status] {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("status must be one of pending, completed or cancelled"))
+		return
 	}
 
-	// return success response
-	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+	page, limit, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	orders, total, err := h.store.GetOrdersByStatus(r.Context(), userId, status, page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"message":    "orders fetched successfully",
+		"data":       orders,
+		"pagination": utils.NewPagination(page, limit, total),
+	})
+}
+
+// handleUpdateOrderItem changes the quantity of a product in one of the user's pending orders
+// Orders that are completed or cancelled are rejected with 409
+func (h *Handler) handleUpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("order ID must be a positive integer"))
+		return
+	}
+
+	var payload types.UpdateOrderItemPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	// only the owner of an order may change it
+	if _, ok := h.getUserOrder(r.Context(), w, id, userId); !ok {
+		return
+	}
+
+	err = h.store.UpdateOrderItem(r.Context(), id, payload.ProductID, payload.VariantID, payload.Quantity)
+	switch {
+	case errors.Is(err, ErrOrderItemNotFound):
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	case errors.Is(err, ErrOrderNotPending), errors.Is(err, ErrInsufficientStock):
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
-		"message": "order created successfully",
-		"data":    order,
+		"message": "order item updated successfully",
 	})
 }
 
-func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+// handleGetInvoice downloads an HTML invoice for one of the user's orders
+func (h *Handler) handleGetInvoice(w http.ResponseWriter, r *http.Request) {
 	userId, err := utils.AuthenticateRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
 
-	orders, err := h.store.GetOrders(userId)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("order ID must be a positive integer"))
+		return
+	}
+
+	order, ok := h.getUserOrder(r.Context(), w, id, userId)
+	if !ok {
+		return
+	}
+
+	// render before writing headers so a template error can still be reported as JSON
+	var invoice bytes.Buffer
+	if err := renderInvoice(&invoice, order); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%d.html"`, order.ID))
+	w.WriteHeader(http.StatusOK)
+	invoice.WriteTo(w)
+}
+
+// getUserOrder loads an order and checks it belongs to the user
+// Orders of other users are reported as not found so their IDs aren't revealed
+// Writes the error response and returns false if the order can't be used
+func (h *Handler) getUserOrder(ctx context.Context, w http.ResponseWriter, orderID, userID int) (*types.Order, bool) {
+	order, err := h.store.GetOrderByID(ctx, orderID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && order.UserID != userID) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("order %d not found", orderID))
+		return nil, false
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return order, true
+}
+
+// handleCartSummary prices a cart without placing an order, so clients can show the cost breakdown
+// No authentication is required so guest carts can be priced; saved addresses and reservations are ignored
+func (h *Handler) handleCartSummary(w http.ResponseWriter, r *http.Request) {
+	var cart types.CartCheckoutPayload
+	if err := utils.ParseJSON(r, &cart); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(cart.Items) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("items are required"))
+		return
+	}
+
+	summary, ok := h.summarizeCart(r.Context(), w, cart, true)
+	if !ok {
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
 		"status":  "success",
-		"message": "orders fetched successfully",
-		"data":    orders,
+		"message": "cart summarized successfully",
+		"data":    summary,
 	})
 }
+
+// summarizeCart prices the items of a cart and estimates its shipping
+// Writes the error response and returns false if the cart can't be priced
+func (h *Handler) summarizeCart(ctx context.Context, w http.ResponseWriter, cart types.CartCheckoutPayload, checkStock bool) (*types.CartSummary, bool) {
+	summary, status, err := h.priceCart(ctx, cart, checkStock)
+	if err != nil {
+		utils.WriteError(w, status, err)
+		return nil, false
+	}
+	return summary, true
+}
+
+// priceCart prices the items of a cart and estimates its shipping
+// Stock is only checked when checkStock is set, reserved items were checked when they were reserved
+// Returns the status to report alongside any error
+func (h *Handler) priceCart(ctx context.Context, cart types.CartCheckoutPayload, checkStock bool) (*types.CartSummary, int, error) {
+	// get products - several variants of one product may be in the cart, so IDs are deduplicated
+	productIDs := []int{}
+	variantIDs := []int{}
+	seenProducts := make(map[int]bool)
+	for _, item := range cart.Items {
+		if item.Quantity <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("quantity for product %d must be greater than 0", item.ProductID)
+		}
+		if !seenProducts[item.ProductID] {
+			seenProducts[item.ProductID] = true
+			productIDs = append(productIDs, item.ProductID)
+		}
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, *item.VariantID)
+		}
+	}
+	products, err := h.productStore.GetProductsByIDs(ctx, productIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// validate products exist
+	if len(products) != len(productIDs) {
+		return nil, http.StatusBadRequest, fmt.Errorf("one or more products not found")
+	}
+	productMap := make(map[int]types.Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	// get variants - a variant's price and quantity replace those of its product
+	variants, err := h.variantStore.GetVariantsByIDs(ctx, variantIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	variantMap := make(map[int]types.ProductVariant)
+	for _, variant := range variants {
+		variantMap[variant.ID] = variant
+	}
+
+	// an order has a single currency, so every product must be priced in the same one
+	currency := ""
+	for _, product := range products {
+		if currency == "" {
+			currency = product.Currency
+		}
+		if product.Currency != currency {
+			return nil, http.StatusBadRequest, fmt.Errorf("products in different currencies can't be checked out together")
+		}
+	}
+
+	// price the items and validate quantities
+	summary := &types.CartSummary{Items: make([]types.CartSummaryItem, len(cart.Items)), Currency: currency}
+	for i, item := range cart.Items {
+		product, exists := productMap[item.ProductID]
+		if !exists {
+			return nil, http.StatusBadRequest, fmt.Errorf("product with ID %d not found", item.ProductID)
+		}
+		price, quantity := product.Price, product.Quantity
+		if item.VariantID != nil {
+			variant, exists := variantMap[*item.VariantID]
+			if !exists || variant.ProductID != item.ProductID {
+				return nil, http.StatusBadRequest, fmt.Errorf("variant with ID %d not found for product %d", *item.VariantID, item.ProductID)
+			}
+			price, quantity = variant.Price, variant.Quantity
+		}
+		if checkStock && item.Quantity > quantity {
+			return nil, http.StatusBadRequest, fmt.Errorf("insufficient quantity for product %d", item.ProductID)
+		}
+		summary.Items[i] = types.CartSummaryItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Name:      product.Name,
+			Image:     product.Image,
+			Quantity:  item.Quantity,
+			Price:     price,
+			Total:     price * types.Price(item.Quantity),
+		}
+		summary.Subtotal += summary.Items[i].Total
+	}
+
+	// calculate shipping - products don't record a weight yet, so every unit counts as one kilogram
+	shippingMethod := cart.ShippingMethod
+	if shippingMethod == "" {
+		shippingMethod = shipping.MethodStandard
+	}
+	totalWeight := 0.0
+	for _, item := range cart.Items {
+		totalWeight += float64(item.Quantity)
+	}
+	address := types.Address{Line: cart.Address, Country: cart.Country}
+	methods, err := shipping.CalculateShipping(address, totalWeight)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	method, err := shipping.FindMethod(methods, shippingMethod)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	summary.ShippingMethod = method.Name
+	summary.ShippingCost = method.Price
+
+	// tax is charged on the items only, not on shipping
+	taxRate, taxAmount, err := tax.CalculateTax(address, float64(summary.Subtotal))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	summary.TaxRate = taxRate
+	summary.Tax = types.Price(taxAmount)
+
+	summary.Total = summary.Subtotal + summary.Tax + summary.ShippingCost
+	return summary, 0, nil
+}
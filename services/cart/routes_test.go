@@ -0,0 +1,1997 @@
+package cart
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/services/shipping"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/gorilla/mux"
+)
+
+// TestCartServiceHandlers is the main test function for cart service handlers
+func TestCartServiceHandlers(t *testing.T) {
+	// Test case: Successful checkout
+	t.Run("Should create an order if checkout payload is valid", func(t *testing.T) {
+		orderStore := &mockOrderStore{
+			createOrderFunc: func(order *types.Order) (int, error) {
+				return 42, nil
+			},
+		}
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		bus := events.NewEventBus(10)
+		published := make(chan events.OrderEvent, 1)
+		bus.Subscribe(func(event events.OrderEvent) { published <- event })
+		handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, bus)
+
+		payload := types.CartCheckoutPayload{
+			Items:   []types.CartItem{{ProductID: 1, Quantity: 2}},
+			Address: "1 Test Street",
+			Country: "US",
+		}
+		marshaled, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+
+		// Create request
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+
+		// Create response recorder
+		rr := httptest.NewRecorder()
+
+		// Create router and register handler
+		router := mux.NewRouter()
+		router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+
+		// Serve request
+		router.ServeHTTP(rr, req)
+
+		// Check status code
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		// Verify the Location header points at the created order
+		expectedLocation := config.Envs.BaseURL() + "/api/v1/orders/42"
+		if location := rr.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("Expected Location header %q, got %q", expectedLocation, location)
+		}
+
+		if len(orderStore.createdItems) != 1 {
+			t.Fatalf("Expected 1 order item to be created, got %d", len(orderStore.createdItems))
+		}
+		if orderStore.createdItems[0].ProductName != "Product 1" {
+			t.Errorf("Expected product name snapshot %q, got %q", "Product 1", orderStore.createdItems[0].ProductName)
+		}
+
+		// Verify subscribers are notified about the new order
+		select {
+		case event := <-published:
+			if event.Type != events.OrderPlaced || event.Order.ID != 42 {
+				t.Errorf("Unexpected event: %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected an OrderPlaced event to be published")
+		}
+	})
+
+	// Test case: Checkout with more than the product has in stock
+	t.Run("Should reject checkout if stock is insufficient", func(t *testing.T) {
+		orderStore := &mockOrderStore{
+			createOrderFunc: func(order *types.Order) (int, error) {
+				t.Error("Expected no order to be created")
+				return 1, nil
+			},
+		}
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 1}}, nil
+			},
+		}
+		handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		payload := types.CartCheckoutPayload{
+			Items:   []types.CartItem{{ProductID: 1, Quantity: 2}},
+			Address: "1 Test Street",
+			Country: "US",
+		}
+		marshaled, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "insufficient quantity for product 1") {
+			t.Errorf("Expected an insufficient quantity error, got %s", rr.Body.String())
+		}
+		if len(orderStore.createdItems) != 0 {
+			t.Errorf("Expected no order items, got %+v", orderStore.createdItems)
+		}
+	})
+
+	// Test case: Checkout without a token
+	t.Run("Should reject checkout if the user is not authenticated", func(t *testing.T) {
+		orderStore := &mockOrderStore{
+			createOrderFunc: func(order *types.Order) (int, error) {
+				t.Error("Expected no order to be created")
+				return 1, nil
+			},
+		}
+		handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		marshaled, err := json.Marshal(types.CartCheckoutPayload{
+			Items:   []types.CartItem{{ProductID: 1, Quantity: 1}},
+			Address: "1 Test Street",
+			Country: "US",
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+		}
+	})
+
+	// Test case: Listing the user's orders
+	t.Run("Should list the user's orders", func(t *testing.T) {
+		testCases := []struct {
+			name           string
+			getOrdersFunc  func(userID int) ([]types.Order, error)
+			expectedStatus int
+			expectedIDs    []int
+		}{
+			{
+				name: "success",
+				getOrdersFunc: func(userID int) ([]types.Order, error) {
+					if userID != 7 {
+						t.Errorf("Expected orders of user 7, got user %d", userID)
+					}
+					return []types.Order{{ID: 2, UserID: 7, Status: "pending"}, {ID: 1, UserID: 7, Status: "completed"}}, nil
+				},
+				expectedStatus: http.StatusOK,
+				expectedIDs:    []int{2, 1},
+			},
+			{
+				name: "database error",
+				getOrdersFunc: func(userID int) ([]types.Order, error) {
+					return nil, fmt.Errorf("connection refused")
+				},
+				expectedStatus: http.StatusInternalServerError,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				handler := NewHandler(&mockOrderStore{getOrdersFunc: tc.getOrdersFunc}, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+				req, err := http.NewRequest(http.MethodGet, "/orders", nil)
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 7))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/orders", handler.handleGetOrders).Methods(http.MethodGet)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus != http.StatusOK {
+					return
+				}
+
+				var response struct {
+					Data []types.Order `json:"data"`
+				}
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if len(response.Data) != len(tc.expectedIDs) {
+					t.Fatalf("Expected %d orders, got %+v", len(tc.expectedIDs), response.Data)
+				}
+				for i, id := range tc.expectedIDs {
+					if response.Data[i].ID != id {
+						t.Errorf("Expected order %d at position %d, got %d", id, i, response.Data[i].ID)
+					}
+				}
+			})
+		}
+	})
+
+	// Test case: Shipping cost is added to the order total
+	t.Run("Should add the selected shipping cost to the order total", func(t *testing.T) {
+		var created *types.Order
+		orderStore := &mockOrderStore{
+			createOrderFunc: func(order *types.Order) (int, error) {
+				created = order
+				return 1, nil
+			},
+		}
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		testCases := []struct {
+			name           string
+			shippingMethod string
+			expectedStatus int
+			expectedCost   types.Price
+		}{
+			{name: "express", shippingMethod: "express", expectedStatus: http.StatusCreated, expectedCost: 17},
+			{name: "defaults to standard", shippingMethod: "", expectedStatus: http.StatusCreated, expectedCost: 6},
+			{name: "unknown method", shippingMethod: "overnight", expectedStatus: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				created = nil
+				payload := types.CartCheckoutPayload{
+					Items:          []types.CartItem{{ProductID: 1, Quantity: 2}},
+					Address:        "1 Test Street",
+					Country:        "US",
+					ShippingMethod: tc.shippingMethod,
+				}
+				marshaled, err := json.Marshal(payload)
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+
+				req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus != http.StatusCreated {
+					var response struct {
+						Error types.APIError `json:"error"`
+					}
+					if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+						t.Fatalf("Failed to decode response: %v", err)
+					}
+					if response.Error.Code != types.ErrCodeBadRequest || response.Error.Message == "" {
+						t.Errorf("Unexpected error response: %+v", response.Error)
+					}
+					return
+				}
+				if created.ShippingCost != tc.expectedCost {
+					t.Errorf("Expected shipping cost %.2f, got %.2f", tc.expectedCost, created.ShippingCost)
+				}
+				if created.Total != 20+tc.expectedCost {
+					t.Errorf("Expected total %.2f, got %.2f", 20+tc.expectedCost, created.Total)
+				}
+			})
+		}
+	})
+
+	// Test case: Variant price and quantity are used when a variant is specified
+	t.Run("Should charge tax for the destination country", func(t *testing.T) {
+		var created *types.Order
+		orderStore := &mockOrderStore{
+			createOrderFunc: func(order *types.Order) (int, error) {
+				created = order
+				return 1, nil
+			},
+		}
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		payload := types.CartCheckoutPayload{
+			Items:   []types.CartItem{{ProductID: 1, Quantity: 2}},
+			Address: "1 Test Street",
+			Country: "IN",
+		}
+		marshaled, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		// 18% of the 20.00 subtotal, shipping to India is 2.50 and isn't taxed
+		if created.TaxRate != 0.18 || created.TaxAmount != 3.6 {
+			t.Errorf("Expected tax rate 0.18 and amount 3.60, got %v and %.2f", created.TaxRate, created.TaxAmount)
+		}
+		if fmt.Sprintf("%.2f", created.Total) != "26.10" {
+			t.Errorf("Expected total 26.10, got %.2f", created.Total)
+		}
+
+		var response struct {
+			Data struct {
+				TaxRate   float64 `json:"taxRate"`
+				TaxAmount float64 `json:"taxAmount"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response.Data.TaxRate != 0.18 || response.Data.TaxAmount != 3.6 {
+			t.Errorf("Expected the tax in the response, got %+v", response.Data)
+		}
+	})
+
+	t.Run("Should use variant price and quantity for variant items", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				if len(ids) != 1 {
+					t.Errorf("Expected product IDs to be deduplicated, got %v", ids)
+				}
+				return []types.Product{{ID: 1, Name: "T-Shirt", Price: 10, Quantity: 100}}, nil
+			},
+		}
+		variantStore := &mockVariantStore{
+			variants: []types.ProductVariant{
+				{ID: 7, ProductID: 1, SKU: "TSHIRT-M", Attributes: map[string]string{"size": "M"}, Price: 12, Quantity: 5},
+				{ID: 8, ProductID: 1, SKU: "TSHIRT-XL", Attributes: map[string]string{"size": "XL"}, Price: 15, Quantity: 1},
+				{ID: 9, ProductID: 2, SKU: "MUG-RED", Attributes: map[string]string{"color": "red"}, Price: 5, Quantity: 10},
+			},
+		}
+		variantID := func(id int) *int { return &id }
+
+		testCases := []struct {
+			name             string
+			items            []types.CartItem
+			expectedStatus   int
+			expectedPrices   []types.Price
+			expectedVariants []*int
+		}{
+			{
+				name: "mixed variant and plain items",
+				items: []types.CartItem{
+					{ProductID: 1, VariantID: variantID(7), Quantity: 2},
+					{ProductID: 1, Quantity: 1},
+				},
+				expectedStatus:   http.StatusCreated,
+				expectedPrices:   []types.Price{12, 10},
+				expectedVariants: []*int{variantID(7), nil},
+			},
+			{
+				name:           "insufficient variant quantity",
+				items:          []types.CartItem{{ProductID: 1, VariantID: variantID(8), Quantity: 2}},
+				expectedStatus: http.StatusBadRequest,
+			},
+			{
+				name:           "variant of another product",
+				items:          []types.CartItem{{ProductID: 1, VariantID: variantID(9), Quantity: 1}},
+				expectedStatus: http.StatusBadRequest,
+			},
+			{
+				name:           "unknown variant",
+				items:          []types.CartItem{{ProductID: 1, VariantID: variantID(99), Quantity: 1}},
+				expectedStatus: http.StatusBadRequest,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				reservationStore := &mockReservationStore{}
+				orderStore := &mockOrderStore{reservations: reservationStore}
+				handler := NewHandler(orderStore, productStore, variantStore, reservationStore, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+				payload := types.CartCheckoutPayload{Items: tc.items, Address: "1 Test Street", Country: "US"}
+				marshaled, err := json.Marshal(payload)
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+
+				req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if len(orderStore.createdItems) != len(tc.expectedPrices) {
+					t.Fatalf("Expected %d order items, got %d", len(tc.expectedPrices), len(orderStore.createdItems))
+				}
+				for i, price := range tc.expectedPrices {
+					if orderStore.createdItems[i].Price != price {
+						t.Errorf("Expected item %d price %.2f, got %.2f", i, price, orderStore.createdItems[i].Price)
+					}
+					// the variant is recorded on the item, so its stock is taken from the variant
+					if got, want := orderStore.createdItems[i].VariantID, tc.expectedVariants[i]; (got == nil) != (want == nil) || (got != nil && *got != *want) {
+						t.Errorf("Expected item %d of variant %v, got %v", i, want, got)
+					}
+				}
+			})
+		}
+	})
+
+	// Test case: Checkout without a reservation holds the stock itself
+	t.Run("Should reserve stock during checkout", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+
+		testCases := []struct {
+			name             string
+			orderStore       *mockOrderStore
+			reservationStore *mockReservationStore
+			expectedStatus   int
+			expectedReleased int
+		}{
+			{
+				name:             "reservation is consumed by the order",
+				orderStore:       &mockOrderStore{},
+				reservationStore: &mockReservationStore{},
+				expectedStatus:   http.StatusCreated,
+			},
+			{
+				name:       "stock taken by a concurrent checkout",
+				orderStore: &mockOrderStore{},
+				reservationStore: &mockReservationStore{
+					createReservationFunc: func(userID int, items []types.CartItem, ttl time.Duration) (*types.Reservation, error) {
+						return nil, ErrInsufficientStock
+					},
+				},
+				expectedStatus: http.StatusConflict,
+			},
+			{
+				name: "reservation is released when the order fails",
+				orderStore: &mockOrderStore{
+					createOrderFunc: func(order *types.Order) (int, error) {
+						return 0, fmt.Errorf("database unavailable")
+					},
+				},
+				reservationStore: &mockReservationStore{},
+				expectedStatus:   http.StatusInternalServerError,
+				expectedReleased: 1,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				tc.orderStore.reservations = tc.reservationStore
+				handler := NewHandler(tc.orderStore, productStore, &mockVariantStore{}, tc.reservationStore, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+				payload := types.CartCheckoutPayload{
+					Items:   []types.CartItem{{ProductID: 1, Quantity: 2}},
+					Address: "1 Test Street",
+					Country: "US",
+				}
+				marshaled, err := json.Marshal(payload)
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+
+				req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if len(tc.reservationStore.active) != 0 {
+					t.Errorf("Expected no reservation to be left holding stock, got %d", len(tc.reservationStore.active))
+				}
+				if len(tc.reservationStore.released) != tc.expectedReleased {
+					t.Errorf("Expected %d released reservations, got %d", tc.expectedReleased, len(tc.reservationStore.released))
+				}
+			})
+		}
+	})
+
+	// Test case: A reservation sent by the client is only consumed once the order is stored
+	t.Run("Should consume a client reservation with the order", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 0}}, nil
+			},
+		}
+
+		testCases := []struct {
+			name             string
+			createOrderErr   error
+			reservationID    int
+			expectedStatus   int
+			expectedConsumed bool
+		}{
+			{name: "order is placed", reservationID: 100, expectedStatus: http.StatusCreated, expectedConsumed: true},
+			{name: "order fails", reservationID: 100, createOrderErr: fmt.Errorf("database unavailable"), expectedStatus: http.StatusInternalServerError},
+			{name: "unknown reservation", reservationID: 7, expectedStatus: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				reservationStore := &mockReservationStore{active: map[int]*types.Reservation{
+					100: {ID: 100, UserID: 1, Status: "active", Items: []types.ReservationItem{{ProductID: 1, Quantity: 2}}},
+				}}
+				orderStore := &mockOrderStore{
+					createOrderFunc: func(order *types.Order) (int, error) {
+						return 42, tc.createOrderErr
+					},
+					reservations: reservationStore,
+				}
+				handler := NewHandler(orderStore, productStore, &mockVariantStore{}, reservationStore, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+				reservationID := tc.reservationID
+				marshaled, err := json.Marshal(types.CartCheckoutPayload{Address: "1 Test Street", Country: "US", ReservationID: &reservationID})
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+
+				req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				// the stock stays held by the reservation until an order takes it
+				if _, held := reservationStore.active[100]; held == tc.expectedConsumed {
+					t.Errorf("Expected reservation consumed %v, still held %v", tc.expectedConsumed, held)
+				}
+				if len(reservationStore.released) != 0 {
+					t.Errorf("Expected a client reservation not to be released, got %v", reservationStore.released)
+				}
+			})
+		}
+	})
+
+	// Test case: Only pending orders owned by the user can have their items changed
+	t.Run("Should only update items of pending orders", func(t *testing.T) {
+		orderStore := &mockOrderStore{
+			getOrderByIDFunc: func(id int) (*types.Order, error) {
+				orders := map[int]*types.Order{
+					1: {ID: 1, UserID: 1, Status: "pending"},
+					2: {ID: 2, UserID: 1, Status: "completed"},
+					3: {ID: 3, UserID: 2, Status: "pending"},
+				}
+				if order, ok := orders[id]; ok {
+					return order, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+			updateOrderItemFunc: func(orderID, productID int, variantID *int, newQuantity int) error {
+				if orderID == 2 {
+					return ErrOrderNotPending
+				}
+				if newQuantity > 5 {
+					return ErrInsufficientStock
+				}
+				return nil
+			},
+		}
+		handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		testCases := []struct {
+			name           string
+			orderID        string
+			quantity       int
+			expectedStatus int
+		}{
+			{name: "pending order", orderID: "1", quantity: 3, expectedStatus: http.StatusOK},
+			{name: "completed order", orderID: "2", quantity: 3, expectedStatus: http.StatusConflict},
+			{name: "not enough stock", orderID: "1", quantity: 10, expectedStatus: http.StatusConflict},
+			{name: "order of another user", orderID: "3", quantity: 3, expectedStatus: http.StatusNotFound},
+			{name: "zero quantity", orderID: "1", quantity: 0, expectedStatus: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				marshaled, err := json.Marshal(types.UpdateOrderItemPayload{ProductID: 1, Quantity: tc.quantity})
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+				req, err := http.NewRequest(http.MethodPatch, "/orders/"+tc.orderID+"/items", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/orders/{id}/items", handler.handleUpdateOrderItem).Methods(http.MethodPatch)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+			})
+		}
+	})
+
+	// Test case: Checkout can ship to one of the user's saved addresses
+	t.Run("Should check out with a saved address", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		addressStore := &mockAddressStore{addresses: []types.SavedAddress{
+			{ID: 1, UserID: 1, Line: "1 Main St", Country: "US"},
+			{ID: 2, UserID: 2, Line: "2 Other St", Country: "IN"},
+		}}
+
+		addressID := func(id int) *int { return &id }
+		testCases := []struct {
+			name            string
+			payload         types.CartCheckoutPayload
+			expectedStatus  int
+			expectedAddress string
+		}{
+			{
+				name:            "own saved address",
+				payload:         types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: 1}}, AddressID: addressID(1)},
+				expectedStatus:  http.StatusCreated,
+				expectedAddress: "1 Main St",
+			},
+			{
+				name:           "address of another user",
+				payload:        types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: 1}}, AddressID: addressID(2)},
+				expectedStatus: http.StatusBadRequest,
+			},
+			{
+				name:           "neither address nor address ID",
+				payload:        types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: 1}}},
+				expectedStatus: http.StatusBadRequest,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				var placed *types.Order
+				orderStore := &mockOrderStore{
+					createOrderFunc: func(order *types.Order) (int, error) {
+						placed = order
+						return 1, nil
+					},
+				}
+				handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, addressStore, &mockGuestStore{}, events.NewEventBus(10))
+				marshaled, err := json.Marshal(tc.payload)
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+				req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, 1))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedAddress != "" && (placed == nil || placed.Address != tc.expectedAddress) {
+					t.Errorf("Expected the order to ship to %q, got %+v", tc.expectedAddress, placed)
+				}
+			})
+		}
+	})
+
+	// Test case: Invoices can only be downloaded by the owner of the order
+	t.Run("Should download the invoice of an order", func(t *testing.T) {
+		orderStore := &mockOrderStore{
+			getOrderByIDFunc: func(id int) (*types.Order, error) {
+				if id != 7 {
+					return nil, sql.ErrNoRows
+				}
+				return &types.Order{
+					ID:           7,
+					UserID:       1,
+					Total:        26,
+					Currency:     "EUR",
+					ShippingCost: 6,
+					Address:      "1 Main St",
+					CreatedAt:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+					Items: []types.OrderItem{
+						{ProductID: 1, ProductName: "<b>Mug</b>", Quantity: 2, Price: 10},
+					},
+				}, nil
+			},
+		}
+		handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+
+		testCases := []struct {
+			name           string
+			orderID        string
+			userID         int
+			expectedStatus int
+		}{
+			{name: "own order", orderID: "7", userID: 1, expectedStatus: http.StatusOK},
+			{name: "order of another user", orderID: "7", userID: 2, expectedStatus: http.StatusNotFound},
+			{name: "missing order", orderID: "8", userID: 1, expectedStatus: http.StatusNotFound},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req, err := http.NewRequest(http.MethodGet, "/orders/"+tc.orderID+"/invoice", nil)
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, tc.userID))
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/orders/{id}/invoice", handler.handleGetInvoice).Methods(http.MethodGet)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus != http.StatusOK {
+					return
+				}
+				if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="invoice-7.html"` {
+					t.Errorf("Unexpected Content-Disposition %q", disposition)
+				}
+				body := rr.Body.String()
+				for _, want := range []string{"Invoice #7", "2024-01-02", "1 Main St", "&lt;b&gt;Mug&lt;/b&gt;", "20.00", "6.00", "26.00 EUR"} {
+					if !strings.Contains(body, want) {
+						t.Errorf("Expected invoice to contain %q", want)
+					}
+				}
+			})
+		}
+	})
+
+	// Test case: Guests can price a cart without an order being created
+	t.Run("Should summarize a cart without placing an order", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+				products := []types.Product{}
+				for _, id := range ids {
+					if id == 1 {
+						products = append(products, types.Product{ID: 1, Name: "Product 1", Price: 10, Quantity: 5})
+					}
+				}
+				return products, nil
+			},
+		}
+
+		testCases := []struct {
+			name           string
+			items          []types.CartItem
+			expectedStatus int
+		}{
+			{name: "valid cart", items: []types.CartItem{{ProductID: 1, Quantity: 2}}, expectedStatus: http.StatusOK},
+			{name: "unknown product", items: []types.CartItem{{ProductID: 2, Quantity: 1}}, expectedStatus: http.StatusBadRequest},
+			{name: "more than in stock", items: []types.CartItem{{ProductID: 1, Quantity: 6}}, expectedStatus: http.StatusBadRequest},
+			{name: "zero quantity", items: []types.CartItem{{ProductID: 1, Quantity: 0}}, expectedStatus: http.StatusBadRequest},
+			{name: "empty cart", items: nil, expectedStatus: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				orderStore := &mockOrderStore{
+					createOrderFunc: func(order *types.Order) (int, error) {
+						t.Error("Expected no order to be created")
+						return 1, nil
+					},
+				}
+				reservationStore := &mockReservationStore{}
+				handler := NewHandler(orderStore, productStore, &mockVariantStore{}, reservationStore, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+				marshaled, err := json.Marshal(types.CartCheckoutPayload{Items: tc.items, Country: "US"})
+				if err != nil {
+					t.Fatalf("Failed to marshal payload: %v", err)
+				}
+
+				// no Authorization header - guest carts can be summarized
+				req, err := http.NewRequest(http.MethodPost, "/cart/summary", bytes.NewBuffer(marshaled))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				rr := httptest.NewRecorder()
+				router := mux.NewRouter()
+				router.HandleFunc("/cart/summary", handler.handleCartSummary).Methods(http.MethodPost)
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if len(reservationStore.active) != 0 {
+					t.Error("Expected no stock to be reserved")
+				}
+				if tc.expectedStatus != http.StatusOK {
+					return
+				}
+
+				var response struct {
+					Data types.CartSummary `json:"data"`
+				}
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				summary := response.Data
+				if len(summary.Items) != 1 || summary.Items[0].Total != 20 {
+					t.Errorf("Expected one item totalling 20, got %+v", summary.Items)
+				}
+				// standard US shipping for 2kg is 5 + 2*0.5
+				if summary.Subtotal != 20 || summary.ShippingCost != 6 || summary.Tax != 0 || summary.Total != 26 {
+					t.Errorf("Unexpected summary %+v", summary)
+				}
+			})
+		}
+	})
+}
+
+// TestGuestCheckout checks guests can order without an account and view the order once with each returned token
+func TestGuestCheckout(t *testing.T) {
+	orders := map[int]*types.Order{}
+	orderStore := &mockOrderStore{
+		createOrderFunc: func(order *types.Order) (int, error) {
+			id := len(orders) + 1
+			orders[id] = order
+			return id, nil
+		},
+		getOrderByIDFunc: func(id int) (*types.Order, error) {
+			if order, ok := orders[id]; ok {
+				return order, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	productStore := &mockProductStore{
+		getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+			return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+		},
+	}
+	guests := &mockGuestStore{users: []types.User{{ID: 1, Email: "member@example.com"}}}
+	handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, guests, events.NewEventBus(10))
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	checkout := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "/guest/checkout", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := checkout(`{"items":[{"productID":1,"quantity":2}],"address":"1 Test Street","country":"US","email":"guest@example.com","firstName":"Gus"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data struct {
+			Order types.Order `json:"order"`
+			Token string      `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(guests.users) != 2 || !guests.users[1].IsGuest || guests.users[1].Email != "guest@example.com" {
+		t.Fatalf("Expected a guest account for the email, got %+v", guests.users)
+	}
+	if response.Data.Order.UserID != guests.users[1].ID {
+		t.Errorf("Expected the order to belong to the guest, got user %d", response.Data.Order.UserID)
+	}
+
+	// the token shows the order without logging in
+	req, err := http.NewRequest(http.MethodGet, "/guest/orders/"+response.Data.Token, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var viewed struct {
+		Data struct {
+			Order types.Order `json:"order"`
+			Token string      `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&viewed); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if viewed.Data.Order.ID != response.Data.Order.ID || viewed.Data.Token == "" || viewed.Data.Token == response.Data.Token {
+		t.Fatalf("Expected the order with a new token, got %+v", viewed.Data)
+	}
+	if _, ok := guests.tokens[response.Data.Token]; ok {
+		t.Error("Expected only the hash of the token to be stored")
+	}
+
+	// each token works once, the replacement shows the order again
+	for _, tc := range []struct {
+		token    string
+		expected int
+	}{
+		{token: response.Data.Token, expected: http.StatusNotFound},
+		{token: viewed.Data.Token, expected: http.StatusOK},
+	} {
+		req, _ = http.NewRequest(http.MethodGet, "/guest/orders/"+tc.token, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tc.expected {
+			t.Errorf("Expected status %d, got %d: %s", tc.expected, rr.Code, rr.Body.String())
+		}
+	}
+	req, _ = http.NewRequest(http.MethodGet, "/guest/orders/not-a-token", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an invalid token, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// a second checkout with the same email reuses the guest account
+	if rr := checkout(`{"items":[{"productID":1,"quantity":1}],"address":"1 Test Street","country":"US","email":"guest@example.com"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if len(guests.users) != 2 || orders[2].UserID != guests.users[1].ID {
+		t.Errorf("Expected the guest account to be reused, got %+v", guests.users)
+	}
+
+	// guests without an email get an account of their own
+	if rr := checkout(`{"items":[{"productID":1,"quantity":1}],"address":"1 Test Street","country":"US"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if len(guests.users) != 3 || !strings.HasSuffix(guests.users[2].Email, "@guest.invalid") {
+		t.Errorf("Expected a placeholder email for the guest, got %+v", guests.users)
+	}
+
+	// registered users must log in, and guests can't use saved addresses
+	if rr := checkout(`{"items":[{"productID":1,"quantity":1}],"address":"1 Test Street","country":"US","email":"member@example.com"}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a registered email, got %d", http.StatusConflict, rr.Code)
+	}
+	if rr := checkout(`{"items":[{"productID":1,"quantity":1}],"addressID":3}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a saved address, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := checkout(`{"items":[{"productID":1,"quantity":1}],"address":"1 Test Street","country":"US","email":"not-an-email"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid email, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// mockAddressStore implements the types.AddressStore interface for testing
+type mockAddressStore struct {
+	addresses []types.SavedAddress
+}
+
+func (m *mockAddressStore) CreateAddress(ctx context.Context, address *types.SavedAddress) error {
+	return nil
+}
+
+func (m *mockAddressStore) GetAddresses(ctx context.Context, userID int) ([]types.SavedAddress, error) {
+	return []types.SavedAddress{}, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(ctx context.Context, id, userID int) (*types.SavedAddress, error) {
+	for i := range m.addresses {
+		if m.addresses[i].ID == id && m.addresses[i].UserID == userID {
+			return &m.addresses[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) DeleteAddress(ctx context.Context, id, userID int) error {
+	return nil
+}
+
+// mockGuestStore implements the types.GuestStore interface in memory
+type mockGuestStore struct {
+	users  []types.User
+	tokens map[string]int // Order ID of each stored token hash
+}
+
+func (m *mockGuestStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	for i := range m.users {
+		if m.users[i].Email == email {
+			return &m.users[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockGuestStore) CreateGuestUser(ctx context.Context, user *types.User) error {
+	user.ID = len(m.users) + 100
+	user.IsGuest = true
+	m.users = append(m.users, *user)
+	return nil
+}
+
+func (m *mockGuestStore) PurgeGuestUsers(ctx context.Context, createdBefore time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockGuestStore) CreateGuestOrderToken(ctx context.Context, orderID int, tokenHash string, expiresAt time.Time) error {
+	if m.tokens == nil {
+		m.tokens = make(map[string]int)
+	}
+	m.tokens[tokenHash] = orderID
+	return nil
+}
+
+func (m *mockGuestStore) RotateGuestOrderToken(ctx context.Context, tokenHash, newTokenHash string) (int, error) {
+	orderID, ok := m.tokens[tokenHash]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	delete(m.tokens, tokenHash)
+	m.tokens[newTokenHash] = orderID
+	return orderID, nil
+}
+
+// TestBulkCheckout covers the request limits of bulk orders and the index reported when one fails
+func TestBulkCheckout(t *testing.T) {
+	orderStore := &mockOrderStore{}
+	productStore := &mockProductStore{
+		getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+			return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+		},
+	}
+	bus := events.NewEventBus(10)
+	published := make(chan events.OrderEvent, 10)
+	bus.Subscribe(func(event events.OrderEvent) { published <- event })
+	handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, bus)
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	checkout := func(carts []types.CartCheckoutPayload) *httptest.ResponseRecorder {
+		t.Helper()
+		marshaled, err := json.Marshal(carts)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/orders/bulk", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	cart := func(quantity int) types.CartCheckoutPayload {
+		return types.CartCheckoutPayload{Items: []types.CartItem{{ProductID: 1, Quantity: quantity}}, Address: "1 Test Street", Country: "US"}
+	}
+	errorIndex := func(t *testing.T, rr *httptest.ResponseRecorder) *int {
+		t.Helper()
+		var response struct {
+			Error types.APIError `json:"error"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response.Error.Index
+	}
+
+	t.Run("places every order", func(t *testing.T) {
+		var placed []*types.Order
+		orderStore.createOrdersFunc = func(orders []*types.Order) error {
+			placed = orders
+			for i, order := range orders {
+				order.ID = 10 + i
+			}
+			return nil
+		}
+		rr := checkout([]types.CartCheckoutPayload{cart(1), cart(2)})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			Data []int `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Data) != 2 || response.Data[0] != 10 || response.Data[1] != 11 {
+			t.Errorf("Expected order IDs [10 11], got %v", response.Data)
+		}
+		if len(placed) != 2 || placed[1].Items[0].Quantity != 2 || placed[1].Items[0].ProductName != "Product 1" || placed[1].UserID != 1 {
+			t.Errorf("Unexpected orders placed: %+v", placed)
+		}
+		for range placed {
+			select {
+			case event := <-published:
+				if event.Type != events.OrderPlaced {
+					t.Errorf("Expected %q event, got %q", events.OrderPlaced, event.Type)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected an OrderPlaced event for every order")
+			}
+		}
+	})
+
+	t.Run("rejects an empty batch", func(t *testing.T) {
+		if rr := checkout([]types.CartCheckoutPayload{}); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("rejects more than MAX_BULK_ORDERS orders", func(t *testing.T) {
+		carts := make([]types.CartCheckoutPayload, config.Envs.MaxBulkOrders+1)
+		for i := range carts {
+			carts[i] = cart(1)
+		}
+		if rr := checkout(carts); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("reports the index of an invalid order", func(t *testing.T) {
+		orderStore.createOrdersFunc = func(orders []*types.Order) error {
+			t.Error("No order should be placed")
+			return nil
+		}
+		reserved := cart(1)
+		reservationID := 3
+		reserved.ReservationID = &reservationID
+		for name, invalid := range map[string]types.CartCheckoutPayload{
+			"quantity":    cart(0),
+			"missing":     {Items: []types.CartItem{{ProductID: 1, Quantity: 1}}},
+			"reservation": reserved,
+		} {
+			rr := checkout([]types.CartCheckoutPayload{cart(1), invalid})
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("%s: expected status %d, got %d: %s", name, http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+			if index := errorIndex(t, rr); index == nil || *index != 1 {
+				t.Errorf("%s: expected index 1, got %v", name, index)
+			}
+		}
+	})
+
+	t.Run("reports the order that ran out of stock", func(t *testing.T) {
+		orderStore.createOrdersFunc = func(orders []*types.Order) error {
+			return &BulkOrderError{Index: 2, Err: fmt.Errorf("%w for product 1", ErrInsufficientStock)}
+		}
+		rr := checkout([]types.CartCheckoutPayload{cart(2), cart(2), cart(2)})
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+		}
+		if index := errorIndex(t, rr); index == nil || *index != 2 {
+			t.Errorf("Expected index 2, got %v", index)
+		}
+	})
+}
+
+// TestCheckoutCurrency verifies an order takes its products' currency and carts mixing currencies are rejected
+func TestCheckoutCurrency(t *testing.T) {
+	var placed *types.Order
+	orderStore := &mockOrderStore{
+		createOrderFunc: func(order *types.Order) (int, error) {
+			placed = order
+			return 1, nil
+		},
+	}
+	productStore := &mockProductStore{
+		getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+			catalog := map[int]types.Product{
+				1: {ID: 1, Name: "Product 1", Price: 10, Currency: "EUR", Quantity: 5},
+				2: {ID: 2, Name: "Product 2", Price: 20, Currency: "EUR", Quantity: 5},
+				3: {ID: 3, Name: "Product 3", Price: 30, Currency: "GBP", Quantity: 5},
+			}
+			products := []types.Product{}
+			for _, id := range ids {
+				products = append(products, catalog[id])
+			}
+			return products, nil
+		},
+	}
+	handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	checkout := func(productIDs ...int) *httptest.ResponseRecorder {
+		t.Helper()
+		payload := types.CartCheckoutPayload{Address: "1 Test Street", Country: "US"}
+		for _, id := range productIDs {
+			payload.Items = append(payload.Items, types.CartItem{ProductID: id, Quantity: 1})
+		}
+		marshaled, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("takes the currency of the products", func(t *testing.T) {
+		rr := checkout(1, 2)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		if placed == nil || placed.Currency != "EUR" {
+			t.Errorf("Expected an order in EUR, got %+v", placed)
+		}
+	})
+
+	t.Run("rejects mixed currencies", func(t *testing.T) {
+		placed = nil
+		rr := checkout(1, 3)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "different currencies") {
+			t.Errorf("Expected a mixed currency error, got %s", rr.Body.String())
+		}
+		if placed != nil {
+			t.Errorf("Expected no order, got %+v", placed)
+		}
+	})
+}
+
+// TestReorder checks a past order is placed again at current prices, and not at all when a product is unavailable
+func TestReorder(t *testing.T) {
+	variantM, variantXL := 7, 8
+	variantStore := &mockVariantStore{
+		variants: []types.ProductVariant{
+			{ID: variantM, ProductID: 1, SKU: "P1-M", Price: 12, Quantity: 5},
+			{ID: variantXL, ProductID: 1, SKU: "P1-XL", Price: 15, Quantity: 1},
+		},
+	}
+	pastOrders := map[int]*types.Order{
+		5: {ID: 5, UserID: 1, Address: "1 Test Street", Country: "GB", ShippingMethod: shipping.MethodExpress, Items: []types.OrderItem{
+			{ProductID: 1, Quantity: 2, Price: 8},
+			{ProductID: 2, Quantity: 1, Price: 15},
+		}},
+		6: {ID: 6, UserID: 1, Address: "1 Test Street", Items: []types.OrderItem{
+			{ProductID: 1, Quantity: 1, Price: 8},
+			{ProductID: 3, Quantity: 1, Price: 30},
+			{ProductID: 4, Quantity: 1, Price: 40},
+		}},
+		7: {ID: 7, UserID: 2, Address: "2 Other Street", Items: []types.OrderItem{{ProductID: 1, Quantity: 1, Price: 8}}},
+		8: {ID: 8, UserID: 1, Address: "1 Test Street", Country: "US", Items: []types.OrderItem{
+			{ProductID: 1, VariantID: &variantM, Quantity: 2, Price: 11},
+			{ProductID: 1, Quantity: 1, Price: 8},
+		}},
+		// product 1 itself has stock, only its XL variant has run out
+		9: {ID: 9, UserID: 1, Address: "1 Test Street", Country: "US", Items: []types.OrderItem{
+			{ProductID: 1, VariantID: &variantXL, Quantity: 2, Price: 14},
+		}},
+	}
+	var placed *types.Order
+	orderStore := &mockOrderStore{
+		createOrderFunc: func(order *types.Order) (int, error) {
+			placed = order
+			return 42, nil
+		},
+		getOrderByIDFunc: func(id int) (*types.Order, error) {
+			if order, ok := pastOrders[id]; ok {
+				return order, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	productStore := &mockProductStore{
+		getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+			// product 3 is out of stock and product 4 has been deleted
+			catalog := map[int]types.Product{
+				1: {ID: 1, Name: "Product 1", Price: 10, Currency: "USD", Quantity: 5},
+				2: {ID: 2, Name: "Product 2", Price: 20, Currency: "USD", Quantity: 5},
+				3: {ID: 3, Name: "Product 3", Price: 30, Currency: "USD", Quantity: 0},
+			}
+			products := []types.Product{}
+			for _, id := range ids {
+				if product, ok := catalog[id]; ok {
+					products = append(products, product)
+				}
+			}
+			return products, nil
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		authenticated  bool
+		expectedStatus int
+	}{
+		{name: "reorders at current prices", path: "/orders/5/reorder", authenticated: true, expectedStatus: http.StatusCreated},
+		{name: "unavailable products", path: "/orders/6/reorder", authenticated: true, expectedStatus: http.StatusConflict},
+		{name: "another user's order", path: "/orders/7/reorder", authenticated: true, expectedStatus: http.StatusNotFound},
+		{name: "unknown order", path: "/orders/99/reorder", authenticated: true, expectedStatus: http.StatusNotFound},
+		{name: "invalid order ID", path: "/orders/abc/reorder", authenticated: true, expectedStatus: http.StatusBadRequest},
+		{name: "unauthenticated", path: "/orders/5/reorder", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			placed = nil
+			orderStore.createdItems = nil
+			handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+			router := mux.NewRouter()
+			handler.OrderRoutes(router)
+
+			req, err := http.NewRequest(http.MethodPost, tc.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tc.authenticated {
+				req.Header.Set("Authorization", authHeader(t, 1))
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusCreated {
+				if placed != nil {
+					t.Errorf("Expected no order, got %+v", placed)
+				}
+				return
+			}
+			if placed == nil || placed.Address != "1 Test Street" || placed.ID != 42 {
+				t.Fatalf("Expected a new order to the past order's address, got %+v", placed)
+			}
+			// the past order's country decides the tax and its shipping method is used again
+			if placed.Country != "GB" || placed.TaxRate != 0.20 || placed.ShippingMethod != shipping.MethodExpress {
+				t.Errorf("Expected an express order to GB taxed at 20%%, got %+v", placed)
+			}
+			if len(orderStore.createdItems) != 2 || orderStore.createdItems[0].Price != 10 || orderStore.createdItems[0].Quantity != 2 || orderStore.createdItems[1].Price != 20 {
+				t.Errorf("Expected the past items at current prices, got %+v", orderStore.createdItems)
+			}
+		})
+	}
+
+	t.Run("reorders the same variants", func(t *testing.T) {
+		orderStore.createdItems = nil
+		handler := NewHandler(orderStore, productStore, variantStore, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+		router := mux.NewRouter()
+		handler.OrderRoutes(router)
+
+		req, err := http.NewRequest(http.MethodPost, "/orders/8/reorder", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		items := orderStore.createdItems
+		if len(items) != 2 || items[0].VariantID == nil || *items[0].VariantID != variantM || items[0].Price != 12 || items[1].VariantID != nil || items[1].Price != 10 {
+			t.Errorf("Expected variant %d at its current price and the plain product, got %+v", variantM, items)
+		}
+	})
+
+	t.Run("checks the stock of variants", func(t *testing.T) {
+		handler := NewHandler(orderStore, productStore, variantStore, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+		router := mux.NewRouter()
+		handler.OrderRoutes(router)
+
+		req, err := http.NewRequest(http.MethodPost, "/orders/9/reorder", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response struct {
+			Error types.APIError `json:"error"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if rr.Code != http.StatusConflict || !slices.Equal(response.Error.ProductIDs, []int{1}) {
+			t.Errorf("Expected product 1 to be unavailable, got %d: %+v", rr.Code, response.Error)
+		}
+	})
+
+	t.Run("lists the unavailable products", func(t *testing.T) {
+		handler := NewHandler(orderStore, productStore, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+		router := mux.NewRouter()
+		handler.OrderRoutes(router)
+
+		req, err := http.NewRequest(http.MethodPost, "/orders/6/reorder", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response struct {
+			Error types.APIError `json:"error"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if !slices.Equal(response.Error.ProductIDs, []int{3, 4}) {
+			t.Errorf("Expected products 3 and 4 to be unavailable, got %+v", response.Error)
+		}
+	})
+}
+
+// TestExportOrders checks the user's orders are downloaded as CSV and ?from=&to= narrows them
+func TestExportOrders(t *testing.T) {
+	orderStore := &mockOrderStore{
+		getOrdersFunc: func(userID int) ([]types.Order, error) {
+			return []types.Order{
+				{ID: 3, UserID: userID, Status: "completed", Total: 42.5, CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), Items: []types.OrderItem{
+					{ProductID: 1, Quantity: 2},
+					{ProductID: 2, Quantity: 1},
+				}},
+				{ID: 4, UserID: userID, Status: "pending", Total: 10, CreatedAt: time.Date(2024, 4, 15, 9, 30, 0, 0, time.UTC), Items: []types.OrderItem{
+					{ProductID: 1, Quantity: 1},
+				}},
+			}, nil
+		},
+	}
+	handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	serve := func(path string, authenticated bool) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if authenticated {
+			req.Header.Set("Authorization", authHeader(t, 1))
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/orders/export", true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Expected a CSV content type, got %q", contentType)
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+		t.Errorf("Expected an attachment, got %q", disposition)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and two orders, got %q", rr.Body.String())
+	}
+	if lines[0] != "order id,createdAt,status,total,item count" {
+		t.Errorf("Unexpected header row %q", lines[0])
+	}
+	if lines[1] != "3,2024-03-01T10:00:00Z,completed,42.50,3" {
+		t.Errorf("Unexpected data row %q", lines[1])
+	}
+
+	// to is inclusive of the whole day
+	rr = serve("/orders/export?from=2024-04-01&to=2024-04-15", true)
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "4,") {
+		t.Errorf("Expected only order 4 in the range, got %q", rr.Body.String())
+	}
+
+	if rr := serve("/orders/export?from=01-04-2024", true); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid date, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := serve("/orders/export?from=2024-05-01&to=2024-04-01", true); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for from after to, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := serve("/orders/export", false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d when unauthenticated, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+// TestGetOrdersStatusFilter checks ?status= narrows the listed orders and rejects unknown statuses
+func TestGetOrdersStatusFilter(t *testing.T) {
+	orderStore := &mockOrderStore{
+		getOrdersFunc: func(userID int) ([]types.Order, error) {
+			return []types.Order{
+				{ID: 1, UserID: userID, Status: "pending"},
+				{ID: 2, UserID: userID, Status: "completed"},
+				{ID: 3, UserID: userID, Status: "pending"},
+			}, nil
+		},
+	}
+	handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	getOrders := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/orders"+query, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("pending", func(t *testing.T) {
+		rr := getOrders("?status=pending")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			Data []types.Order `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Data) != 2 || response.Data[0].ID != 1 || response.Data[1].ID != 3 {
+			t.Errorf("Expected the two pending orders, got %+v", response.Data)
+		}
+	})
+
+	t.Run("no filter", func(t *testing.T) {
+		rr := getOrders("")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			Data []types.Order `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Data) != 3 {
+			t.Errorf("Expected every order, got %+v", response.Data)
+		}
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		rr := getOrders("?status=shipped")
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "status must be one of") {
+			t.Errorf("Expected a status error, got %s", rr.Body.String())
+		}
+	})
+}
+
+// TestGetOrdersPagination checks orders are listed a page at a time with the pagination metadata
+func TestGetOrdersPagination(t *testing.T) {
+	orderStore := &mockOrderStore{
+		getOrdersFunc: func(userID int) ([]types.Order, error) {
+			orders := make([]types.Order, 25)
+			for i := range orders {
+				orders[i] = types.Order{ID: i + 1, UserID: userID, Status: "pending"}
+			}
+			return orders, nil
+		},
+	}
+	handler := NewHandler(orderStore, &mockProductStore{}, &mockVariantStore{}, &mockReservationStore{}, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+	router := mux.NewRouter()
+	handler.OrderRoutes(router)
+
+	getOrders := func(query string) (*httptest.ResponseRecorder, []types.Order, types.Pagination) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/orders"+query, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response struct {
+			Data       []types.Order    `json:"data"`
+			Pagination types.Pagination `json:"pagination"`
+		}
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rr, response.Data, response.Pagination
+	}
+
+	t.Run("defaults to the first 10 orders", func(t *testing.T) {
+		rr, orders, pagination := getOrders("")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if len(orders) != 10 || orders[0].ID != 1 {
+			t.Errorf("Expected orders 1 to 10, got %+v", orders)
+		}
+		expected := types.Pagination{Page: 1, Limit: 10, Total: 25, TotalPages: 3}
+		if pagination != expected {
+			t.Errorf("Expected pagination %+v, got %+v", expected, pagination)
+		}
+	})
+
+	t.Run("page 2 returns different orders than page 1", func(t *testing.T) {
+		_, first, _ := getOrders("?page=1&limit=5")
+		rr, second, pagination := getOrders("?page=2&limit=5")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if len(first) != 5 || len(second) != 5 {
+			t.Fatalf("Expected 5 orders on each page, got %d and %d", len(first), len(second))
+		}
+		seen := map[int]bool{}
+		for _, order := range first {
+			seen[order.ID] = true
+		}
+		for _, order := range second {
+			if seen[order.ID] {
+				t.Errorf("Expected page 2 not to repeat order %d from page 1", order.ID)
+			}
+		}
+		if pagination.Page != 2 || pagination.TotalPages != 5 {
+			t.Errorf("Expected page 2 of 5, got %+v", pagination)
+		}
+	})
+
+	t.Run("limit above the maximum", func(t *testing.T) {
+		rr, _, _ := getOrders("?limit=51")
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("invalid page", func(t *testing.T) {
+		rr, _, _ := getOrders("?page=0")
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// mockOrderStore implements the types.OrderStore interface for testing
+type mockOrderStore struct {
+	createOrderFunc     func(order *types.Order) (int, error)
+	getOrdersFunc       func(userID int) ([]types.Order, error)
+	getOrderByIDFunc    func(id int) (*types.Order, error)
+	updateOrderItemFunc func(orderID, productID int, variantID *int, newQuantity int) error
+	createOrdersFunc    func(orders []*types.Order) error
+	createdItems        []types.OrderItem
+	reservations        *mockReservationStore // Reservations consumed by CreateReservedOrder, nil accepts any reservation
+}
+
+func (m *mockOrderStore) CreateOrders(ctx context.Context, orders []*types.Order) error {
+	if m.createOrdersFunc != nil {
+		return m.createOrdersFunc(orders)
+	}
+	for i, order := range orders {
+		order.ID = i + 1
+	}
+	return nil
+}
+
+// CreateReservedOrder stores the order with the ID createOrderFunc returns and records its items, then consumes the reservation
+// Nothing is stored when the reservation can't be consumed, like the real transaction
+func (m *mockOrderStore) CreateReservedOrder(ctx context.Context, order *types.Order, reservationID int) error {
+	if m.reservations != nil {
+		if _, err := m.reservations.GetReservation(ctx, reservationID, order.UserID); err != nil {
+			return err
+		}
+	}
+	orderID := 1
+	if m.createOrderFunc != nil {
+		var err error
+		if orderID, err = m.createOrderFunc(order); err != nil {
+			return err
+		}
+	}
+	order.ID = orderID
+	for i := range order.Items {
+		order.Items[i].OrderID = orderID
+		m.createdItems = append(m.createdItems, order.Items[i])
+	}
+	if m.reservations != nil {
+		m.reservations.consume(reservationID)
+	}
+	return nil
+}
+
+func (m *mockOrderStore) GetOrders(ctx context.Context, userID int) ([]types.Order, error) {
+	if m.getOrdersFunc != nil {
+		return m.getOrdersFunc(userID)
+	}
+	return []types.Order{}, nil
+}
+
+// GetOrdersByStatus filters the orders GetOrders returns, keeping those with the given status, and pages them
+func (m *mockOrderStore) GetOrdersByStatus(ctx context.Context, userID int, status string, page, limit int) ([]types.Order, int, error) {
+	orders, err := m.GetOrders(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	filtered := []types.Order{}
+	for _, order := range orders {
+		if status == "" || order.Status == status {
+			filtered = append(filtered, order)
+		}
+	}
+	start := min((page-1)*limit, len(filtered))
+	end := min(start+limit, len(filtered))
+	return filtered[start:end], len(filtered), nil
+}
+
+func (m *mockOrderStore) GetOrderByID(ctx context.Context, id int) (*types.Order, error) {
+	if m.getOrderByIDFunc != nil {
+		return m.getOrderByIDFunc(id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) GetOrderItems(ctx context.Context, orderIDs []int) (map[int][]types.OrderItem, error) {
+	return map[int][]types.OrderItem{}, nil
+}
+
+func (m *mockOrderStore) GetOrdersByProductID(ctx context.Context, productID, page, limit int) ([]types.Order, int, error) {
+	return []types.Order{}, 0, nil
+}
+
+func (m *mockOrderStore) UpdateOrderItem(ctx context.Context, orderID, productID int, variantID *int, newQuantity int) error {
+	if m.updateOrderItemFunc != nil {
+		return m.updateOrderItemFunc(orderID, productID, variantID, newQuantity)
+	}
+	return nil
+}
+
+func (m *mockOrderStore) ExportOrders(ctx context.Context, userID int, from, to time.Time, fn func(types.OrderSummary) error) error {
+	orders, err := m.GetOrders(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if (!from.IsZero() && order.CreatedAt.Before(from)) || (!to.IsZero() && !order.CreatedAt.Before(to)) {
+			continue
+		}
+		summary := types.OrderSummary{ID: order.ID, CreatedAt: order.CreatedAt, Status: order.Status, Total: order.Total}
+		for _, item := range order.Items {
+			summary.ItemCount += item.Quantity
+		}
+		if err := fn(summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockOrderStore) GetPurchasedProducts(ctx context.Context, userID int) ([]types.PurchasedProduct, error) {
+	return []types.PurchasedProduct{}, nil
+}
+
+// mockProductStore implements the types.ProductStore interface for testing
+type mockProductStore struct {
+	getProductsByIDsFunc func(ids []int) ([]types.Product, error)
+}
+
+func (m *mockProductStore) GetProducts(ctx context.Context, filter types.ProductFilter) ([]types.Product, error) {
+	return []types.Product{}, nil
+}
+
+func (m *mockProductStore) GetProductByID(ctx context.Context, id int) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductByName(ctx context.Context, name string) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductBySKU(ctx context.Context, sku string) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetRelatedProducts(ctx context.Context, productID, limit int) ([]types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) SearchProducts(ctx context.Context, query string, page, limit int) ([]types.Product, int, error) {
+	return []types.Product{}, 0, nil
+}
+
+func (m *mockProductStore) GetProductSummaries(ctx context.Context, page, limit int) ([]types.ProductSummary, int, error) {
+	return []types.ProductSummary{}, 0, nil
+}
+
+func (m *mockProductStore) GetFeaturedProducts(ctx context.Context, limit int) ([]types.Product, error) {
+	return []types.Product{}, nil
+}
+
+func (m *mockProductStore) SetFeatured(ctx context.Context, productID int, featured bool) error {
+	return nil
+}
+
+func (m *mockProductStore) CreateProduct(ctx context.Context, product *types.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) CreateProducts(ctx context.Context, products []*types.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) AdjustStockBatch(ctx context.Context, adjustments []types.StockAdjustment) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductsByIDs(ctx context.Context, ids []int) ([]types.Product, error) {
+	if m.getProductsByIDsFunc != nil {
+		return m.getProductsByIDsFunc(ids)
+	}
+	return nil, fmt.Errorf("products not found")
+}
+
+func (m *mockProductStore) UpdateProductPrice(ctx context.Context, id int, price types.Price) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductStock(ctx context.Context, id int) (int, error) {
+	return 0, sql.ErrNoRows
+}
+
+// mockVariantStore implements the types.VariantStore interface for testing
+type mockVariantStore struct {
+	variants []types.ProductVariant
+}
+
+func (m *mockVariantStore) CreateVariant(ctx context.Context, variant *types.ProductVariant) error {
+	return nil
+}
+
+func (m *mockVariantStore) GetVariantByID(ctx context.Context, id int) (*types.ProductVariant, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockVariantStore) GetVariantsByProductID(ctx context.Context, productID int) ([]types.ProductVariant, error) {
+	return []types.ProductVariant{}, nil
+}
+
+func (m *mockVariantStore) GetVariantsByIDs(ctx context.Context, ids []int) ([]types.ProductVariant, error) {
+	variants := []types.ProductVariant{}
+	for _, variant := range m.variants {
+		for _, id := range ids {
+			if variant.ID == id {
+				variants = append(variants, variant)
+			}
+		}
+	}
+	return variants, nil
+}
+
+func (m *mockVariantStore) UpdateVariant(ctx context.Context, variant *types.ProductVariant) error {
+	return nil
+}
+
+func (m *mockVariantStore) DeleteVariant(ctx context.Context, id int) error {
+	return nil
+}
+
+// mockReservationStore implements the types.ReservationStore interface for testing
+// Reservations it creates can be released like real ones, and consumed by a mockOrderStore linked to it
+type mockReservationStore struct {
+	createReservationFunc func(userID int, items []types.CartItem, ttl time.Duration) (*types.Reservation, error)
+	active                map[int]*types.Reservation
+	released              []int
+}
+
+func (m *mockReservationStore) CreateReservation(ctx context.Context, userID int, items []types.CartItem, ttl time.Duration) (*types.Reservation, error) {
+	if m.createReservationFunc != nil {
+		return m.createReservationFunc(userID, items, ttl)
+	}
+	if m.active == nil {
+		m.active = make(map[int]*types.Reservation)
+	}
+	reservation := &types.Reservation{ID: len(m.active) + 100, UserID: userID, Status: "active"}
+	for _, item := range items {
+		reservation.Items = append(reservation.Items, types.ReservationItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
+	}
+	m.active[reservation.ID] = reservation
+	return reservation, nil
+}
+
+func (m *mockReservationStore) GetReservation(ctx context.Context, reservationID, userID int) (*types.Reservation, error) {
+	reservation, ok := m.active[reservationID]
+	if !ok || reservation.UserID != userID {
+		return nil, ErrReservationNotFound
+	}
+	return reservation, nil
+}
+
+// consume marks a reservation as used by an order, like CreateReservedOrder does in the real store
+func (m *mockReservationStore) consume(reservationID int) {
+	m.active[reservationID].Status = "consumed"
+	delete(m.active, reservationID)
+}
+
+func (m *mockReservationStore) ReleaseReservation(ctx context.Context, reservationID, userID int) error {
+	if _, ok := m.active[reservationID]; !ok {
+		return ErrReservationNotFound
+	}
+	delete(m.active, reservationID)
+	m.released = append(m.released, reservationID)
+	return nil
+}
+
+func (m *mockReservationStore) ReleaseExpired(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// authHeader returns a valid Authorization header value for the given user ID
+func authHeader(t *testing.T, userID int) string {
+	t.Helper()
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return "Bearer " + token
+}
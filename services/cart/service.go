@@ -1 +1,65 @@
 package cart
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// StartReservationSweeper periodically releases expired reservations back to stock
+// It runs until the returned stop function is called
+func StartReservationSweeper(store types.ReservationStore, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				released, err := store.ReleaseExpired(context.Background())
+				if err != nil {
+					log.Printf("Error releasing expired reservations: %v", err)
+					continue
+				}
+				if released > 0 {
+					log.Printf("Released %d expired reservations", released)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// StartGuestSweeper periodically cleans up guest accounts older than retention
+// It runs until the returned stop function is called
+func StartGuestSweeper(store types.GuestStore, retention, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := store.PurgeGuestUsers(context.Background(), time.Now().Add(-retention))
+				if err != nil {
+					log.Printf("Error cleaning up guest accounts: %v", err)
+					continue
+				}
+				if purged > 0 {
+					log.Printf("Cleaned up %d guest accounts", purged)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
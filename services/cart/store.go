@@ -1,149 +1,913 @@
 package cart
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/tracing"
 	"github.com/Asif-Faizal/Gommerce/types"
 )
 
+// ErrInsufficientStock is returned when a product does not have enough stock to cover a request
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrReservationNotFound is returned when a reservation does not exist, has expired or was already used
+var ErrReservationNotFound = errors.New("reservation not found or expired")
+
+// ErrOrderItemNotFound is returned when an order does not exist or does not contain a product
+var ErrOrderItemNotFound = errors.New("order item not found")
+
+// ErrOrderNotPending is returned when changing an order that is no longer pending
+var ErrOrderNotPending = errors.New("only pending orders can be changed")
+
 // Store represents the user data store
 // It implements the types.CartStore interface
 type Store struct {
-	db *sql.DB // Database connection
+	db        *db.DB               // Database connection, every query runs with DB_QUERY_TIMEOUT and is logged when slower than SLOW_QUERY_MS
+	inventory *events.InventoryBus // Receives stock levels after they change, nil when nobody is watching
 }
 
 // NewStore creates a new instance of the user Store
 // Takes a database connection as a parameter
-func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+func NewStore(conn *sql.DB) *Store {
+	return &Store{db: db.WithQueryTimeout(conn).LogConfiguredSlowQueries()}
+}
+
+// SetInventoryBus makes the store publish the new stock level of every product whose stock it changes
+func (s *Store) SetInventoryBus(bus *events.InventoryBus) {
+	s.inventory = bus
+}
+
+// BulkOrderError reports which order of a bulk checkout failed
+type BulkOrderError struct {
+	Index int   // Position of the order in the batch
+	Err   error // Why the order failed
+}
+
+func (e *BulkOrderError) Error() string {
+	return fmt.Sprintf("order %d: %v", e.Index, e.Err)
 }
 
-func (s *Store) CreateOrder(order *types.Order) (int, error) {
-	query := "INSERT INTO orders (userId, total, status, address) VALUES (?, ?, ?, ?)"
-	result, err := s.db.Exec(query, order.UserID, order.Total, order.Status, order.Address)
+func (e *BulkOrderError) Unwrap() error {
+	return e.Err
+}
+
+// CreateOrders places several orders with their items in a single transaction, filling in their IDs
+// Each item's stock is taken from its variant or product, so either every order is placed or none are
+// Returns a *BulkOrderError wrapping ErrInsufficientStock or the database error of the first order that fails
+func (s *Store) CreateOrders(ctx context.Context, orders []*types.Order) error {
+	defer tracing.StartDBSpan(ctx, "CreateOrders").End()
+
+	var productIDs []int
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		for i, order := range orders {
+			if err := createOrder(tx, order); err != nil {
+				return &BulkOrderError{Index: i, Err: err}
+			}
+			for _, item := range order.Items {
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, err
+		return err
+	}
+	s.publishStock(productIDs)
+	return nil
+}
+
+// createOrder takes the stock of an order's items and inserts the order and its items within a transaction
+func createOrder(tx *db.Tx, order *types.Order) error {
+	for _, item := range order.Items {
+		if err := decrementStock(tx, item.ProductID, item.VariantID, item.Quantity); err != nil {
+			return err
+		}
+	}
+	return insertOrder(tx, order)
+}
+
+// insertOrder inserts an order and its items within a transaction, filling in their IDs
+// The stock of the items must already have been taken
+func insertOrder(tx *db.Tx, order *types.Order) error {
+	result, err := tx.Exec(
+		"INSERT INTO orders (userId, total, currency, shippingCost, shippingMethod, taxRate, taxAmount, status, address, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		order.UserID, order.Total, order.Currency, order.ShippingCost, order.ShippingMethod, order.TaxRate, order.TaxAmount, order.Status, order.Address, order.Country,
+	)
+	if err != nil {
+		return err
 	}
-	orderID, err := result.LastInsertId()
+	id, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return err
+	}
+	order.ID = int(id)
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.OrderID = order.ID
+		if _, err := tx.Exec(
+			"INSERT INTO order_items (orderId, productId, variantId, productName, productImage, quantity, price) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			item.OrderID, item.ProductID, item.VariantID, item.ProductName, item.ProductImage, item.Quantity, item.Price,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decrementStock takes quantity units out of an item's stock within a transaction
+// Items of a variant take them from the variant, other items from their product
+func decrementStock(tx *db.Tx, productID int, variantID *int, quantity int) error {
+	if variantID != nil {
+		return decrementVariantQuantity(tx, productID, *variantID, quantity)
+	}
+	return decrementProductQuantity(tx, productID, quantity)
+}
+
+// incrementStock puts quantity units back into an item's stock within a transaction
+func incrementStock(tx *db.Tx, productID int, variantID *int, quantity int) error {
+	if variantID != nil {
+		_, err := tx.Exec("UPDATE product_variants SET quantity = quantity + ? WHERE id = ?", quantity, *variantID)
+		return err
+	}
+	return incrementProductQuantity(tx, productID, quantity)
+}
+
+// decrementVariantQuantity takes quantity units out of a variant's stock within a transaction
+// Returns ErrInsufficientStock if the variant has fewer units in stock or isn't a variant of the product
+func decrementVariantQuantity(tx *db.Tx, productID, variantID, quantity int) error {
+	result, err := tx.Exec(
+		"UPDATE product_variants SET quantity = quantity - ? WHERE id = ? AND productId = ? AND quantity >= ?",
+		quantity, variantID, productID, quantity,
+	)
+	if db.IsOutOfRange(err) {
+		return fmt.Errorf("%w for variant %d", ErrInsufficientStock, variantID)
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
-	return int(orderID), nil
+	if affected == 0 {
+		return fmt.Errorf("%w for variant %d", ErrInsufficientStock, variantID)
+	}
+	return nil
 }
 
-func (s *Store) CreateOrderItem(orderItem *types.OrderItem) error {
-	query := "INSERT INTO order_items (orderId, productId, quantity, price) VALUES (?, ?, ?, ?)"
-	_, err := s.db.Exec(query, orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price)
+// decrementProductQuantity takes quantity units out of a product's stock within a transaction
+// Returns ErrInsufficientStock if the product has fewer units in stock
+func decrementProductQuantity(tx *db.Tx, productID, quantity int) error {
+	result, err := tx.Exec(
+		"UPDATE products SET quantity = quantity - ? WHERE id = ? AND quantity >= ?",
+		quantity, productID, quantity,
+	)
+	// products.quantity is UNSIGNED, so should the guard ever miss, MySQL refuses to take stock below zero
+	if db.IsOutOfRange(err) {
+		return fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+	}
 	return nil
 }
 
-func (s *Store) GetOrders(userID int) ([]types.Order, error) {
-	// First get all orders for the user
+// incrementProductQuantity puts quantity units back into a product's stock within a transaction
+func incrementProductQuantity(tx *db.Tx, productID, quantity int) error {
+	_, err := tx.Exec("UPDATE products SET quantity = quantity + ? WHERE id = ?", quantity, productID)
+	return err
+}
+
+// publishStock publishes the current stock level of the given products to the inventory bus
+// It runs after the change is committed, so watchers never see stock a rollback undid
+// Errors are logged, the stock change itself already succeeded
+func (s *Store) publishStock(productIDs []int) {
+	if s.inventory == nil || len(productIDs) == 0 {
+		return
+	}
+
+	placeholders := make([]string, len(productIDs))
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	query := fmt.Sprintf("SELECT id, quantity FROM products WHERE id IN (%s)", strings.Join(placeholders, ","))
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error loading stock levels to publish: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event events.InventoryEvent
+		if err := rows.Scan(&event.ProductID, &event.Quantity); err != nil {
+			log.Printf("Error loading stock levels to publish: %v", err)
+			return
+		}
+		s.inventory.Publish(event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error loading stock levels to publish: %v", err)
+	}
+}
+
+// GetOrders retrieves every order of a user, newest first
+func (s *Store) GetOrders(ctx context.Context, userID int) ([]types.Order, error) {
+	defer tracing.StartDBSpan(ctx, "GetOrders").End()
+
+	orders, _, err := s.getOrders(ctx, userID, "", 0, 0)
+	return orders, err
+}
+
+// GetOrdersByStatus retrieves a page of a user's orders with the given status, or of all of them when status is empty
+// The total counts every matching order
+func (s *Store) GetOrdersByStatus(ctx context.Context, userID int, status string, page, limit int) ([]types.Order, int, error) {
+	defer tracing.StartDBSpan(ctx, "GetOrdersByStatus").End()
+
+	return s.getOrders(ctx, userID, status, page, limit)
+}
+
+// getOrders retrieves a user's orders with their items, newest first, filtered by status unless it is empty
+// With a limit of 0 every order is returned, otherwise only the given page of orders and the total is counted
+func (s *Store) getOrders(ctx context.Context, userID int, status string, page, limit int) ([]types.Order, int, error) {
+	where := "WHERE o.userId = ?"
+	args := []interface{}{userID}
+	if status != "" {
+		where += " AND o.status = ?"
+		args = append(args, status)
+	}
+
+	total := -1
+	if limit > 0 {
+		if err := s.db.QueryRow("SELECT COUNT(DISTINCT o.id) FROM orders o "+where, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("error counting orders: %w", err)
+		}
+	}
+
+	orders, err := s.loadOrders(ctx, where, args, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total < 0 {
+		total = len(orders)
+	}
+	return orders, total, nil
+}
+
+// loadOrders loads the orders matching where, newest first, then their items with one more query
+// Each order is read once however many items it has, unlike with a single joined query, see loadOrdersJoined in the tests
+// With a limit of 0 every matching order is loaded, otherwise only the given page
+func (s *Store) loadOrders(ctx context.Context, where string, args []interface{}, page, limit int) ([]types.Order, error) {
 	query := `
-		SELECT 
-			o.id, 
-			o.userId, 
-			o.total, 
-			o.status, 
-			o.address, 
-			o.createdAt,
-			oi.id as item_id, 
-			oi.orderId, 
-			oi.productId, 
-			oi.quantity, 
-			oi.price,
-			p.id as product_id, 
-			p.name as product_name, 
-			p.description as product_description, 
-			p.image as product_image, 
-			p.price as product_price, 
-			p.quantity as product_quantity, 
-			p.createdAt as product_createdAt
+		SELECT o.id, o.userId, o.total, o.currency, o.shippingCost, o.shippingMethod, o.taxRate, o.taxAmount, o.status, o.address, o.country, o.createdAt
 		FROM orders o
-		LEFT JOIN order_items oi ON o.id = oi.orderId
-		LEFT JOIN products p ON oi.productId = p.id
-		WHERE o.userId = ?
+		` + where + `
 		ORDER BY o.createdAt DESC, o.id ASC
 	`
-	rows, err := s.db.Query(query, userID)
+	if limit > 0 {
+		query += "LIMIT ? OFFSET ?"
+		args = append(args[:len(args):len(args)], limit, (page-1)*limit)
+	}
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	// Map to store orders by ID
-	ordersMap := make(map[int]*types.Order)
-
+	orders := []types.Order{}
+	orderIDs := []int{}
 	for rows.Next() {
 		var order types.Order
-		var orderItem types.OrderItem
-		var product types.Product
-		var itemID sql.NullInt64
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Total,
+			&order.Currency,
+			&order.ShippingCost,
+			&order.ShippingMethod,
+			&order.TaxRate,
+			&order.TaxAmount,
+			&order.Status,
+			&order.Address,
+			&order.Country,
+			&order.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := s.GetOrderItems(ctx, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+		if orders[i].Items == nil {
+			orders[i].Items = []types.OrderItem{}
+		}
+	}
+	return orders, nil
+}
+
+// ExportOrders calls fn with a summary of each of a user's orders, oldest first
+// Only orders created in [from, to) are included, a zero from or to leaves that end of the range open
+// Rows are handed to fn as they are read so an export of any size is never held in memory; an error from fn stops the export
+func (s *Store) ExportOrders(ctx context.Context, userID int, from, to time.Time, fn func(types.OrderSummary) error) error {
+	defer tracing.StartDBSpan(ctx, "ExportOrders").End()
+
+	where := "WHERE o.userId = ?"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		where += " AND o.createdAt >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		where += " AND o.createdAt < ?"
+		args = append(args, to)
+	}
+
+	query := `
+		SELECT o.id, o.createdAt, o.status, o.total, COALESCE(SUM(oi.quantity), 0)
+		FROM orders o
+		LEFT JOIN order_items oi ON oi.orderId = o.id
+		` + where + `
+		GROUP BY o.id, o.createdAt, o.status, o.total
+		ORDER BY o.createdAt ASC, o.id ASC
+	`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary types.OrderSummary
+		if err := rows.Scan(&summary.ID, &summary.CreatedAt, &summary.Status, &summary.Total, &summary.ItemCount); err != nil {
+			return err
+		}
+		if err := fn(summary); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetOrderByID retrieves an order and its items by the order's ID
+// Returns sql.ErrNoRows if no order has the given ID
+func (s *Store) GetOrderByID(ctx context.Context, id int) (*types.Order, error) {
+	defer tracing.StartDBSpan(ctx, "GetOrderByID").End()
+
+	order := &types.Order{}
+	query := "SELECT id, userId, total, currency, shippingCost, shippingMethod, taxRate, taxAmount, status, address, country, createdAt FROM orders WHERE id = ?"
+	err := s.db.QueryRow(query, id).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Total,
+		&order.Currency,
+		&order.ShippingCost,
+		&order.ShippingMethod,
+		&order.TaxRate,
+		&order.TaxAmount,
+		&order.Status,
+		&order.Address,
+		&order.Country,
+		&order.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.GetOrderItems(ctx, []int{order.ID})
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items[order.ID]
+	if order.Items == nil {
+		order.Items = []types.OrderItem{}
+	}
+	return order, nil
+}
+
+// GetOrderItems loads the items of many orders with a single IN (...) query
+// Returns the items grouped by order ID; orders without items are absent from the map
+func (s *Store) GetOrderItems(ctx context.Context, orderIDs []int) (map[int][]types.OrderItem, error) {
+	defer tracing.StartDBSpan(ctx, "GetOrderItems").End()
+
+	itemsByOrder := make(map[int][]types.OrderItem)
+	if len(orderIDs) == 0 {
+		return itemsByOrder, nil
+	}
+
+	// Create placeholders for the IN clause
+	placeholders := make([]string, len(orderIDs))
+	args := make([]interface{}, len(orderIDs))
+	for i, id := range orderIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			oi.id,
+			oi.orderId,
+			oi.productId,
+			oi.variantId,
+			oi.productName,
+			oi.productImage,
+			oi.quantity,
+			oi.price,
+			p.id,
+			p.name,
+			p.description,
+			p.image,
+			p.price,
+			p.currency,
+			p.quantity,
+			p.createdAt
+		FROM order_items oi
+		LEFT JOIN products p ON oi.productId = p.id
+		WHERE oi.orderId IN (%s)
+		ORDER BY oi.orderId ASC, oi.id ASC
+	`, strings.Join(placeholders, ","))
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item types.OrderItem
+		var variantID sql.NullInt64
 		var productID sql.NullInt64
 		var productName sql.NullString
 		var productDesc sql.NullString
 		var productImage sql.NullString
 		var productPrice sql.NullFloat64
+		var productCurrency sql.NullString
 		var productQuantity sql.NullInt32
 		var productCreatedAt sql.NullTime
 
-		err := rows.Scan(
-			&order.ID,
-			&order.UserID,
-			&order.Total,
-			&order.Status,
-			&order.Address,
-			&order.CreatedAt,
-			&itemID,
-			&orderItem.OrderID,
-			&orderItem.ProductID,
-			&orderItem.Quantity,
-			&orderItem.Price,
+		if err := rows.Scan(
+			&item.ID,
+			&item.OrderID,
+			&item.ProductID,
+			&variantID,
+			&item.ProductName,
+			&item.ProductImage,
+			&item.Quantity,
+			&item.Price,
 			&productID,
 			&productName,
 			&productDesc,
 			&productImage,
 			&productPrice,
+			&productCurrency,
 			&productQuantity,
 			&productCreatedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			item.VariantID = &id
+		}
+		if productID.Valid {
+			item.Product = &types.Product{
+				ID:          int(productID.Int64),
+				Name:        productName.String,
+				Description: productDesc.String,
+				Image:       productImage.String,
+				Price:       types.Price(productPrice.Float64),
+				Currency:    productCurrency.String,
+				Quantity:    int(productQuantity.Int32),
+				CreatedAt:   productCreatedAt.Time,
+			}
+		}
+		itemsByOrder[item.OrderID] = append(itemsByOrder[item.OrderID], item)
+	}
+	return itemsByOrder, rows.Err()
+}
+
+// CreateReservation holds stock for the given items until the ttl elapses
+// Stock is moved out of each item's variant or product in a single transaction, so either every item is held or none are
+// Returns ErrInsufficientStock if any variant or product cannot cover the requested quantity
+func (s *Store) CreateReservation(ctx context.Context, userID int, items []types.CartItem, ttl time.Duration) (*types.Reservation, error) {
+	defer tracing.StartDBSpan(ctx, "CreateReservation").End()
+
+	now := time.Now()
+	reservation := &types.Reservation{
+		UserID:    userID,
+		Status:    "active",
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		Items:     make([]types.ReservationItem, 0, len(items)),
+	}
+
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		for _, item := range items {
+			if err := decrementStock(tx, item.ProductID, item.VariantID, item.Quantity); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(
+			"INSERT INTO reservations (userId, status, expiresAt, createdAt) VALUES (?, ?, ?, ?)",
+			reservation.UserID, reservation.Status, reservation.ExpiresAt, reservation.CreatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		reservation.ID = int(id)
 
-		// Get or create order in map
-		existingOrder, exists := ordersMap[order.ID]
-		if !exists {
-			order.Items = []types.OrderItem{}
-			ordersMap[order.ID] = &order
-			existingOrder = &order
-		}
-
-		// If there's an order item, add it to the order
-		if itemID.Valid {
-			orderItem.ID = int(itemID.Int64)
-			if productID.Valid {
-				product.ID = int(productID.Int64)
-				product.Name = productName.String
-				product.Description = productDesc.String
-				product.Image = productImage.String
-				product.Price = productPrice.Float64
-				product.Quantity = int(productQuantity.Int32)
-				product.CreatedAt = productCreatedAt.Time
-				orderItem.Product = &product
+		for _, item := range items {
+			if _, err := tx.Exec(
+				"INSERT INTO reservation_items (reservationId, productId, variantId, quantity) VALUES (?, ?, ?, ?)",
+				reservation.ID, item.ProductID, item.VariantID, item.Quantity,
+			); err != nil {
+				return err
 			}
-			existingOrder.Items = append(existingOrder.Items, orderItem)
+			reservation.Items = append(reservation.Items, types.ReservationItem{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity})
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
 	}
+	s.publishStock(productIDs)
+	return reservation, nil
+}
+
+// CreateReservedOrder places an order with the stock held by one of the order user's reservations
+// The order, its items and the consumed reservation are written in a single transaction,
+// so a checkout that fails part way never loses the held stock
+// Returns ErrReservationNotFound if the reservation is missing, expired, used or owned by another user
+func (s *Store) CreateReservedOrder(ctx context.Context, order *types.Order, reservationID int) error {
+	defer tracing.StartDBSpan(ctx, "CreateReservedOrder").End()
+
+	return db.WithTransaction(s.db, func(tx *db.Tx) error {
+		var id int
+		err := tx.QueryRow(
+			"SELECT id FROM reservations WHERE id = ? AND userId = ? AND status = 'active' AND expiresAt > ? FOR UPDATE",
+			reservationID, order.UserID, time.Now(),
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := insertOrder(tx, order); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE reservations SET status = 'consumed' WHERE id = ?", id)
+		return err
+	})
+}
+
+// GetReservation returns one of a user's active reservations with the items it holds
+// Returns ErrReservationNotFound if the reservation is missing, expired, used or owned by another user
+func (s *Store) GetReservation(ctx context.Context, reservationID, userID int) (*types.Reservation, error) {
+	defer tracing.StartDBSpan(ctx, "GetReservation").End()
+
+	reservation := &types.Reservation{}
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		err := tx.QueryRow(`
+			SELECT id, userId, status, expiresAt, createdAt
+			FROM reservations
+			WHERE id = ? AND userId = ? AND status = 'active' AND expiresAt > ?
+		`, reservationID, userID, time.Now()).Scan(
+			&reservation.ID,
+			&reservation.UserID,
+			&reservation.Status,
+			&reservation.ExpiresAt,
+			&reservation.CreatedAt,
+		)
+		if err == sql.ErrNoRows {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
 
-	// Convert map to slice
-	orders := make([]types.Order, 0, len(ordersMap))
-	for _, order := range ordersMap {
-		orders = append(orders, *order)
+		reservation.Items, err = getReservationItems(tx, reservation.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return reservation, nil
+}
 
-	return orders, nil
+// ReleaseExpired returns the stock held by expired reservations back to their variants and products
+// Returns the number of reservations released
+func (s *Store) ReleaseExpired(ctx context.Context) (int, error) {
+	defer tracing.StartDBSpan(ctx, "ReleaseExpired").End()
+
+	var ids, productIDs []int
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		rows, err := tx.Query(
+			"SELECT id FROM reservations WHERE status = 'active' AND expiresAt <= ? FOR UPDATE",
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			items, err := releaseReservation(tx, id)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.publishStock(productIDs)
+	return len(ids), nil
+}
+
+// ReleaseReservation returns the stock held by one of a user's active reservations to its variants and products
+// Used when a checkout that reserved stock is abandoned before the order is placed
+// Returns ErrReservationNotFound if the user has no active reservation with the given ID
+func (s *Store) ReleaseReservation(ctx context.Context, reservationID, userID int) error {
+	defer tracing.StartDBSpan(ctx, "ReleaseReservation").End()
+
+	var items []types.ReservationItem
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		var id int
+		err := tx.QueryRow(
+			"SELECT id FROM reservations WHERE id = ? AND userId = ? AND status = 'active' FOR UPDATE",
+			reservationID, userID,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		items, err = releaseReservation(tx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+	s.publishStock(productIDs)
+	return nil
+}
+
+// releaseReservation restores the stock of a locked reservation and marks it released
+// Returns the items whose stock was restored
+func releaseReservation(tx *db.Tx, reservationID int) ([]types.ReservationItem, error) {
+	items, err := getReservationItems(tx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := incrementStock(tx, item.ProductID, item.VariantID, item.Quantity); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("UPDATE reservations SET status = 'released' WHERE id = ?", reservationID); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// getReservationItems loads the items held by a reservation within a transaction
+func getReservationItems(tx *db.Tx, reservationID int) ([]types.ReservationItem, error) {
+	rows, err := tx.Query("SELECT productId, variantId, quantity FROM reservation_items WHERE reservationId = ?", reservationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []types.ReservationItem{}
+	for rows.Next() {
+		var item types.ReservationItem
+		var variantID sql.NullInt64
+		if err := rows.Scan(&item.ProductID, &variantID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			item.VariantID = &id
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetOrdersByProductID returns a page of the orders containing the given product, newest first
+// Each order carries all of its items; the total counts every matching order
+func (s *Store) GetOrdersByProductID(ctx context.Context, productID, page, limit int) ([]types.Order, int, error) {
+	defer tracing.StartDBSpan(ctx, "GetOrdersByProductID").End()
+
+	var total int
+	countQuery := "SELECT COUNT(DISTINCT orderId) FROM order_items WHERE productId = ?"
+	if err := s.db.QueryRow(countQuery, productID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting orders for product: %w", err)
+	}
+
+	query := `
+		SELECT o.id, o.userId, o.total, o.currency, o.shippingCost, o.shippingMethod, o.taxRate, o.taxAmount, o.status, o.address, o.country, o.createdAt
+		FROM orders o
+		JOIN (SELECT DISTINCT orderId FROM order_items WHERE productId = ?) oi ON oi.orderId = o.id
+		ORDER BY o.createdAt DESC, o.id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.db.Query(query, productID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying orders for product: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []types.Order{}
+	orderIDs := []int{}
+	for rows.Next() {
+		var order types.Order
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Total,
+			&order.Currency,
+			&order.ShippingCost,
+			&order.ShippingMethod,
+			&order.TaxRate,
+			&order.TaxAmount,
+			&order.Status,
+			&order.Address,
+			&order.Country,
+			&order.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	items, err := s.GetOrderItems(ctx, orderIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range orders {
+		orders[i].Items = items[orders[i].ID]
+		if orders[i].Items == nil {
+			orders[i].Items = []types.OrderItem{}
+		}
+	}
+	return orders, total, nil
+}
+
+// GetPurchasedProducts returns the distinct products a user has ordered, most recently purchased first
+// Cancelled orders don't count as purchases
+func (s *Store) GetPurchasedProducts(ctx context.Context, userID int) ([]types.PurchasedProduct, error) {
+	defer tracing.StartDBSpan(ctx, "GetPurchasedProducts").End()
+
+	query := `
+		SELECT p.id, p.name, p.image, p.price, p.currency, MAX(o.createdAt) AS lastPurchasedAt
+		FROM orders o
+		JOIN order_items oi ON oi.orderId = o.id
+		JOIN products p ON p.id = oi.productId
+		WHERE o.userId = ? AND o.status <> 'cancelled'
+		GROUP BY p.id, p.name, p.image, p.price, p.currency
+		ORDER BY lastPurchasedAt DESC, p.id DESC
+	`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying purchased products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []types.PurchasedProduct{}
+	for rows.Next() {
+		var product types.PurchasedProduct
+		if err := rows.Scan(&product.ProductID, &product.Name, &product.Image, &product.Price, &product.Currency, &product.LastPurchasedAt); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// UpdateOrderItem changes the quantity of a product, or of one of its variants, in a pending order
+// The item, the variant or product stock and the order tax and total are updated in a single transaction
+// Returns ErrOrderItemNotFound, ErrOrderNotPending or ErrInsufficientStock if the change is not possible
+func (s *Store) UpdateOrderItem(ctx context.Context, orderID, productID int, variantID *int, newQuantity int) error {
+	defer tracing.StartDBSpan(ctx, "UpdateOrderItem").End()
+
+	var quantity int
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		var status string
+		err := tx.QueryRow("SELECT status FROM orders WHERE id = ? FOR UPDATE", orderID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return ErrOrderItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != "pending" {
+			return ErrOrderNotPending
+		}
+
+		var itemID int
+		// <=> also matches the item of the product itself, whose variantId is NULL
+		err = tx.QueryRow(
+			"SELECT id, quantity FROM order_items WHERE orderId = ? AND productId = ? AND variantId <=> ? FOR UPDATE",
+			orderID, productID, variantID,
+		).Scan(&itemID, &quantity)
+		if err == sql.ErrNoRows {
+			return ErrOrderItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// move the difference between the old and new quantity in or out of stock
+		if delta := newQuantity - quantity; delta > 0 {
+			if err := decrementStock(tx, productID, variantID, delta); err != nil {
+				return err
+			}
+		} else if delta < 0 {
+			if err := incrementStock(tx, productID, variantID, -delta); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE order_items SET quantity = ? WHERE id = ?", newQuantity, itemID); err != nil {
+			return err
+		}
+		// tax is recalculated at the rate charged at checkout, MySQL assigns left to right so the total sees the new tax
+		_, err = tx.Exec(`
+			UPDATE orders
+			SET taxAmount = ROUND((SELECT SUM(quantity * price) FROM order_items WHERE orderId = ?) * taxRate, 2),
+				total = shippingCost + taxAmount + (SELECT SUM(quantity * price) FROM order_items WHERE orderId = ?)
+			WHERE id = ?
+		`, orderID, orderID, orderID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if newQuantity != quantity {
+		s.publishStock([]int{productID})
+	}
+	return nil
 }
@@ -0,0 +1,1469 @@
+package cart
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/cmd/migrate/migrations"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/services/products"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/gorilla/mux"
+)
+
+// TestReservationStore walks a reservation through reserve, expire and restore
+func TestReservationStore(t *testing.T) {
+	t.Run("reserve decrements stock for every item", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(2, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(1, 2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO reservations").
+			WithArgs(5, "active", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectExec("INSERT INTO reservation_items").
+			WithArgs(10, 1, nil, 2).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO reservation_items").
+			WithArgs(10, 2, nil, 1).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		items := []types.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}}
+		reservation, err := store.CreateReservation(context.Background(), 5, items, time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if reservation.ID != 10 || len(reservation.Items) != 2 {
+			t.Errorf("Unexpected reservation: %+v", reservation)
+		}
+		if !reservation.ExpiresAt.After(time.Now()) {
+			t.Error("Expected reservation to expire in the future")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("reserve rolls back when stock is insufficient", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(2, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(9, 2, 9).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		items := []types.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 9}}
+		_, err = store.CreateReservation(context.Background(), 5, items, time.Minute)
+		if !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected ErrInsufficientStock, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("expired reservations restore stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM reservations").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectQuery("SELECT productId, variantId, quantity FROM reservation_items").
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"productId", "variantId", "quantity"}).AddRow(1, nil, 2).AddRow(2, nil, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity \\+ \\?").
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity \\+ \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE reservations SET status = 'released'").
+			WithArgs(10).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		released, err := store.ReleaseExpired(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if released != 1 {
+			t.Errorf("Expected 1 released reservation, got %d", released)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("released reservation restores stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM reservations WHERE id = \\? AND userId = \\? AND status = 'active'").
+			WithArgs(10, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectQuery("SELECT productId, variantId, quantity FROM reservation_items").
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"productId", "variantId", "quantity"}).AddRow(1, nil, 2))
+		mock.ExpectExec("UPDATE products SET quantity = quantity \\+ \\?").
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE reservations SET status = 'released'").
+			WithArgs(10).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.ReleaseReservation(context.Background(), 10, 5); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("expired reservation cannot be loaded", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, userId, status, expiresAt, createdAt FROM reservations").
+			WithArgs(10, 5, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "status", "expiresAt", "createdAt"}))
+		mock.ExpectRollback()
+
+		_, err = store.GetReservation(context.Background(), 10, 5)
+		if !errors.Is(err, ErrReservationNotFound) {
+			t.Errorf("Expected ErrReservationNotFound, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestGetOrderItems verifies items from a single query are grouped by their order
+func TestGetOrderItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{
+		"id", "orderId", "productId", "variantId", "productName", "productImage", "quantity", "price",
+		"id", "name", "description", "image", "price", "currency", "quantity", "createdAt",
+	}
+	now := time.Now()
+	mock.ExpectQuery("FROM order_items oi .* WHERE oi.orderId IN \\(\\?,\\?,\\?\\)").
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(10, 1, 100, nil, "Product 100", "img", 2, 9.99, 100, "Product 100", "Desc", "img", 9.99, "USD", 5, now).
+			AddRow(11, 1, 101, nil, "Product 101", "img", 1, 19.99, 101, "Product 101", "Desc", "img", 19.99, "USD", 3, now).
+			AddRow(12, 3, 102, nil, "Deleted Product", "img", 4, 9.99, nil, nil, nil, nil, nil, nil, nil, nil))
+
+	items, err := store.GetOrderItems(context.Background(), []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(items[1]) != 2 {
+		t.Errorf("Expected 2 items for order 1, got %d", len(items[1]))
+	}
+	if _, ok := items[2]; ok {
+		t.Error("Expected order 2 to have no items")
+	}
+	if len(items[3]) != 1 {
+		t.Fatalf("Expected 1 item for order 3, got %d", len(items[3]))
+	}
+	if items[1][1].Product == nil || items[1][1].Product.Name != "Product 101" {
+		t.Errorf("Expected product details on order item, got %+v", items[1][1].Product)
+	}
+	if items[3][0].Product != nil {
+		t.Error("Expected no product details when the product no longer exists")
+	}
+	if items[3][0].ProductName != "Deleted Product" {
+		t.Errorf("Expected the snapshot name to survive product deletion, got %q", items[3][0].ProductName)
+	}
+	for orderID, orderItems := range items {
+		for _, item := range orderItems {
+			if item.OrderID != orderID {
+				t.Errorf("Item %d grouped under order %d but belongs to order %d", item.ID, orderID, item.OrderID)
+			}
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetOrdersByProductID verifies matching orders are paged and loaded with their items
+func TestGetOrdersByProductID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT COUNT\\(DISTINCT orderId\\) FROM order_items WHERE productId = \\?").
+		WithArgs(100).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery("FROM orders o\\s+JOIN \\(SELECT DISTINCT orderId FROM order_items WHERE productId = \\?\\)").
+		WithArgs(100, 5, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "total", "currency", "shippingCost", "shippingMethod", "taxRate", "taxAmount", "status", "address", "country", "createdAt"}).
+			AddRow(2, 1, 25.0, "USD", 5.0, "standard", 0.0, 0.0, "pending", "1 Test Street", "US", now).
+			AddRow(1, 1, 15.0, "USD", 5.0, "standard", 0.0, 0.0, "completed", "1 Test Street", "US", now))
+	mock.ExpectQuery("FROM order_items oi .* WHERE oi.orderId IN \\(\\?,\\?\\)").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "orderId", "productId", "variantId", "productName", "productImage", "quantity", "price",
+			"id", "name", "description", "image", "price", "currency", "quantity", "createdAt",
+		}).AddRow(10, 2, 100, nil, "Product 100", "img", 2, 10.0, 100, "Product 100", "Desc", "img", 10.0, "USD", 5, now))
+
+	orders, total, err := store.GetOrdersByProductID(context.Background(), 100, 2, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 7 {
+		t.Errorf("Expected total 7, got %d", total)
+	}
+	if len(orders) != 2 || orders[0].ID != 2 {
+		t.Fatalf("Unexpected orders: %+v", orders)
+	}
+	if len(orders[0].Items) != 1 || orders[1].Items == nil || len(orders[1].Items) != 0 {
+		t.Errorf("Unexpected order items: %+v / %+v", orders[0].Items, orders[1].Items)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetOrdersUsesProductSnapshot verifies a renamed product doesn't change the items of past orders
+func TestGetOrdersUsesProductSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	// The order was placed when the product was called "Old Name"; it has since been renamed
+	now := time.Now()
+	mock.ExpectQuery("FROM orders o WHERE o.userId = \\?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(5, 1, 20.0, "USD", 0.0, "standard", 0.0, 0.0, "pending", "1 Test Street", "US", now))
+	mock.ExpectQuery("FROM order_items oi .* WHERE oi.orderId IN \\(\\?\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(orderItemColumns).AddRow(
+			10, 5, 100, nil, "Old Name", "old.jpg", 2, 10.0,
+			100, "New Name", "Desc", "new.jpg", 12.0, "USD", 3, now,
+		))
+
+	orders, err := store.GetOrders(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(orders) != 1 || len(orders[0].Items) != 1 {
+		t.Fatalf("Unexpected orders: %+v", orders)
+	}
+	item := orders[0].Items[0]
+	if item.ProductName != "Old Name" || item.ProductImage != "old.jpg" {
+		t.Errorf("Expected the purchase-time snapshot, got name %q and image %q", item.ProductName, item.ProductImage)
+	}
+	if item.Product == nil || item.Product.Name != "New Name" {
+		t.Errorf("Expected the current product details alongside the snapshot, got %+v", item.Product)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateOrderItem(t *testing.T) {
+	t.Run("rejects orders that are not pending", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("completed"))
+		mock.ExpectRollback()
+
+		if err := store.UpdateOrderItem(context.Background(), 1, 7, nil, 3); !errors.Is(err, ErrOrderNotPending) {
+			t.Fatalf("Expected ErrOrderNotPending, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("updates item, stock and total of a pending order", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending"))
+		mock.ExpectQuery("SELECT id, quantity FROM order_items").
+			WithArgs(1, 7, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(4, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\? WHERE id = \\? AND quantity >= \\?").
+			WithArgs(2, 7, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE order_items SET quantity = \\? WHERE id = \\?").
+			WithArgs(3, 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE orders\\s+SET taxAmount = ROUND\\(.*\\s+total = shippingCost \\+ taxAmount").
+			WithArgs(1, 1, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.UpdateOrderItem(context.Background(), 1, 7, nil, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("returns stock to the variant of the item", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending"))
+		mock.ExpectQuery("SELECT id, quantity FROM order_items WHERE orderId = \\? AND productId = \\? AND variantId <=> \\?").
+			WithArgs(1, 7, 70).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(4, 3))
+		mock.ExpectExec("UPDATE product_variants SET quantity = quantity \\+ \\? WHERE id = \\?").
+			WithArgs(2, 70).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE order_items SET quantity = \\? WHERE id = \\?").
+			WithArgs(1, 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE orders").
+			WithArgs(1, 1, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		variantID := 70
+		if err := store.UpdateOrderItem(context.Background(), 1, 7, &variantID, 1); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rejects quantities above available stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders WHERE id = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending"))
+		mock.ExpectQuery("SELECT id, quantity FROM order_items").
+			WithArgs(1, 7, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(4, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+			WithArgs(99, 7, 99).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := store.UpdateOrderItem(context.Background(), 1, 7, nil, 100); !errors.Is(err, ErrInsufficientStock) {
+			t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestCreateReservedOrder verifies the reservation is only consumed in the transaction that stores the order
+func TestCreateReservedOrder(t *testing.T) {
+	newOrder := func() *types.Order {
+		return &types.Order{UserID: 5, Total: 20, Status: "pending", Address: "1 Test Street", Items: []types.OrderItem{{ProductID: 1, ProductName: "Product 1", Quantity: 2, Price: 10}}}
+	}
+
+	t.Run("order and reservation are written together", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM reservations .* FOR UPDATE").
+			WithArgs(10, 5, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(42, 1))
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(42, 1, nil, "Product 1", "", 2, types.Price(10)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE reservations SET status = 'consumed'").
+			WithArgs(10).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order := newOrder()
+		if err := store.CreateReservedOrder(context.Background(), order, 10); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if order.ID != 42 || order.Items[0].OrderID != 42 {
+			t.Errorf("Expected the order and its items to get ID 42, got %+v", order)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("failed item leaves the reservation active", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM reservations .* FOR UPDATE").
+			WithArgs(10, 5, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(42, 1))
+		mock.ExpectExec("INSERT INTO order_items").WillReturnError(fmt.Errorf("connection reset"))
+		mock.ExpectRollback()
+
+		if err := store.CreateReservedOrder(context.Background(), newOrder(), 10); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("expired reservation places no order", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM reservations .* FOR UPDATE").
+			WithArgs(10, 5, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		if err := store.CreateReservedOrder(context.Background(), newOrder(), 10); !errors.Is(err, ErrReservationNotFound) {
+			t.Errorf("Expected ErrReservationNotFound, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestCreateOrders verifies bulk orders are placed in one transaction that rolls back if any order fails
+func TestCreateOrders(t *testing.T) {
+	newOrders := func() []*types.Order {
+		return []*types.Order{
+			{UserID: 1, Total: 20, Status: "pending", Address: "1 Test Street", Items: []types.OrderItem{{ProductID: 1, ProductName: "Product 1", Quantity: 2, Price: 10}}},
+			{UserID: 1, Total: 30, Status: "pending", Address: "2 Test Street", Items: []types.OrderItem{{ProductID: 2, ProductName: "Product 2", Quantity: 3, Price: 10}}},
+		}
+	}
+
+	t.Run("places every order", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\? WHERE id = \\? AND quantity >= \\?").
+			WithArgs(2, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(7, 1, nil, "Product 1", "", 2, types.Price(10)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE products SET quantity = quantity - \\? WHERE id = \\? AND quantity >= \\?").
+			WithArgs(3, 2, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(8, 1))
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(8, 2, nil, "Product 2", "", 3, types.Price(10)).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		orders := newOrders()
+		if err := store.CreateOrders(context.Background(), orders); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if orders[0].ID != 7 || orders[1].ID != 8 || orders[1].Items[0].OrderID != 8 {
+			t.Errorf("Unexpected order IDs: %+v %+v", orders[0], orders[1])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back when an order runs out of stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products").WithArgs(2, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO order_items").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE products").WithArgs(3, 2, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = store.CreateOrders(context.Background(), newOrders())
+		var bulkErr *BulkOrderError
+		if !errors.As(err, &bulkErr) || bulkErr.Index != 1 || !errors.Is(err, ErrInsufficientStock) {
+			t.Fatalf("Expected insufficient stock for order 1, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back when the database refuses negative stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE products").
+			WithArgs(2, 1, 2).
+			WillReturnError(&mysql.MySQLError{Number: 1690, Message: "BIGINT UNSIGNED value is out of range in '(`gommerce`.`products`.`quantity` - 2)'"})
+		mock.ExpectRollback()
+
+		err = store.CreateOrders(context.Background(), newOrders())
+		var bulkErr *BulkOrderError
+		if !errors.As(err, &bulkErr) || bulkErr.Index != 0 || !errors.Is(err, ErrInsufficientStock) {
+			t.Fatalf("Expected insufficient stock for order 0, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("takes variant stock from the variant", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		variantID := 7
+		order := &types.Order{UserID: 1, Total: 24, Status: "pending", Address: "1 Test Street", Items: []types.OrderItem{
+			{ProductID: 1, VariantID: &variantID, ProductName: "T-Shirt", Quantity: 2, Price: 12},
+		}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE product_variants SET quantity = quantity - \\? WHERE id = \\? AND productId = \\? AND quantity >= \\?").
+			WithArgs(2, 7, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO order_items").
+			WithArgs(7, 1, 7, "T-Shirt", "", 2, types.Price(12)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		if err := store.CreateOrders(context.Background(), []*types.Order{order}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back when a variant runs out of stock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		variantID := 7
+		order := &types.Order{UserID: 1, Items: []types.OrderItem{{ProductID: 1, VariantID: &variantID, Quantity: 2, Price: 12}}}
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE product_variants").WithArgs(2, 7, 1, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := store.CreateOrders(context.Background(), []*types.Order{order}); !errors.Is(err, ErrInsufficientStock) {
+			t.Fatalf("Expected insufficient stock, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestGetOrdersByStatus checks the status filter is only added to the query when a status is given
+func TestGetOrdersByStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT COUNT\\(DISTINCT o.id\\) FROM orders o WHERE o.userId = \\? AND o.status = \\?").
+		WithArgs(1, "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("WHERE o.userId = \\? AND o.status = \\? ORDER BY o.createdAt DESC, o.id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(1, "pending", 10, 0).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(5, 1, 20.0, "USD", 0.0, "standard", 0.0, 0.0, "pending", "1 Test Street", "US", now))
+	mock.ExpectQuery("FROM order_items oi .* WHERE oi.orderId IN \\(\\?\\)").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(orderItemColumns).AddRow(
+			10, 5, 100, nil, "Product", "product.jpg", 2, 10.0,
+			100, "Product", "Desc", "product.jpg", 10.0, "USD", 3, now,
+		))
+
+	orders, total, err := store.GetOrdersByStatus(context.Background(), 1, "pending", 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 1 || len(orders) != 1 || orders[0].Status != "pending" || len(orders[0].Items) != 1 {
+		t.Errorf("Unexpected orders: %+v of %d", orders, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestExportOrdersDateRange checks the date range is applied in the query and each row is handed on as it is read
+func TestExportOrdersDateRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("WHERE o.userId = \\? AND o.createdAt >= \\? AND o.createdAt < \\? GROUP BY .* ORDER BY o.createdAt ASC, o.id ASC").
+		WithArgs(1, from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "createdAt", "status", "total", "itemCount"}).
+			AddRow(3, from, "completed", 42.5, 3).
+			AddRow(4, from.Add(time.Hour), "pending", 10.0, 0))
+
+	var summaries []types.OrderSummary
+	err = store.ExportOrders(context.Background(), 1, from, to, func(summary types.OrderSummary) error {
+		summaries = append(summaries, summary)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].ID != 3 || summaries[0].ItemCount != 3 || summaries[1].Status != "pending" {
+		t.Errorf("Unexpected summaries: %+v", summaries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetOrdersByStatusPage checks a page of orders is picked before loading their items, keeping the orders newest first
+func TestGetOrdersByStatusPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT COUNT\\(DISTINCT o.id\\) FROM orders o WHERE o.userId = \\?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery("FROM orders o WHERE o.userId = \\? ORDER BY o.createdAt DESC, o.id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(1, 3, 3).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow(9, 1, 20.0, "USD", 0.0, "standard", 0.0, 0.0, "pending", "1 Test Street", "US", now).
+			AddRow(4, 1, 10.0, "USD", 0.0, "standard", 0.0, 0.0, "completed", "1 Test Street", "US", now.Add(-time.Hour)).
+			AddRow(2, 1, 10.0, "USD", 0.0, "standard", 0.0, 0.0, "completed", "1 Test Street", "US", now.Add(-2*time.Hour)))
+	mock.ExpectQuery("FROM order_items oi .* WHERE oi.orderId IN \\(\\?,\\?,\\?\\)").
+		WithArgs(9, 4, 2).
+		WillReturnRows(sqlmock.NewRows(orderItemColumns).
+			AddRow(11, 2, 100, nil, "Product", "product.jpg", 1, 10.0,
+				100, "Product", "Desc", "product.jpg", 10.0, "USD", 3, now).
+			AddRow(12, 4, 100, nil, "Product", "product.jpg", 1, 10.0,
+				100, "Product", "Desc", "product.jpg", 10.0, "USD", 3, now).
+			AddRow(20, 9, 100, nil, "Product", "product.jpg", 1, 10.0,
+				100, "Product", "Desc", "product.jpg", 10.0, "USD", 3, now).
+			AddRow(21, 9, 101, nil, "Other", "other.jpg", 1, 10.0,
+				101, "Other", "Desc", "other.jpg", 10.0, "USD", 3, now))
+
+	orders, total, err := store.GetOrdersByStatus(context.Background(), 1, "", 2, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 7 || len(orders) != 3 {
+		t.Fatalf("Expected 3 of 7 orders, got %d of %d", len(orders), total)
+	}
+	if orders[0].ID != 9 || orders[1].ID != 4 || orders[2].ID != 2 || len(orders[0].Items) != 2 {
+		t.Errorf("Expected orders 9, 4 and 2 in query order with their items, got %+v", orders)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// orderColumns are the columns loadOrders reads for each order
+var orderColumns = []string{"id", "userId", "total", "currency", "shippingCost", "shippingMethod", "taxRate", "taxAmount", "status", "address", "country", "createdAt"}
+
+// orderItemColumns are the columns GetOrderItems reads for each item and its current product
+var orderItemColumns = []string{
+	"id", "orderId", "productId", "variantId", "productName", "productImage", "quantity", "price",
+	"id", "name", "description", "image", "price", "currency", "quantity", "createdAt",
+}
+
+// loadOrdersJoined loads the orders matching where, newest first, with their items in a single joined query
+// The join returns one row per item, so an order is read again for each of its items; it is only kept here
+// to check loadOrders against and to benchmark the two
+// With a limit of 0 every matching order is loaded, otherwise only the given page
+func (s *Store) loadOrdersJoined(where string, args []interface{}, page, limit int) ([]types.Order, error) {
+	// Paging applies to orders rather than to the joined item rows, so the page is picked in a subquery
+	from := "orders o"
+	if limit > 0 {
+		from = `(SELECT o.id FROM orders o ` + where + ` ORDER BY o.createdAt DESC, o.id ASC LIMIT ? OFFSET ?) page
+		JOIN orders o ON o.id = page.id`
+		where = ""
+		args = append(args[:len(args):len(args)], limit, (page-1)*limit)
+	}
+
+	query := `
+		SELECT 
+			o.id, 
+			o.userId, 
+			o.total, 
+			o.currency, 
+			o.shippingCost, 
+			o.shippingMethod, 
+			o.taxRate, 
+			o.taxAmount, 
+			o.status, 
+			o.address, 
+			o.country, 
+			o.createdAt,
+			oi.id as item_id, 
+			oi.orderId, 
+			oi.productId, 
+			oi.variantId, 
+			oi.productName, 
+			oi.productImage, 
+			oi.quantity, 
+			oi.price,
+			p.id as product_id, 
+			p.name as product_name, 
+			p.description as product_description, 
+			p.image as product_image, 
+			p.price as product_price, 
+			p.currency as product_currency, 
+			p.quantity as product_quantity, 
+			p.createdAt as product_createdAt
+		FROM ` + from + `
+		LEFT JOIN order_items oi ON o.id = oi.orderId
+		LEFT JOIN products p ON oi.productId = p.id
+		` + where + `
+		ORDER BY o.createdAt DESC, o.id ASC, oi.id ASC
+	`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Orders are kept in the order of the query, the map finds the order an item row belongs to
+	orders := []*types.Order{}
+	ordersMap := make(map[int]*types.Order)
+
+	for rows.Next() {
+		var order types.Order
+		var orderItem types.OrderItem
+		var product types.Product
+		// Item columns are NULL for an order without items
+		var itemID sql.NullInt64
+		var itemOrderID sql.NullInt64
+		var itemProductID sql.NullInt64
+		var itemVariantID sql.NullInt64
+		var itemProductName sql.NullString
+		var itemProductImage sql.NullString
+		var itemQuantity sql.NullInt64
+		var itemPrice sql.NullFloat64
+		var productID sql.NullInt64
+		var productName sql.NullString
+		var productDesc sql.NullString
+		var productImage sql.NullString
+		var productPrice sql.NullFloat64
+		var productCurrency sql.NullString
+		var productQuantity sql.NullInt32
+		var productCreatedAt sql.NullTime
+
+		err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Total,
+			&order.Currency,
+			&order.ShippingCost,
+			&order.ShippingMethod,
+			&order.TaxRate,
+			&order.TaxAmount,
+			&order.Status,
+			&order.Address,
+			&order.Country,
+			&order.CreatedAt,
+			&itemID,
+			&itemOrderID,
+			&itemProductID,
+			&itemVariantID,
+			&itemProductName,
+			&itemProductImage,
+			&itemQuantity,
+			&itemPrice,
+			&productID,
+			&productName,
+			&productDesc,
+			&productImage,
+			&productPrice,
+			&productCurrency,
+			&productQuantity,
+			&productCreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Get or create order in map
+		existingOrder, exists := ordersMap[order.ID]
+		if !exists {
+			order.Items = []types.OrderItem{}
+			ordersMap[order.ID] = &order
+			orders = append(orders, &order)
+			existingOrder = &order
+		}
+
+		// If there's an order item, add it to the order
+		if itemID.Valid {
+			orderItem.ID = int(itemID.Int64)
+			orderItem.OrderID = int(itemOrderID.Int64)
+			orderItem.ProductID = int(itemProductID.Int64)
+			if itemVariantID.Valid {
+				variantID := int(itemVariantID.Int64)
+				orderItem.VariantID = &variantID
+			}
+			orderItem.ProductName = itemProductName.String
+			orderItem.ProductImage = itemProductImage.String
+			orderItem.Quantity = int(itemQuantity.Int64)
+			orderItem.Price = types.Price(itemPrice.Float64)
+			if productID.Valid {
+				product.ID = int(productID.Int64)
+				product.Name = productName.String
+				product.Description = productDesc.String
+				product.Image = productImage.String
+				product.Price = types.Price(productPrice.Float64)
+				product.Currency = productCurrency.String
+				product.Quantity = int(productQuantity.Int32)
+				product.CreatedAt = productCreatedAt.Time
+				orderItem.Product = &product
+			}
+			existingOrder.Items = append(existingOrder.Items, orderItem)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]types.Order, len(orders))
+	for i, order := range orders {
+		result[i] = *order
+	}
+	return result, nil
+}
+
+// joinedOrderColumns are the columns loadOrdersJoined reads for each order and item pair
+var joinedOrderColumns = []string{
+	"id", "userId", "total", "currency", "shippingCost", "shippingMethod", "taxRate", "taxAmount", "status", "address", "country", "createdAt",
+	"item_id", "orderId", "productId", "variantId", "productName", "productImage", "quantity", "price",
+	"product_id", "product_name", "product_description", "product_image", "product_price", "product_currency", "product_quantity", "product_createdAt",
+}
+
+// orderFixtures builds orders newest first, each with the given number of items, all for user 1
+// Every third item's product has been deleted, so its current product details are missing,
+// and the item before each of those was ordered as a variant of its product
+func orderFixtures(orderCount, itemsPerOrder int) []types.Order {
+	now := time.Now().Truncate(time.Second)
+	orders := make([]types.Order, orderCount)
+	for i := range orders {
+		orderID := orderCount - i
+		order := types.Order{
+			ID: orderID, UserID: 1, Total: 10, Currency: "USD", ShippingCost: 5, ShippingMethod: "standard", Status: "pending",
+			Address: "1 Test Street", Country: "US", CreatedAt: now.Add(-time.Duration(i) * time.Hour), Items: []types.OrderItem{},
+		}
+		for j := 0; j < itemsPerOrder; j++ {
+			productID := 100 + j
+			item := types.OrderItem{
+				ID: orderID*1000 + j, OrderID: orderID, ProductID: productID, ProductName: fmt.Sprintf("Product %d", productID),
+				ProductImage: "product.jpg", Quantity: 1 + j%3, Price: 10,
+			}
+			if j%3 == 1 {
+				variantID := productID * 10
+				item.VariantID = &variantID
+			}
+			if j%3 != 2 {
+				item.Product = &types.Product{
+					ID: productID, Name: item.ProductName, Description: "Desc", Image: "product.jpg",
+					Price: 12, Currency: "USD", Quantity: 5, CreatedAt: now,
+				}
+			}
+			order.Items = append(order.Items, item)
+		}
+		orders[i] = order
+	}
+	return orders
+}
+
+// orderRow is the order part of a row read by loadOrders or loadOrdersJoined
+func orderRow(order types.Order) []driver.Value {
+	return []driver.Value{
+		order.ID, order.UserID, float64(order.Total), order.Currency, float64(order.ShippingCost), order.ShippingMethod,
+		order.TaxRate, float64(order.TaxAmount), order.Status, order.Address, order.Country, order.CreatedAt,
+	}
+}
+
+// orderItemRow is the item part of a row read by GetOrderItems or loadOrdersJoined, NULL where the product is gone
+func orderItemRow(item types.OrderItem) []driver.Value {
+	var variantID driver.Value
+	if item.VariantID != nil {
+		variantID = *item.VariantID
+	}
+	row := []driver.Value{item.ID, item.OrderID, item.ProductID, variantID, item.ProductName, item.ProductImage, item.Quantity, float64(item.Price)}
+	if item.Product == nil {
+		return append(row, nil, nil, nil, nil, nil, nil, nil, nil)
+	}
+	p := item.Product
+	return append(row, p.ID, p.Name, p.Description, p.Image, float64(p.Price), p.Currency, p.Quantity, p.CreatedAt)
+}
+
+// joinedOrderRows are the rows loadOrdersJoined reads for orders, one per item and one for each order without items
+func joinedOrderRows(orders []types.Order) *sqlmock.Rows {
+	rows := sqlmock.NewRows(joinedOrderColumns)
+	for _, order := range orders {
+		if len(order.Items) == 0 {
+			rows.AddRow(append(orderRow(order), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)...)
+		}
+		for _, item := range order.Items {
+			rows.AddRow(append(orderRow(order), orderItemRow(item)...)...)
+		}
+	}
+	return rows
+}
+
+// expectLoadOrders sets up the two queries loadOrders runs for orders
+func expectLoadOrders(mock sqlmock.Sqlmock, orders []types.Order) {
+	orderRows := sqlmock.NewRows(orderColumns)
+	itemRows := sqlmock.NewRows(orderItemColumns)
+	for _, order := range orders {
+		orderRows.AddRow(orderRow(order)...)
+	}
+	// GetOrderItems sorts by order ID, the fixtures are newest first
+	for i := len(orders) - 1; i >= 0; i-- {
+		for _, item := range orders[i].Items {
+			itemRows.AddRow(orderItemRow(item)...)
+		}
+	}
+	mock.ExpectQuery("SELECT o.id, o.userId, .* FROM orders o WHERE").WillReturnRows(orderRows)
+	if len(orders) > 0 {
+		mock.ExpectQuery("FROM order_items oi").WillReturnRows(itemRows)
+	}
+}
+
+// TestLoadOrdersMatchesJoined checks the two-query loader returns exactly what the joined query does
+func TestLoadOrdersMatchesJoined(t *testing.T) {
+	withoutItems := orderFixtures(3, 2)
+	withoutItems[1].Items = []types.OrderItem{}
+
+	testCases := []struct {
+		name   string
+		orders []types.Order
+		page   int
+		limit  int
+	}{
+		{name: "every order", orders: orderFixtures(4, 3), page: 1, limit: 0},
+		{name: "a page of orders", orders: orderFixtures(2, 5), page: 2, limit: 2},
+		{name: "an order without items", orders: withoutItems, page: 1, limit: 0},
+		{name: "no orders", orders: []types.Order{}, page: 1, limit: 10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db)
+
+			mock.ExpectQuery("LEFT JOIN order_items oi").WillReturnRows(joinedOrderRows(tc.orders))
+			expectLoadOrders(mock, tc.orders)
+
+			where, args := "WHERE o.userId = ?", []interface{}{1}
+			joined, err := store.loadOrdersJoined(where, args, tc.page, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error from the joined query: %v", err)
+			}
+			loaded, err := store.loadOrders(context.Background(), where, args, tc.page, tc.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error from the two queries: %v", err)
+			}
+			if !reflect.DeepEqual(joined, tc.orders) {
+				t.Errorf("Joined query returned %+v, expected %+v", joined, tc.orders)
+			}
+			if !reflect.DeepEqual(loaded, joined) {
+				t.Errorf("Two queries returned %+v, the joined query %+v", loaded, joined)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// BenchmarkLoadOrders compares loading a page of orders with many items through the join and through two queries
+// sqlmock stands in for the database, so this measures the rows scanned and assembled rather than MySQL itself
+func BenchmarkLoadOrders(b *testing.B) {
+	for _, size := range []struct{ orders, items int }{{10, 1}, {10, 50}} {
+		orders := orderFixtures(size.orders, size.items)
+		where, args := "WHERE o.userId = ?", []interface{}{1}
+
+		b.Run(fmt.Sprintf("joined/%d items", size.items), func(b *testing.B) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				b.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				mock.ExpectQuery("LEFT JOIN order_items oi").WillReturnRows(joinedOrderRows(orders))
+				b.StartTimer()
+				if _, err := store.loadOrdersJoined(where, args, 1, size.orders); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("two-query/%d items", size.items), func(b *testing.B) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				b.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db)
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				expectLoadOrders(mock, orders)
+				b.StartTimer()
+				if _, err := store.loadOrders(context.Background(), where, args, 1, size.orders); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestPublishStock checks stock levels are published once a stock change commits, and not when it rolls back
+func TestPublishStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+	bus := events.NewInventoryBus()
+	store.SetInventoryBus(bus)
+	updates, unsubscribe := bus.Subscribe(10)
+	defer unsubscribe()
+
+	// the reservation fails on its second product, so nothing is published
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+		WithArgs(2, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET quantity = quantity - \\?").
+		WithArgs(1, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	items := []types.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}}
+	if _, err := store.CreateReservation(context.Background(), 5, items, time.Minute); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	if len(updates) != 0 {
+		t.Fatalf("Expected no stock updates after a rollback, got %d", len(updates))
+	}
+
+	// releasing a reservation publishes the restored stock of its products
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM reservations").
+		WithArgs(10, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery("SELECT productId, variantId, quantity FROM reservation_items").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"productId", "variantId", "quantity"}).AddRow(1, nil, 2))
+	mock.ExpectExec("UPDATE products SET quantity = quantity \\+ \\?").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE reservations SET status = 'released'").
+		WithArgs(10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, quantity FROM products WHERE id IN").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "quantity"}).AddRow(1, 7))
+
+	if err := store.ReleaseReservation(context.Background(), 10, 5); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case update := <-updates:
+		if update.ProductID != 1 || update.Quantity != 7 {
+			t.Errorf("Unexpected stock update %+v", update)
+		}
+	default:
+		t.Error("Expected a stock update for product 1")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetPurchasedProducts checks purchased products are grouped per product in the query and scanned with their latest purchase
+func TestGetPurchasedProducts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	latest := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("WHERE o.userId = \\? AND o.status <> 'cancelled'\\s+GROUP BY p.id").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "image", "price", "currency", "lastPurchasedAt"}).
+			AddRow(7, "Coffee Beans", "https://example.com/beans.jpg", 12.5, "USD", latest).
+			AddRow(2, "Mug", "https://example.com/mug.jpg", 8.0, "USD", latest.Add(-time.Hour)))
+
+	products, err := store.GetPurchasedProducts(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 || products[0].ProductID != 7 || !products[0].LastPurchasedAt.Equal(latest) || products[1].Name != "Mug" {
+		t.Errorf("Unexpected purchased products: %+v", products)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetPurchasedProductsMySQL checks against a real MySQL database that a product bought in several orders is listed once,
+// with the date of its latest purchase, and that cancelled orders don't count
+// It migrates the database named by TEST_MYSQL_DSN, e.g. user:pass@tcp(localhost:3306)/gommerce_test, and is skipped when it's unset
+func TestGetPurchasedProductsMySQL(t *testing.T) {
+	conn := openMySQL(t)
+	store := NewStore(conn)
+
+	// a unique tag keeps other rows in the database out of the way
+	tag := "buy" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	result, err := conn.Exec("INSERT INTO users (firstName, lastName, email, password) VALUES ('Jane', 'Doe', ?, 'hash')", tag+"@example.com")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	userID, _ := result.LastInsertId()
+	t.Cleanup(func() { conn.Exec("DELETE FROM users WHERE id = ?", userID) })
+
+	productIDs := make([]int, 3)
+	for i := range productIDs {
+		result, err := conn.Exec(
+			"INSERT INTO products (name, description, image, price, quantity) VALUES (?, 'A product', 'https://example.com/p.jpg', 10, 100)",
+			fmt.Sprintf("Product %d %s", i, tag),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		productIDs[i] = int(id)
+		t.Cleanup(func() { conn.Exec("DELETE FROM products WHERE id = ?", id) })
+	}
+
+	// product 0 is bought three times, product 1 once and product 2 only in a cancelled order
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	purchases := []struct {
+		products  []int
+		status    string
+		createdAt time.Time
+	}{
+		{products: []int{productIDs[0]}, status: "completed", createdAt: first},
+		{products: []int{productIDs[0], productIDs[1]}, status: "completed", createdAt: first.Add(24 * time.Hour)},
+		{products: []int{productIDs[0]}, status: "pending", createdAt: first.Add(48 * time.Hour)},
+		{products: []int{productIDs[2]}, status: "cancelled", createdAt: first.Add(72 * time.Hour)},
+	}
+	for _, purchase := range purchases {
+		order := &types.Order{UserID: int(userID), Total: 10, Currency: "USD", Status: purchase.status, Address: "1 Test Street"}
+		for _, productID := range purchase.products {
+			order.Items = append(order.Items, types.OrderItem{ProductID: productID, ProductName: "Product", Quantity: 1, Price: 10})
+		}
+		if err := store.CreateOrders(context.Background(), []*types.Order{order}); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		t.Cleanup(func() {
+			conn.Exec("DELETE FROM order_items WHERE orderId = ?", order.ID)
+			conn.Exec("DELETE FROM orders WHERE id = ?", order.ID)
+		})
+		if _, err := conn.Exec("UPDATE orders SET createdAt = ? WHERE id = ?", purchase.createdAt, order.ID); err != nil {
+			t.Fatalf("Failed to date order: %v", err)
+		}
+	}
+
+	products, err := store.GetPurchasedProducts(context.Background(), int(userID))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 distinct products, got %+v", products)
+	}
+	if products[0].ProductID != productIDs[0] || !products[0].LastPurchasedAt.Equal(first.Add(48*time.Hour)) {
+		t.Errorf("Expected product %d last bought on %v first, got %+v", productIDs[0], first.Add(48*time.Hour), products[0])
+	}
+	if products[1].ProductID != productIDs[1] || !products[1].LastPurchasedAt.Equal(first.Add(24*time.Hour)) {
+		t.Errorf("Expected product %d last bought on %v second, got %+v", productIDs[1], first.Add(24*time.Hour), products[1])
+	}
+}
+
+// TestVariantCheckoutMySQL checks against a real MySQL database that checking out a variant
+// takes its stock from the variant rather than the product and records the variant on the order item
+// It is skipped when TEST_MYSQL_DSN is unset
+func TestVariantCheckoutMySQL(t *testing.T) {
+	conn := openMySQL(t)
+	store := NewStore(conn)
+	productStore := products.NewStore(conn)
+
+	// a unique tag keeps other rows in the database out of the way
+	tag := "var" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	result, err := conn.Exec("INSERT INTO users (firstName, lastName, email, password) VALUES ('Jane', 'Doe', ?, 'hash')", tag+"@example.com")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	userID, _ := result.LastInsertId()
+	t.Cleanup(func() { conn.Exec("DELETE FROM users WHERE id = ?", userID) })
+
+	result, err = conn.Exec(
+		"INSERT INTO products (name, description, image, price, quantity) VALUES (?, 'A shirt', 'https://example.com/shirt.jpg', 10, 100)",
+		"Shirt "+tag,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	productID, _ := result.LastInsertId()
+	t.Cleanup(func() { conn.Exec("DELETE FROM products WHERE id = ?", productID) })
+
+	variant := &types.ProductVariant{ProductID: int(productID), SKU: tag + "-M", Attributes: map[string]string{"size": "M"}, Price: 15, Quantity: 3}
+	if err := productStore.CreateVariant(context.Background(), variant); err != nil {
+		t.Fatalf("Failed to create variant: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Exec("DELETE FROM reservation_items WHERE productId = ?", productID)
+		conn.Exec("DELETE FROM reservations WHERE userId = ?", userID)
+		conn.Exec("DELETE FROM order_items WHERE productId = ?", productID)
+		conn.Exec("DELETE FROM orders WHERE userId = ?", userID)
+		conn.Exec("DELETE FROM product_variants WHERE id = ?", variant.ID)
+	})
+
+	handler := NewHandler(store, productStore, productStore, store, &mockAddressStore{}, &mockGuestStore{}, events.NewEventBus(10))
+	router := mux.NewRouter()
+	router.HandleFunc("/order", handler.handleCheckout).Methods(http.MethodPost)
+	checkout := func(quantity int) *httptest.ResponseRecorder {
+		payload := types.CartCheckoutPayload{
+			Items:   []types.CartItem{{ProductID: int(productID), VariantID: &variant.ID, Quantity: quantity}},
+			Address: "1 Test Street",
+			Country: "US",
+		}
+		marshaled, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, "/order", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, int(userID)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	stock := func() (product, variant int) {
+		if err := conn.QueryRow("SELECT quantity FROM products WHERE id = ?", productID).Scan(&product); err != nil {
+			t.Fatalf("Failed to read product stock: %v", err)
+		}
+		if err := conn.QueryRow("SELECT quantity FROM product_variants WHERE productId = ?", productID).Scan(&variant); err != nil {
+			t.Fatalf("Failed to read variant stock: %v", err)
+		}
+		return product, variant
+	}
+
+	rr := checkout(2)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Data types.Order `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if productStock, variantStock := stock(); productStock != 100 || variantStock != 1 {
+		t.Errorf("Expected the variant's stock to drop to 1 and the product's to stay at 100, got %d and %d", variantStock, productStock)
+	}
+
+	order, err := store.GetOrderByID(context.Background(), response.Data.ID)
+	if err != nil {
+		t.Fatalf("Failed to load order: %v", err)
+	}
+	if len(order.Items) != 1 || order.Items[0].VariantID == nil || *order.Items[0].VariantID != variant.ID || order.Items[0].Price != 15 {
+		t.Errorf("Expected one item of variant %d at 15.00, got %+v", variant.ID, order.Items)
+	}
+
+	// only one unit of the variant is left, however much stock the product itself has
+	if rr := checkout(2); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	if productStock, variantStock := stock(); productStock != 100 || variantStock != 1 {
+		t.Errorf("Expected a refused checkout to leave stock alone, got product %d and variant %d", productStock, variantStock)
+	}
+}
+
+// openMySQL migrates the database named by TEST_MYSQL_DSN and returns a connection to it
+// The test is skipped when TEST_MYSQL_DSN is unset
+func openMySQL(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Invalid TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.ParseTime = true
+	cfg.MultiStatements = true
+
+	// the migrator closes its connection, so it gets one of its own
+	migrationDB, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	m, err := migrations.New(migrationDB)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	conn, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
@@ -0,0 +1,97 @@
+// Package events delivers domain events to asynchronous subscribers
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// EventType identifies what happened to an order
+type EventType string
+
+const (
+	OrderPlaced EventType = "order.placed"
+)
+
+// OrderEvent is published whenever something happens to an order
+type OrderEvent struct {
+	Type       EventType   `json:"type"`       // What happened to the order
+	Order      types.Order `json:"order"`      // The order the event is about
+	OccurredAt time.Time   `json:"occurredAt"` // When the event happened
+}
+
+// EventBus fans out order events to every registered subscriber
+// Events are queued on a buffered channel and delivered by a background goroutine,
+// so publishing never waits for subscribers to finish
+type EventBus struct {
+	events      chan OrderEvent
+	mu          sync.RWMutex
+	subscribers []func(OrderEvent)
+	wg          sync.WaitGroup // Tracks the dispatcher and in-flight deliveries
+}
+
+// NewEventBus creates an EventBus holding up to buffer queued events and starts its dispatcher
+func NewEventBus(buffer int) *EventBus {
+	bus := &EventBus{events: make(chan OrderEvent, buffer)}
+	bus.wg.Add(1)
+	go bus.dispatch()
+	return bus
+}
+
+// Subscribe registers a handler that is called for every published event
+// Handlers run concurrently, each in its own goroutine
+func (b *EventBus) Subscribe(handler func(OrderEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, handler)
+}
+
+// Publish queues an event for delivery
+// When the queue is full the event is dropped and logged rather than blocking the caller
+func (b *EventBus) Publish(event OrderEvent) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	select {
+	case b.events <- event:
+	default:
+		log.Printf("Event queue full, dropping %s event for order %d", event.Type, event.Order.ID)
+	}
+}
+
+// Close stops accepting events and waits until queued events have been delivered
+// Publish must not be called after Close
+func (b *EventBus) Close() {
+	close(b.events)
+	b.wg.Wait()
+}
+
+// dispatch delivers queued events to a snapshot of the current subscribers
+func (b *EventBus) dispatch() {
+	defer b.wg.Done()
+	for event := range b.events {
+		b.mu.RLock()
+		subscribers := make([]func(OrderEvent), len(b.subscribers))
+		copy(subscribers, b.subscribers)
+		b.mu.RUnlock()
+
+		for _, subscriber := range subscribers {
+			b.wg.Add(1)
+			go b.deliver(subscriber, event)
+		}
+	}
+}
+
+// deliver calls a single subscriber, keeping a panicking subscriber from taking down the bus
+func (b *EventBus) deliver(subscriber func(OrderEvent), event OrderEvent) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event subscriber panicked handling %s for order %d: %v", event.Type, event.Order.ID, r)
+		}
+	}()
+	subscriber(event)
+}
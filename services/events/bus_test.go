@@ -0,0 +1,115 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Run("fans out events to every subscriber", func(t *testing.T) {
+		bus := NewEventBus(10)
+
+		var mu sync.Mutex
+		received := map[string][]int{}
+		record := func(name string) func(OrderEvent) {
+			return func(event OrderEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				received[name] = append(received[name], event.Order.ID)
+			}
+		}
+		bus.Subscribe(record("email"))
+		bus.Subscribe(record("sms"))
+
+		bus.Publish(OrderEvent{Type: OrderPlaced, Order: types.Order{ID: 1}})
+		bus.Publish(OrderEvent{Type: OrderPlaced, Order: types.Order{ID: 2}})
+		bus.Close()
+
+		for _, name := range []string{"email", "sms"} {
+			if len(received[name]) != 2 {
+				t.Errorf("Expected %s subscriber to receive 2 events, got %v", name, received[name])
+			}
+		}
+	})
+
+	t.Run("a panicking subscriber does not stop the others", func(t *testing.T) {
+		bus := NewEventBus(10)
+
+		delivered := make(chan OrderEvent, 1)
+		bus.Subscribe(func(OrderEvent) { panic("boom") })
+		bus.Subscribe(func(event OrderEvent) { delivered <- event })
+
+		bus.Publish(OrderEvent{Type: OrderPlaced, Order: types.Order{ID: 1}})
+		bus.Close()
+
+		select {
+		case event := <-delivered:
+			if event.OccurredAt.IsZero() {
+				t.Error("Expected OccurredAt to be set on publish")
+			}
+		default:
+			t.Error("Expected the healthy subscriber to receive the event")
+		}
+	})
+}
+
+// mockMailer records the emails it is asked to send
+type mockMailer struct {
+	to, subject string
+}
+
+func (m *mockMailer) Send(email Email) error {
+	m.to, m.subject = email.To, email.Subject
+	return nil
+}
+
+// mockUserStore implements the types.UserStore interface for testing
+type mockUserStore struct {
+	types.UserStore
+}
+
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	return &types.User{ID: id, FirstName: "Test", Email: "test@example.com"}, nil
+}
+
+func TestEmailSubscriber(t *testing.T) {
+	mailer := &mockMailer{}
+	subscriber := NewEmailSubscriber(&mockUserStore{}, mailer)
+
+	subscriber.Handle(OrderEvent{Type: OrderPlaced, Order: types.Order{ID: 42, UserID: 1}})
+
+	if mailer.to != "test@example.com" {
+		t.Errorf("Expected email to test@example.com, got %q", mailer.to)
+	}
+	if mailer.subject != "Your order #42 has been placed" {
+		t.Errorf("Unexpected subject %q", mailer.subject)
+	}
+}
+
+// TestLogMailer checks the logged line names what the email is about without the recipient or contents
+func TestLogMailer(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	email := Email{To: "test@example.com", Subject: "Your order #42 has been placed", Body: "Hi Test", Event: string(OrderPlaced), RefID: 42}
+	if err := (LogMailer{}).Send(email); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.Contains(logged.String(), "order.placed 42") {
+		t.Errorf("Expected the event and order ID to be logged, got %q", logged.String())
+	}
+	for _, private := range []string{email.To, email.Subject, email.Body} {
+		if strings.Contains(logged.String(), private) {
+			t.Errorf("Expected %q not to be logged, got %q", private, logged.String())
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+// InventoryEvent reports a product's stock level after it changed
+type InventoryEvent struct {
+	ProductID int `json:"productID"` // Product whose stock changed
+	Quantity  int `json:"quantity"`  // Units in stock after the change
+}
+
+// InventoryBus fans out stock changes to whoever is watching, such as the admin inventory dashboard
+// Unlike EventBus, subscribers come and go, so each one gets its own buffered channel
+type InventoryBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan InventoryEvent]struct{}
+}
+
+// NewInventoryBus creates an InventoryBus with no subscribers
+func NewInventoryBus() *InventoryBus {
+	return &InventoryBus{subscribers: map[chan InventoryEvent]struct{}{}}
+}
+
+// Subscribe returns a channel receiving every event published from now on, holding up to buffer undelivered events
+// The returned function unsubscribes and closes the channel; it must be called once the subscriber is done
+func (b *InventoryBus) Subscribe(buffer int) (<-chan InventoryEvent, func()) {
+	events := make(chan InventoryEvent, buffer)
+	b.mu.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, events)
+			b.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber
+// A subscriber whose buffer is full misses the event rather than blocking the caller
+func (b *InventoryBus) Publish(event InventoryEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Printf("Inventory subscriber too slow, dropping stock update for product %d", event.ProductID)
+		}
+	}
+}
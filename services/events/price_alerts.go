@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// priceDrop is a batch of alerts triggered by a single price change
+type priceDrop struct {
+	product types.Product
+	alerts  []types.PriceAlert
+}
+
+// PriceAlertNotifier emails users whose price alerts were triggered by a price drop
+// Notifications are queued and sent by a background goroutine, so the price update never waits for email
+type PriceAlertNotifier struct {
+	queue  chan priceDrop
+	users  types.UserStore
+	alerts types.PriceAlertStore
+	mailer Mailer
+	wg     sync.WaitGroup
+}
+
+// NewPriceAlertNotifier creates a PriceAlertNotifier holding up to buffer queued price drops and starts its sender
+func NewPriceAlertNotifier(users types.UserStore, alerts types.PriceAlertStore, mailer Mailer, buffer int) *PriceAlertNotifier {
+	n := &PriceAlertNotifier{queue: make(chan priceDrop, buffer), users: users, alerts: alerts, mailer: mailer}
+	n.wg.Add(1)
+	go n.send()
+	return n
+}
+
+// Enqueue queues emails for the alerts triggered by the product's new price
+// When the queue is full the notifications are dropped and logged; the alerts stay unnotified,
+// so they are picked up again by the next price drop
+func (n *PriceAlertNotifier) Enqueue(product types.Product, alerts []types.PriceAlert) {
+	if len(alerts) == 0 {
+		return
+	}
+	select {
+	case n.queue <- priceDrop{product: product, alerts: alerts}:
+	default:
+		log.Printf("Price alert queue full, dropping %d alerts for product %d", len(alerts), product.ID)
+	}
+}
+
+// Close stops accepting price drops and waits until queued notifications have been sent
+// Enqueue must not be called after Close
+func (n *PriceAlertNotifier) Close() {
+	close(n.queue)
+	n.wg.Wait()
+}
+
+// send emails every queued alert and marks the ones that were sent as notified
+func (n *PriceAlertNotifier) send() {
+	defer n.wg.Done()
+	for drop := range n.queue {
+		notified := []int{}
+		for _, alert := range drop.alerts {
+			user, err := n.users.GetUserByID(context.Background(), alert.UserID)
+			if err != nil {
+				log.Printf("Error loading user %d for price alert %d: %v", alert.UserID, alert.ID, err)
+				continue
+			}
+
+			subject := fmt.Sprintf("%s is now %.2f", drop.product.Name, drop.product.Price)
+			body := fmt.Sprintf(
+				"Hi %s,\n\nGood news! %s has dropped to %.2f, at or below your target price of %.2f.\n",
+				user.FirstName, drop.product.Name, drop.product.Price, alert.TargetPrice,
+			)
+			email := Email{To: user.Email, Subject: subject, Body: body, Event: "price_alert.triggered", RefID: alert.ID}
+			if err := n.mailer.Send(email); err != nil {
+				log.Printf("Error sending price alert %d email: %v", alert.ID, err)
+				continue
+			}
+			notified = append(notified, alert.ID)
+		}
+		if err := n.alerts.MarkAlertsNotified(context.Background(), notified); err != nil {
+			log.Printf("Error marking price alerts %v as notified: %v", notified, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// Email is a plain-text email and what it is about
+type Email struct {
+	To      string // Recipient address
+	Subject string // Subject line
+	Body    string // Plain-text body
+	Event   string // What the email is about, e.g. order.placed
+	RefID   int    // ID of the order or price alert the email is about
+}
+
+// Mailer sends a plain-text email
+type Mailer interface {
+	Send(email Email) error
+}
+
+// LogMailer is a Mailer that writes emails to the log instead of sending them
+// It stands in until a real mail provider is configured
+// Recipients and contents are personal data, so only what the email is about is logged
+type LogMailer struct{}
+
+func (LogMailer) Send(email Email) error {
+	log.Printf("Email for %s %d", email.Event, email.RefID)
+	return nil
+}
+
+// EmailSubscriber emails the customer when their order is placed
+type EmailSubscriber struct {
+	users  types.UserStore
+	mailer Mailer
+}
+
+// NewEmailSubscriber creates an EmailSubscriber that looks up customers in users and sends through mailer
+func NewEmailSubscriber(users types.UserStore, mailer Mailer) *EmailSubscriber {
+	return &EmailSubscriber{users: users, mailer: mailer}
+}
+
+// Handle sends the order confirmation email for OrderPlaced events
+func (s *EmailSubscriber) Handle(event OrderEvent) {
+	if event.Type != OrderPlaced {
+		return
+	}
+
+	user, err := s.users.GetUserByID(context.Background(), event.Order.UserID)
+	if err != nil {
+		log.Printf("Error loading user %d for order %d email: %v", event.Order.UserID, event.Order.ID, err)
+		return
+	}
+
+	subject := fmt.Sprintf("Your order #%d has been placed", event.Order.ID)
+	body := fmt.Sprintf(
+		"Hi %s,\n\nThanks for your order! We've received order #%d totalling %.2f and will ship it to:\n%s\n",
+		user.FirstName, event.Order.ID, event.Order.Total, event.Order.Address,
+	)
+	email := Email{To: user.Email, Subject: subject, Body: body, Event: string(event.Type), RefID: event.Order.ID}
+	if err := s.mailer.Send(email); err != nil {
+		log.Printf("Error sending order %d email: %v", event.Order.ID, err)
+	}
+}
+
+// SMSSubscriber will text the customer about their order
+// It is a stub until an SMS provider is integrated and users have a phone number
+type SMSSubscriber struct{}
+
+// Handle logs the SMS that would be sent for OrderPlaced events
+func (SMSSubscriber) Handle(event OrderEvent) {
+	if event.Type != OrderPlaced {
+		return
+	}
+	log.Printf("SMS stub: order #%d for user %d has been placed", event.Order.ID, event.Order.UserID)
+}
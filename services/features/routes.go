@@ -0,0 +1,98 @@
+package features
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// Handler represents the feature flag HTTP handlers
+type Handler struct {
+	store     types.FeatureFlagStore // Interface for feature flag data operations
+	userStore types.UserStore        // Interface for user lookups in admin-only routes
+}
+
+// NewHandler creates a new instance of the feature flag Handler
+func NewHandler(store types.FeatureFlagStore, userStore types.UserStore) *Handler {
+	return &Handler{store: store, userStore: userStore}
+}
+
+// RegisterRoutes sets up the admin-only feature flag routes
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	requireAdmin := utils.RequireRole(h.userStore, types.RoleAdmin)
+	router.Handle("/admin/flags", requireAdmin(http.HandlerFunc(h.handleGetFlags))).Methods(http.MethodGet)
+	router.Handle("/admin/flags/{name}", requireAdmin(http.HandlerFunc(h.handleSetFlag))).Methods(http.MethodPut)
+	router.Handle(utils.MaintenancePath, requireAdmin(http.HandlerFunc(h.handleSetMaintenance))).Methods(http.MethodPost)
+}
+
+// handleGetFlags lists every feature flag that has been set
+func (h *Handler) handleGetFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.store.GetFlags(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "feature flags fetched successfully",
+		"data":    flags,
+	})
+}
+
+// handleSetFlag turns a feature on or off
+// The change is visible to this instance immediately and to others once their cache expires
+func (h *Handler) handleSetFlag(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if len(name) > 100 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("flag name must be at most 100 characters"))
+		return
+	}
+
+	var payload types.SetFeatureFlagPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	if err := h.store.SetFlag(r.Context(), name, *payload.Enabled); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.InvalidateFlag(name)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "feature flag updated successfully",
+		"data":    map[string]interface{}{"name": name, "enabled": *payload.Enabled},
+	})
+}
+
+// handleSetMaintenance turns maintenance mode on or off without a restart
+// Only this instance is affected, as the mode is held in memory
+func (h *Handler) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var payload types.SetMaintenancePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	utils.SetMaintenance(*payload.Enabled)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "maintenance mode updated successfully",
+		"data":    map[string]interface{}{"enabled": utils.MaintenanceEnabled()},
+	})
+}
@@ -0,0 +1,272 @@
+package features
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/testutil"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// TestFeatureFlagHandlers checks flags can only be managed by admins and that updates are stored
+func TestFeatureFlagHandlers(t *testing.T) {
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+
+	t.Run("Should only let admins set flags", func(t *testing.T) {
+		testCases := []struct {
+			name           string
+			userID         int
+			body           string
+			expectedStatus int
+		}{
+			{name: "admin enables a flag", userID: 1, body: `{"enabled": true}`, expectedStatus: http.StatusOK},
+			{name: "regular user", userID: 2, body: `{"enabled": true}`, expectedStatus: http.StatusForbidden},
+			{name: "missing enabled", userID: 1, body: `{}`, expectedStatus: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				store := &mockFeatureFlagStore{flags: map[string]bool{}}
+				router := mux.NewRouter()
+				NewHandler(store, userStore).RegisterRoutes(router)
+
+				req, err := http.NewRequest(http.MethodPut, "/admin/flags/reviews", bytes.NewBufferString(tc.body))
+				if err != nil {
+					t.Fatalf("Failed to create request: %v", err)
+				}
+				req.Header.Set("Authorization", authHeader(t, tc.userID))
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus == http.StatusOK && !store.flags["reviews"] {
+					t.Error("Expected the reviews flag to be enabled")
+				}
+			})
+		}
+	})
+
+	t.Run("Should list flags", func(t *testing.T) {
+		store := &mockFeatureFlagStore{flags: map[string]bool{"reviews": true}}
+		router := mux.NewRouter()
+		NewHandler(store, userStore).RegisterRoutes(router)
+
+		req, err := http.NewRequest(http.MethodGet, "/admin/flags", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", authHeader(t, 1))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var response struct {
+			Data []types.FeatureFlag `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(response.Data) != 1 || response.Data[0].Name != "reviews" || !response.Data[0].Enabled {
+			t.Errorf("Expected the enabled reviews flag, got %+v", response.Data)
+		}
+	})
+}
+
+// TestMaintenanceMode checks admins can toggle maintenance mode and the middleware follows the new state
+func TestMaintenanceMode(t *testing.T) {
+	defer utils.SetMaintenance(false)
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	router := mux.NewRouter()
+	router.Use(utils.MaintenanceMiddleware)
+	NewHandler(&mockFeatureFlagStore{flags: map[string]bool{}}, userStore).RegisterRoutes(router)
+	router.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet)
+
+	toggle := func(t *testing.T, userID int, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, http.MethodPost, utils.MaintenancePath, body, http.Header{"Authorization": {authHeader(t, userID)}})
+	}
+
+	steps := []struct {
+		name            string
+		userID          int
+		body            string
+		expectedStatus  int
+		expectedEnabled bool
+		productsStatus  int
+	}{
+		{name: "regular user", userID: 2, body: `{"enabled": true}`, expectedStatus: http.StatusForbidden, productsStatus: http.StatusOK},
+		{name: "missing enabled", userID: 1, body: `{}`, expectedStatus: http.StatusBadRequest, productsStatus: http.StatusOK},
+		{name: "admin turns maintenance on", userID: 1, body: `{"enabled": true}`, expectedStatus: http.StatusOK, expectedEnabled: true, productsStatus: http.StatusServiceUnavailable},
+		{name: "regular user during maintenance", userID: 2, body: `{"enabled": false}`, expectedStatus: http.StatusForbidden, expectedEnabled: true, productsStatus: http.StatusServiceUnavailable},
+		{name: "admin turns maintenance off", userID: 1, body: `{"enabled": false}`, expectedStatus: http.StatusOK, productsStatus: http.StatusOK},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			rr := toggle(t, step.userID, step.body)
+			if rr.Code != step.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", step.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if step.expectedStatus == http.StatusOK {
+				response := testutil.DecodeJSON[struct {
+					Data struct {
+						Enabled bool `json:"enabled"`
+					} `json:"data"`
+				}](t, rr.Body)
+				if response.Data.Enabled != step.expectedEnabled {
+					t.Errorf("Expected enabled %v in the response, got %v", step.expectedEnabled, response.Data.Enabled)
+				}
+			}
+			if utils.MaintenanceEnabled() != step.expectedEnabled {
+				t.Errorf("Expected maintenance mode %v, got %v", step.expectedEnabled, utils.MaintenanceEnabled())
+			}
+
+			rr = testutil.MakeRequest(t, router, http.MethodGet, "/products", nil)
+			if rr.Code != step.productsStatus {
+				t.Fatalf("Expected other routes to respond %d, got %d", step.productsStatus, rr.Code)
+			}
+			if step.productsStatus == http.StatusServiceUnavailable {
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Code != types.ErrCodeServiceUnavailable {
+					t.Errorf("Expected code %q, got %q", types.ErrCodeServiceUnavailable, response.Error.Code)
+				}
+			}
+		})
+	}
+
+	// Requests keep flowing while admins flip the mode, which -race checks is safe
+	t.Run("toggling while serving requests", func(t *testing.T) {
+		header := http.Header{"Authorization": {authHeader(t, 1)}}
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				req := httptest.NewRequest(http.MethodPost, utils.MaintenancePath, strings.NewReader(fmt.Sprintf(`{"enabled": %v}`, i%2 == 0)))
+				req.Header = header.Clone()
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}()
+			go func() {
+				defer wg.Done()
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products", nil))
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// mockFeatureFlagStore implements the types.FeatureFlagStore interface in memory
+type mockFeatureFlagStore struct {
+	flags map[string]bool
+}
+
+func (m *mockFeatureFlagStore) GetFlag(ctx context.Context, name string) (bool, error) {
+	return m.flags[name], nil
+}
+
+func (m *mockFeatureFlagStore) GetFlags(ctx context.Context) ([]types.FeatureFlag, error) {
+	flags := []types.FeatureFlag{}
+	for name, enabled := range m.flags {
+		flags = append(flags, types.FeatureFlag{Name: name, Enabled: enabled})
+	}
+	return flags, nil
+}
+
+func (m *mockFeatureFlagStore) SetFlag(ctx context.Context, name string, enabled bool) error {
+	m.flags[name] = enabled
+	return nil
+}
+
+// mockUserStore implements the types.UserStore interface for testing
+// Only GetUserByID is backed by data, which is all the role middleware needs
+type mockUserStore struct {
+	users map[int]*types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	return nil
+}
+
+func (m *mockUserStore) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	return []types.LoginEvent{}, 0, nil
+}
+
+func (m *mockUserStore) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	return []types.User{}, nil
+}
+
+func (m *mockUserStore) CountUsers(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) DeactivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) ActivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+// authHeader returns a valid Authorization header value for the given user ID
+func authHeader(t *testing.T, userID int) string {
+	t.Helper()
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return "Bearer " + token
+}
@@ -0,0 +1,71 @@
+// Package features contains the feature flag database operations and admin routes
+package features
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// Store represents the feature flag data store
+// It implements the types.FeatureFlagStore interface
+type Store struct {
+	db *sql.DB // Database connection
+}
+
+// NewStore creates a new instance of the feature flag Store
+// Takes a database connection as a parameter
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// GetFlag reports whether the named feature is enabled
+// A flag that has never been set is disabled
+func (s *Store) GetFlag(ctx context.Context, name string) (bool, error) {
+	defer tracing.StartDBSpan(ctx, "GetFlag").End()
+
+	var enabled bool
+	err := s.db.QueryRow("SELECT enabled FROM feature_flags WHERE name = ?", name).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// GetFlags retrieves every feature flag that has been set, ordered by name
+func (s *Store) GetFlags(ctx context.Context) ([]types.FeatureFlag, error) {
+	defer tracing.StartDBSpan(ctx, "GetFlags").End()
+
+	rows, err := s.db.Query("SELECT name, enabled, updatedAt FROM feature_flags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []types.FeatureFlag{}
+	for rows.Next() {
+		var flag types.FeatureFlag
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &flag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+// SetFlag turns the named feature on or off, creating the flag if it doesn't exist yet
+func (s *Store) SetFlag(ctx context.Context, name string, enabled bool) error {
+	defer tracing.StartDBSpan(ctx, "SetFlag").End()
+
+	query := `
+		INSERT INTO feature_flags (name, enabled) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)
+	`
+	_, err := s.db.Exec(query, name, enabled)
+	return err
+}
@@ -0,0 +1,177 @@
+package products
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+)
+
+// maxBatchProducts caps how many products can be created in one batch
+const maxBatchProducts = 100
+
+// handleBatchCreateProducts creates several products at once, for admins importing new inventory
+// Every product is checked with the rules of POST /products/create and the errors of all rejected ones are reported,
+// indexed by position; only when every product passes are they created, in a single transaction
+func (h *Handler) handleBatchCreateProducts(w http.ResponseWriter, r *http.Request) {
+	var payload types.BatchCreateProductsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(payload.Products) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at least one product is required"))
+		return
+	}
+	if len(payload.Products) > maxBatchProducts {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at most %d products can be created at once", maxBatchProducts))
+		return
+	}
+
+	// Conflicts are reported as 409 unless a product is also invalid, which makes the batch a bad request
+	status := http.StatusConflict
+	var productErrors []types.APIError
+	products := make([]*types.Product, len(payload.Products))
+	names, skus := make(map[string]int), make(map[string]int)
+	for i, productPayload := range payload.Products {
+		product, err := validateProductPayload(productPayload)
+		if err != nil {
+			status = http.StatusBadRequest
+			productErrors = append(productErrors, batchProductError(i, http.StatusBadRequest, err))
+			continue
+		}
+		product.Name = utils.SanitizeString(product.Name)
+		product.Description = utils.SanitizeString(product.Description)
+
+		// Names and SKUs must be unique within the batch as well as among existing products
+		if first, ok := names[strings.ToLower(product.Name)]; ok {
+			productErrors = append(productErrors, batchProductError(i, http.StatusConflict, fmt.Errorf("name is already used by product %d of the batch", first)))
+			continue
+		}
+		names[strings.ToLower(product.Name)] = i
+		if product.SKU != "" {
+			if first, ok := skus[strings.ToLower(product.SKU)]; ok {
+				productErrors = append(productErrors, batchProductError(i, http.StatusConflict, fmt.Errorf("sku is already used by product %d of the batch", first)))
+				continue
+			}
+			skus[strings.ToLower(product.SKU)] = i
+		}
+		if conflictStatus, err := h.checkProductUnique(r.Context(), product); err != nil {
+			if conflictStatus == http.StatusInternalServerError {
+				utils.WriteError(w, conflictStatus, err)
+				return
+			}
+			productErrors = append(productErrors, batchProductError(i, conflictStatus, err))
+			continue
+		}
+		products[i] = &product
+	}
+	if len(productErrors) > 0 {
+		utils.WriteError(w, status, types.APIError{
+			Code:    utils.ErrorCodeForStatus(status),
+			Message: fmt.Sprintf("no products were created, %d of %d were rejected", len(productErrors), len(payload.Products)),
+			Errors:  productErrors,
+		})
+		return
+	}
+
+	err := h.store.CreateProducts(r.Context(), products)
+	var batchErr *BatchProductError
+	switch {
+	case errors.As(err, &batchErr) && (errors.Is(err, ErrProductNameTaken) || errors.Is(err, ErrProductSKUTaken)):
+		utils.WriteError(w, http.StatusConflict, types.APIError{
+			Code:    types.ErrCodeConflict,
+			Message: "no products were created, 1 was rejected",
+			Errors:  []types.APIError{batchProductError(batchErr.Index, http.StatusConflict, batchErr.Err)},
+		})
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created := make([]int, len(products))
+	for i, product := range products {
+		created[i] = product.ID
+	}
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "products created successfully",
+		"data":    types.BatchCreateProductsResult{Created: created, Errors: []types.APIError{}},
+	})
+}
+
+// handleAdjustStock applies several stock adjustments at once, e.g. after a stocktake
+// Every adjustment is applied in a single transaction, so if any would make stock negative none are
+// Errors carry the index of the adjustment that failed
+func (h *Handler) handleAdjustStock(w http.ResponseWriter, r *http.Request) {
+	var adjustments []types.StockAdjustment
+	if err := utils.ParseJSON(r, &adjustments); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(adjustments) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at least one adjustment is required"))
+		return
+	}
+	if len(adjustments) > maxBatchProducts {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("at most %d adjustments can be applied at once", maxBatchProducts))
+		return
+	}
+
+	// Each product is adjusted once so its resulting quantity is unambiguous
+	seen := make(map[int]bool, len(adjustments))
+	for i, adjustment := range adjustments {
+		if err := utils.Validate.Struct(adjustment); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, batchProductError(i, http.StatusBadRequest, utils.ValidationError(err)))
+			return
+		}
+		if seen[adjustment.ProductID] {
+			utils.WriteError(w, http.StatusBadRequest, batchProductError(i, http.StatusBadRequest, fmt.Errorf("product %d is adjusted more than once", adjustment.ProductID)))
+			return
+		}
+		seen[adjustment.ProductID] = true
+	}
+
+	err := h.store.AdjustStockBatch(r.Context(), adjustments)
+	var batchErr *BatchProductError
+	switch {
+	case errors.As(err, &batchErr) && errors.Is(err, ErrNegativeStock):
+		utils.WriteError(w, http.StatusConflict, batchProductError(batchErr.Index, http.StatusConflict, batchErr.Err))
+		return
+	case errors.As(err, &batchErr) && errors.Is(err, sql.ErrNoRows):
+		utils.WriteError(w, http.StatusNotFound, batchProductError(batchErr.Index, http.StatusNotFound, fmt.Errorf("product with ID %d not found", adjustments[batchErr.Index].ProductID)))
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if h.inventory != nil {
+		for _, adjustment := range adjustments {
+			h.inventory.Publish(events.InventoryEvent{ProductID: adjustment.ProductID, Quantity: adjustment.Quantity})
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "stock adjusted successfully",
+		"data":    adjustments,
+	})
+}
+
+// batchProductError describes why one entry of a batch was rejected, recording its index
+func batchProductError(index, status int, err error) types.APIError {
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = types.APIError{Code: utils.ErrorCodeForStatus(status), Message: err.Error()}
+	}
+	apiErr.Message = fmt.Sprintf("product %d: %s", index, apiErr.Message)
+	apiErr.Index = &index
+	return apiErr
+}
@@ -0,0 +1,111 @@
+package products
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// cachedListing is a first page of the product listing and when it stops being served
+type cachedListing struct {
+	products  []types.Product
+	expiresAt time.Time
+}
+
+// CachedStore is a ProductStore that serves the first page of the unfiltered product listing from memory
+// Listings are cached for ttl per page size and dropped whenever a product is created or updated through
+// the store. Changes made elsewhere, e.g. stock taken by checkouts or new reviews, show once ttl has passed
+type CachedStore struct {
+	types.ProductStore
+
+	mu         sync.Mutex
+	ttl        time.Duration
+	listings   map[int]cachedListing // Cached listings by page size, 0 for the unpaginated listing
+	generation int                   // Bumped by every write, so a listing read before a write isn't cached after it
+	now        func() time.Time      // Overridable clock, used by tests
+}
+
+// NewCachedStore wraps store with a listing cache holding listings for ttl
+// A ttl of zero or less turns the cache off
+func NewCachedStore(store types.ProductStore, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		ProductStore: store,
+		ttl:          ttl,
+		listings:     make(map[int]cachedListing),
+		now:          time.Now,
+	}
+}
+
+// GetProductStock always reads the stock from the store, clients poll it to see stock change as it happens
+func (s *CachedStore) GetProductStock(ctx context.Context, id int) (int, error) {
+	return s.ProductStore.GetProductStock(ctx, id)
+}
+
+// GetProducts returns the first page of the unfiltered listing from the cache when it holds a fresh copy
+// Filtered listings and later pages are always read from the store
+func (s *CachedStore) GetProducts(ctx context.Context, filter types.ProductFilter) ([]types.Product, error) {
+	if s.ttl <= 0 || filter.InStock || filter.After != nil {
+		return s.ProductStore.GetProducts(ctx, filter)
+	}
+
+	s.mu.Lock()
+	listing, ok := s.listings[filter.Limit]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && s.now().Before(listing.expiresAt) {
+		return slices.Clone(listing.products), nil
+	}
+
+	products, err := s.ProductStore.GetProducts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		s.listings[filter.Limit] = cachedListing{products: slices.Clone(products), expiresAt: s.now().Add(s.ttl)}
+	}
+	return products, nil
+}
+
+// Invalidate drops every cached listing
+func (s *CachedStore) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	clear(s.listings)
+}
+
+// CreateProduct creates the product and drops the cached listings
+func (s *CachedStore) CreateProduct(ctx context.Context, product *types.Product) error {
+	defer s.Invalidate()
+	return s.ProductStore.CreateProduct(ctx, product)
+}
+
+// CreateProducts creates the products and drops the cached listings
+func (s *CachedStore) CreateProducts(ctx context.Context, products []*types.Product) error {
+	defer s.Invalidate()
+	return s.ProductStore.CreateProducts(ctx, products)
+}
+
+// AdjustStockBatch adjusts the stock and drops the cached listings
+func (s *CachedStore) AdjustStockBatch(ctx context.Context, adjustments []types.StockAdjustment) error {
+	defer s.Invalidate()
+	return s.ProductStore.AdjustStockBatch(ctx, adjustments)
+}
+
+// UpdateProductPrice changes the price and drops the cached listings
+func (s *CachedStore) UpdateProductPrice(ctx context.Context, id int, price types.Price) error {
+	defer s.Invalidate()
+	return s.ProductStore.UpdateProductPrice(ctx, id, price)
+}
+
+// SetFeatured features or unfeatures the product and drops the cached listings
+func (s *CachedStore) SetFeatured(ctx context.Context, productID int, featured bool) error {
+	defer s.Invalidate()
+	return s.ProductStore.SetFeatured(ctx, productID, featured)
+}
@@ -0,0 +1,109 @@
+package products
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+)
+
+// Number of products that can be compared at once
+const (
+	minCompareProducts = 2
+	maxCompareProducts = 4
+)
+
+// comparedFields are the product fields checked for differences, keyed by their JSON name
+var comparedFields = []struct {
+	name  string
+	value func(types.Product) interface{}
+}{
+	{"name", func(p types.Product) interface{} { return p.Name }},
+	{"description", func(p types.Product) interface{} { return p.Description }},
+	{"image", func(p types.Product) interface{} { return p.Image }},
+	{"price", func(p types.Product) interface{} { return p.Price }},
+	{"quantity", func(p types.Product) interface{} { return p.Quantity }},
+	{"averageRating", func(p types.Product) interface{} { return p.AverageRating }},
+	{"reviewCount", func(p types.Product) interface{} { return p.ReviewCount }},
+}
+
+// handleCompareProducts returns the products named by ?ids= side by side, with the fields they differ in
+// No authentication is required, like the featured listing, so shoppers can compare before signing in
+func (h *Handler) handleCompareProducts(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseCompareIDs(utils.GetStringParam(r, "ids", ""))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	products, err := h.store.GetProductsByIDs(r.Context(), ids)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// products come back in the order of ids, so the first gap is the first missing product
+	for i, id := range ids {
+		if i >= len(products) || products[i].ID != id {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "products compared successfully",
+		"data": map[string]interface{}{
+			"products":    products,
+			"differences": compareProducts(products),
+		},
+	})
+}
+
+// parseCompareIDs parses a comma-separated list of between minCompareProducts and maxCompareProducts distinct product IDs
+func parseCompareIDs(value string) ([]int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("ids is required")
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) < minCompareProducts || len(parts) > maxCompareProducts {
+		return nil, fmt.Errorf("between %d and %d product IDs can be compared", minCompareProducts, maxCompareProducts)
+	}
+
+	ids := make([]int, len(parts))
+	seen := make(map[int]bool, len(parts))
+	for i, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("product IDs must be positive integers")
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("product %d is listed more than once", id)
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// compareProducts lists the value of each product for every field that isn't the same across all of them
+// Values are in the same order as products, fields every product agrees on are left out
+func compareProducts(products []types.Product) map[string][]interface{} {
+	differences := map[string][]interface{}{}
+	for _, field := range comparedFields {
+		values := make([]interface{}, len(products))
+		differ := false
+		for i, product := range products {
+			values[i] = field.value(product)
+			if values[i] != values[0] {
+				differ = true
+			}
+		}
+		if differ {
+			differences[field.name] = values
+		}
+	}
+	return differences
+}
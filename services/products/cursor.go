@@ -0,0 +1,52 @@
+package products
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or was not issued by this server
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns a listing position into an opaque cursor for clients
+// The position is signed with the JWT secret so clients can't craft cursors of their own
+func encodeCursor(cursor types.ProductCursor) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d.%d", cursor.CreatedAt.UnixNano(), cursor.ID)),
+	)
+	return payload + "." + signCursor(payload)
+}
+
+// decodeCursor reads a cursor made by encodeCursor
+// Returns ErrInvalidCursor if the cursor can't be parsed or its signature doesn't match
+func decodeCursor(value string) (types.ProductCursor, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCursor(payload))) {
+		return types.ProductCursor{}, ErrInvalidCursor
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return types.ProductCursor{}, ErrInvalidCursor
+	}
+	var nanos int64
+	var id int
+	if n, err := fmt.Sscanf(string(decoded), "%d.%d", &nanos, &id); err != nil || n != 2 || id < 1 {
+		return types.ProductCursor{}, ErrInvalidCursor
+	}
+	return types.ProductCursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+func signCursor(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.Envs.JWTSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package products
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// maxFeaturedProducts is how many products the featured listing returns
+const maxFeaturedProducts = 20
+
+// handleGetFeaturedProducts lists the featured products, the most recently featured first
+// It needs no authentication so the storefront can show featured products to every visitor
+func (h *Handler) handleGetFeaturedProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.store.GetFeaturedProducts(r.Context(), maxFeaturedProducts)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "featured products fetched successfully",
+		"data":    products,
+	})
+}
+
+// handleFeatureProduct adds a product to the featured listing
+func (h *Handler) handleFeatureProduct(w http.ResponseWriter, r *http.Request) {
+	h.setFeatured(w, r, true)
+}
+
+// handleUnfeatureProduct removes a product from the featured listing
+func (h *Handler) handleUnfeatureProduct(w http.ResponseWriter, r *http.Request) {
+	h.setFeatured(w, r, false)
+}
+
+// setFeatured sets whether the product in the id path variable is featured and responds with the new state
+func (h *Handler) setFeatured(w http.ResponseWriter, r *http.Request, featured bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	err = h.store.SetFeatured(r.Context(), id, featured)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	message := "product featured successfully"
+	if !featured {
+		message = "product unfeatured successfully"
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": message,
+		"data":    map[string]interface{}{"id": id, "isFeatured": featured},
+	})
+}
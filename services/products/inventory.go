@@ -0,0 +1,62 @@
+package products
+
+import (
+	"log"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// inventoryBuffer is how many stock changes a slow dashboard can fall behind before it misses some
+const inventoryBuffer = 64
+
+// tokenFromQuery turns a ?token= query parameter into a bearer Authorization header
+// WebSocket clients in browsers can't set headers on the upgrade request, so they pass their JWT in the URL
+// A request that already has an Authorization header is left alone
+func tokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inventoryStream returns the WebSocket handler sending admins a JSON message per stock change,
+// such as {"productID": 1, "quantity": 5}
+// Any origin is accepted since the connection is authenticated by its token rather than by cookies
+func (h *Handler) inventoryStream() http.Handler {
+	return websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   h.streamInventory,
+	}
+}
+
+// streamInventory forwards stock changes to one dashboard connection until it is closed
+func (h *Handler) streamInventory(ws *websocket.Conn) {
+	defer ws.Close()
+
+	updates, unsubscribe := h.inventory.Subscribe(inventoryBuffer)
+	defer unsubscribe()
+
+	// the dashboard only listens, so a read returning means the connection was closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case update := <-updates:
+			if err := websocket.JSON.Send(ws, update); err != nil {
+				log.Printf("Error sending stock update to inventory dashboard: %v", err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package products
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Asif-Faizal/Gommerce/utils"
+)
+
+// Search radius of the nearby products listing, in kilometres
+const (
+	defaultNearbyRadiusKm = 50
+	maxNearbyRadiusKm     = 500
+)
+
+// handleGetNearbyProducts lists the products in stock at warehouses within ?radius= km of ?lat= and ?lng=, nearest first
+func (h *Handler) handleGetNearbyProducts(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if utils.GetStringParam(r, "lat", "") == "" || utils.GetStringParam(r, "lng", "") == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("lat and lng are required"))
+		return
+	}
+	latitude, err := utils.GetFloatParam(r, "lat", 0)
+	if err != nil || latitude < -90 || latitude > 90 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("lat must be a number between -90 and 90"))
+		return
+	}
+	longitude, err := utils.GetFloatParam(r, "lng", 0)
+	if err != nil || longitude < -180 || longitude > 180 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("lng must be a number between -180 and 180"))
+		return
+	}
+	radius, err := utils.GetFloatParam(r, "radius", defaultNearbyRadiusKm)
+	if err != nil || radius <= 0 || radius > maxNearbyRadiusKm {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("radius must be greater than 0 and at most %d km", maxNearbyRadiusKm))
+		return
+	}
+
+	products, err := h.warehouses.GetProductsNearby(r.Context(), latitude, longitude, radius)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "nearby products fetched successfully",
+		"data":    products,
+	})
+}
@@ -0,0 +1,132 @@
+package products
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/gorilla/mux"
+)
+
+// handleCreatePriceAlert asks for an email when the product drops to the target price
+// Setting a new target replaces the user's previous alert for the product
+func (h *Handler) handleCreatePriceAlert(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	id, ok := h.productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.CreatePriceAlertPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	alert := &types.PriceAlert{UserID: userId, ProductID: id, TargetPrice: types.Price(payload.TargetPrice)}
+	if err := h.alertStore.CreateAlert(r.Context(), alert); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "price alert created successfully",
+		"data":    alert,
+	})
+}
+
+// handleDeletePriceAlert stops watching the product's price
+func (h *Handler) handleDeletePriceAlert(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	err = h.alertStore.DeleteAlert(r.Context(), userId, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("no price alert for product %d", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "price alert deleted successfully",
+	})
+}
+
+// handleUpdateProductPrice changes a product's price
+// When the price drops, users whose target price it reaches are emailed in the background
+func (h *Handler) handleUpdateProductPrice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	var payload types.UpdateProductPricePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	product, err := h.store.GetProductByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	oldPrice := product.Price
+	product.Price = types.Price(payload.Price)
+	if err := h.store.UpdateProductPrice(r.Context(), id, product.Price); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the price is already saved, so a failure to look up alerts is only logged
+	if product.Price < oldPrice {
+		alerts, err := h.alertStore.GetAlertsForProduct(r.Context(), id, payload.Price)
+		if err != nil {
+			log.Printf("Error loading price alerts for product %d: %v", id, err)
+		} else {
+			h.priceAlerts.Enqueue(*product, alerts)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "product price updated successfully",
+		"data":    product,
+	})
+}
@@ -1,11 +1,22 @@
 package products
 
 import (
+	"context"
+	"crypto/md5"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/events"
 	"github.com/Asif-Faizal/Gommerce/types"
 	"github.com/Asif-Faizal/Gommerce/utils"
 	"github.com/gorilla/mux"
@@ -14,20 +25,69 @@ import (
 // Handler represents the user-related HTTP handlers
 // It contains methods to handle different user-related endpoints
 type Handler struct {
-	store types.ProductStore // Interface for user data operations
+	store       types.ProductStore         // Interface for user data operations
+	orderStore  types.OrderStore           // Interface for order data operations
+	userStore   types.UserStore            // Interface for user lookups in admin-only routes
+	reviewStore types.ReviewStore          // Interface for product review operations
+	imageStore  types.ImageStore           // Interface for product image gallery operations
+	alertStore  types.PriceAlertStore      // Interface for users' price drop alerts
+	warehouses  types.WarehouseStore       // Interface for stock held at warehouses
+	priceAlerts *events.PriceAlertNotifier // Emails users whose alerts a price drop triggers
+	inventory   *events.InventoryBus       // Stock changes streamed to the admin inventory dashboard
 }
 
 // NewHandler creates a new instance of the user Handler
 // This is a constructor function for the Handler struct
-func NewHandler(store types.ProductStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.ProductStore, orderStore types.OrderStore, userStore types.UserStore, reviewStore types.ReviewStore, imageStore types.ImageStore, alertStore types.PriceAlertStore, warehouses types.WarehouseStore, priceAlerts *events.PriceAlertNotifier, inventory *events.InventoryBus) *Handler {
+	return &Handler{store: store, orderStore: orderStore, userStore: userStore, reviewStore: reviewStore, imageStore: imageStore, alertStore: alertStore, warehouses: warehouses, priceAlerts: priceAlerts, inventory: inventory}
 }
 
 // RegisterRoutes sets up all the user-related routes
 // It takes a router and attaches the handler functions to specific paths
 func (h *Handler) ProductRoutes(router *mux.Router) {
 	router.HandleFunc("/products/create", h.handleCreateProduct).Methods(http.MethodPost)
-	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products", utils.AllowHead(h.handleGetProducts)).Methods(http.MethodGet, http.MethodHead)
+	// The comparison, compact, featured, nearby and search routes are registered first so "compare", "compact", "featured", "nearby" and "search" aren't matched as product IDs
+	router.HandleFunc("/products/compare", h.handleCompareProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/compact", h.handleGetProductSummaries).Methods(http.MethodGet)
+	router.HandleFunc("/products/featured", h.handleGetFeaturedProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/search", h.handleSearchProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/nearby", h.handleGetNearbyProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}", h.handleGetProduct).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}/related", h.handleGetRelatedProducts).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}/stock", h.handleGetProductStock).Methods(http.MethodGet)
+	router.HandleFunc("/products/sku/{sku}", h.handleGetProductBySKU).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}/reviews", h.handleCreateReview).Methods(http.MethodPost)
+	router.HandleFunc("/products/{id}/reviews", h.handleGetReviews).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}/price-alert", h.handleCreatePriceAlert).Methods(http.MethodPost)
+	router.HandleFunc("/products/{id}/price-alert", h.handleDeletePriceAlert).Methods(http.MethodDelete)
+
+	// Register the admin-only product order lookup - will handle GET requests to /api/v1/admin/products/{id}/orders
+	requireAdmin := utils.RequireRole(h.userStore, types.RoleAdmin)
+	router.Handle("/admin/products/{id}/orders", requireAdmin(http.HandlerFunc(h.handleGetProductOrders))).Methods(http.MethodGet)
+
+	// Register the admin-only batch product creation - will handle POST requests to /api/v1/admin/products/batch
+	router.Handle("/admin/products/batch", requireAdmin(http.HandlerFunc(h.handleBatchCreateProducts))).Methods(http.MethodPost)
+
+	// Register the admin-only bulk stock adjustment - will handle POST requests to /api/v1/products/stock-adjustments
+	router.Handle("/products/stock-adjustments", requireAdmin(http.HandlerFunc(h.handleAdjustStock))).Methods(http.MethodPost)
+
+	// Register the admin-only price update - will handle PUT requests to /api/v1/products/{id}/price
+	router.Handle("/products/{id}/price", requireAdmin(http.HandlerFunc(h.handleUpdateProductPrice))).Methods(http.MethodPut)
+
+	// Register the admin-only featured flag - will handle PUT and DELETE requests to /api/v1/admin/products/{id}/featured
+	router.Handle("/admin/products/{id}/featured", requireAdmin(http.HandlerFunc(h.handleFeatureProduct))).Methods(http.MethodPut)
+	router.Handle("/admin/products/{id}/featured", requireAdmin(http.HandlerFunc(h.handleUnfeatureProduct))).Methods(http.MethodDelete)
+
+	// Register the admin-only image gallery endpoints - will handle requests to /api/v1/products/{id}/images
+	// The reorder route is registered first so "reorder" isn't matched as an image ID
+	router.Handle("/products/{id}/images", requireAdmin(http.HandlerFunc(h.handleAddImage))).Methods(http.MethodPost)
+	router.Handle("/products/{id}/images/reorder", requireAdmin(http.HandlerFunc(h.handleReorderImages))).Methods(http.MethodPut)
+	router.Handle("/products/{id}/images/{imageID}", requireAdmin(http.HandlerFunc(h.handleDeleteImage))).Methods(http.MethodDelete)
+
+	// Register the admin-only inventory stream - will handle WebSocket upgrades at /api/v1/ws/admin/inventory
+	// Browsers can't set headers on a WebSocket upgrade, so the token comes from ?token=
+	router.Handle("/ws/admin/inventory", tokenFromQuery(requireAdmin(h.inventoryStream()))).Methods(http.MethodGet)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
@@ -40,19 +100,81 @@ func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("User %d requesting products list", userId)
 
-	products, err := h.store.GetProducts()
+	var filter types.ProductFilter
+	if value := r.URL.Query().Get("inStock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("inStock must be true or false"))
+			return
+		}
+		filter.InStock = inStock
+	}
+
+	// the listing is paged with a cursor when the client asks for one, otherwise every product is returned
+	query := r.URL.Query()
+	paginated := query.Has("cursor") || query.Has("limit")
+	limit := 0
+	if paginated {
+		_, limit, err = utils.ParsePagination(r)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if value := utils.GetStringParam(r, "cursor", ""); value != "" {
+			cursor, err := decodeCursor(value)
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			filter.After = &cursor
+		}
+		// one extra product tells us whether there is a next page
+		filter.Limit = limit + 1
+	}
+
+	products, err := h.store.GetProducts(r.Context(), filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+
+	var nextCursor *string
+	if paginated && len(products) > limit {
+		products = products[:limit]
+		last := products[limit-1]
+		next := encodeCursor(types.ProductCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		nextCursor = &next
+	}
+
+	// Let clients cache the listing and revalidate it cheaply with If-None-Match
+	serialized, err := json.Marshal(products)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// The ETag is weak: the JSON envelope around the products may change without the listing changing
+	etag := fmt.Sprintf(`W/"%x"`, md5.Sum(serialized))
+	// the listing is only served to authenticated callers, so shared caches must not store it
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	w.Header().Add("Vary", "Authorization")
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	response := map[string]interface{}{
 		"status":  "success",
 		"message": "products fetched successfully",
 		"data":    products,
-	})
+	}
+	if paginated {
+		response["nextCursor"] = nextCursor // null on the last page
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
 }
 
-func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleGetProduct(w http.ResponseWriter, r *http.Request) {
 	// Authenticate the request
 	userId, err := utils.AuthenticateRequest(r)
 	if err != nil {
@@ -60,55 +182,659 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("User %d attempting to create a product", userId)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
 
-	var product types.Product
-	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		log.Printf("Error decoding request body: %v", err)
+	log.Printf("User %d requesting product %d", userId, id)
+
+	product, err := h.store.GetProductByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	product.Images, err = h.imageStore.GetImagesByProduct(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "product fetched successfully",
+		"data":    product,
+	})
+}
+
+// handleGetProductBySKU returns the product with the given SKU
+// It needs no authentication so external warehouse management systems can look products up
+func (h *Handler) handleGetProductBySKU(w http.ResponseWriter, r *http.Request) {
+	sku := mux.Vars(r)["sku"]
+	if !skuPattern.MatchString(sku) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("sku must be at most 50 letters, digits or hyphens"))
+		return
+	}
+
+	product, err := h.store.GetProductBySKU(r.Context(), sku)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	product.Images, err = h.imageStore.GetImagesByProduct(r.Context(), product.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "product fetched successfully",
+		"data":    product,
+	})
+}
+
+// defaultRelatedLimit is how many related products are returned when ?limit= is omitted
+const defaultRelatedLimit = 4
+
+// handleGetRelatedProducts returns other products in the same category as a product, newest first
+// Uncategorized products get the newest other products; ?limit= caps how many, up to utils.MaxPageLimit
+func (h *Handler) handleGetRelatedProducts(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+	limit, err := utils.GetIntParam(r, "limit", defaultRelatedLimit)
+	if err != nil || limit < 1 || limit > utils.MaxPageLimit {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", utils.MaxPageLimit))
+		return
+	}
+
+	products, err := h.store.GetRelatedProducts(r.Context(), id, limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "related products fetched successfully",
+		"data":    products,
+	})
+}
+
+// handleGetProductStock returns how many units of a product are in stock, without the rest of the product
+// It requires authentication so the stock of the whole catalogue can't be scraped anonymously
+func (h *Handler) handleGetProductStock(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	quantity, err := h.store.GetProductStock(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "product stock fetched successfully",
+		"data":    types.ProductStock{ProductID: id, Quantity: quantity, InStock: quantity > 0},
+	})
+}
+
+// handleCreateReview lets the authenticated user rate a product from 1 to 5
+// Each user can review a product once; a second review is rejected with 409
+func (h *Handler) handleCreateReview(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	var payload types.CreateReviewPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.Rating < 1 || payload.Rating > 5 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("rating must be between 1 and 5"))
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	if _, err := h.store.GetProductByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	review := &types.Review{
+		UserID:    userId,
+		ProductID: id,
+		Rating:    payload.Rating,
+		Comment:   utils.SanitizeString(payload.Comment),
+	}
+	err = h.reviewStore.CreateReview(r.Context(), review)
+	if errors.Is(err, ErrAlreadyReviewed) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "review created successfully",
+		"data":    review,
+	})
+}
+
+// handleGetReviews returns the reviews of a product along with its average rating
+func (h *Handler) handleGetReviews(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	if _, err := h.store.GetProductByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	reviews, err := h.reviewStore.GetReviewsByProduct(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	average, err := h.reviewStore.GetAverageRating(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "reviews fetched successfully",
+		"data": map[string]interface{}{
+			"reviews":       reviews,
+			"averageRating": average,
+			"reviewCount":   len(reviews),
+		},
+	})
+}
+
+// handleAddImage adds an image to the end of a product's gallery
+func (h *Handler) handleAddImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.AddProductImagePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
 
-	log.Printf("Decoded product: %+v", product)
+	image := &types.ProductImage{ProductID: id, URL: payload.URL, IsPrimary: payload.IsPrimary}
+	if err := h.imageStore.AddImage(r.Context(), image); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "image added successfully",
+		"data":    image,
+	})
+}
+
+// handleDeleteImage removes an image from a product's gallery
+func (h *Handler) handleDeleteImage(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	imageID, err := strconv.Atoi(mux.Vars(r)["imageID"])
+	if err != nil || imageID < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("image ID must be a positive integer"))
+		return
+	}
+
+	err = h.imageStore.DeleteImage(r.Context(), id, imageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("image with ID %d not found for product %d", imageID, id))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "image deleted successfully",
+	})
+}
+
+// handleReorderImages sets the order of a product's gallery
+// The payload must list every image of the product exactly once
+func (h *Handler) handleReorderImages(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.productIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var payload types.ReorderProductImagesPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	err := h.imageStore.ReorderImages(r.Context(), id, payload.ImageIDs)
+	if errors.Is(err, ErrInvalidImageOrder) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	images, err := h.imageStore.GetImagesByProduct(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "images reordered successfully",
+		"data":    images,
+	})
+}
+
+// productIDFromPath parses the id path variable and checks the product exists
+// Writes the error response and returns false if the product can't be used
+func (h *Handler) productIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return 0, false
+	}
+	if _, err := h.store.GetProductByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return 0, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// handleGetProductOrders returns a page of the orders that contain a product, e.g. for recalls
+// Accepts optional page and limit query parameters
+func (h *Handler) handleGetProductOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("product ID must be a positive integer"))
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.store.GetProductByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("product with ID %d not found", id))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	orders, total, err := h.orderStore.GetOrdersByProductID(r.Context(), id, page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"message":    "product orders fetched successfully",
+		"data":       orders,
+		"pagination": utils.NewPagination(page, limit, total),
+	})
+}
+
+// maxSearchQueryLength caps the length of a product search query, in characters
+const maxSearchQueryLength = 200
+
+// handleSearchProducts returns a page of the products matching the full-text query ?q=, most relevant first
+func (h *Handler) handleSearchProducts(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	query := strings.TrimSpace(utils.GetStringParam(r, "q", ""))
+	if query == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q is required"))
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("q must not exceed %d characters", maxSearchQueryLength))
+		return
+	}
+	page, limit, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	products, total, err := h.store.SearchProducts(r.Context(), query, page, limit)
+	if errors.Is(err, ErrInvalidSearchQuery) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"message":    "products searched successfully",
+		"data":       products,
+		"pagination": utils.NewPagination(page, limit, total),
+	})
+}
+
+// handleGetProductSummaries returns a page of product IDs and names
+// It is meant for dropdowns, which don't need descriptions, prices or images
+func (h *Handler) handleGetProductSummaries(w http.ResponseWriter, r *http.Request) {
+	if _, err := utils.AuthenticateRequest(r); err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summaries, total, err := h.store.GetProductSummaries(r.Context(), page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"message":    "product summaries fetched successfully",
+		"data":       summaries,
+		"pagination": utils.NewPagination(page, limit, total),
+	})
+}
+
+// etagMatches reports whether an If-None-Match header value matches the given ETag
+// The header may hold a comma-separated list of ETags or "*"; tags are compared
+// using weak comparison, as If-None-Match requires, so the W/ prefix is ignored
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxProductImages caps the gallery a product can be created with
+const maxProductImages = 10
+
+// skuPattern matches a valid SKU: 1 to 50 letters, digits or hyphens
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,50}$`)
+
+// categoryPattern matches a valid category: 1 to 50 letters, digits, spaces, hyphens or ampersands
+var categoryPattern = regexp.MustCompile(`^[A-Za-z0-9 &-]{1,50}$`)
+
+// validateWarn is the ?validate= mode that returns ProductWarnings with a created product
+const validateWarn = "warn"
+
+// newGallery builds the gallery of a new product from the image URLs of its create request
+// The product's image comes first as the primary image, without a gallery no images are stored
+func newGallery(image string, urls []string) []types.ProductImage {
+	if len(urls) == 0 {
+		return nil
+	}
+	if image != "" {
+		// An image also listed in the gallery moves to the front rather than appearing twice
+		urls = append([]string{image}, slices.DeleteFunc(slices.Clone(urls), func(url string) bool { return url == image })...)
+	}
+
+	images := make([]types.ProductImage, len(urls))
+	for i, url := range urls {
+		images[i] = types.ProductImage{URL: url, SortOrder: i, IsPrimary: i == 0}
+	}
+	return images
+}
+
+// validateProductPayload checks a product create request against the product rules and normalizes it:
+// the currency defaults to the default currency, the SKU and category are trimmed and the gallery is built from the image URLs
+// Free-text fields are returned unescaped, callers sanitize them once they no longer need the original text
+func validateProductPayload(payload types.CreateProductPayload) (types.Product, error) {
+	product := payload.Product
 
 	// Validate required fields
 	if product.Name == "" {
-		log.Printf("Validation error: name is required")
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("name is required"))
-		return
+		return types.Product{}, fmt.Errorf("name is required")
 	}
 	if product.Description == "" {
-		log.Printf("Validation error: description is required")
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("description is required"))
-		return
+		return types.Product{}, fmt.Errorf("description is required")
+	}
+	if product.Image == "" && len(payload.Images) == 0 {
+		return types.Product{}, fmt.Errorf("image is required")
+	}
+	if product.Price <= 0 {
+		return types.Product{}, fmt.Errorf("price must be greater than 0")
+	}
+	if product.Quantity < 0 {
+		return types.Product{}, fmt.Errorf("quantity cannot be negative")
+	}
+	// Products without a currency are priced in the default one
+	product.Currency = strings.ToUpper(strings.TrimSpace(product.Currency))
+	if product.Currency == "" {
+		product.Currency = types.DefaultCurrency
+	}
+	if !types.Currencies[product.Currency] {
+		return types.Product{}, fmt.Errorf("currency %q is not supported", product.Currency)
+	}
+	// SKUs are optional, products without one are stored with none
+	product.SKU = strings.TrimSpace(product.SKU)
+	if product.SKU != "" && !skuPattern.MatchString(product.SKU) {
+		return types.Product{}, fmt.Errorf("sku must be at most 50 letters, digits or hyphens")
 	}
+	// Categories are optional too, uncategorized products are related to the newest products
+	product.Category = strings.TrimSpace(product.Category)
+	if product.Category != "" && !categoryPattern.MatchString(product.Category) {
+		return types.Product{}, fmt.Errorf("category must be at most 50 letters, digits, spaces, hyphens or ampersands")
+	}
+	if len(payload.Images) > maxProductImages {
+		return types.Product{}, fmt.Errorf("a product can have at most %d images", maxProductImages)
+	}
+	if err := utils.Validate.Var(payload.Images, "unique,dive,required,url,max=2048"); err != nil {
+		return types.Product{}, fmt.Errorf("images must be unique URLs")
+	}
+	product.Images = newGallery(product.Image, payload.Images)
 	if product.Image == "" {
-		log.Printf("Validation error: image is required")
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("image is required"))
+		product.Image = product.Images[0].URL
+	}
+
+	return product, nil
+}
+
+// checkProductUnique checks no existing product has the name or SKU of a new product
+// Returns 409 with ErrProductNameTaken or ErrProductSKUTaken when one does, and 500 when the lookup fails
+func (h *Handler) checkProductUnique(ctx context.Context, product types.Product) (int, error) {
+	existing, err := h.store.GetProductByName(ctx, product.Name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking product name: %v", err)
+		return http.StatusInternalServerError, err
+	}
+	if existing != nil {
+		return http.StatusConflict, ErrProductNameTaken
+	}
+	if product.SKU == "" {
+		return http.StatusOK, nil
+	}
+	existing, err = h.store.GetProductBySKU(ctx, product.SKU)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error checking product SKU: %v", err)
+		return http.StatusInternalServerError, err
+	}
+	if existing != nil {
+		return http.StatusConflict, ErrProductSKUTaken
+	}
+	return http.StatusOK, nil
+}
+
+func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
+	// Authenticate the request
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
-	if product.Price <= 0 {
-		log.Printf("Validation error: price must be greater than 0")
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("price must be greater than 0"))
+
+	log.Printf("User %d attempting to create a product", userId)
+
+	// ?validate=warn reports non-fatal issues with the product alongside it
+	validateMode := utils.GetStringParam(r, "validate", "")
+	if validateMode != "" && validateMode != validateWarn {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("validate must be %q", validateWarn))
 		return
 	}
-	if product.Quantity < 0 {
-		log.Printf("Validation error: quantity cannot be negative")
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("quantity cannot be negative"))
+
+	var payload types.CreateProductPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Printf("Decoded product: %+v", payload.Product)
+
+	product, err := validateProductPayload(payload)
+	if err != nil {
+		log.Printf("Validation error: %v", err)
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Check the product as the operator wrote it, before escaping changes its length
+	var warnings []string
+	if validateMode == validateWarn {
+		warnings = ProductWarnings(product)
+	}
+
+	// Escape free-text fields so they can't carry injected scripts
+	product.Name = utils.SanitizeString(product.Name)
+	product.Description = utils.SanitizeString(product.Description)
+
+	// Product names and SKUs must be unique so customers can tell products apart
+	if status, err := h.checkProductUnique(r.Context(), product); err != nil {
+		utils.WriteError(w, status, err)
 		return
 	}
 
 	log.Printf("Creating product in database")
-	if err := h.store.CreateProduct(&product); err != nil {
+	err = h.store.CreateProduct(r.Context(), &product)
+	if errors.Is(err, ErrProductNameTaken) || errors.Is(err, ErrProductSKUTaken) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
 		log.Printf("Error creating product: %v", err)
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	log.Printf("Product created successfully with ID: %d by user: %d", product.ID, userId)
-	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+	w.Header().Set("Location", fmt.Sprintf("%s%s/products/%d", config.Envs.BaseURL(), utils.APIPrefix, product.ID))
+	response := map[string]interface{}{
 		"status":  "success",
 		"message": "product created successfully",
 		"data":    product,
-	})
+	}
+	if warnings != nil {
+		response["warnings"] = warnings
+	}
+	utils.WriteJSON(w, http.StatusCreated, response)
 }
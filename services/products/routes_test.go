@@ -1,17 +1,29 @@
 package products
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/events"
+	"github.com/Asif-Faizal/Gommerce/services/testutil"
 	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
 	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
 )
 
 // TestProductServiceHandlers is the main test function for product service handlers
@@ -19,15 +31,20 @@ func TestProductServiceHandlers(t *testing.T) {
 	// Create a mock product store for testing
 	productStore := &mockProductStore{}
 	// Create a new handler with the mock store
-	handler := NewHandler(productStore)
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
 
 	// Test case: Create Product Validation
 	t.Run("Should fail if create product payload is invalid", func(t *testing.T) {
 		testCases := []struct {
 			name    string
-			payload types.Product
+			payload any
 			wantErr string
 		}{
+			{
+				name:    "price is not a number",
+				payload: `{"name":"Test Product","description":"Test Description","image":"https://example.com/image.jpg","price":"99.99","quantity":10}`,
+				wantErr: "field 'price' must be a number",
+			},
 			{
 				name: "empty name",
 				payload: types.Product{
@@ -95,40 +112,20 @@ func TestProductServiceHandlers(t *testing.T) {
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				// Marshal the payload to JSON
-				marshaled, err := json.Marshal(tc.payload)
-				if err != nil {
-					t.Fatalf("Failed to marshal payload: %v", err)
-				}
-
-				// Create request
-				req, err := http.NewRequest(http.MethodPost, "/products/create", bytes.NewBuffer(marshaled))
-				if err != nil {
-					t.Fatalf("Failed to create request: %v", err)
-				}
-
-				// Create response recorder
-				rr := httptest.NewRecorder()
-
 				// Create router and register handler
 				router := mux.NewRouter()
 				router.HandleFunc("/products/create", handler.handleCreateProduct).Methods(http.MethodPost)
 
-				// Serve request
-				router.ServeHTTP(rr, req)
+				rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", tc.payload, authorized(t, 1))
 
 				// Check status code
 				if rr.Code != http.StatusBadRequest {
 					t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
 				}
 
-				var response map[string]string
-				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-					t.Fatalf("Failed to decode response: %v", err)
-				}
-
-				if response["error"] != tc.wantErr {
-					t.Errorf("Expected error %q, got %q", tc.wantErr, response["error"])
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Message != tc.wantErr {
+					t.Errorf("Expected error %q, got %q", tc.wantErr, response.Error.Message)
 				}
 			})
 		}
@@ -154,43 +151,30 @@ func TestProductServiceHandlers(t *testing.T) {
 			return nil
 		}
 
-		// Marshal the payload to JSON
-		marshaled, err := json.Marshal(payload)
-		if err != nil {
-			t.Fatalf("Failed to marshal payload: %v", err)
-		}
-
-		// Create request
-		req, err := http.NewRequest(http.MethodPost, "/products/create", bytes.NewBuffer(marshaled))
-		if err != nil {
-			t.Fatalf("Failed to create request: %v", err)
-		}
-
-		// Create response recorder
-		rr := httptest.NewRecorder()
-
 		// Create router and register handler
 		router := mux.NewRouter()
 		router.HandleFunc("/products/create", handler.handleCreateProduct).Methods(http.MethodPost)
 
-		// Serve request
-		router.ServeHTTP(rr, req)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", payload, authorized(t, 1))
 
 		// Check status code
 		if rr.Code != http.StatusCreated {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
 		}
 
-		var response map[string]interface{}
-		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-			t.Fatalf("Failed to decode response: %v", err)
-		}
+		response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
 
 		// Verify success message
 		if response["message"] != "product created successfully" {
 			t.Errorf("Expected message %q, got %q", "product created successfully", response["message"])
 		}
 
+		// Verify the Location header points at the created product
+		expectedLocation := config.Envs.BaseURL() + "/api/v1/products/1"
+		if location := rr.Header().Get("Location"); location != expectedLocation {
+			t.Errorf("Expected Location header %q, got %q", expectedLocation, location)
+		}
+
 		// Verify function calls
 		if !createProductCalled {
 			t.Error("CreateProduct was not called")
@@ -247,7 +231,7 @@ func TestProductServiceHandlers(t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
 				// Create mock store
 				mockStore := &mockProductStore{
-					getProductsFunc: func() ([]types.Product, error) {
+					getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
 						if tc.mockError != nil {
 							return nil, tc.mockError
 						}
@@ -255,37 +239,25 @@ func TestProductServiceHandlers(t *testing.T) {
 					},
 				}
 
-				handler := NewHandler(mockStore)
-
-				// Create request
-				req, err := http.NewRequest(http.MethodGet, "/products", nil)
-				if err != nil {
-					t.Fatalf("Failed to create request: %v", err)
-				}
-
-				// Create response recorder
-				rr := httptest.NewRecorder()
+				handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
 
 				// Create router and register handler
 				router := mux.NewRouter()
 				router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
 
-				// Serve request
-				router.ServeHTTP(rr, req)
+				rr := testutil.MakeRequest(t, router, http.MethodGet, "/products", nil, authorized(t, 1))
 
 				// Check status code
 				if rr.Code != tc.expectedCode {
 					t.Errorf("Expected status %d, got %d", tc.expectedCode, rr.Code)
 				}
 
-				var response map[string]interface{}
-				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-					t.Fatalf("Failed to decode response: %v", err)
-				}
+				response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
 
 				if tc.expectedError != "" {
-					if response["error"] != tc.expectedError {
-						t.Errorf("Expected error %q, got %q", tc.expectedError, response["error"])
+					apiErr, _ := response["error"].(map[string]interface{})
+					if apiErr["message"] != tc.expectedError {
+						t.Errorf("Expected error %q, got %q", tc.expectedError, apiErr["message"])
 					}
 				} else {
 					// Check success response structure
@@ -308,32 +280,2287 @@ func TestProductServiceHandlers(t *testing.T) {
 			})
 		}
 	})
-}
 
-// mockProductStore implements the types.ProductStore interface for testing
-type mockProductStore struct {
-	getProductsFunc      func() ([]types.Product, error)
-	createProductFunc    func(product *types.Product) error
-	getProductsByIDsFunc func(ids []int) ([]types.Product, error)
+	// Test case: In-stock filter
+	t.Run("In Stock Filter Tests", func(t *testing.T) {
+		products := []types.Product{
+			{ID: 1, Name: "In Stock", Price: 10, Quantity: 5},
+			{ID: 2, Name: "Sold Out", Price: 20, Quantity: 0},
+			{ID: 3, Name: "Last One", Price: 30, Quantity: 1},
+		}
+
+		mockStore := &mockProductStore{
+			getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
+				result := []types.Product{}
+				for _, product := range products {
+					if filter.InStock && product.Quantity <= 0 {
+						continue
+					}
+					result = append(result, product)
+				}
+				return result, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
+
+		testCases := []struct {
+			name         string
+			query        string
+			expectedCode int
+			expectedIDs  []int
+		}{
+			{name: "flag set excludes out-of-stock", query: "?inStock=true", expectedCode: http.StatusOK, expectedIDs: []int{1, 3}},
+			{name: "flag absent includes out-of-stock", query: "", expectedCode: http.StatusOK, expectedIDs: []int{1, 2, 3}},
+			{name: "flag false includes out-of-stock", query: "?inStock=false", expectedCode: http.StatusOK, expectedIDs: []int{1, 2, 3}},
+			{name: "invalid flag", query: "?inStock=maybe", expectedCode: http.StatusBadRequest},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := testutil.MakeRequest(t, router, http.MethodGet, "/products"+tc.query, nil, authorized(t, 1))
+				if rr.Code != tc.expectedCode {
+					t.Fatalf("Expected status %d, got %d", tc.expectedCode, rr.Code)
+				}
+				if tc.expectedCode != http.StatusOK {
+					return
+				}
+
+				response := testutil.DecodeJSON[struct {
+					Data []types.Product `json:"data"`
+				}](t, rr.Body)
+				if len(response.Data) != len(tc.expectedIDs) {
+					t.Fatalf("Expected %d products, got %d", len(tc.expectedIDs), len(response.Data))
+				}
+				for i, product := range response.Data {
+					if product.ID != tc.expectedIDs[i] {
+						t.Errorf("Expected product %d at position %d, got %d", tc.expectedIDs[i], i, product.ID)
+					}
+				}
+			})
+		}
+	})
+
+	// Test case: Cursor pagination
+	t.Run("Cursor Pagination Tests", func(t *testing.T) {
+		// 23 products newest first, created in batches of three so the ID has to break ties
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		products := make([]types.Product, 23)
+		for i := range products {
+			id := len(products) - i
+			products[i] = types.Product{ID: id, Name: fmt.Sprintf("Product %d", id), CreatedAt: base.Add(time.Duration(id/3) * time.Minute)}
+		}
+
+		mockStore := &mockProductStore{
+			getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
+				result := []types.Product{}
+				for _, product := range products {
+					if after := filter.After; after != nil {
+						if product.CreatedAt.After(after.CreatedAt) || (product.CreatedAt.Equal(after.CreatedAt) && product.ID >= after.ID) {
+							continue
+						}
+					}
+					if filter.Limit > 0 && len(result) == filter.Limit {
+						break
+					}
+					result = append(result, product)
+				}
+				return result, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
+
+		get := func(query string) *httptest.ResponseRecorder {
+			return testutil.MakeRequest(t, router, http.MethodGet, "/products"+query, nil, authorized(t, 1))
+		}
+
+		t.Run("pages through every product once", func(t *testing.T) {
+			seen := []int{}
+			query := "?limit=5"
+			for pages := 0; ; pages++ {
+				if pages > len(products) {
+					t.Fatal("Paging did not finish")
+				}
+				rr := get(query)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+				}
+				response := testutil.DecodeJSON[struct {
+					Data       []types.Product `json:"data"`
+					NextCursor *string         `json:"nextCursor"`
+				}](t, rr.Body)
+				for _, product := range response.Data {
+					seen = append(seen, product.ID)
+				}
+				if response.NextCursor == nil {
+					break
+				}
+				query = "?limit=5&cursor=" + *response.NextCursor
+			}
+
+			if len(seen) != len(products) {
+				t.Fatalf("Expected %d products, got %d: %v", len(products), len(seen), seen)
+			}
+			for i, id := range seen {
+				if id != products[i].ID {
+					t.Fatalf("Expected product %d at position %d, got %d: %v", products[i].ID, i, id, seen)
+				}
+			}
+		})
+
+		t.Run("last page has a null cursor", func(t *testing.T) {
+			response := testutil.DecodeJSON[map[string]interface{}](t, get("?limit=50").Body)
+			if cursor, ok := response["nextCursor"]; !ok || cursor != nil {
+				t.Errorf("Expected a null nextCursor, got %v", cursor)
+			}
+		})
+
+		t.Run("rejects tampered cursors", func(t *testing.T) {
+			cursor := encodeCursor(types.ProductCursor{CreatedAt: base, ID: 10})
+			payload, signature, _ := strings.Cut(cursor, ".")
+			forged := encodeCursor(types.ProductCursor{CreatedAt: base, ID: 20})
+			forgedPayload, _, _ := strings.Cut(forged, ".")
+
+			for _, value := range []string{forgedPayload + "." + signature, payload, payload + ".", "not-a-cursor", payload + "." + signature + "x"} {
+				if rr := get("?cursor=" + value); rr.Code != http.StatusBadRequest {
+					t.Errorf("Expected status %d for cursor %q, got %d", http.StatusBadRequest, value, rr.Code)
+				}
+			}
+		})
+	})
+
+	// Test case: HEAD requests on the listing
+	t.Run("Should answer HEAD with the GET headers and no body", func(t *testing.T) {
+		mockStore := &mockProductStore{
+			getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		handler.ProductRoutes(router)
+
+		serve := func(method string) *httptest.ResponseRecorder {
+			return testutil.MakeRequest(t, router, method, "/products", nil, authorized(t, 1))
+		}
+
+		get, head := serve(http.MethodGet), serve(http.MethodHead)
+		if head.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, head.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Errorf("Expected an empty body, got %q", head.Body.String())
+		}
+		if length := head.Header().Get("Content-Length"); length == "" || length != fmt.Sprint(get.Body.Len()) {
+			t.Errorf("Expected Content-Length %d, got %q", get.Body.Len(), length)
+		}
+		for _, header := range []string{"Content-Type", "ETag", "Cache-Control"} {
+			if head.Header().Get(header) != get.Header().Get(header) {
+				t.Errorf("Expected %s %q, got %q", header, get.Header().Get(header), head.Header().Get(header))
+			}
+		}
+	})
+
+	// Test case: ETag caching
+	t.Run("ETag Tests", func(t *testing.T) {
+		mockStore := &mockProductStore{
+			getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
+				return []types.Product{{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}}, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		router.HandleFunc("/products", handler.handleGetProducts).Methods(http.MethodGet)
+
+		get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+			header := authorized(t, 1)
+			if ifNoneMatch != "" {
+				header.Set("If-None-Match", ifNoneMatch)
+			}
+			return testutil.MakeRequest(t, router, http.MethodGet, "/products", nil, header)
+		}
+
+		// A fresh request gets the full body and a new ETag
+		rr := get("")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		etag := rr.Header().Get("ETag")
+		if !strings.HasPrefix(etag, `W/"`) {
+			t.Fatalf("Expected a weak ETag header, got %q", etag)
+		}
+		if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "private, max-age=60" {
+			t.Errorf("Expected Cache-Control %q, got %q", "private, max-age=60", cacheControl)
+		}
+		if vary := rr.Header().Get("Vary"); vary != "Authorization" {
+			t.Errorf("Expected Vary %q, got %q", "Authorization", vary)
+		}
+
+		// A request carrying the same ETag is answered with 304 and no body
+		rr = get(etag)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("Expected status %d, got %d", http.StatusNotModified, rr.Code)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("Expected empty body, got %q", rr.Body.String())
+		}
+
+		// Weak comparison also matches the strong form of the same tag inside a list
+		rr = get(`"other", ` + strings.TrimPrefix(etag, "W/"))
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("Expected status %d, got %d", http.StatusNotModified, rr.Code)
+		}
+
+		// A stale ETag gets the full response again
+		rr = get(`"stale"`)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	// Test case: Get single product
+	t.Run("Get Product Tests", func(t *testing.T) {
+		mockStore := &mockProductStore{
+			getProductByIDFunc: func(id int) (*types.Product, error) {
+				if id == 1 {
+					return &types.Product{ID: 1, Name: "Product 1", Price: 10, Quantity: 5}, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handleGetProduct).Methods(http.MethodGet)
+
+		testCases := []struct {
+			name          string
+			path          string
+			expectedCode  int
+			expectedError string
+		}{
+			{name: "successful product fetch", path: "/products/1", expectedCode: http.StatusOK},
+			{name: "product not found", path: "/products/99", expectedCode: http.StatusNotFound, expectedError: "product with ID 99 not found"},
+			{name: "non-numeric id", path: "/products/abc", expectedCode: http.StatusBadRequest, expectedError: "product ID must be a positive integer"},
+			{name: "zero id", path: "/products/0", expectedCode: http.StatusBadRequest, expectedError: "product ID must be a positive integer"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := testutil.MakeRequest(t, router, http.MethodGet, tc.path, nil, authorized(t, 1))
+				if rr.Code != tc.expectedCode {
+					t.Errorf("Expected status %d, got %d", tc.expectedCode, rr.Code)
+				}
+
+				response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
+				if tc.expectedError != "" {
+					apiErr, _ := response["error"].(map[string]interface{})
+					if apiErr["message"] != tc.expectedError {
+						t.Errorf("Expected error %q, got %q", tc.expectedError, apiErr["message"])
+					}
+					return
+				}
+				data, ok := response["data"].(map[string]interface{})
+				if !ok || data["id"] != float64(1) {
+					t.Errorf("Expected product 1 in response data, got %v", response["data"])
+				}
+			})
+		}
+	})
+
+	// Test case: Sanitization of free-text fields
+	t.Run("Should escape HTML in product name and description", func(t *testing.T) {
+		var stored types.Product
+		mockStore := &mockProductStore{
+			createProductFunc: func(product *types.Product) error {
+				stored = *product
+				product.ID = 1
+				return nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+
+		payload := types.Product{
+			Name:        "<script>alert(1)</script>",
+			Description: `<img src="x" onerror="alert(1)">`,
+			Image:       "https://example.com/image.jpg",
+			Price:       99.99,
+			Quantity:    10,
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/products/create", handler.handleCreateProduct).Methods(http.MethodPost)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", payload, authorized(t, 1))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if expected := "&lt;script&gt;alert(1)&lt;/script&gt;"; stored.Name != expected {
+			t.Errorf("Expected stored name %q, got %q", expected, stored.Name)
+		}
+		if expected := "&lt;img src=&#34;x&#34; onerror=&#34;alert(1)&#34;&gt;"; stored.Description != expected {
+			t.Errorf("Expected stored description %q, got %q", expected, stored.Description)
+		}
+	})
+
+	// Test case: Duplicate product names
+	t.Run("Should reject duplicate product names", func(t *testing.T) {
+		payload := types.Product{
+			Name:        "Test Product",
+			Description: "Test Description",
+			Image:       "https://example.com/image.jpg",
+			Price:       99.99,
+			Quantity:    10,
+		}
+
+		testCases := []struct {
+			name      string
+			mockStore *mockProductStore
+		}{
+			{
+				name: "name found by lookup",
+				mockStore: &mockProductStore{
+					getProductByNameFunc: func(name string) (*types.Product, error) {
+						return &types.Product{ID: 1, Name: name}, nil
+					},
+					createProductFunc: func(product *types.Product) error {
+						t.Error("CreateProduct should not be called for a duplicate name")
+						return nil
+					},
+				},
+			},
+			{
+				name: "name rejected by unique index",
+				mockStore: &mockProductStore{
+					createProductFunc: func(product *types.Product) error {
+						return ErrProductNameTaken
+					},
+				},
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				handler := NewHandler(tc.mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+				router := mux.NewRouter()
+				router.HandleFunc("/products/create", handler.handleCreateProduct).Methods(http.MethodPost)
+				rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", payload, authorized(t, 1))
+
+				if rr.Code != http.StatusConflict {
+					t.Errorf("Expected status %d, got %d", http.StatusConflict, rr.Code)
+				}
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Message != "product with this name already exists" {
+					t.Errorf("Expected error %q, got %q", "product with this name already exists", response.Error.Message)
+				}
+			})
+		}
+	})
+
+	// Test case: Admin lookup of the orders containing a product
+	t.Run("Get Product Orders Tests", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductByIDFunc: func(id int) (*types.Product, error) {
+				if id == 1 {
+					return &types.Product{ID: 1, Name: "Product 1"}, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+		}
+		orderStore := &mockOrderStore{
+			getOrdersByProductIDFunc: func(productID, page, limit int) ([]types.Order, int, error) {
+				// 12 matching orders in total, paged by the requested limit
+				total := 12
+				orders := []types.Order{}
+				for id := (page-1)*limit + 1; id <= total && id <= page*limit; id++ {
+					orders = append(orders, types.Order{ID: id, Items: []types.OrderItem{{OrderID: id, ProductID: productID}}})
+				}
+				return orders, total, nil
+			},
+		}
+		userStore := &mockUserStore{
+			users: map[int]*types.User{
+				1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+				2: {ID: 2, Role: types.RoleUser, IsActive: true},
+			},
+		}
+		handler := NewHandler(productStore, orderStore, userStore, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		handler.ProductRoutes(router)
+
+		testCases := []struct {
+			name               string
+			path               string
+			userID             int
+			expectedStatus     int
+			expectedOrders     int
+			expectedPagination types.Pagination
+		}{
+			{
+				name:               "first page uses the default limit",
+				path:               "/admin/products/1/orders",
+				userID:             1,
+				expectedStatus:     http.StatusOK,
+				expectedOrders:     10,
+				expectedPagination: types.Pagination{Page: 1, Limit: 10, Total: 12, TotalPages: 2},
+			},
+			{
+				name:               "last partial page",
+				path:               "/admin/products/1/orders?page=3&limit=5",
+				userID:             1,
+				expectedStatus:     http.StatusOK,
+				expectedOrders:     2,
+				expectedPagination: types.Pagination{Page: 3, Limit: 5, Total: 12, TotalPages: 3},
+			},
+			{
+				name:           "invalid limit",
+				path:           "/admin/products/1/orders?limit=0",
+				userID:         1,
+				expectedStatus: http.StatusBadRequest,
+			},
+			{
+				name:           "unknown product",
+				path:           "/admin/products/99/orders",
+				userID:         1,
+				expectedStatus: http.StatusNotFound,
+			},
+			{
+				name:           "non-admin user",
+				path:           "/admin/products/1/orders",
+				userID:         2,
+				expectedStatus: http.StatusForbidden,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := testutil.MakeRequest(t, router, http.MethodGet, tc.path, nil, authorized(t, tc.userID))
+				if rr.Code != tc.expectedStatus {
+					t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+				if tc.expectedStatus != http.StatusOK {
+					return
+				}
+
+				response := testutil.DecodeJSON[struct {
+					Data       []types.Order    `json:"data"`
+					Pagination types.Pagination `json:"pagination"`
+				}](t, rr.Body)
+				if len(response.Data) != tc.expectedOrders {
+					t.Errorf("Expected %d orders, got %d", tc.expectedOrders, len(response.Data))
+				}
+				if response.Pagination != tc.expectedPagination {
+					t.Errorf("Expected pagination %+v, got %+v", tc.expectedPagination, response.Pagination)
+				}
+			})
+		}
+	})
+
+	// Test case: Product reviews
+	t.Run("Review Tests", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductByIDFunc: func(id int) (*types.Product, error) {
+				if id == 1 {
+					return &types.Product{ID: 1, Name: "Product 1"}, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+		}
+		reviewStore := &mockReviewStore{}
+		handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, reviewStore, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		handler.ProductRoutes(router)
+
+		serve := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+			t.Helper()
+			return testutil.MakeRequest(t, router, method, path, body, authorized(t, userID))
+		}
+
+		createCases := []struct {
+			name           string
+			path           string
+			userID         int
+			body           string
+			expectedStatus int
+		}{
+			{name: "first review", path: "/products/1/reviews", userID: 1, body: `{"rating":5,"comment":"Great"}`, expectedStatus: http.StatusCreated},
+			{name: "review by another user", path: "/products/1/reviews", userID: 2, body: `{"rating":2}`, expectedStatus: http.StatusCreated},
+			{name: "duplicate review", path: "/products/1/reviews", userID: 1, body: `{"rating":3}`, expectedStatus: http.StatusConflict},
+			{name: "rating below range", path: "/products/1/reviews", userID: 3, body: `{"rating":0}`, expectedStatus: http.StatusBadRequest},
+			{name: "rating above range", path: "/products/1/reviews", userID: 3, body: `{"rating":6}`, expectedStatus: http.StatusBadRequest},
+			{name: "unknown product", path: "/products/99/reviews", userID: 3, body: `{"rating":4}`, expectedStatus: http.StatusNotFound},
+		}
+		for _, tc := range createCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := serve(http.MethodPost, tc.path, tc.userID, tc.body)
+				if rr.Code != tc.expectedStatus {
+					t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+				}
+			})
+		}
+
+		// The listing holds both accepted reviews and their average
+		rr := serve(http.MethodGet, "/products/1/reviews", 3, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		response := testutil.DecodeJSON[struct {
+			Data struct {
+				Reviews       []types.Review `json:"reviews"`
+				AverageRating float64        `json:"averageRating"`
+				ReviewCount   int            `json:"reviewCount"`
+			} `json:"data"`
+		}](t, rr.Body)
+		if response.Data.ReviewCount != 2 || len(response.Data.Reviews) != 2 {
+			t.Errorf("Expected 2 reviews, got %d", len(response.Data.Reviews))
+		}
+		if response.Data.AverageRating != 3.5 {
+			t.Errorf("Expected average rating 3.5, got %v", response.Data.AverageRating)
+		}
+	})
+
+	t.Run("Image Gallery Tests", func(t *testing.T) {
+		productStore := &mockProductStore{
+			getProductByIDFunc: func(id int) (*types.Product, error) {
+				if id == 1 {
+					return &types.Product{ID: 1, Name: "Product 1"}, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+		}
+		userStore := &mockUserStore{users: map[int]*types.User{
+			1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+			2: {ID: 2, Role: types.RoleUser, IsActive: true},
+		}}
+		imageStore := &mockImageStore{}
+		handler := NewHandler(productStore, &mockOrderStore{}, userStore, &mockReviewStore{}, imageStore, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+		router := mux.NewRouter()
+		handler.ProductRoutes(router)
+
+		serve := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+			t.Helper()
+			return testutil.MakeRequest(t, router, method, path, body, authorized(t, userID))
+		}
+
+		steps := []struct {
+			name           string
+			method         string
+			path           string
+			userID         int
+			body           string
+			expectedStatus int
+		}{
+			{name: "first image", method: http.MethodPost, path: "/products/1/images", userID: 1, body: `{"url":"https://cdn.example.com/front.jpg"}`, expectedStatus: http.StatusCreated},
+			{name: "second image", method: http.MethodPost, path: "/products/1/images", userID: 1, body: `{"url":"https://cdn.example.com/back.jpg"}`, expectedStatus: http.StatusCreated},
+			{name: "not an admin", method: http.MethodPost, path: "/products/1/images", userID: 2, body: `{"url":"https://cdn.example.com/side.jpg"}`, expectedStatus: http.StatusForbidden},
+			{name: "invalid url", method: http.MethodPost, path: "/products/1/images", userID: 1, body: `{"url":"not a url"}`, expectedStatus: http.StatusBadRequest},
+			{name: "unknown product", method: http.MethodPost, path: "/products/99/images", userID: 1, body: `{"url":"https://cdn.example.com/front.jpg"}`, expectedStatus: http.StatusNotFound},
+			{name: "reorder missing an image", method: http.MethodPut, path: "/products/1/images/reorder", userID: 1, body: `{"imageIDs":[2]}`, expectedStatus: http.StatusBadRequest},
+			{name: "reorder with duplicates", method: http.MethodPut, path: "/products/1/images/reorder", userID: 1, body: `{"imageIDs":[2,2]}`, expectedStatus: http.StatusBadRequest},
+			{name: "reorder", method: http.MethodPut, path: "/products/1/images/reorder", userID: 1, body: `{"imageIDs":[2,1]}`, expectedStatus: http.StatusOK},
+			{name: "delete unknown image", method: http.MethodDelete, path: "/products/1/images/99", userID: 1, expectedStatus: http.StatusNotFound},
+		}
+		for _, step := range steps {
+			if rr := serve(step.method, step.path, step.userID, step.body); rr.Code != step.expectedStatus {
+				t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.expectedStatus, rr.Code, rr.Body.String())
+			}
+		}
+
+		// The product response includes the gallery in its new order
+		rr := serve(http.MethodGet, "/products/1", 2, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		response := testutil.DecodeJSON[struct {
+			Data types.Product `json:"data"`
+		}](t, rr.Body)
+		images := response.Data.Images
+		if len(images) != 2 || images[0].ID != 2 || images[1].ID != 1 {
+			t.Fatalf("Expected images 2 then 1, got %+v", images)
+		}
+		if !images[1].IsPrimary || images[0].IsPrimary {
+			t.Errorf("Expected the first image added to stay primary, got %+v", images)
+		}
+
+		if rr := serve(http.MethodDelete, "/products/1/images/1", 1, ""); rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
 }
 
-func (m *mockProductStore) GetProducts() ([]types.Product, error) {
-	if m.getProductsFunc != nil {
-		return m.getProductsFunc()
+// TestPriceAlerts walks price alerts through being set, triggered by a price drop and removed
+func TestPriceAlerts(t *testing.T) {
+	product := &types.Product{ID: 1, Name: "Headphones", Price: 100}
+	productStore := &mockProductStore{
+		getProductByIDFunc: func(id int) (*types.Product, error) {
+			if id != product.ID {
+				return nil, sql.ErrNoRows
+			}
+			current := *product
+			return &current, nil
+		},
+		updateProductPriceFunc: func(id int, price types.Price) error {
+			product.Price = price
+			return nil
+		},
 	}
-	return nil, fmt.Errorf("products not found")
-}
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true, Email: "admin@example.com"},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true, FirstName: "Ann", Email: "ann@example.com"},
+		3: {ID: 3, Role: types.RoleUser, IsActive: true, FirstName: "Bob", Email: "bob@example.com"},
+	}}
+	alertStore := &mockPriceAlertStore{}
+	mailer := &recordingMailer{}
+	notifier := events.NewPriceAlertNotifier(userStore, alertStore, mailer, 10)
+	handler := NewHandler(productStore, &mockOrderStore{}, userStore, &mockReviewStore{}, &mockImageStore{}, alertStore, &mockWarehouseStore{}, notifier, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
 
-func (m *mockProductStore) CreateProduct(product *types.Product) error {
+	serve := func(method, path string, userID int, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, method, path, body, authorized(t, userID))
+	}
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		userID         int
+		body           string
+		expectedStatus int
+	}{
+		{"alert on an unknown product", http.MethodPost, "/products/9/price-alert", 2, `{"targetPrice":80}`, http.StatusNotFound},
+		{"invalid target price", http.MethodPost, "/products/1/price-alert", 2, `{"targetPrice":0}`, http.StatusBadRequest},
+		{"first user sets an alert", http.MethodPost, "/products/1/price-alert", 2, `{"targetPrice":80}`, http.StatusCreated},
+		{"second user sets a lower alert", http.MethodPost, "/products/1/price-alert", 3, `{"targetPrice":50}`, http.StatusCreated},
+		{"non-admin can't change the price", http.MethodPut, "/products/1/price", 2, `{"price":10}`, http.StatusForbidden},
+		{"admin drops the price", http.MethodPut, "/products/1/price", 1, `{"price":75}`, http.StatusOK},
+		{"deleting a missing alert", http.MethodDelete, "/products/1/price-alert", 1, "", http.StatusNotFound},
+		{"second user removes their alert", http.MethodDelete, "/products/1/price-alert", 3, "", http.StatusOK},
+	}
+	for _, step := range steps {
+		if rr := serve(step.method, step.path, step.userID, step.body); rr.Code != step.expectedStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.expectedStatus, rr.Code, rr.Body.String())
+		}
+	}
+
+	// wait for the queued notifications to be sent
+	notifier.Close()
+
+	if len(mailer.sent) != 1 || mailer.sent[0] != "ann@example.com" {
+		t.Fatalf("Expected only the first user to be emailed, got %v", mailer.sent)
+	}
+	if len(alertStore.alerts) != 1 || !alertStore.alerts[0].Notified {
+		t.Errorf("Expected the triggered alert to be marked notified, got %+v", alertStore.alerts)
+	}
+}
+
+// recordingMailer records who emails are sent to
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (m *recordingMailer) Send(email events.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, email.To)
+	return nil
+}
+
+// TestCompareProducts checks only the fields that differ are listed, with one value per product
+func TestCompareProducts(t *testing.T) {
+	base := types.Product{ID: 1, Name: "Phone", Description: "A phone", Image: "phone.jpg", Price: 299, Quantity: 5, AverageRating: 4, ReviewCount: 10}
+
+	testCases := []struct {
+		name     string
+		products []types.Product
+		expected map[string][]interface{}
+	}{
+		{
+			name:     "identical products have no differences",
+			products: []types.Product{base, func() types.Product { p := base; p.ID = 2; return p }()},
+			expected: map[string][]interface{}{},
+		},
+		{
+			name: "lists every value of a differing field",
+			products: []types.Product{
+				base,
+				func() types.Product { p := base; p.ID = 2; p.Name = "Phone Pro"; p.Price = 399; return p }(),
+				func() types.Product { p := base; p.ID = 3; p.Quantity = 0; return p }(),
+			},
+			expected: map[string][]interface{}{
+				"name":     {"Phone", "Phone Pro", "Phone"},
+				"price":    {types.Price(299), types.Price(399), types.Price(299)},
+				"quantity": {5, 5, 0},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			differences := compareProducts(tc.products)
+			if !reflect.DeepEqual(differences, tc.expected) {
+				t.Errorf("Expected differences %v, got %v", tc.expected, differences)
+			}
+		})
+	}
+}
+
+// TestHandleCompareProducts checks the ID validation of the public comparison endpoint
+func TestHandleCompareProducts(t *testing.T) {
+	mockStore := &mockProductStore{
+		getProductsByIDsFunc: func(ids []int) ([]types.Product, error) {
+			products := []types.Product{}
+			for _, id := range ids {
+				if id <= 3 {
+					products = append(products, types.Product{ID: id, Name: fmt.Sprintf("Product %d", id), Price: types.Price(id * 10)})
+				}
+			}
+			return products, nil
+		},
+	}
+	handler := NewHandler(mockStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "two products", query: "?ids=1,2", expectedStatus: http.StatusOK},
+		{name: "missing ids", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "one product", query: "?ids=1", expectedStatus: http.StatusBadRequest},
+		{name: "five products", query: "?ids=1,2,3,4,5", expectedStatus: http.StatusBadRequest},
+		{name: "invalid id", query: "?ids=1,abc", expectedStatus: http.StatusBadRequest},
+		{name: "repeated id", query: "?ids=1,1", expectedStatus: http.StatusBadRequest},
+		{name: "unknown product", query: "?ids=1,9", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// no Authorization header - the comparison is public
+			rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/compare"+tc.query, nil)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			response := testutil.DecodeJSON[struct {
+				Data struct {
+					Products    []types.Product          `json:"products"`
+					Differences map[string][]interface{} `json:"differences"`
+				} `json:"data"`
+			}](t, rr.Body)
+			if len(response.Data.Products) != 2 || len(response.Data.Differences["price"]) != 2 {
+				t.Errorf("Unexpected comparison: %+v", response.Data)
+			}
+		})
+	}
+}
+
+// TestHandleGetNearbyProducts covers coordinate validation and the radius cap of the nearby listing
+func TestHandleGetNearbyProducts(t *testing.T) {
+	warehouses := &mockWarehouseStore{
+		products: []types.NearbyProduct{
+			{Product: types.Product{ID: 1, Name: "Product 1"}, Warehouse: types.Warehouse{ID: 1, Name: "Central"}, DistanceKm: 3.2},
+		},
+	}
+	handler := NewHandler(&mockProductStore{}, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, warehouses, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedRadius float64
+	}{
+		{name: "default radius", query: "?lat=51.5&lng=-0.12", expectedStatus: http.StatusOK, expectedRadius: defaultNearbyRadiusKm},
+		{name: "maximum radius", query: "?lat=51.5&lng=-0.12&radius=500", expectedStatus: http.StatusOK, expectedRadius: maxNearbyRadiusKm},
+		{name: "radius over cap", query: "?lat=51.5&lng=-0.12&radius=501", expectedStatus: http.StatusBadRequest},
+		{name: "zero radius", query: "?lat=51.5&lng=-0.12&radius=0", expectedStatus: http.StatusBadRequest},
+		{name: "missing lng", query: "?lat=51.5", expectedStatus: http.StatusBadRequest},
+		{name: "latitude out of range", query: "?lat=91&lng=0", expectedStatus: http.StatusBadRequest},
+		{name: "longitude out of range", query: "?lat=0&lng=-181", expectedStatus: http.StatusBadRequest},
+		{name: "invalid latitude", query: "?lat=north&lng=0", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			warehouses.radiusKm = 0
+			rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/nearby"+tc.query, nil, authorized(t, 1))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if warehouses.radiusKm != tc.expectedRadius {
+				t.Errorf("Expected radius %v, got %v", tc.expectedRadius, warehouses.radiusKm)
+			}
+			response := testutil.DecodeJSON[struct {
+				Data []types.NearbyProduct `json:"data"`
+			}](t, rr.Body)
+			if len(response.Data) != 1 || response.Data[0].Warehouse.Name != "Central" || response.Data[0].DistanceKm != 3.2 {
+				t.Errorf("Unexpected nearby products: %+v", response.Data)
+			}
+		})
+	}
+}
+
+// TestHandleSearchProducts checks the search query and pagination are validated and passed to the store
+func TestHandleSearchProducts(t *testing.T) {
+	var gotQuery string
+	var gotPage, gotLimit int
+	productStore := &mockProductStore{
+		searchProductsFunc: func(query string, page, limit int) ([]types.Product, int, error) {
+			if query == `"espresso` {
+				return nil, 0, ErrInvalidSearchQuery
+			}
+			gotQuery, gotPage, gotLimit = query, page, limit
+			return []types.Product{{ID: 2, Name: "Espresso Machine"}, {ID: 5, Name: "Coffee Grinder"}}, 12, nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedQuery  string
+		expectedPage   int
+		expectedLimit  int
+	}{
+		{name: "defaults", query: "?q=espresso", expectedStatus: http.StatusOK, expectedQuery: "espresso", expectedPage: 1, expectedLimit: utils.DefaultPageLimit},
+		{name: "boolean operators and paging", query: "?q=" + url.QueryEscape(" +espresso -tea ") + "&page=2&limit=5", expectedStatus: http.StatusOK, expectedQuery: "+espresso -tea", expectedPage: 2, expectedLimit: 5},
+		{name: "missing query", query: "", expectedStatus: http.StatusBadRequest},
+		{name: "blank query", query: "?q=%20%20", expectedStatus: http.StatusBadRequest},
+		{name: "query too long", query: "?q=" + strings.Repeat("a", maxSearchQueryLength+1), expectedStatus: http.StatusBadRequest},
+		{name: "invalid page", query: "?q=espresso&page=0", expectedStatus: http.StatusBadRequest},
+		{name: "query MySQL can't parse", query: "?q=" + url.QueryEscape(`"espresso`), expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotQuery, gotPage, gotLimit = "", 0, 0
+			rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/search"+tc.query, nil, authorized(t, 1))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				if gotQuery != "" {
+					t.Errorf("Expected no search, got query %q", gotQuery)
+				}
+				return
+			}
+			if gotQuery != tc.expectedQuery || gotPage != tc.expectedPage || gotLimit != tc.expectedLimit {
+				t.Errorf("Expected search for %q page %d limit %d, got %q page %d limit %d", tc.expectedQuery, tc.expectedPage, tc.expectedLimit, gotQuery, gotPage, gotLimit)
+			}
+			response := testutil.DecodeJSON[struct {
+				Data       []types.Product  `json:"data"`
+				Pagination types.Pagination `json:"pagination"`
+			}](t, rr.Body)
+			if len(response.Data) != 2 || response.Data[0].ID != 2 || response.Pagination.Total != 12 {
+				t.Errorf("Unexpected response: %+v", response)
+			}
+		})
+	}
+}
+
+// TestHandleGetProductSummaries checks the compact listing is paginated and holds nothing but IDs and names
+func TestHandleGetProductSummaries(t *testing.T) {
+	var gotPage, gotLimit int
+	productStore := &mockProductStore{
+		getSummariesFunc: func(page, limit int) ([]types.ProductSummary, int, error) {
+			gotPage, gotLimit = page, limit
+			return []types.ProductSummary{{ID: 3, Name: "Camera"}, {ID: 1, Name: "Tripod"}}, 7, nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	t.Run("requires authentication", func(t *testing.T) {
+		if rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/compact", nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("invalid pagination", func(t *testing.T) {
+		if rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/compact?limit=0", nil, authorized(t, 1)); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("only IDs and names", func(t *testing.T) {
+		rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/compact?page=2&limit=2", nil, authorized(t, 1))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if gotPage != 2 || gotLimit != 2 {
+			t.Errorf("Expected page 2 limit 2, got page %d limit %d", gotPage, gotLimit)
+		}
+
+		response := testutil.DecodeJSON[struct {
+			Data       []map[string]interface{} `json:"data"`
+			Pagination types.Pagination         `json:"pagination"`
+		}](t, rr.Body)
+		if len(response.Data) != 2 {
+			t.Fatalf("Expected 2 products, got %d", len(response.Data))
+		}
+		for _, product := range response.Data {
+			keys := []string{}
+			for key := range product {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, []string{"id", "name"}) {
+				t.Errorf("Expected only id and name, got %v", keys)
+			}
+		}
+		if response.Data[0]["name"] != "Camera" || response.Pagination != (types.Pagination{Page: 2, Limit: 2, Total: 7, TotalPages: 4}) {
+			t.Errorf("Unexpected response: %+v", response)
+		}
+	})
+}
+
+// TestFeaturedProducts checks admins can feature products and anyone can list them
+func TestFeaturedProducts(t *testing.T) {
+	var featured []int // IDs of the featured products, in the order they were featured
+	productStore := &mockProductStore{
+		setFeaturedFunc: func(productID int, feature bool) error {
+			if productID > 3 {
+				return sql.ErrNoRows
+			}
+			index := slices.Index(featured, productID)
+			if !feature && index >= 0 {
+				featured = slices.Delete(featured, index, index+1)
+			} else if feature && index < 0 {
+				featured = append(featured, productID)
+			}
+			return nil
+		},
+		getFeaturedFunc: func(limit int) ([]types.Product, error) {
+			if limit != maxFeaturedProducts {
+				t.Errorf("Expected a limit of %d, got %d", maxFeaturedProducts, limit)
+			}
+			products := []types.Product{}
+			for i := len(featured) - 1; i >= 0; i-- {
+				products = append(products, types.Product{ID: featured[i], IsFeatured: true})
+			}
+			return products, nil
+		},
+	}
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	handler := NewHandler(productStore, &mockOrderStore{}, userStore, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		userID         int
+		expectedStatus int
+	}{
+		{name: "feature a product", method: http.MethodPut, path: "/admin/products/1/featured", userID: 1, expectedStatus: http.StatusOK},
+		{name: "feature another product", method: http.MethodPut, path: "/admin/products/2/featured", userID: 1, expectedStatus: http.StatusOK},
+		{name: "feature a third product", method: http.MethodPut, path: "/admin/products/3/featured", userID: 1, expectedStatus: http.StatusOK},
+		{name: "feature an already featured product", method: http.MethodPut, path: "/admin/products/1/featured", userID: 1, expectedStatus: http.StatusOK},
+		{name: "stop featuring a product", method: http.MethodDelete, path: "/admin/products/2/featured", userID: 1, expectedStatus: http.StatusOK},
+		{name: "regular user", method: http.MethodPut, path: "/admin/products/2/featured", userID: 2, expectedStatus: http.StatusForbidden},
+		{name: "unknown product", method: http.MethodPut, path: "/admin/products/9/featured", userID: 1, expectedStatus: http.StatusNotFound},
+		{name: "invalid product ID", method: http.MethodDelete, path: "/admin/products/abc/featured", userID: 1, expectedStatus: http.StatusBadRequest},
+	}
+	for _, step := range steps {
+		if rr := testutil.MakeRequest(t, router, step.method, step.path, nil, authorized(t, step.userID)); rr.Code != step.expectedStatus {
+			t.Fatalf("%s: expected status %d, got %d: %s", step.name, step.expectedStatus, rr.Code, rr.Body.String())
+		}
+	}
+
+	// The listing is public, and shows the most recently featured product first
+	rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/featured", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	response := testutil.DecodeJSON[struct {
+		Data []types.Product `json:"data"`
+	}](t, rr.Body)
+	if len(response.Data) != 2 || response.Data[0].ID != 3 || response.Data[1].ID != 1 || !response.Data[0].IsFeatured {
+		t.Errorf("Expected featured products 3 then 1, got %+v", response.Data)
+	}
+}
+
+// TestProductListingCache checks the first page of the listing is cached for the TTL and dropped by a create
+func TestProductListingCache(t *testing.T) {
+	var listed []types.Product
+	reads := 0
+	productStore := &mockProductStore{
+		getProductsFunc: func(filter types.ProductFilter) ([]types.Product, error) {
+			reads++
+			return slices.Clone(listed), nil
+		},
+		createProductFunc: func(product *types.Product) error {
+			product.ID = len(listed) + 1
+			listed = append([]types.Product{*product}, listed...)
+			return nil
+		},
+	}
+	now := time.Now()
+	cache := NewCachedStore(productStore, time.Minute)
+	cache.now = func() time.Time { return now }
+	handler := NewHandler(cache, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	list := func(t *testing.T, query string) []types.Product {
+		t.Helper()
+		rr := testutil.MakeRequest(t, router, http.MethodGet, "/products"+query, nil, authorized(t, 1))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		return testutil.DecodeJSON[struct {
+			Data []types.Product `json:"data"`
+		}](t, rr.Body).Data
+	}
+	create := func(t *testing.T, name string) {
+		t.Helper()
+		payload := types.Product{Name: name, Description: "A product", Image: "https://example.com/product.jpg", Price: 10, Quantity: 1}
+		if rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", payload, authorized(t, 1)); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+	}
+
+	create(t, "Camera")
+	list(t, "")
+	listed[0].Name = "Renamed behind the cache's back"
+	now = now.Add(59 * time.Second)
+	if products := list(t, ""); reads != 1 || len(products) != 1 || products[0].Name != "Camera" {
+		t.Fatalf("Expected the cached listing within the TTL, got %+v after %d reads", products, reads)
+	}
+
+	// Filtered listings always go to the store
+	list(t, "?inStock=true")
+	if reads != 2 {
+		t.Errorf("Expected a filtered listing to be read from the store, got %d reads", reads)
+	}
+
+	create(t, "Tripod")
+	if products := list(t, ""); reads != 3 || len(products) != 2 {
+		t.Fatalf("Expected a create to invalidate the cache, got %+v after %d reads", products, reads)
+	}
+
+	now = now.Add(time.Minute)
+	list(t, "")
+	if reads != 4 {
+		t.Errorf("Expected the listing to be read again once the TTL passed, got %d reads", reads)
+	}
+}
+
+// TestCreateProductWithImages creates a product with a gallery and reads it back in order
+func TestCreateProductWithImages(t *testing.T) {
+	imageStore := &mockImageStore{}
+	var created types.Product
+	productStore := &mockProductStore{
+		createProductFunc: func(product *types.Product) error {
+			product.ID = 1
+			for i := range product.Images {
+				product.Images[i].ID = i + 1
+				product.Images[i].ProductID = product.ID
+			}
+			imageStore.images = append(imageStore.images, product.Images...)
+			created = *product
+			return nil
+		},
+		getProductByIDFunc: func(id int) (*types.Product, error) {
+			product := created
+			product.Images = nil
+			return &product, nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, imageStore, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	post := func(t *testing.T, payload map[string]interface{}) *httptest.ResponseRecorder {
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", payload, authorized(t, 1))
+		return rr
+	}
+	product := func(images ...string) map[string]interface{} {
+		return map[string]interface{}{"name": "Camera", "description": "A camera", "price": 250, "quantity": 3, "images": images}
+	}
+
+	t.Run("rejects invalid images", func(t *testing.T) {
+		tooMany := make([]string, maxProductImages+1)
+		for i := range tooMany {
+			tooMany[i] = fmt.Sprintf("https://example.com/%d.jpg", i)
+		}
+		for name, images := range map[string][]string{
+			"not a url": {"https://example.com/front.jpg", "back.jpg"},
+			"repeated":  {"https://example.com/front.jpg", "https://example.com/front.jpg"},
+			"too many":  tooMany,
+		} {
+			if rr := post(t, product(images...)); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d: %s", name, http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("stores the gallery in order", func(t *testing.T) {
+		urls := []string{"https://example.com/front.jpg", "https://example.com/back.jpg", "https://example.com/side.jpg"}
+		if rr := post(t, product(urls...)); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		// The first image becomes the primary image when none is given
+		if created.Image != urls[0] {
+			t.Errorf("Expected image %q, got %q", urls[0], created.Image)
+		}
+
+		rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/1", nil, authorized(t, 1))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		response := testutil.DecodeJSON[struct {
+			Data types.Product `json:"data"`
+		}](t, rr.Body)
+		if len(response.Data.Images) != len(urls) {
+			t.Fatalf("Expected %d images, got %+v", len(urls), response.Data.Images)
+		}
+		for i, image := range response.Data.Images {
+			if image.URL != urls[i] || image.SortOrder != i || image.IsPrimary != (i == 0) {
+				t.Errorf("Unexpected image at position %d: %+v", i, image)
+			}
+		}
+	})
+}
+
+// TestNewGallery verifies the product image leads the gallery and is never listed twice
+func TestNewGallery(t *testing.T) {
+	front, back := "https://example.com/front.jpg", "https://example.com/back.jpg"
+	testCases := []struct {
+		name     string
+		image    string
+		urls     []string
+		expected []string
+	}{
+		{name: "no gallery", image: front, expected: nil},
+		{name: "image first", image: back, urls: []string{front}, expected: []string{back, front}},
+		{name: "image listed in gallery", image: back, urls: []string{front, back}, expected: []string{back, front}},
+		{name: "no image", urls: []string{front, back}, expected: []string{front, back}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			images := newGallery(tc.image, tc.urls)
+			if len(images) != len(tc.expected) {
+				t.Fatalf("Expected %d images, got %+v", len(tc.expected), images)
+			}
+			for i, url := range tc.expected {
+				if images[i].URL != url || images[i].SortOrder != i || images[i].IsPrimary != (i == 0) {
+					t.Errorf("Unexpected image at position %d: %+v", i, images[i])
+				}
+			}
+		})
+	}
+}
+
+// TestProductWarnings covers each non-fatal issue ProductWarnings reports
+func TestProductWarnings(t *testing.T) {
+	description := "A sturdy camera with a 24 megapixel sensor and two lenses"
+	testCases := []struct {
+		name     string
+		product  types.Product
+		expected []string
+	}{
+		{name: "no issues", product: types.Product{Description: description, Price: 250, Quantity: 10}, expected: []string{}},
+		{name: "short description", product: types.Product{Description: "A camera", Price: 250, Quantity: 10}, expected: []string{"description is very short (8 characters, at least 30 recommended)"}},
+		{name: "price ending in .99", product: types.Product{Description: description, Price: 19.99, Quantity: 10}, expected: []string{"price ends in .99"}},
+		{name: "price drifting below .99", product: types.Product{Description: description, Price: 19.98999999, Quantity: 10}, expected: []string{"price ends in .99"}},
+		{name: "huge quantity", product: types.Product{Description: description, Price: 250, Quantity: 250000}, expected: []string{"quantity 250000 is unusually large (more than 100000)"}},
+		{name: "several issues", product: types.Product{Description: "", Price: 0.99, Quantity: 100001}, expected: []string{
+			"description is very short (0 characters, at least 30 recommended)",
+			"price ends in .99",
+			"quantity 100001 is unusually large (more than 100000)",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if warnings := ProductWarnings(tc.product); !reflect.DeepEqual(warnings, tc.expected) {
+				t.Errorf("Expected warnings %q, got %q", tc.expected, warnings)
+			}
+		})
+	}
+}
+
+// TestCreateProductWarnings verifies warnings are only returned with ?validate=warn and don't block creation
+func TestCreateProductWarnings(t *testing.T) {
+	productStore := &mockProductStore{
+		createProductFunc: func(product *types.Product) error {
+			product.ID = 1
+			return nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	create := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create"+query, types.Product{Name: "Camera", Description: "A camera", Image: "https://example.com/camera.jpg", Price: 249.99, Quantity: 3}, authorized(t, 1))
+		return rr
+	}
+	warnings := func(t *testing.T, rr *httptest.ResponseRecorder) []string {
+		response := testutil.DecodeJSON[struct {
+			Warnings []string `json:"warnings"`
+		}](t, rr.Body)
+		return response.Warnings
+	}
+
+	t.Run("returns warnings with the product", func(t *testing.T) {
+		rr := create(t, "?validate=warn")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		if got := warnings(t, rr); len(got) != 2 {
+			t.Errorf("Expected short description and .99 warnings, got %q", got)
+		}
+	})
+
+	t.Run("omits warnings by default", func(t *testing.T) {
+		rr := create(t, "")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), `"warnings"`) {
+			t.Errorf("Expected no warnings, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("rejects unknown modes", func(t *testing.T) {
+		if rr := create(t, "?validate=strict"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+// TestCreateProductCurrency verifies products get the default currency and unsupported ones are rejected
+func TestCreateProductCurrency(t *testing.T) {
+	var created types.Product
+	productStore := &mockProductStore{
+		createProductFunc: func(product *types.Product) error {
+			product.ID = 1
+			created = *product
+			return nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name             string
+		currency         string
+		expectedStatus   int
+		expectedCurrency string
+	}{
+		{name: "default currency", currency: "", expectedStatus: http.StatusCreated, expectedCurrency: types.DefaultCurrency},
+		{name: "given currency", currency: "EUR", expectedStatus: http.StatusCreated, expectedCurrency: "EUR"},
+		{name: "lowercase currency", currency: "gbp", expectedStatus: http.StatusCreated, expectedCurrency: "GBP"},
+		{name: "unsupported currency", currency: "XYZ", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created = types.Product{}
+			rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", types.Product{Name: "Camera", Description: "A camera", Image: "https://example.com/camera.jpg", Price: 250, Currency: tc.currency, Quantity: 3}, authorized(t, 1))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if created.Currency != tc.expectedCurrency {
+				t.Errorf("Expected currency %q, got %q", tc.expectedCurrency, created.Currency)
+			}
+		})
+	}
+}
+
+// TestCreateProductSKU checks SKUs are validated and a taken SKU is rejected with 409
+func TestCreateProductSKU(t *testing.T) {
+	var created types.Product
+	productStore := &mockProductStore{
+		createProductFunc: func(product *types.Product) error {
+			if product.SKU == "RACE-1" {
+				return ErrProductSKUTaken
+			}
+			product.ID = 1
+			created = *product
+			return nil
+		},
+		getProductBySKUFunc: func(sku string) (*types.Product, error) {
+			if sku == "CAM-100" {
+				return &types.Product{ID: 9, SKU: sku}, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		sku            string
+		expectedStatus int
+		expectedSKU    string
+		expectedError  string
+	}{
+		{name: "no SKU", sku: "", expectedStatus: http.StatusCreated},
+		{name: "valid SKU", sku: " Cam-200-b ", expectedStatus: http.StatusCreated, expectedSKU: "Cam-200-b"},
+		{name: "invalid characters", sku: "CAM 200", expectedStatus: http.StatusBadRequest, expectedError: "sku must be"},
+		{name: "too long", sku: strings.Repeat("A", 51), expectedStatus: http.StatusBadRequest, expectedError: "sku must be"},
+		{name: "taken SKU", sku: "CAM-100", expectedStatus: http.StatusConflict, expectedError: "a product with this SKU already exists"},
+		{name: "SKU taken while creating", sku: "RACE-1", expectedStatus: http.StatusConflict, expectedError: "a product with this SKU already exists"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created = types.Product{}
+			rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", types.Product{Name: "Camera", SKU: tc.sku, Description: "A camera", Image: "https://example.com/camera.jpg", Price: 250, Quantity: 3}, authorized(t, 1))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedError != "" && !strings.Contains(rr.Body.String(), tc.expectedError) {
+				t.Errorf("Expected error %q, got %s", tc.expectedError, rr.Body.String())
+			}
+			if created.SKU != tc.expectedSKU {
+				t.Errorf("Expected SKU %q, got %q", tc.expectedSKU, created.SKU)
+			}
+		})
+	}
+}
+
+// TestCreateProductCategory checks categories are optional, trimmed and validated
+func TestCreateProductCategory(t *testing.T) {
+	var created types.Product
+	productStore := &mockProductStore{
+		createProductFunc: func(product *types.Product) error {
+			product.ID = 1
+			created = *product
+			return nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name             string
+		category         string
+		expectedStatus   int
+		expectedCategory string
+	}{
+		{name: "no category", category: "", expectedStatus: http.StatusCreated},
+		{name: "valid category", category: " Home & Kitchen ", expectedStatus: http.StatusCreated, expectedCategory: "Home & Kitchen"},
+		{name: "invalid characters", category: "<b>Coffee</b>", expectedStatus: http.StatusBadRequest},
+		{name: "too long", category: strings.Repeat("a", 51), expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created = types.Product{}
+			rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/create", types.Product{Name: "Camera", Category: tc.category, Description: "A camera", Image: "https://example.com/camera.jpg", Price: 250, Quantity: 3}, authorized(t, 1))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusBadRequest && !strings.Contains(rr.Body.String(), "category must be") {
+				t.Errorf("Expected a category error, got %s", rr.Body.String())
+			}
+			if created.Category != tc.expectedCategory {
+				t.Errorf("Expected category %q, got %q", tc.expectedCategory, created.Category)
+			}
+		})
+	}
+}
+
+// TestHandleGetProductBySKU checks products can be looked up by their SKU
+func TestHandleGetProductBySKU(t *testing.T) {
+	productStore := &mockProductStore{
+		getProductBySKUFunc: func(sku string) (*types.Product, error) {
+			switch sku {
+			case "CAM-100":
+				return &types.Product{ID: 9, Name: "Camera", SKU: sku}, nil
+			case "BROKEN-1":
+				return nil, fmt.Errorf("database unavailable")
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	images := &mockImageStore{images: []types.ProductImage{{ID: 1, ProductID: 9, URL: "https://example.com/camera.jpg"}}}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, images, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		sku            string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "known SKU", sku: "CAM-100", expectedStatus: http.StatusOK},
+		{name: "URL-encoded SKU", sku: "CAM%2D100", expectedStatus: http.StatusOK},
+		{name: "unknown SKU", sku: "CAM-999", expectedStatus: http.StatusNotFound, expectedError: "product not found"},
+		{name: "invalid SKU", sku: "CAM_100", expectedStatus: http.StatusBadRequest},
+		{name: "URL-encoded special characters", sku: url.PathEscape("CAM 100#?"), expectedStatus: http.StatusBadRequest},
+		{name: "store error", sku: "BROKEN-1", expectedStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// The lookup is public, so no Authorization header is sent
+			rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/sku/"+tc.sku, nil)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedError != "" {
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Message != tc.expectedError {
+					t.Errorf("Expected error %q, got %q", tc.expectedError, response.Error.Message)
+				}
+				return
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			response := testutil.DecodeJSON[struct {
+				Data types.Product `json:"data"`
+			}](t, rr.Body)
+			if response.Data.ID != 9 || response.Data.SKU != "CAM-100" || len(response.Data.Images) != 1 {
+				t.Errorf("Expected product 9 with its image, got %+v", response.Data)
+			}
+		})
+	}
+}
+
+// TestHandleGetRelatedProducts checks related products are returned for a product with the requested limit
+func TestHandleGetRelatedProducts(t *testing.T) {
+	var requestedLimit int
+	productStore := &mockProductStore{
+		getRelatedProductsFunc: func(productID, limit int) ([]types.Product, error) {
+			requestedLimit = limit
+			switch productID {
+			case 5:
+				return []types.Product{{ID: 7, Name: "Espresso Machine", Category: "Coffee"}, {ID: 6, Name: "Coffee Grinder", Category: "Coffee"}}, nil
+			case 6:
+				return nil, fmt.Errorf("database unavailable")
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		path           string
+		authenticated  bool
+		expectedStatus int
+		expectedLimit  int
+	}{
+		{name: "default limit", path: "/products/5/related", authenticated: true, expectedStatus: http.StatusOK, expectedLimit: defaultRelatedLimit},
+		{name: "custom limit", path: "/products/5/related?limit=2", authenticated: true, expectedStatus: http.StatusOK, expectedLimit: 2},
+		{name: "limit too large", path: "/products/5/related?limit=51", authenticated: true, expectedStatus: http.StatusBadRequest},
+		{name: "invalid limit", path: "/products/5/related?limit=abc", authenticated: true, expectedStatus: http.StatusBadRequest},
+		{name: "invalid ID", path: "/products/0/related", authenticated: true, expectedStatus: http.StatusBadRequest},
+		{name: "unknown product", path: "/products/404/related", authenticated: true, expectedStatus: http.StatusNotFound},
+		{name: "store error", path: "/products/6/related", authenticated: true, expectedStatus: http.StatusInternalServerError},
+		{name: "unauthenticated", path: "/products/5/related", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requestedLimit = 0
+			header := http.Header{}
+			if tc.authenticated {
+				header = authorized(t, 1)
+			}
+			rr := testutil.MakeRequest(t, router, http.MethodGet, tc.path, nil, header)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if requestedLimit != tc.expectedLimit {
+				t.Errorf("Expected limit %d, got %d", tc.expectedLimit, requestedLimit)
+			}
+			response := testutil.DecodeJSON[struct {
+				Data []types.Product `json:"data"`
+			}](t, rr.Body)
+			if len(response.Data) != 2 || response.Data[0].ID != 7 || response.Data[0].Category != "Coffee" {
+				t.Errorf("Unexpected related products: %+v", response.Data)
+			}
+		})
+	}
+}
+
+// TestHandleGetProductStock checks the stock endpoint reports in-stock, out-of-stock and unknown products,
+// and always reads the current stock even through the listing cache
+func TestHandleGetProductStock(t *testing.T) {
+	stock := map[int]int{5: 42, 6: 0}
+	productStore := &mockProductStore{
+		getProductStockFunc: func(id int) (int, error) {
+			if id == 7 {
+				return 0, fmt.Errorf("database unavailable")
+			}
+			quantity, ok := stock[id]
+			if !ok {
+				return 0, sql.ErrNoRows
+			}
+			return quantity, nil
+		},
+	}
+	handler := NewHandler(NewCachedStore(productStore, time.Minute), &mockOrderStore{}, &mockUserStore{}, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	type stockResponse struct {
+		Data types.ProductStock `json:"data"`
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		authenticated  bool
+		expectedStatus int
+		expectedStock  types.ProductStock
+	}{
+		{name: "in stock", path: "/products/5/stock", authenticated: true, expectedStatus: http.StatusOK, expectedStock: types.ProductStock{ProductID: 5, Quantity: 42, InStock: true}},
+		{name: "out of stock", path: "/products/6/stock", authenticated: true, expectedStatus: http.StatusOK, expectedStock: types.ProductStock{ProductID: 6}},
+		{name: "unknown product", path: "/products/404/stock", authenticated: true, expectedStatus: http.StatusNotFound},
+		{name: "invalid ID", path: "/products/abc/stock", authenticated: true, expectedStatus: http.StatusBadRequest},
+		{name: "store error", path: "/products/7/stock", authenticated: true, expectedStatus: http.StatusInternalServerError},
+		{name: "unauthenticated", path: "/products/5/stock", expectedStatus: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.authenticated {
+				header = authorized(t, 1)
+			}
+			rr := testutil.MakeRequest(t, router, http.MethodGet, tc.path, nil, header)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "no-store" {
+				t.Errorf("Expected Cache-Control %q, got %q", "no-store", cacheControl)
+			}
+			if got := testutil.DecodeJSON[stockResponse](t, rr.Body).Data; got != tc.expectedStock {
+				t.Errorf("Expected %+v, got %+v", tc.expectedStock, got)
+			}
+		})
+	}
+
+	t.Run("not cached", func(t *testing.T) {
+		stock[5] = 3
+		rr := testutil.MakeRequest(t, router, http.MethodGet, "/products/5/stock", nil, authorized(t, 1))
+		if got := testutil.DecodeJSON[stockResponse](t, rr.Body).Data; got.Quantity != 3 {
+			t.Errorf("Expected the stock to be read again, got %+v", got)
+		}
+	})
+}
+
+// TestBatchCreateProducts checks a batch is created in one go when every product is valid and not at all otherwise
+func TestBatchCreateProducts(t *testing.T) {
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	var created [][]*types.Product
+	productStore := &mockProductStore{
+		getProductByNameFunc: func(name string) (*types.Product, error) {
+			if name == "Existing Camera" {
+				return &types.Product{ID: 9, Name: name}, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+		createProductsFunc: func(products []*types.Product) error {
+			if products[0].Name == "Race Camera" {
+				return &BatchProductError{Index: 0, Err: ErrProductNameTaken}
+			}
+			for i, product := range products {
+				product.ID = 10 + i
+			}
+			created = append(created, products)
+			return nil
+		},
+	}
+	handler := NewHandler(productStore, &mockOrderStore{}, userStore, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, nil)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	valid := func(name string) types.CreateProductPayload {
+		return types.CreateProductPayload{Product: types.Product{Name: name, Description: "A camera", Image: "https://example.com/camera.jpg", Price: 250, Quantity: 3}}
+	}
+	invalid := valid("Broken Camera")
+	invalid.Price = 0
+	tooMany := make([]types.CreateProductPayload, maxBatchProducts+1)
+	for i := range tooMany {
+		tooMany[i] = valid(fmt.Sprintf("Camera %d", i))
+	}
+
+	testCases := []struct {
+		name            string
+		userID          int
+		products        []types.CreateProductPayload
+		expectedStatus  int
+		expectedCreated []int
+		expectedIndexes []int
+	}{
+		{name: "every product valid", userID: 1, products: []types.CreateProductPayload{valid("Camera A"), valid("Camera B")}, expectedStatus: http.StatusCreated, expectedCreated: []int{10, 11}},
+		{name: "some products invalid", userID: 1, products: []types.CreateProductPayload{valid("Camera A"), invalid, valid("Camera C"), {}}, expectedStatus: http.StatusBadRequest, expectedIndexes: []int{1, 3}},
+		{name: "name taken by an existing product", userID: 1, products: []types.CreateProductPayload{valid("Camera A"), valid("Existing Camera")}, expectedStatus: http.StatusConflict, expectedIndexes: []int{1}},
+		{name: "name repeated within the batch", userID: 1, products: []types.CreateProductPayload{valid("Camera A"), valid("camera a")}, expectedStatus: http.StatusConflict, expectedIndexes: []int{1}},
+		{name: "name taken while creating", userID: 1, products: []types.CreateProductPayload{valid("Race Camera")}, expectedStatus: http.StatusConflict, expectedIndexes: []int{0}},
+		{name: "empty batch", userID: 1, products: []types.CreateProductPayload{}, expectedStatus: http.StatusBadRequest},
+		{name: "batch too large", userID: 1, products: tooMany, expectedStatus: http.StatusBadRequest},
+		{name: "regular user", userID: 2, products: []types.CreateProductPayload{valid("Camera A")}, expectedStatus: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created = nil
+			rr := testutil.MakeRequest(t, router, http.MethodPost, "/admin/products/batch", types.BatchCreateProductsPayload{Products: tc.products}, authorized(t, tc.userID))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusCreated {
+				response := testutil.DecodeJSON[struct {
+					Data types.BatchCreateProductsResult `json:"data"`
+				}](t, rr.Body)
+				if !reflect.DeepEqual(response.Data.Created, tc.expectedCreated) || len(response.Data.Errors) != 0 {
+					t.Errorf("Expected products %v to be created without errors, got %+v", tc.expectedCreated, response.Data)
+				}
+				return
+			}
+
+			// a rejected batch creates nothing
+			if len(created) != 0 {
+				t.Errorf("Expected no products to be created, got %d batches", len(created))
+			}
+			if tc.expectedIndexes == nil {
+				return
+			}
+			response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+			indexes := []int{}
+			for _, productErr := range response.Error.Errors {
+				if productErr.Index == nil {
+					t.Fatalf("Expected every error to carry an index, got %+v", productErr)
+				}
+				indexes = append(indexes, *productErr.Index)
+			}
+			if !reflect.DeepEqual(indexes, tc.expectedIndexes) {
+				t.Errorf("Expected errors for products %v, got %+v", tc.expectedIndexes, response.Error.Errors)
+			}
+		})
+	}
+}
+
+// TestAdjustStock checks a batch of stock adjustments is applied in full or, when any would go negative, not at all
+func TestAdjustStock(t *testing.T) {
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	var stock map[int]int
+	productStore := &mockProductStore{
+		// adjusts a copy of the stock and only keeps it when every adjustment succeeds, like the transaction
+		adjustStockBatchFunc: func(adjustments []types.StockAdjustment) error {
+			adjusted := maps.Clone(stock)
+			for i, adjustment := range adjustments {
+				quantity, ok := adjusted[adjustment.ProductID]
+				if !ok {
+					return &BatchProductError{Index: i, Err: sql.ErrNoRows}
+				}
+				if quantity+adjustment.Delta < 0 {
+					return &BatchProductError{Index: i, Err: ErrNegativeStock}
+				}
+				adjusted[adjustment.ProductID] = quantity + adjustment.Delta
+			}
+			stock = adjusted
+			for i := range adjustments {
+				adjustments[i].Quantity = stock[adjustments[i].ProductID]
+			}
+			return nil
+		},
+	}
+	bus := events.NewInventoryBus()
+	updates, unsubscribe := bus.Subscribe(10)
+	defer unsubscribe()
+	handler := NewHandler(productStore, &mockOrderStore{}, userStore, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, bus)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+
+	testCases := []struct {
+		name           string
+		userID         int
+		body           string
+		expectedStatus int
+		expectedStock  map[int]int
+		expectedIndex  int
+	}{
+		{name: "every adjustment applied", userID: 1, body: `[{"productID": 1, "delta": 5}, {"productID": 2, "delta": -3}]`, expectedStatus: http.StatusOK, expectedStock: map[int]int{1: 15, 2: 0}},
+		{name: "adjustment going negative rolls back the batch", userID: 1, body: `[{"productID": 1, "delta": 5}, {"productID": 2, "delta": -4}]`, expectedStatus: http.StatusConflict, expectedStock: map[int]int{1: 10, 2: 3}, expectedIndex: 1},
+		{name: "unknown product", userID: 1, body: `[{"productID": 1, "delta": 5}, {"productID": 99, "delta": 1}]`, expectedStatus: http.StatusNotFound, expectedStock: map[int]int{1: 10, 2: 3}, expectedIndex: 1},
+		{name: "zero delta", userID: 1, body: `[{"productID": 1, "delta": 0}]`, expectedStatus: http.StatusBadRequest, expectedStock: map[int]int{1: 10, 2: 3}},
+		{name: "product adjusted twice", userID: 1, body: `[{"productID": 1, "delta": 1}, {"productID": 1, "delta": 1}]`, expectedStatus: http.StatusBadRequest, expectedStock: map[int]int{1: 10, 2: 3}, expectedIndex: 1},
+		{name: "empty batch", userID: 1, body: `[]`, expectedStatus: http.StatusBadRequest, expectedStock: map[int]int{1: 10, 2: 3}},
+		{name: "regular user", userID: 2, body: `[{"productID": 1, "delta": 5}]`, expectedStatus: http.StatusForbidden, expectedStock: map[int]int{1: 10, 2: 3}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stock = map[int]int{1: 10, 2: 3}
+			rr := testutil.MakeRequest(t, router, http.MethodPost, "/products/stock-adjustments", tc.body, authorized(t, tc.userID))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if !reflect.DeepEqual(stock, tc.expectedStock) {
+				t.Errorf("Expected stock %v, got %v", tc.expectedStock, stock)
+			}
+
+			if tc.expectedStatus != http.StatusOK {
+				if tc.expectedIndex == 0 {
+					return
+				}
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Index == nil || *response.Error.Index != tc.expectedIndex {
+					t.Errorf("Expected the error to point at adjustment %d, got %+v", tc.expectedIndex, response.Error)
+				}
+				return
+			}
+
+			response := testutil.DecodeJSON[struct {
+				Data []types.StockAdjustment `json:"data"`
+			}](t, rr.Body)
+			for _, adjustment := range response.Data {
+				if adjustment.Quantity != tc.expectedStock[adjustment.ProductID] {
+					t.Errorf("Expected product %d to have %d in stock, got %d", adjustment.ProductID, tc.expectedStock[adjustment.ProductID], adjustment.Quantity)
+				}
+				select {
+				case event := <-updates:
+					if event.ProductID != adjustment.ProductID || event.Quantity != adjustment.Quantity {
+						t.Errorf("Expected a stock update for product %d, got %+v", adjustment.ProductID, event)
+					}
+				default:
+					t.Errorf("Expected a stock update for product %d", adjustment.ProductID)
+				}
+			}
+		})
+	}
+}
+
+// TestInventoryStream checks only admins can open the inventory WebSocket and that they receive stock changes
+func TestInventoryStream(t *testing.T) {
+	userStore := &mockUserStore{users: map[int]*types.User{
+		1: {ID: 1, Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Role: types.RoleUser, IsActive: true},
+	}}
+	bus := events.NewInventoryBus()
+	handler := NewHandler(&mockProductStore{}, &mockOrderStore{}, userStore, &mockReviewStore{}, &mockImageStore{}, &mockPriceAlertStore{}, &mockWarehouseStore{}, nil, bus)
+	router := mux.NewRouter()
+	handler.ProductRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	token := func(userID int) string {
+		t.Helper()
+		return strings.TrimPrefix(authHeader(t, userID), "Bearer ")
+	}
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "no token", query: "", expectedStatus: http.StatusUnauthorized},
+		{name: "invalid token", query: "?token=garbage", expectedStatus: http.StatusUnauthorized},
+		{name: "customer", query: "?token=" + token(2), expectedStatus: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/ws/admin/inventory" + tc.query)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	t.Run("admin receives stock changes", func(t *testing.T) {
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/admin/inventory?token=" + token(1)
+		ws, err := websocket.Dial(wsURL, "", server.URL)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer ws.Close()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		// the handler subscribes once the upgrade is done, so keep publishing until the update arrives
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				bus.Publish(events.InventoryEvent{ProductID: 1, Quantity: 5})
+				select {
+				case <-done:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+
+		var message map[string]int
+		if err := websocket.JSON.Receive(ws, &message); err != nil {
+			t.Fatalf("Failed to receive stock change: %v", err)
+		}
+		if message["productID"] != 1 || message["quantity"] != 5 {
+			t.Errorf("Unexpected message %v", message)
+		}
+	})
+}
+
+// mockProductStore implements the types.ProductStore interface for testing
+type mockProductStore struct {
+	getProductsFunc        func(filter types.ProductFilter) ([]types.Product, error)
+	createProductFunc      func(product *types.Product) error
+	createProductsFunc     func(products []*types.Product) error
+	adjustStockBatchFunc   func(adjustments []types.StockAdjustment) error
+	getProductsByIDsFunc   func(ids []int) ([]types.Product, error)
+	getProductByIDFunc     func(id int) (*types.Product, error)
+	getProductByNameFunc   func(name string) (*types.Product, error)
+	getProductBySKUFunc    func(sku string) (*types.Product, error)
+	getProductStockFunc    func(id int) (int, error)
+	getRelatedProductsFunc func(productID, limit int) ([]types.Product, error)
+	searchProductsFunc     func(query string, page, limit int) ([]types.Product, int, error)
+	getSummariesFunc       func(page, limit int) ([]types.ProductSummary, int, error)
+	getFeaturedFunc        func(limit int) ([]types.Product, error)
+	setFeaturedFunc        func(productID int, featured bool) error
+	updateProductPriceFunc func(id int, price types.Price) error
+}
+
+func (m *mockProductStore) GetProducts(ctx context.Context, filter types.ProductFilter) ([]types.Product, error) {
+	if m.getProductsFunc != nil {
+		return m.getProductsFunc(filter)
+	}
+	return nil, fmt.Errorf("products not found")
+}
+
+func (m *mockProductStore) GetProductBySKU(ctx context.Context, sku string) (*types.Product, error) {
+	if m.getProductBySKUFunc != nil {
+		return m.getProductBySKUFunc(sku)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetRelatedProducts(ctx context.Context, productID, limit int) ([]types.Product, error) {
+	if m.getRelatedProductsFunc != nil {
+		return m.getRelatedProductsFunc(productID, limit)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) SearchProducts(ctx context.Context, query string, page, limit int) ([]types.Product, int, error) {
+	if m.searchProductsFunc != nil {
+		return m.searchProductsFunc(query, page, limit)
+	}
+	return []types.Product{}, 0, nil
+}
+
+func (m *mockProductStore) GetProductSummaries(ctx context.Context, page, limit int) ([]types.ProductSummary, int, error) {
+	if m.getSummariesFunc != nil {
+		return m.getSummariesFunc(page, limit)
+	}
+	return []types.ProductSummary{}, 0, nil
+}
+
+func (m *mockProductStore) GetFeaturedProducts(ctx context.Context, limit int) ([]types.Product, error) {
+	if m.getFeaturedFunc != nil {
+		return m.getFeaturedFunc(limit)
+	}
+	return []types.Product{}, nil
+}
+
+func (m *mockProductStore) SetFeatured(ctx context.Context, productID int, featured bool) error {
+	if m.setFeaturedFunc != nil {
+		return m.setFeaturedFunc(productID, featured)
+	}
+	return nil
+}
+
+func (m *mockProductStore) CreateProduct(ctx context.Context, product *types.Product) error {
 	if m.createProductFunc != nil {
 		return m.createProductFunc(product)
 	}
 	return nil
 }
 
-func (m *mockProductStore) GetProductsByIDs(ids []int) ([]types.Product, error) {
+func (m *mockProductStore) CreateProducts(ctx context.Context, products []*types.Product) error {
+	if m.createProductsFunc != nil {
+		return m.createProductsFunc(products)
+	}
+	for i, product := range products {
+		product.ID = i + 1
+	}
+	return nil
+}
+
+func (m *mockProductStore) AdjustStockBatch(ctx context.Context, adjustments []types.StockAdjustment) error {
+	if m.adjustStockBatchFunc != nil {
+		return m.adjustStockBatchFunc(adjustments)
+	}
+	return nil
+}
+
+func (m *mockProductStore) GetProductsByIDs(ctx context.Context, ids []int) ([]types.Product, error) {
 	if m.getProductsByIDsFunc != nil {
 		return m.getProductsByIDsFunc(ids)
 	}
 	return nil, fmt.Errorf("products not found")
 }
+
+func (m *mockProductStore) UpdateProductPrice(ctx context.Context, id int, price types.Price) error {
+	if m.updateProductPriceFunc != nil {
+		return m.updateProductPriceFunc(id, price)
+	}
+	return nil
+}
+
+func (m *mockProductStore) GetProductStock(ctx context.Context, id int) (int, error) {
+	if m.getProductStockFunc != nil {
+		return m.getProductStockFunc(id)
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductByID(ctx context.Context, id int) (*types.Product, error) {
+	if m.getProductByIDFunc != nil {
+		return m.getProductByIDFunc(id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProductByName(ctx context.Context, name string) (*types.Product, error) {
+	if m.getProductByNameFunc != nil {
+		return m.getProductByNameFunc(name)
+	}
+	return nil, sql.ErrNoRows
+}
+
+// mockReviewStore implements the types.ReviewStore interface for testing
+// Reviews are kept in memory and the one-review-per-user rule is enforced like the unique index does
+type mockReviewStore struct {
+	reviews []types.Review
+}
+
+func (m *mockReviewStore) CreateReview(ctx context.Context, review *types.Review) error {
+	for _, existing := range m.reviews {
+		if existing.UserID == review.UserID && existing.ProductID == review.ProductID {
+			return ErrAlreadyReviewed
+		}
+	}
+	review.ID = len(m.reviews) + 1
+	m.reviews = append(m.reviews, *review)
+	return nil
+}
+
+func (m *mockReviewStore) GetReviewsByProduct(ctx context.Context, productID int) ([]types.Review, error) {
+	reviews := []types.Review{}
+	for _, review := range m.reviews {
+		if review.ProductID == productID {
+			reviews = append(reviews, review)
+		}
+	}
+	return reviews, nil
+}
+
+func (m *mockReviewStore) GetAverageRating(ctx context.Context, productID int) (float64, error) {
+	reviews, _ := m.GetReviewsByProduct(ctx, productID)
+	if len(reviews) == 0 {
+		return 0, nil
+	}
+	sum := 0
+	for _, review := range reviews {
+		sum += review.Rating
+	}
+	return float64(sum) / float64(len(reviews)), nil
+}
+
+// mockPriceAlertStore implements the types.PriceAlertStore interface for testing
+// Alerts are kept in memory, one per user and product
+type mockPriceAlertStore struct {
+	mu     sync.Mutex // The notifier marks alerts from its own goroutine
+	alerts []types.PriceAlert
+}
+
+func (m *mockPriceAlertStore) CreateAlert(ctx context.Context, alert *types.PriceAlert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.alerts {
+		if existing.UserID == alert.UserID && existing.ProductID == alert.ProductID {
+			alert.ID = existing.ID
+			m.alerts[i] = *alert
+			return nil
+		}
+	}
+	alert.ID = len(m.alerts) + 1
+	m.alerts = append(m.alerts, *alert)
+	return nil
+}
+
+func (m *mockPriceAlertStore) DeleteAlert(ctx context.Context, userID, productID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, alert := range m.alerts {
+		if alert.UserID == userID && alert.ProductID == productID {
+			m.alerts = append(m.alerts[:i], m.alerts[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockPriceAlertStore) GetAlertsForProduct(ctx context.Context, productID int, newPrice float64) ([]types.PriceAlert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alerts := []types.PriceAlert{}
+	for _, alert := range m.alerts {
+		if alert.ProductID == productID && !alert.Notified && float64(alert.TargetPrice) >= newPrice {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+func (m *mockPriceAlertStore) MarkAlertsNotified(ctx context.Context, ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		for i := range m.alerts {
+			if m.alerts[i].ID == id {
+				m.alerts[i].Notified = true
+			}
+		}
+	}
+	return nil
+}
+
+// mockWarehouseStore implements the types.WarehouseStore interface for testing
+// It records the radius of the last search
+type mockWarehouseStore struct {
+	products []types.NearbyProduct
+	radiusKm float64
+}
+
+func (m *mockWarehouseStore) GetProductsNearby(ctx context.Context, latitude, longitude, radiusKm float64) ([]types.NearbyProduct, error) {
+	m.radiusKm = radiusKm
+	return m.products, nil
+}
+
+// mockImageStore implements the types.ImageStore interface for testing
+// Images are kept in memory in gallery order
+type mockImageStore struct {
+	images []types.ProductImage
+}
+
+func (m *mockImageStore) AddImage(ctx context.Context, image *types.ProductImage) error {
+	existing, _ := m.GetImagesByProduct(ctx, image.ProductID)
+	image.ID = len(m.images) + 1
+	image.SortOrder = len(existing)
+	if len(existing) == 0 {
+		image.IsPrimary = true
+	}
+	m.images = append(m.images, *image)
+	return nil
+}
+
+func (m *mockImageStore) DeleteImage(ctx context.Context, productID, imageID int) error {
+	for i, image := range m.images {
+		if image.ID == imageID && image.ProductID == productID {
+			m.images = append(m.images[:i], m.images[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockImageStore) ReorderImages(ctx context.Context, productID int, imageIDs []int) error {
+	existing, _ := m.GetImagesByProduct(ctx, productID)
+	if len(existing) != len(imageIDs) {
+		return ErrInvalidImageOrder
+	}
+	for sortOrder, id := range imageIDs {
+		found := false
+		for i := range m.images {
+			if m.images[i].ID == id && m.images[i].ProductID == productID {
+				m.images[i].SortOrder = sortOrder
+				found = true
+			}
+		}
+		if !found {
+			return ErrInvalidImageOrder
+		}
+	}
+	return nil
+}
+
+func (m *mockImageStore) GetImagesByProduct(ctx context.Context, productID int) ([]types.ProductImage, error) {
+	images := []types.ProductImage{}
+	for _, image := range m.images {
+		if image.ProductID == productID {
+			images = append(images, image)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].SortOrder < images[j].SortOrder })
+	return images, nil
+}
+
+// mockOrderStore implements the types.OrderStore interface for testing
+type mockOrderStore struct {
+	getOrdersByProductIDFunc func(productID, page, limit int) ([]types.Order, int, error)
+}
+
+func (m *mockOrderStore) CreateOrders(ctx context.Context, orders []*types.Order) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateReservedOrder(ctx context.Context, order *types.Order, reservationID int) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrders(ctx context.Context, userID int) ([]types.Order, error) {
+	return []types.Order{}, nil
+}
+
+func (m *mockOrderStore) GetOrdersByStatus(ctx context.Context, userID int, status string, page, limit int) ([]types.Order, int, error) {
+	return []types.Order{}, 0, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(ctx context.Context, id int) (*types.Order, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) GetOrderItems(ctx context.Context, orderIDs []int) (map[int][]types.OrderItem, error) {
+	return map[int][]types.OrderItem{}, nil
+}
+
+func (m *mockOrderStore) GetOrdersByProductID(ctx context.Context, productID, page, limit int) ([]types.Order, int, error) {
+	if m.getOrdersByProductIDFunc != nil {
+		return m.getOrdersByProductIDFunc(productID, page, limit)
+	}
+	return []types.Order{}, 0, nil
+}
+
+func (m *mockOrderStore) UpdateOrderItem(ctx context.Context, orderID, productID int, variantID *int, newQuantity int) error {
+	return nil
+}
+
+func (m *mockOrderStore) ExportOrders(ctx context.Context, userID int, from, to time.Time, fn func(types.OrderSummary) error) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetPurchasedProducts(ctx context.Context, userID int) ([]types.PurchasedProduct, error) {
+	return []types.PurchasedProduct{}, nil
+}
+
+// mockUserStore implements the types.UserStore interface for testing
+// Only GetUserByID is backed by data, which is all the role middleware needs
+type mockUserStore struct {
+	users map[int]*types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	return nil
+}
+
+func (m *mockUserStore) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	return []types.LoginEvent{}, 0, nil
+}
+
+func (m *mockUserStore) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	return []types.User{}, nil
+}
+
+func (m *mockUserStore) CountUsers(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (m *mockUserStore) DeactivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) ActivateUser(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(ctx context.Context, user *types.User) error {
+	return nil
+}
+
+// authHeader returns a valid Authorization header value for the given user ID
+func authHeader(t *testing.T, userID int) string {
+	t.Helper()
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// authorized returns request headers authenticating as the given user ID
+func authorized(t *testing.T, userID int) http.Header {
+	t.Helper()
+	return http.Header{"Authorization": {authHeader(t, userID)}}
+}
@@ -1,34 +1,221 @@
 package products
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/tracing"
 	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
 )
 
+// ErrProductNameTaken is returned when a product with the same name already exists
+var ErrProductNameTaken = errors.New("product with this name already exists")
+
+// ErrProductSKUTaken is returned when a product with the same SKU already exists
+var ErrProductSKUTaken = errors.New("a product with this SKU already exists")
+
+// ErrInvalidSearchQuery is returned when MySQL can't parse a search query's boolean mode operators
+var ErrInvalidSearchQuery = errors.New("q is not a valid search query, check its quotes and operators")
+
+// productReviews selects the average rating and review count of the product p, both 0 when it has no reviews
+// The subqueries are correlated on p.id, so only the reviews of the products read are aggregated, through the productId index
+const productReviews = `
+		COALESCE((SELECT AVG(rating) FROM reviews WHERE productId = p.id), 0),
+		(SELECT COUNT(*) FROM reviews WHERE productId = p.id)`
+
+// selectProducts selects every product column followed by the product's review aggregate
+const selectProducts = `
+	SELECT p.id, p.name, COALESCE(p.sku, ''), COALESCE(p.category, ''), p.isFeatured, p.description, p.image, p.price, p.currency, p.quantity, p.createdAt,` + productReviews + `
+	FROM products p
+`
+
 // Store represents the user data store
 // It implements the types.ProductStore interface
 type Store struct {
-	db *sql.DB // Database connection
+	db *db.DB // Database connection, every query runs with DB_QUERY_TIMEOUT and is logged when slower than SLOW_QUERY_MS
 }
 
 // NewStore creates a new instance of the user Store
 // Takes a database connection as a parameter
-func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+func NewStore(conn *sql.DB) *Store {
+	return &Store{db: db.WithQueryTimeout(conn).LogConfiguredSlowQueries()}
 }
 
 // GetProductByID retrieves a product from the database by its ID
-func (s *Store) GetProductByID() ([]types.Product, error) {
-	query := "SELECT * FROM products"
-	rows, err := s.db.Query(query)
+// Returns sql.ErrNoRows if no product has the given ID
+func (s *Store) GetProductByID(ctx context.Context, id int) (*types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductByID").End()
+
+	rows, err := s.db.Query(selectProducts+"WHERE p.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	return scanRowsIntoProduct(rows)
+}
+
+// GetProductByName retrieves a product from the database by its exact name
+// Returns sql.ErrNoRows if no product has the given name
+func (s *Store) GetProductByName(ctx context.Context, name string) (*types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductByName").End()
+
+	rows, err := s.db.Query(selectProducts+"WHERE p.name = ?", name)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	return scanRowsIntoProduct(rows)
+}
+
+// GetProductBySKU retrieves a product from the database by its SKU
+// Returns sql.ErrNoRows if no product has the given SKU
+func (s *Store) GetProductBySKU(ctx context.Context, sku string) (*types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductBySKU").End()
+
+	rows, err := s.db.Query(selectProducts+"WHERE p.sku = ?", sku)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, sql.ErrNoRows
+	}
+	return scanRowsIntoProduct(rows)
+}
+
+// GetProductStock returns how many units of a product are in stock
+// Returns sql.ErrNoRows if no product has the given ID
+func (s *Store) GetProductStock(ctx context.Context, id int) (int, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductStock").End()
+
+	var quantity int
+	if err := s.db.QueryRow("SELECT quantity FROM products WHERE id = ?", id).Scan(&quantity); err != nil {
+		return 0, err
+	}
+	return quantity, nil
+}
+
+// matchProducts is the full-text condition product search filters and ranks by, it takes the search query
+// Boolean mode lets the query use operators such as +required, -excluded and prefix*
+const matchProducts = "MATCH(p.name, p.description) AGAINST(? IN BOOLEAN MODE)"
+
+// SearchProducts returns a page of the products matching a full-text query, most relevant first
+// The total counts every matching product
+// Returns ErrInvalidSearchQuery when the query's boolean mode operators don't parse, e.g. an unbalanced quote
+func (s *Store) SearchProducts(ctx context.Context, query string, page, limit int) ([]types.Product, int, error) {
+	defer tracing.StartDBSpan(ctx, "SearchProducts").End()
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM products p WHERE "+matchProducts, query).Scan(&total); err != nil {
+		if db.IsParseError(err) {
+			return nil, 0, ErrInvalidSearchQuery
+		}
+		return nil, 0, fmt.Errorf("error counting matching products: %w", err)
+	}
+
+	rows, err := s.db.Query(
+		selectProducts+"WHERE "+matchProducts+" ORDER BY "+matchProducts+" DESC, p.id ASC LIMIT ? OFFSET ?",
+		query, query, limit, (page-1)*limit,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []types.Product{}
+	for rows.Next() {
+		product, err := scanRowsIntoProduct(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		products = append(products, *product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// GetProductSummaries returns a page of product IDs and names ordered by name, and the total number of products
+func (s *Store) GetProductSummaries(ctx context.Context, page, limit int) ([]types.ProductSummary, int, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductSummaries").End()
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM products").Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting products: %w", err)
+	}
+
+	rows, err := s.db.Query("SELECT id, name FROM products ORDER BY name ASC, id ASC LIMIT ? OFFSET ?", limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error getting product summaries: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []types.ProductSummary{}
+	for rows.Next() {
+		var summary types.ProductSummary
+		if err := rows.Scan(&summary.ID, &summary.Name); err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return summaries, total, nil
+}
+
+// GetRelatedProducts returns up to limit other products in the same category as a product, newest first
+// Uncategorized products get the newest other products instead
+// Returns sql.ErrNoRows if no product has the given ID
+func (s *Store) GetRelatedProducts(ctx context.Context, productID, limit int) ([]types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetRelatedProducts").End()
+
+	var category string
+	if err := s.db.QueryRow("SELECT COALESCE(category, '') FROM products WHERE id = ?", productID).Scan(&category); err != nil {
+		return nil, err
+	}
+
+	query := selectProducts + "WHERE p.id <> ?"
+	args := []interface{}{productID}
+	if category != "" {
+		query += " AND p.category = ?"
+		args = append(args, category)
+	}
+	query += " ORDER BY p.createdAt DESC, p.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	products := []types.Product{}
 	for rows.Next() {
 		product, err := scanRowsIntoProduct(rows)
@@ -37,44 +224,255 @@ func (s *Store) GetProductByID() ([]types.Product, error) {
 		}
 		products = append(products, *product)
 	}
-	return products, nil
+	return products, rows.Err()
 }
 
-// CreateProduct creates a new product in the database
-func (s *Store) CreateProduct(product *types.Product) error {
-	query := `
-		INSERT INTO products (name, description, image, price, quantity, createdAt)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`
+// CreateProduct creates a new product in the database along with its image gallery, if any
+// Gallery images are stored in the order given and their IDs are filled in
+// Returns ErrProductSKUTaken or ErrProductNameTaken if the unique SKU or name index rejects the insert
+func (s *Store) CreateProduct(ctx context.Context, product *types.Product) error {
+	defer tracing.StartDBSpan(ctx, "CreateProduct").End()
+
+	err := utils.RetryOnTransient(func() error {
+		_, err := s.insertProducts([]*types.Product{product})
+		return err
+	}, utils.TransientRetryAttempts, utils.TransientRetryBackoff)
+	return productWriteError(err)
+}
+
+// BatchProductError reports which product of a batch failed
+type BatchProductError struct {
+	Index int   // Position of the product in the batch
+	Err   error // Why the product failed
+}
+
+func (e *BatchProductError) Error() string {
+	return fmt.Sprintf("product %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchProductError) Unwrap() error {
+	return e.Err
+}
+
+// CreateProducts creates several products with their image galleries in a single transaction, filling in their IDs
+// Either every product is created or none are
+// Returns a *BatchProductError wrapping ErrProductSKUTaken, ErrProductNameTaken or the database error of the first product that fails
+func (s *Store) CreateProducts(ctx context.Context, products []*types.Product) error {
+	defer tracing.StartDBSpan(ctx, "CreateProducts").End()
+
+	var index int
+	err := utils.RetryOnTransient(func() error {
+		var err error
+		index, err = s.insertProducts(products)
+		return err
+	}, utils.TransientRetryAttempts, utils.TransientRetryBackoff)
+	if err != nil && index >= 0 {
+		return &BatchProductError{Index: index, Err: productWriteError(err)}
+	}
+	return err
+}
 
-	// Set the creation time if not already set
-	if product.CreatedAt.IsZero() {
-		product.CreatedAt = time.Now()
+// ErrNegativeStock is returned when a stock adjustment would take more units out of a product's stock than it holds
+var ErrNegativeStock = errors.New("adjustment would make stock negative")
+
+// AdjustStockBatch applies stock adjustments in a single transaction, filling in each product's resulting quantity
+// If any adjustment would make stock negative or names an unknown product, none are applied
+// Returns a *BatchProductError wrapping ErrNegativeStock, sql.ErrNoRows or the database error of the first adjustment that fails
+func (s *Store) AdjustStockBatch(ctx context.Context, adjustments []types.StockAdjustment) error {
+	defer tracing.StartDBSpan(ctx, "AdjustStockBatch").End()
+
+	quantities := make([]int, len(adjustments))
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		for i, adjustment := range adjustments {
+			// Lock the product so a concurrent checkout can't take stock between the check and the update
+			var quantity int
+			if err := tx.QueryRow("SELECT quantity FROM products WHERE id = ? FOR UPDATE", adjustment.ProductID).Scan(&quantity); err != nil {
+				return &BatchProductError{Index: i, Err: err}
+			}
+			quantity += adjustment.Delta
+			if quantity < 0 {
+				return &BatchProductError{Index: i, Err: ErrNegativeStock}
+			}
+			if _, err := tx.Exec("UPDATE products SET quantity = ? WHERE id = ?", quantity, adjustment.ProductID); err != nil {
+				return &BatchProductError{Index: i, Err: err}
+			}
+			quantities[i] = quantity
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range adjustments {
+		adjustments[i].Quantity = quantities[i]
+	}
+	return nil
+}
+
+// productWriteError maps a duplicate key error on the products table to the unique index that raised it
+// Duplicates on any other index, such as one added later, are returned unchanged rather than blamed on the name
+func productWriteError(err error) error {
+	if db.IsDuplicateKey(err, "idx_products_sku") {
+		return ErrProductSKUTaken
+	}
+	if db.IsDuplicateKey(err, "idx_products_name") {
+		return ErrProductNameTaken
+	}
+	return err
+}
+
+// insertProducts inserts products and their galleries in one transaction
+// Products without a creation time or currency get the current time and the default currency
+// IDs are only set once the transaction commits so a retried attempt starts clean
+// On failure it returns the index of the product that failed, or -1 when the transaction itself failed
+func (s *Store) insertProducts(products []*types.Product) (int, error) {
+	failed := -1
+	productIDs := make([]int, len(products))
+	imageIDs := make([][]int, len(products))
+	err := db.WithTransaction(s.db, func(tx *db.Tx) error {
+		for i, product := range products {
+			if product.CreatedAt.IsZero() {
+				product.CreatedAt = time.Now()
+			}
+			if product.Currency == "" {
+				product.Currency = types.DefaultCurrency
+			}
+			var err error
+			productIDs[i], imageIDs[i], err = insertProduct(tx, product)
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return failed, err
 	}
+	for i, product := range products {
+		product.ID = productIDs[i]
+		for j := range product.Images {
+			product.Images[j].ID = imageIDs[i][j]
+			product.Images[j].ProductID = product.ID
+		}
+	}
+	return -1, nil
+}
 
-	result, err := s.db.Exec(
-		query,
+// insertProduct inserts a product and its gallery within tx
+// Returns the ID of the product and of each of its images
+func insertProduct(tx *db.Tx, product *types.Product) (int, []int, error) {
+	result, err := tx.Exec(`
+		INSERT INTO products (name, sku, category, description, image, price, currency, quantity, createdAt)
+		VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+	`,
 		product.Name,
+		product.SKU,
+		product.Category,
 		product.Description,
 		product.Image,
 		product.Price,
+		product.Currency,
 		product.Quantity,
 		product.CreatedAt,
 	)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 
 	// Get the ID of the newly created product
-	id, err := result.LastInsertId()
+	productID, err := result.LastInsertId()
 	if err != nil {
+		return 0, nil, err
+	}
+
+	imageIDs := make([]int, len(product.Images))
+	for i, image := range product.Images {
+		result, err := tx.Exec(
+			"INSERT INTO product_images (productId, url, sortOrder, isPrimary) VALUES (?, ?, ?, ?)",
+			productID, image.URL, image.SortOrder, image.IsPrimary,
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, nil, err
+		}
+		imageIDs[i] = int(id)
+	}
+	return int(productID), imageIDs, nil
+}
+
+// UpdateProductPrice sets the price of a product
+// Returns sql.ErrNoRows if no product has the given ID
+func (s *Store) UpdateProductPrice(ctx context.Context, id int, price types.Price) error {
+	defer tracing.StartDBSpan(ctx, "UpdateProductPrice").End()
+
+	// MySQL reports 0 affected rows when the price doesn't change, so check the product exists separately
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)", id).Scan(&exists); err != nil {
 		return err
 	}
-	product.ID = int(id)
-	return nil
+	if !exists {
+		return sql.ErrNoRows
+	}
+	_, err := s.db.Exec("UPDATE products SET price = ? WHERE id = ?", price, id)
+	return err
 }
 
-func (s *Store) GetProductsByIDs(ids []int) ([]types.Product, error) {
+// SetFeatured adds a product to or removes it from the featured listing
+// A product keeps its place in the listing when it is featured again while already featured
+// Returns sql.ErrNoRows if no product has the given ID
+func (s *Store) SetFeatured(ctx context.Context, productID int, featured bool) error {
+	defer tracing.StartDBSpan(ctx, "SetFeatured").End()
+
+	// MySQL reports 0 affected rows when nothing changes, so check the product exists separately
+	var exists bool
+	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)", productID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	query := "UPDATE products SET isFeatured = FALSE, featuredAt = NULL WHERE id = ?"
+	if featured {
+		query = "UPDATE products SET isFeatured = TRUE, featuredAt = COALESCE(featuredAt, CURRENT_TIMESTAMP) WHERE id = ?"
+	}
+	_, err := s.db.Exec(query, productID)
+	return err
+}
+
+// GetFeaturedProducts returns up to limit featured products, the most recently featured first
+func (s *Store) GetFeaturedProducts(ctx context.Context, limit int) ([]types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetFeaturedProducts").End()
+
+	rows, err := s.db.Query(selectProducts+"WHERE p.isFeatured ORDER BY p.featuredAt DESC, p.id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting featured products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []types.Product{}
+	for rows.Next() {
+		product, err := scanRowsIntoProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetProductsByIDs retrieves the products with the given IDs
+// Products are returned in the order their IDs first appear in ids, IDs without a product are skipped
+func (s *Store) GetProductsByIDs(ctx context.Context, ids []int) ([]types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductsByIDs").End()
+
 	if len(ids) == 0 {
 		return []types.Product{}, nil
 	}
@@ -87,33 +485,51 @@ func (s *Store) GetProductsByIDs(ids []int) ([]types.Product, error) {
 		args[i] = id
 	}
 
-	query := fmt.Sprintf("SELECT * FROM products WHERE id IN (%s)", strings.Join(placeholders, ","))
+	query := fmt.Sprintf("%sWHERE p.id IN (%s)", selectProducts, strings.Join(placeholders, ","))
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	products := []types.Product{}
+	found := make(map[int]types.Product, len(ids))
 	for rows.Next() {
 		product, err := scanRowsIntoProduct(rows)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, *product)
+		found[product.ID] = *product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// MySQL returns the rows in whatever order it likes, so put them back in the requested order
+	products := make([]types.Product, 0, len(found))
+	for _, id := range ids {
+		if product, ok := found[id]; ok {
+			products = append(products, product)
+			delete(found, id)
+		}
 	}
 	return products, nil
 }
 
-func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
+func scanRowsIntoProduct(rows *db.Rows) (*types.Product, error) {
 	product := &types.Product{}
 	err := rows.Scan(
 		&product.ID,
 		&product.Name,
+		&product.SKU,
+		&product.Category,
+		&product.IsFeatured,
 		&product.Description,
 		&product.Image,
 		&product.Price,
+		&product.Currency,
 		&product.Quantity,
 		&product.CreatedAt,
+		&product.AverageRating,
+		&product.ReviewCount,
 	)
 	if err != nil {
 		return nil, err
@@ -121,10 +537,31 @@ func scanRowsIntoProduct(rows *sql.Rows) (*types.Product, error) {
 	return product, nil
 }
 
-// GetProducts retrieves all products from the database
-func (s *Store) GetProducts() ([]types.Product, error) {
-	query := "SELECT * FROM products"
-	rows, err := s.db.Query(query)
+// GetProducts retrieves the products matching the filter from the database, newest first
+func (s *Store) GetProducts(ctx context.Context, filter types.ProductFilter) ([]types.Product, error) {
+	defer tracing.StartDBSpan(ctx, "GetProducts").End()
+
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.InStock {
+		conditions = append(conditions, "p.quantity > 0")
+	}
+	if filter.After != nil {
+		conditions = append(conditions, "(p.createdAt, p.id) < (?, ?)")
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+	}
+
+	query := selectProducts
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ")
+	}
+	// newest first, with the ID as a tie breaker so a cursor always points at a single product
+	query += " ORDER BY p.createdAt DESC, p.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -139,3 +576,533 @@ func (s *Store) GetProducts() ([]types.Product, error) {
 	}
 	return products, nil
 }
+
+// ErrVariantSKUTaken is returned when a variant with the same SKU already exists
+var ErrVariantSKUTaken = errors.New("variant with this SKU already exists")
+
+const variantColumns = "id, productId, sku, attributes, price, quantity, createdAt"
+
+// CreateVariant creates a new product variant in the database
+// Returns ErrVariantSKUTaken if the unique SKU index rejects the insert
+func (s *Store) CreateVariant(ctx context.Context, variant *types.ProductVariant) error {
+	defer tracing.StartDBSpan(ctx, "CreateVariant").End()
+
+	attributes, err := json.Marshal(variant.Attributes)
+	if err != nil {
+		return err
+	}
+	if variant.CreatedAt.IsZero() {
+		variant.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO product_variants (productId, sku, attributes, price, quantity, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := s.db.Exec(query, variant.ProductID, variant.SKU, attributes, variant.Price, variant.Quantity, variant.CreatedAt)
+	if db.IsDuplicateKey(err, "idx_product_variants_sku") {
+		return ErrVariantSKUTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	variant.ID = int(id)
+	return nil
+}
+
+// GetVariantByID retrieves a product variant from the database by its ID
+// Returns sql.ErrNoRows if no variant has the given ID
+func (s *Store) GetVariantByID(ctx context.Context, id int) (*types.ProductVariant, error) {
+	defer tracing.StartDBSpan(ctx, "GetVariantByID").End()
+
+	row := s.db.QueryRow("SELECT "+variantColumns+" FROM product_variants WHERE id = ?", id)
+	return scanVariant(row)
+}
+
+// GetVariantsByProductID retrieves all variants of a product
+func (s *Store) GetVariantsByProductID(ctx context.Context, productID int) ([]types.ProductVariant, error) {
+	defer tracing.StartDBSpan(ctx, "GetVariantsByProductID").End()
+
+	rows, err := s.db.Query("SELECT "+variantColumns+" FROM product_variants WHERE productId = ? ORDER BY id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVariants(rows)
+}
+
+// GetVariantsByIDs retrieves the variants with the given IDs
+// Variants that don't exist are left out of the result
+func (s *Store) GetVariantsByIDs(ctx context.Context, ids []int) ([]types.ProductVariant, error) {
+	defer tracing.StartDBSpan(ctx, "GetVariantsByIDs").End()
+
+	if len(ids) == 0 {
+		return []types.ProductVariant{}, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM product_variants WHERE id IN (%s)", variantColumns, strings.Join(placeholders, ","))
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVariants(rows)
+}
+
+// UpdateVariant updates the SKU, attributes, price and quantity of a variant
+func (s *Store) UpdateVariant(ctx context.Context, variant *types.ProductVariant) error {
+	defer tracing.StartDBSpan(ctx, "UpdateVariant").End()
+
+	attributes, err := json.Marshal(variant.Attributes)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE product_variants SET sku = ?, attributes = ?, price = ?, quantity = ? WHERE id = ?"
+	_, err = s.db.Exec(query, variant.SKU, attributes, variant.Price, variant.Quantity, variant.ID)
+	if db.IsDuplicateKey(err, "idx_product_variants_sku") {
+		return ErrVariantSKUTaken
+	}
+	return err
+}
+
+// DeleteVariant removes a variant from the database
+// Returns sql.ErrNoRows if no variant has the given ID
+func (s *Store) DeleteVariant(ctx context.Context, id int) error {
+	defer tracing.StartDBSpan(ctx, "DeleteVariant").End()
+
+	result, err := s.db.Exec("DELETE FROM product_variants WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanVariant(row rowScanner) (*types.ProductVariant, error) {
+	variant := &types.ProductVariant{}
+	var attributes []byte
+	err := row.Scan(
+		&variant.ID,
+		&variant.ProductID,
+		&variant.SKU,
+		&attributes,
+		&variant.Price,
+		&variant.Quantity,
+		&variant.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(attributes, &variant.Attributes); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+func scanVariants(rows *db.Rows) ([]types.ProductVariant, error) {
+	variants := []types.ProductVariant{}
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, *variant)
+	}
+	return variants, rows.Err()
+}
+
+// ErrAlreadyReviewed is returned when a user reviews a product they have already reviewed
+var ErrAlreadyReviewed = errors.New("you have already reviewed this product")
+
+// CreateReview stores a user's review of a product
+// Returns ErrAlreadyReviewed if the user has already reviewed the product
+func (s *Store) CreateReview(ctx context.Context, review *types.Review) error {
+	defer tracing.StartDBSpan(ctx, "CreateReview").End()
+
+	if review.CreatedAt.IsZero() {
+		review.CreatedAt = time.Now()
+	}
+	query := "INSERT INTO reviews (userId, productId, rating, comment, createdAt) VALUES (?, ?, ?, ?, ?)"
+	result, err := s.db.Exec(query, review.UserID, review.ProductID, review.Rating, review.Comment, review.CreatedAt)
+	if db.IsDuplicateEntry(err) {
+		return ErrAlreadyReviewed
+	}
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	review.ID = int(id)
+	return nil
+}
+
+// GetReviewsByProduct retrieves all reviews of a product, newest first
+func (s *Store) GetReviewsByProduct(ctx context.Context, productID int) ([]types.Review, error) {
+	defer tracing.StartDBSpan(ctx, "GetReviewsByProduct").End()
+
+	query := `
+		SELECT id, userId, productId, rating, comment, createdAt
+		FROM reviews
+		WHERE productId = ?
+		ORDER BY createdAt DESC, id DESC
+	`
+	rows, err := s.db.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []types.Review{}
+	for rows.Next() {
+		var review types.Review
+		if err := rows.Scan(
+			&review.ID,
+			&review.UserID,
+			&review.ProductID,
+			&review.Rating,
+			&review.Comment,
+			&review.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// GetAverageRating returns the mean rating of a product, or 0 if it has no reviews
+func (s *Store) GetAverageRating(ctx context.Context, productID int) (float64, error) {
+	defer tracing.StartDBSpan(ctx, "GetAverageRating").End()
+
+	var average sql.NullFloat64
+	if err := s.db.QueryRow("SELECT AVG(rating) FROM reviews WHERE productId = ?", productID).Scan(&average); err != nil {
+		return 0, err
+	}
+	return average.Float64, nil
+}
+
+// ErrInvalidImageOrder is returned when a reorder doesn't list exactly the images of the product
+var ErrInvalidImageOrder = errors.New("image IDs must list every image of the product exactly once")
+
+// AddImage appends an image to the end of a product's gallery
+// The first image of a product becomes its primary image, as does any image added as primary
+func (s *Store) AddImage(ctx context.Context, image *types.ProductImage) error {
+	defer tracing.StartDBSpan(ctx, "AddImage").End()
+
+	return db.WithTransaction(s.db, func(tx *db.Tx) error {
+		var count, nextSortOrder int
+		err := tx.QueryRow(
+			"SELECT COUNT(*), COALESCE(MAX(sortOrder) + 1, 0) FROM product_images WHERE productId = ? FOR UPDATE",
+			image.ProductID,
+		).Scan(&count, &nextSortOrder)
+		if err != nil {
+			return err
+		}
+		image.SortOrder = nextSortOrder
+		if count == 0 {
+			image.IsPrimary = true
+		}
+		if image.IsPrimary && count > 0 {
+			if _, err := tx.Exec("UPDATE product_images SET isPrimary = FALSE WHERE productId = ?", image.ProductID); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(
+			"INSERT INTO product_images (productId, url, sortOrder, isPrimary) VALUES (?, ?, ?, ?)",
+			image.ProductID, image.URL, image.SortOrder, image.IsPrimary,
+		)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		image.ID = int(id)
+		return nil
+	})
+}
+
+// DeleteImage removes an image from a product's gallery
+// When the primary image is removed, the first remaining image becomes primary
+// Returns sql.ErrNoRows if the product has no image with the given ID
+func (s *Store) DeleteImage(ctx context.Context, productID, imageID int) error {
+	defer tracing.StartDBSpan(ctx, "DeleteImage").End()
+
+	return db.WithTransaction(s.db, func(tx *db.Tx) error {
+		var isPrimary bool
+		err := tx.QueryRow(
+			"SELECT isPrimary FROM product_images WHERE id = ? AND productId = ? FOR UPDATE",
+			imageID, productID,
+		).Scan(&isPrimary)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM product_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		if !isPrimary {
+			return nil
+		}
+		_, err = tx.Exec(
+			"UPDATE product_images SET isPrimary = TRUE WHERE productId = ? ORDER BY sortOrder, id LIMIT 1",
+			productID,
+		)
+		return err
+	})
+}
+
+// ReorderImages sets the gallery order of a product to the order of imageIDs
+// Returns ErrInvalidImageOrder unless imageIDs lists every image of the product exactly once
+func (s *Store) ReorderImages(ctx context.Context, productID int, imageIDs []int) error {
+	defer tracing.StartDBSpan(ctx, "ReorderImages").End()
+
+	return db.WithTransaction(s.db, func(tx *db.Tx) error {
+		rows, err := tx.Query("SELECT id FROM product_images WHERE productId = ? FOR UPDATE", productID)
+		if err != nil {
+			return err
+		}
+		unordered := make(map[int]bool)
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			unordered[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(imageIDs) != len(unordered) {
+			return ErrInvalidImageOrder
+		}
+		for _, id := range imageIDs {
+			if !unordered[id] {
+				return ErrInvalidImageOrder
+			}
+			delete(unordered, id)
+		}
+
+		for i, id := range imageIDs {
+			if _, err := tx.Exec("UPDATE product_images SET sortOrder = ? WHERE id = ?", i, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetImagesByProduct retrieves the gallery of a product in sort order
+func (s *Store) GetImagesByProduct(ctx context.Context, productID int) ([]types.ProductImage, error) {
+	defer tracing.StartDBSpan(ctx, "GetImagesByProduct").End()
+
+	rows, err := s.db.Query(
+		"SELECT id, productId, url, sortOrder, isPrimary FROM product_images WHERE productId = ? ORDER BY sortOrder, id",
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []types.ProductImage{}
+	for rows.Next() {
+		var image types.ProductImage
+		if err := rows.Scan(&image.ID, &image.ProductID, &image.URL, &image.SortOrder, &image.IsPrimary); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// CreateAlert saves a price alert, replacing the user's existing alert for the product
+// A replaced alert is reset so the user is notified again
+func (s *Store) CreateAlert(ctx context.Context, alert *types.PriceAlert) error {
+	defer tracing.StartDBSpan(ctx, "CreateAlert").End()
+
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	alert.Notified = false
+	result, err := s.db.Exec(`
+		INSERT INTO price_alerts (userId, productId, targetPrice, notified, createdAt)
+		VALUES (?, ?, ?, FALSE, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), targetPrice = VALUES(targetPrice), notified = FALSE
+	`, alert.UserID, alert.ProductID, alert.TargetPrice, alert.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	alert.ID = int(id)
+	return nil
+}
+
+// DeleteAlert removes a user's price alert for a product
+// Returns sql.ErrNoRows if the user has no alert for the product
+func (s *Store) DeleteAlert(ctx context.Context, userID, productID int) error {
+	defer tracing.StartDBSpan(ctx, "DeleteAlert").End()
+
+	result, err := s.db.Exec("DELETE FROM price_alerts WHERE userId = ? AND productId = ?", userID, productID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAlertsForProduct retrieves the alerts of a product that newPrice satisfies and haven't been notified yet
+func (s *Store) GetAlertsForProduct(ctx context.Context, productID int, newPrice float64) ([]types.PriceAlert, error) {
+	defer tracing.StartDBSpan(ctx, "GetAlertsForProduct").End()
+
+	rows, err := s.db.Query(`
+		SELECT id, userId, productId, targetPrice, notified, createdAt
+		FROM price_alerts
+		WHERE productId = ? AND notified = FALSE AND targetPrice >= ?
+		ORDER BY id
+	`, productID, newPrice)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []types.PriceAlert{}
+	for rows.Next() {
+		var alert types.PriceAlert
+		if err := rows.Scan(&alert.ID, &alert.UserID, &alert.ProductID, &alert.TargetPrice, &alert.Notified, &alert.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// MarkAlertsNotified records that the users of the given alerts have been emailed
+func (s *Store) MarkAlertsNotified(ctx context.Context, ids []int) error {
+	defer tracing.StartDBSpan(ctx, "MarkAlertsNotified").End()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	_, err := s.db.Exec(
+		fmt.Sprintf("UPDATE price_alerts SET notified = TRUE WHERE id IN (%s)", strings.Join(placeholders, ",")),
+		args...,
+	)
+	return err
+}
+
+// earthRadiusKm is the mean radius of the Earth used for great-circle distances
+const earthRadiusKm = 6371
+
+// GetProductsNearby returns the products in stock at warehouses within radiusKm of a point, nearest first
+// Distances use the Haversine formula, LEAST guards ASIN against rounding just above 1
+func (s *Store) GetProductsNearby(ctx context.Context, latitude, longitude, radiusKm float64) ([]types.NearbyProduct, error) {
+	defer tracing.StartDBSpan(ctx, "GetProductsNearby").End()
+
+	query := fmt.Sprintf(`
+		SELECT p.id, p.name, COALESCE(p.sku, ''), COALESCE(p.category, ''), p.isFeatured, p.description, p.image, p.price, p.currency, p.quantity, p.createdAt,`+productReviews+`,
+			w.id, w.name, w.latitude, w.longitude, w.createdAt, nearby.distance
+		FROM (
+			SELECT wp.productId, wp.warehouseId,
+				2 * %d * ASIN(LEAST(1, SQRT(
+					POW(SIN((RADIANS(w.latitude) - RADIANS(?)) / 2), 2) +
+					COS(RADIANS(?)) * COS(RADIANS(w.latitude)) * POW(SIN((RADIANS(w.longitude) - RADIANS(?)) / 2), 2)
+				))) AS distance
+			FROM warehouse_products wp
+			JOIN warehouses w ON w.id = wp.warehouseId
+			WHERE wp.quantity > 0
+			HAVING distance <= ?
+		) nearby
+		JOIN products p ON p.id = nearby.productId
+		JOIN warehouses w ON w.id = nearby.warehouseId
+		ORDER BY nearby.distance ASC, p.id ASC
+	`, earthRadiusKm)
+	rows, err := s.db.Query(query, latitude, latitude, longitude, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// a product stocked at several warehouses is listed once, at the nearest one
+	products := []types.NearbyProduct{}
+	seen := make(map[int]bool)
+	for rows.Next() {
+		var nearby types.NearbyProduct
+		if err := rows.Scan(
+			&nearby.ID,
+			&nearby.Name,
+			&nearby.SKU,
+			&nearby.Category,
+			&nearby.IsFeatured,
+			&nearby.Description,
+			&nearby.Image,
+			&nearby.Price,
+			&nearby.Currency,
+			&nearby.Quantity,
+			&nearby.CreatedAt,
+			&nearby.AverageRating,
+			&nearby.ReviewCount,
+			&nearby.Warehouse.ID,
+			&nearby.Warehouse.Name,
+			&nearby.Warehouse.Latitude,
+			&nearby.Warehouse.Longitude,
+			&nearby.Warehouse.CreatedAt,
+			&nearby.DistanceKm,
+		); err != nil {
+			return nil, err
+		}
+		if seen[nearby.ID] {
+			continue
+		}
+		seen[nearby.ID] = true
+		products = append(products, nearby)
+	}
+	return products, rows.Err()
+}
@@ -0,0 +1,930 @@
+package products
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/cmd/migrate/migrations"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// TestVariantStore verifies variant attributes round-trip through their JSON column
+func TestVariantStore(t *testing.T) {
+	t.Run("create stores attributes as JSON", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectExec("INSERT INTO product_variants").
+			WithArgs(1, "TSHIRT-M", []byte(`{"color":"red","size":"M"}`), 12.5, 5, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(7, 1))
+
+		variant := &types.ProductVariant{
+			ProductID:  1,
+			SKU:        "TSHIRT-M",
+			Attributes: map[string]string{"size": "M", "color": "red"},
+			Price:      12.5,
+			Quantity:   5,
+		}
+		if err := store.CreateVariant(context.Background(), variant); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if variant.ID != 7 {
+			t.Errorf("Expected variant ID 7, got %d", variant.ID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("get decodes attributes", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		columns := []string{"id", "productId", "sku", "attributes", "price", "quantity", "createdAt"}
+		mock.ExpectQuery("SELECT .* FROM product_variants WHERE productId = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, 1, "TSHIRT-M", []byte(`{"size":"M"}`), 12.5, 5, time.Now()).
+				AddRow(8, 1, "TSHIRT-L", []byte(`{"size":"L"}`), 13.5, 2, time.Now()))
+
+		variants, err := store.GetVariantsByProductID(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(variants) != 2 {
+			t.Fatalf("Expected 2 variants, got %d", len(variants))
+		}
+		if variants[1].Attributes["size"] != "L" {
+			t.Errorf("Expected size L, got %v", variants[1].Attributes)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestGetAverageRating verifies the average rating query and its value for products without reviews
+func TestGetAverageRating(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectQuery("SELECT AVG\\(rating\\) FROM reviews WHERE productId = \\?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"AVG(rating)"}).AddRow(4.25))
+	mock.ExpectQuery("SELECT AVG\\(rating\\) FROM reviews WHERE productId = \\?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"AVG(rating)"}).AddRow(nil))
+
+	average, err := store.GetAverageRating(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if average != 4.25 {
+		t.Errorf("Expected average 4.25, got %v", average)
+	}
+
+	average, err = store.GetAverageRating(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if average != 0 {
+		t.Errorf("Expected average 0 for a product without reviews, got %v", average)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductsIncludesRatings verifies the review aggregate is scanned for reviewed and unreviewed products
+func TestGetProductsIncludesRatings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	now := time.Now()
+	mock.ExpectQuery("SELECT AVG\\(rating\\) FROM reviews WHERE productId = p.id").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "Reviewed", "", "", false, "", "", 10.0, "USD", 5, now, 3.5, 2).
+			AddRow(2, "Unreviewed", "", "", false, "", "", 20.0, "USD", 5, now, 0, 0))
+	mock.ExpectQuery("WHERE p.id = \\?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Reviewed", "", "", false, "", "", 10.0, "USD", 5, now, 3.5, 2))
+
+	products, err := store.GetProducts(context.Background(), types.ProductFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 products, got %d", len(products))
+	}
+	if products[0].AverageRating != 3.5 || products[0].ReviewCount != 2 {
+		t.Errorf("Expected rating 3.5 from 2 reviews, got %v from %d", products[0].AverageRating, products[0].ReviewCount)
+	}
+	if products[1].AverageRating != 0 || products[1].ReviewCount != 0 {
+		t.Errorf("Expected rating 0 from 0 reviews, got %v from %d", products[1].AverageRating, products[1].ReviewCount)
+	}
+
+	product, err := store.GetProductByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if product.AverageRating != 3.5 || product.ReviewCount != 2 {
+		t.Errorf("Expected rating 3.5 from 2 reviews, got %v from %d", product.AverageRating, product.ReviewCount)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestReorderImages verifies a reorder must list exactly the product's images
+func TestReorderImages(t *testing.T) {
+	t.Run("rejects images of other products", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM product_images WHERE productId = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectRollback()
+
+		if err := store.ReorderImages(context.Background(), 1, []int{2, 3}); !errors.Is(err, ErrInvalidImageOrder) {
+			t.Fatalf("Expected ErrInvalidImageOrder, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("updates the sort order of every image", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM product_images WHERE productId = \\?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectExec("UPDATE product_images SET sortOrder = \\? WHERE id = \\?").
+			WithArgs(0, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE product_images SET sortOrder = \\? WHERE id = \\?").
+			WithArgs(1, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.ReorderImages(context.Background(), 1, []int{2, 1}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestInsertProductWithImages verifies the product and its gallery are inserted in one transaction, in order
+func TestInsertProductWithImages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	product := &types.Product{
+		Name:  "Camera",
+		Image: "https://example.com/front.jpg",
+		Price: 250,
+		Images: []types.ProductImage{
+			{URL: "https://example.com/front.jpg", SortOrder: 0, IsPrimary: true},
+			{URL: "https://example.com/back.jpg", SortOrder: 1},
+		},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO products").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("INSERT INTO product_images").
+		WithArgs(int64(7), "https://example.com/front.jpg", 0, true).
+		WillReturnResult(sqlmock.NewResult(20, 1))
+	mock.ExpectExec("INSERT INTO product_images").
+		WithArgs(int64(7), "https://example.com/back.jpg", 1, false).
+		WillReturnResult(sqlmock.NewResult(21, 1))
+	mock.ExpectCommit()
+
+	if err := store.CreateProduct(context.Background(), product); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if product.ID != 7 || product.Images[0].ID != 20 || product.Images[1].ID != 21 || product.Images[1].ProductID != 7 {
+		t.Errorf("Unexpected IDs: %+v", product)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductsAfterCursor verifies the keyset condition, ordering and limit of a cursor page
+func TestGetProductsAfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	mock.ExpectQuery("WHERE p.quantity > 0 AND \\(p.createdAt, p.id\\) < \\(\\?, \\?\\) ORDER BY p.createdAt DESC, p.id DESC LIMIT \\?").
+		WithArgs(after, 7, 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(6, "Product 6", "", "", false, "", "", 10.0, "USD", 5, after, 0, 0))
+
+	products, err := store.GetProducts(context.Background(), types.ProductFilter{
+		InStock: true,
+		After:   &types.ProductCursor{CreatedAt: after, ID: 7},
+		Limit:   3,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 1 || products[0].ID != 6 {
+		t.Errorf("Unexpected products: %+v", products)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductsByIDsKeepsRequestedOrder verifies products come back in the order of the requested IDs
+func TestGetProductsByIDsKeepsRequestedOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	now := time.Now()
+	mock.ExpectQuery("WHERE p.id IN \\(\\?,\\?,\\?,\\?,\\?\\)").
+		WithArgs(3, 1, 4, 2, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "Product 1", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0).
+			AddRow(2, "Product 2", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0).
+			AddRow(3, "Product 3", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0))
+
+	// 4 doesn't exist and 3 is requested twice
+	products, err := store.GetProductsByIDs(context.Background(), []int{3, 1, 4, 2, 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []int{3, 1, 2}
+	if len(products) != len(expected) {
+		t.Fatalf("Expected %d products, got %+v", len(expected), products)
+	}
+	for i, id := range expected {
+		if products[i].ID != id {
+			t.Errorf("Expected product %d at position %d, got %d", id, i, products[i].ID)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductsNearby verifies a product stocked at several warehouses is listed once, at the nearest
+func TestGetProductsNearby(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount",
+		"warehouseId", "warehouseName", "latitude", "longitude", "warehouseCreatedAt", "distance"}
+	now := time.Now()
+	mock.ExpectQuery("ASIN\\(LEAST\\(1, SQRT\\(.*HAVING distance <= \\?.*ORDER BY nearby.distance ASC, p.id ASC").
+		WithArgs(51.5, 51.5, -0.12, 25.0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "Product 1", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0, 2, "Central", 51.51, -0.13, now, 1.3).
+			AddRow(2, "Product 2", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0, 2, "Central", 51.51, -0.13, now, 1.3).
+			AddRow(1, "Product 1", "", "", false, "", "", 10.0, "USD", 5, now, 0, 0, 3, "North", 51.6, -0.1, now, 11.2))
+
+	products, err := store.GetProductsNearby(context.Background(), 51.5, -0.12, 25)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 products, got %+v", products)
+	}
+	if products[0].ID != 1 || products[0].Warehouse.Name != "Central" || products[0].DistanceKm != 1.3 {
+		t.Errorf("Expected product 1 at its nearest warehouse, got %+v", products[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetAlertsForProduct verifies only unnotified alerts the new price reaches are selected
+func TestGetAlertsForProduct(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	now := time.Now()
+	mock.ExpectQuery("FROM price_alerts\\s+WHERE productId = \\? AND notified = FALSE AND targetPrice >= \\?").
+		WithArgs(1, 75.0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "productId", "targetPrice", "notified", "createdAt"}).
+			AddRow(4, 2, 1, 80.0, false, now))
+
+	alerts, err := store.GetAlertsForProduct(context.Background(), 1, 75)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].UserID != 2 || alerts[0].TargetPrice != 80 {
+		t.Errorf("Unexpected alerts: %+v", alerts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCreateProductDuplicates checks a duplicate key error is reported as the SKU or the name being taken, by index
+func TestCreateProductDuplicates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		message  string
+		expected error
+	}{
+		{name: "SKU on MySQL 8", message: "Duplicate entry 'CAM-1' for key 'products.idx_products_sku'", expected: ErrProductSKUTaken},
+		{name: "SKU on MySQL 5.7", message: "Duplicate entry 'CAM-1' for key 'idx_products_sku'", expected: ErrProductSKUTaken},
+		{name: "name", message: "Duplicate entry 'Camera' for key 'products.idx_products_name'", expected: ErrProductNameTaken},
+		{name: "other index", message: "Duplicate entry '1' for key 'products.PRIMARY'", expected: &mysql.MySQLError{Number: 1062}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db)
+
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO products").
+				WithArgs("Camera", "CAM-1", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnError(&mysql.MySQLError{Number: 1062, Message: tc.message})
+			mock.ExpectRollback()
+
+			err = store.CreateProduct(context.Background(), &types.Product{Name: "Camera", SKU: "CAM-1", Price: 10})
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestGetProductBySKU checks a product is looked up by SKU and a missing one is reported as sql.ErrNoRows
+func TestGetProductBySKU(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	mock.ExpectQuery("WHERE p.sku = \\?").
+		WithArgs("CAM-100").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(9, "Camera", "CAM-100", "", false, "A camera", "", 250.0, "USD", 3, time.Now(), 0, 0))
+	mock.ExpectQuery("WHERE p.sku = \\?").
+		WithArgs("CAM-999").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	product, err := store.GetProductBySKU(context.Background(), "CAM-100")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if product.ID != 9 || product.SKU != "CAM-100" {
+		t.Errorf("Expected product 9 with SKU CAM-100, got %+v", product)
+	}
+	if _, err := store.GetProductBySKU(context.Background(), "CAM-999"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for an unknown SKU, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductStock checks the stock of a product is read on its own and an unknown product is reported as sql.ErrNoRows
+func TestGetProductStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\?").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(42))
+	mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\?").
+		WithArgs(404).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}))
+
+	quantity, err := store.GetProductStock(context.Background(), 9)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if quantity != 42 {
+		t.Errorf("Expected 42 in stock, got %d", quantity)
+	}
+	if _, err := store.GetProductStock(context.Background(), 404); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for an unknown product, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCreateProducts checks a batch of products is created in one transaction, or not at all
+func TestCreateProducts(t *testing.T) {
+	newProducts := func() []*types.Product {
+		return []*types.Product{
+			{Name: "Camera", Price: 250, Quantity: 3, Images: []types.ProductImage{{URL: "https://example.com/camera.jpg", IsPrimary: true}}},
+			{Name: "Tripod", SKU: "TRI-1", Price: 40, Quantity: 8},
+		}
+	}
+
+	t.Run("creates every product", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO products").
+			WithArgs("Camera", "", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectExec("INSERT INTO product_images").
+			WithArgs(int64(4), "https://example.com/camera.jpg", 0, true).
+			WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO products").
+			WithArgs("Tripod", "TRI-1", "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(5, 1))
+		mock.ExpectCommit()
+
+		products := newProducts()
+		if err := store.CreateProducts(context.Background(), products); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if products[0].ID != 4 || products[1].ID != 5 || products[0].Images[0].ID != 7 || products[0].Images[0].ProductID != 4 {
+			t.Errorf("Unexpected IDs: %+v %+v", products[0], products[1])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back when a product is rejected", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO products").WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectExec("INSERT INTO product_images").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO products").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'TRI-1' for key 'products.idx_products_sku'"})
+		mock.ExpectRollback()
+
+		products := newProducts()
+		err = store.CreateProducts(context.Background(), products)
+		var batchErr *BatchProductError
+		if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrProductSKUTaken) {
+			t.Errorf("Expected product 1 to be rejected for its SKU, got %v", err)
+		}
+		if products[0].ID != 0 {
+			t.Errorf("Expected no IDs to be set after a rollback, got %d", products[0].ID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestAdjustStockBatch checks stock adjustments are applied together and rolled back when one would go negative
+func TestAdjustStockBatch(t *testing.T) {
+	t.Run("applies every adjustment", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(10))
+		mock.ExpectExec("UPDATE products SET quantity = \\? WHERE id = \\?").
+			WithArgs(15, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(3))
+		mock.ExpectExec("UPDATE products SET quantity = \\? WHERE id = \\?").
+			WithArgs(0, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		adjustments := []types.StockAdjustment{{ProductID: 1, Delta: 5}, {ProductID: 2, Delta: -3}}
+		if err := store.AdjustStockBatch(context.Background(), adjustments); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if adjustments[0].Quantity != 15 || adjustments[1].Quantity != 0 {
+			t.Errorf("Expected resulting quantities 15 and 0, got %+v", adjustments)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back when stock would go negative", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(10))
+		mock.ExpectExec("UPDATE products SET quantity = \\? WHERE id = \\?").
+			WithArgs(15, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\? FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(3))
+		mock.ExpectRollback()
+
+		adjustments := []types.StockAdjustment{{ProductID: 1, Delta: 5}, {ProductID: 2, Delta: -4}}
+		err = store.AdjustStockBatch(context.Background(), adjustments)
+		var batchErr *BatchProductError
+		if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrNegativeStock) {
+			t.Errorf("Expected adjustment 1 to be rejected for negative stock, got %v", err)
+		}
+		if adjustments[0].Quantity != 0 {
+			t.Errorf("Expected no quantities to be filled in after a rollback, got %+v", adjustments)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestSearchProducts checks the full-text query filters, ranks and pages the products
+func TestSearchProducts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	now := time.Now()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM products p WHERE MATCH\\(p.name, p.description\\) AGAINST\\(\\? IN BOOLEAN MODE\\)").
+		WithArgs("+espresso").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("ORDER BY MATCH\\(p.name, p.description\\) AGAINST\\(\\? IN BOOLEAN MODE\\) DESC, p.id ASC LIMIT \\? OFFSET \\?").
+		WithArgs("+espresso", "+espresso", 2, 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(5, "Coffee Grinder", "", "", false, "Grinds espresso beans", "", 40.0, "USD", 5, now, 0, 0))
+
+	products, total, err := store.SearchProducts(context.Background(), "+espresso", 2, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 3 || len(products) != 1 || products[0].ID != 5 {
+		t.Errorf("Unexpected search results: %+v of %d", products, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSearchProductsInvalidQuery checks a query MySQL can't parse is reported as ErrInvalidSearchQuery
+func TestSearchProductsInvalidQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM products p WHERE MATCH").
+		WithArgs(`"espresso`).
+		WillReturnError(&mysql.MySQLError{Number: 1064, Message: "syntax error, unexpected $end"})
+
+	if _, _, err := store.SearchProducts(context.Background(), `"espresso`, 1, 10); !errors.Is(err, ErrInvalidSearchQuery) {
+		t.Errorf("Expected ErrInvalidSearchQuery, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetProductSummaries checks only IDs and names are read, a page at a time
+func TestGetProductSummaries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM products").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT id, name FROM products ORDER BY name ASC, id ASC LIMIT \\? OFFSET \\?").
+		WithArgs(2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(4, "Tripod"))
+
+	summaries, total, err := store.GetProductSummaries(context.Background(), 2, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 3 || len(summaries) != 1 || summaries[0] != (types.ProductSummary{ID: 4, Name: "Tripod"}) {
+		t.Errorf("Unexpected summaries: %+v of %d", summaries, total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestSetFeatured checks featuring keeps an existing featuredAt and unfeaturing clears it
+func TestSetFeatured(t *testing.T) {
+	testCases := []struct {
+		name        string
+		featured    bool
+		exists      bool
+		expectedSQL string
+	}{
+		{name: "feature", featured: true, exists: true, expectedSQL: "UPDATE products SET isFeatured = TRUE, featuredAt = COALESCE\\(featuredAt, CURRENT_TIMESTAMP\\) WHERE id = \\?"},
+		{name: "unfeature", featured: false, exists: true, expectedSQL: "UPDATE products SET isFeatured = FALSE, featuredAt = NULL WHERE id = \\?"},
+		{name: "unknown product", featured: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db)
+
+			mock.ExpectQuery("SELECT EXISTS").WithArgs(4).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tc.exists))
+			if tc.exists {
+				mock.ExpectExec(tc.expectedSQL).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			err = store.SetFeatured(context.Background(), 4, tc.featured)
+			if !tc.exists {
+				if !errors.Is(err, sql.ErrNoRows) {
+					t.Fatalf("Expected sql.ErrNoRows, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestGetFeaturedProducts checks featured products are listed the most recently featured first
+func TestGetFeaturedProducts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	now := time.Now()
+	mock.ExpectQuery("WHERE p.isFeatured ORDER BY p.featuredAt DESC, p.id DESC LIMIT \\?").
+		WithArgs(20).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "Camera", "", "", true, "", "", 250.0, "USD", 3, now, 0, 0).
+			AddRow(1, "Tripod", "", "", true, "", "", 40.0, "USD", 5, now, 0, 0))
+
+	products, err := store.GetFeaturedProducts(context.Background(), 20)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(products) != 2 || products[0].ID != 3 || !products[0].IsFeatured {
+		t.Errorf("Unexpected featured products: %+v", products)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetRelatedProducts checks related products share the product's category, or are the newest for an uncategorized product
+func TestGetRelatedProducts(t *testing.T) {
+	columns := []string{"id", "name", "sku", "category", "isFeatured", "description", "image", "price", "currency", "quantity", "createdAt", "averageRating", "reviewCount"}
+	now := time.Now()
+
+	t.Run("same category", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectQuery("SELECT COALESCE\\(category, ''\\) FROM products WHERE id = \\?").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow("Coffee"))
+		mock.ExpectQuery("WHERE p.id <> \\? AND p.category = \\? ORDER BY p.createdAt DESC, p.id DESC LIMIT \\?").
+			WithArgs(5, "Coffee", 4).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, "Espresso Machine", "", "Coffee", false, "Pulls shots", "", 300.0, "USD", 2, now, 0, 0).
+				AddRow(6, "Coffee Grinder", "", "Coffee", false, "Grinds beans", "", 40.0, "USD", 5, now, 0, 0))
+
+		products, err := store.GetRelatedProducts(context.Background(), 5, 4)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(products) != 2 || products[0].ID != 7 || products[1].Category != "Coffee" {
+			t.Errorf("Unexpected related products: %+v", products)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("uncategorized falls back to newest", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectQuery("SELECT COALESCE\\(category, ''\\) FROM products WHERE id = \\?").
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"category"}).AddRow(""))
+		mock.ExpectQuery("WHERE p.id <> \\? ORDER BY p.createdAt DESC, p.id DESC LIMIT \\?").
+			WithArgs(5, 2).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(9, "Tea Kettle", "", "Kitchen", false, "Boils water", "", 25.0, "USD", 9, now, 0, 0).
+				AddRow(8, "Camera", "", "", false, "Takes photos", "", 250.0, "USD", 3, now, 0, 0))
+
+		products, err := store.GetRelatedProducts(context.Background(), 5, 2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(products) != 2 || products[0].ID != 9 || products[1].ID != 8 {
+			t.Errorf("Unexpected related products: %+v", products)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown product", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db)
+
+		mock.ExpectQuery("SELECT COALESCE\\(category, ''\\) FROM products WHERE id = \\?").
+			WithArgs(404).
+			WillReturnRows(sqlmock.NewRows([]string{"category"}))
+
+		if _, err := store.GetRelatedProducts(context.Background(), 404, 4); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestSearchProductsMySQL runs a full-text search against a real MySQL database, which sqlmock can't rank
+// It migrates the database named by TEST_MYSQL_DSN, e.g. user:pass@tcp(localhost:3306)/gommerce_test, and is skipped when it's unset
+func TestSearchProductsMySQL(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Invalid TEST_MYSQL_DSN: %v", err)
+	}
+	cfg.ParseTime = true
+	cfg.MultiStatements = true
+
+	// the migrator closes its connection, so it gets one of its own
+	migrationDB, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	m, err := migrations.New(migrationDB)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	conn, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	store := NewStore(conn)
+
+	// a unique word keeps other rows in the database out of the results
+	tag := "fts" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	catalog := []*types.Product{
+		{Name: "Coffee Grinder " + tag, Description: "Grinds beans fine enough for espresso", Price: 40, Quantity: 5},
+		{Name: "Espresso Machine " + tag, Description: "Pulls espresso shots and steams milk for espresso drinks", Price: 300, Quantity: 2},
+		{Name: "Tea Kettle " + tag, Description: "Boils water for tea", Price: 25, Quantity: 9},
+	}
+	for _, product := range catalog {
+		if err := store.CreateProduct(context.Background(), product); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+		id := product.ID
+		t.Cleanup(func() { conn.Exec("DELETE FROM products WHERE id = ?", id) })
+	}
+
+	products, total, err := store.SearchProducts(context.Background(), "+espresso +"+tag, 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 2 || len(products) != 2 {
+		t.Fatalf("Expected the 2 espresso products, got %d of %d: %+v", len(products), total, products)
+	}
+	// the machine mentions espresso three times to the grinder's once, so it ranks first
+	if products[0].ID != catalog[1].ID || products[1].ID != catalog[0].ID {
+		t.Errorf("Expected the espresso machine ranked first, got %q then %q", products[0].Name, products[1].Name)
+	}
+
+	products, total, err = store.SearchProducts(context.Background(), "+"+tag+" -espresso", 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if total != 1 || len(products) != 1 || products[0].ID != catalog[2].ID {
+		t.Errorf("Expected only the tea kettle, got %+v", products)
+	}
+}
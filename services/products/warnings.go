@@ -0,0 +1,32 @@
+package products
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// Thresholds past which a new product is valid but likely a mistake
+const (
+	minDescriptionLength = 30
+	maxUsualQuantity     = 100000
+)
+
+// ProductWarnings lists the non-fatal issues of a valid product, such as a very short description
+// Products are created regardless, the warnings are returned to the operator with ?validate=warn
+func ProductWarnings(p types.Product) []string {
+	warnings := []string{}
+	if length := utf8.RuneCountInString(p.Description); length < minDescriptionLength {
+		warnings = append(warnings, fmt.Sprintf("description is very short (%d characters, at least %d recommended)", length, minDescriptionLength))
+	}
+	// compare whole cents so float drift such as 19.989999 still counts
+	if cents := int64(math.Round(float64(p.Price) * 100)); cents%100 == 99 {
+		warnings = append(warnings, "price ends in .99")
+	}
+	if p.Quantity > maxUsualQuantity {
+		warnings = append(warnings, fmt.Sprintf("quantity %d is unusually large (more than %d)", p.Quantity, maxUsualQuantity))
+	}
+	return warnings
+}
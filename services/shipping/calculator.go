@@ -0,0 +1,84 @@
+// Package shipping calculates the delivery options and costs for an order
+package shipping
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+const (
+	MethodStandard = "standard"
+	MethodExpress  = "express"
+)
+
+var (
+	ErrInvalidWeight     = errors.New("total weight must not be negative")
+	ErrMethodUnavailable = errors.New("shipping method is not available for this address")
+	ErrMissingCountry    = errors.New("destination country is required")
+)
+
+// rate is the pricing rule for a single shipping method
+type rate struct {
+	name          string
+	estimatedDays int
+	basePrice     float64 // Flat price per order
+	perKg         float64 // Price added for every kilogram of weight
+}
+
+// countryRates holds the hard-coded shipping rules per destination country
+var countryRates = map[string][]rate{
+	"US": {
+		{name: MethodStandard, estimatedDays: 5, basePrice: 5.00, perKg: 0.50},
+		{name: MethodExpress, estimatedDays: 2, basePrice: 15.00, perKg: 1.00},
+	},
+	"IN": {
+		{name: MethodStandard, estimatedDays: 6, basePrice: 2.00, perKg: 0.25},
+		{name: MethodExpress, estimatedDays: 2, basePrice: 6.00, perKg: 0.50},
+	},
+}
+
+// internationalRates apply to every country without its own rules
+var internationalRates = []rate{
+	{name: MethodStandard, estimatedDays: 14, basePrice: 20.00, perKg: 2.00},
+	{name: MethodExpress, estimatedDays: 5, basePrice: 45.00, perKg: 4.00},
+}
+
+// CalculateShipping returns the shipping methods available for the address
+// with their price for the given total weight in kilograms
+// Countries without their own rates are charged international rates, an address without a country is rejected
+func CalculateShipping(address types.Address, totalWeight float64) ([]types.ShippingMethod, error) {
+	if totalWeight < 0 {
+		return nil, ErrInvalidWeight
+	}
+	country := strings.ToUpper(strings.TrimSpace(address.Country))
+	if country == "" {
+		return nil, ErrMissingCountry
+	}
+
+	rates, ok := countryRates[country]
+	if !ok {
+		rates = internationalRates
+	}
+
+	methods := make([]types.ShippingMethod, len(rates))
+	for i, r := range rates {
+		methods[i] = types.ShippingMethod{
+			Name:          r.name,
+			EstimatedDays: r.estimatedDays,
+			Price:         types.Price(r.basePrice + r.perKg*totalWeight),
+		}
+	}
+	return methods, nil
+}
+
+// FindMethod picks the named method from the available methods
+func FindMethod(methods []types.ShippingMethod, name string) (types.ShippingMethod, error) {
+	for _, method := range methods {
+		if strings.EqualFold(method.Name, name) {
+			return method, nil
+		}
+	}
+	return types.ShippingMethod{}, ErrMethodUnavailable
+}
@@ -0,0 +1,57 @@
+package shipping
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+func TestCalculateShipping(t *testing.T) {
+	t.Run("uses country specific rates", func(t *testing.T) {
+		methods, err := CalculateShipping(types.Address{Country: "us"}, 2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		standard, err := FindMethod(methods, MethodStandard)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if standard.Price != 6.00 || standard.EstimatedDays != 5 {
+			t.Errorf("Unexpected standard method: %+v", standard)
+		}
+	})
+
+	t.Run("falls back to international rates", func(t *testing.T) {
+		methods, err := CalculateShipping(types.Address{Country: "FR"}, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		express, err := FindMethod(methods, MethodExpress)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if express.Price != 49.00 {
+			t.Errorf("Expected express price 49.00, got %.2f", express.Price)
+		}
+	})
+
+	t.Run("rejects a missing country", func(t *testing.T) {
+		if _, err := CalculateShipping(types.Address{Line: "1 Test Street", Country: " "}, 1); !errors.Is(err, ErrMissingCountry) {
+			t.Errorf("Expected ErrMissingCountry, got %v", err)
+		}
+	})
+
+	t.Run("rejects negative weight", func(t *testing.T) {
+		if _, err := CalculateShipping(types.Address{Country: "US"}, -1); !errors.Is(err, ErrInvalidWeight) {
+			t.Errorf("Expected ErrInvalidWeight, got %v", err)
+		}
+	})
+
+	t.Run("unknown method is unavailable", func(t *testing.T) {
+		methods, _ := CalculateShipping(types.Address{Country: "US"}, 1)
+		if _, err := FindMethod(methods, "overnight"); !errors.Is(err, ErrMethodUnavailable) {
+			t.Errorf("Expected ErrMethodUnavailable, got %v", err)
+		}
+	})
+}
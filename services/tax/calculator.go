@@ -0,0 +1,42 @@
+// Package tax calculates the sales tax charged on an order
+package tax
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// ErrInvalidSubtotal is returned by CalculateTax when the subtotal is negative
+var ErrInvalidSubtotal = errors.New("subtotal must not be negative")
+
+// countryRates holds the hard-coded VAT rate per destination country
+// Countries without an entry are not taxed
+var countryRates = map[string]float64{
+	"IN": 0.18,
+	"GB": 0.20,
+	"DE": 0.19,
+	"FR": 0.20,
+	"IT": 0.22,
+	"ES": 0.21,
+	"NL": 0.21,
+	"AU": 0.10,
+}
+
+// CalculateTax returns the tax rate for the address and the tax owed on the subtotal
+// The amount is rounded to the nearest cent
+func CalculateTax(address types.Address, subtotal float64) (float64, float64, error) {
+	if subtotal < 0 {
+		return 0, 0, ErrInvalidSubtotal
+	}
+
+	rate := countryRates[strings.ToUpper(strings.TrimSpace(address.Country))]
+	return rate, Amount(subtotal, rate), nil
+}
+
+// Amount is the tax owed on the subtotal at the given rate, rounded to the nearest cent
+func Amount(subtotal, rate float64) float64 {
+	return math.Round(subtotal*rate*100) / 100
+}
@@ -0,0 +1,46 @@
+package tax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+func TestCalculateTax(t *testing.T) {
+	t.Run("uses the country VAT rate", func(t *testing.T) {
+		rate, amount, err := CalculateTax(types.Address{Country: "in"}, 100)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if rate != 0.18 || amount != 18 {
+			t.Errorf("Expected rate 0.18 and amount 18, got %v and %v", rate, amount)
+		}
+	})
+
+	t.Run("rounds the amount to cents", func(t *testing.T) {
+		_, amount, err := CalculateTax(types.Address{Country: "DE"}, 10.55)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if amount != 2.00 {
+			t.Errorf("Expected amount 2.00, got %v", amount)
+		}
+	})
+
+	t.Run("untaxed countries pay nothing", func(t *testing.T) {
+		rate, amount, err := CalculateTax(types.Address{Country: "US"}, 100)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if rate != 0 || amount != 0 {
+			t.Errorf("Expected no tax, got rate %v and amount %v", rate, amount)
+		}
+	})
+
+	t.Run("rejects negative subtotal", func(t *testing.T) {
+		if _, _, err := CalculateTax(types.Address{Country: "IN"}, -1); !errors.Is(err, ErrInvalidSubtotal) {
+			t.Errorf("Expected ErrInvalidSubtotal, got %v", err)
+		}
+	})
+}
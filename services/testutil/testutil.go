@@ -0,0 +1,67 @@
+// Package testutil contains helpers shared by the route tests of the services
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+)
+
+// ErrorResponse is the body utils.WriteError responds with
+type ErrorResponse struct {
+	Error types.APIError `json:"error"`
+}
+
+// MakeRequest serves a request through router and returns the recorded response
+// A string or []byte body is sent as is, any other body is marshalled to JSON, and a nil body sends none
+// Every given header, e.g. an Authorization header, is added to the request
+func MakeRequest(t testing.TB, router http.Handler, method, path string, body any, header ...http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	case []byte:
+		reader = bytes.NewBuffer(b)
+	default:
+		marshaled, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("Failed to marshal payload: %v", err)
+		}
+		reader = bytes.NewBuffer(marshaled)
+	}
+
+	req, err := http.NewRequest(method, path, reader)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for _, h := range header {
+		for key, values := range h {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// DecodeJSON decodes a JSON response body into a T, failing the test if it can't
+func DecodeJSON[T any](t testing.TB, body io.Reader) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(body).Decode(&v); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return v
+}
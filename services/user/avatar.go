@@ -0,0 +1,181 @@
+package user
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"golang.org/x/image/draw"
+)
+
+// AvatarPath is the URL path uploaded avatars are served under, outside the versioned API
+const AvatarPath = "/avatars/"
+
+const (
+	maxAvatarSize      = 2 << 20 // Largest avatar upload accepted, in bytes
+	maxAvatarDimension = 8000    // Larger images are rejected before they are decoded
+	avatarSize         = 256     // Width and height avatars are resized to
+)
+
+var errInvalidAvatar = errors.New("avatar must be a JPEG or PNG image")
+
+// AvatarHandler serves the avatars saved in dir under AvatarPath
+// Directories are reported as not found so the saved avatars can't be listed
+func AvatarHandler(dir string) http.Handler {
+	return http.StripPrefix(AvatarPath, http.FileServer(avatarFS{http.Dir(dir)}))
+}
+
+// avatarFS only opens files, a directory is opened as if it didn't exist
+type avatarFS struct {
+	fs http.FileSystem
+}
+
+func (a avatarFS) Open(name string) (http.File, error) {
+	file, err := a.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
+
+// handleUploadAvatar replaces the authenticated user's avatar with the uploaded image
+// The image is cropped to a square, resized to avatarSize and saved under config.Envs.AvatarDir
+func (h *Handler) handleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+64<<10)
+	file, header, err := r.FormFile("avatar")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("avatar must not exceed 2 MB"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("avatar file is required"))
+		return
+	}
+	defer file.Close()
+	if header.Size > maxAvatarSize {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("avatar must not exceed 2 MB"))
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	avatar, format, err := resizeAvatar(data)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// every upload gets a new name so clients and caches never see a stale image under the old URL
+	name := fmt.Sprintf("%d-%d.%s", userId, time.Now().UnixNano(), format)
+	if err := os.MkdirAll(config.Envs.AvatarDir, 0o755); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(config.Envs.AvatarDir, name), avatar, 0o644); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(r.Context(), userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	avatarPath := AvatarPath + name
+	if err := h.store.UpdateAvatar(r.Context(), userId, avatarPath); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	removeAvatar(user.AvatarURL)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "avatar updated successfully",
+		"data": map[string]string{
+			"avatarUrl": config.Envs.BaseURL() + avatarPath,
+		},
+	})
+}
+
+// resizeAvatar checks data is a JPEG or PNG image and crops and scales it to a square avatarSize image
+// The avatar is encoded in the same format it was uploaded in, which is returned as a file extension
+func resizeAvatar(data []byte) ([]byte, string, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, "", errInvalidAvatar
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errInvalidAvatar
+	}
+	if cfg.Width > maxAvatarDimension || cfg.Height > maxAvatarDimension {
+		return nil, "", fmt.Errorf("avatar must not be larger than %dx%d pixels", maxAvatarDimension, maxAvatarDimension)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errInvalidAvatar
+	}
+
+	// crop the largest centered square so the avatar isn't stretched
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+	dst := image.NewRGBA(image.Rect(0, 0, avatarSize, avatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/png" {
+		err = png.Encode(&buf, dst)
+		return buf.Bytes(), "png", err
+	}
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+	return buf.Bytes(), "jpg", err
+}
+
+// removeAvatar deletes a replaced avatar file, failures are only logged as the new avatar is already saved
+func removeAvatar(avatarPath string) {
+	if !strings.HasPrefix(avatarPath, AvatarPath) {
+		return
+	}
+	name := path.Base(avatarPath)
+	if err := os.Remove(filepath.Join(config.Envs.AvatarDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing old avatar %s: %v", name, err)
+	}
+}
@@ -0,0 +1,30 @@
+package user
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// disposableDomainsList is a bundled list of known disposable-email domains, one per line
+//
+//go:embed disposable_domains.txt
+var disposableDomainsList string
+
+// disposableDomains is the lookup set built from disposableDomainsList
+var disposableDomains = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(disposableDomainsList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// isDisposableEmail reports whether an email's domain appears in the bundled list of disposable-email domains
+// The domain is lowercased first, so "jane@Mailinator.COM" is treated the same as "jane@mailinator.com"
+func isDisposableEmail(email string) bool {
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	_, found := disposableDomains[domain]
+	return found
+}
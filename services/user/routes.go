@@ -2,10 +2,15 @@
 package user
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Asif-Faizal/Gommerce/config"
@@ -15,16 +20,34 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// dummyCompare is swapped out in tests to observe the not-found login path
+var dummyCompare = auth.DummyCompare
+
 // Handler represents the user-related HTTP handlers
 // It contains methods to handle different user-related endpoints
 type Handler struct {
-	store types.UserStore // Interface for user data operations
+	store             types.UserStore              // Interface for user data operations
+	apiKeys           types.APIKeyStore            // Interface for API key data operations
+	addresses         types.AddressStore           // Interface for address book data operations
+	notificationPrefs types.NotificationPrefsStore // Interface for notification preference data operations
+	orders            types.OrderStore             // Interface for order data operations, used by the admin order lookup and purchase history
+	loginLimiter      *auth.LoginLimiter           // Tracks failed logins to lock out brute-force attempts
 }
 
 // NewHandler creates a new instance of the user Handler
 // This is a constructor function for the Handler struct
-func NewHandler(store types.UserStore) *Handler {
-	return &Handler{store: store}
+func NewHandler(store types.UserStore, apiKeys types.APIKeyStore, addresses types.AddressStore, notificationPrefs types.NotificationPrefsStore, orders types.OrderStore) *Handler {
+	return &Handler{
+		store:             store,
+		apiKeys:           apiKeys,
+		addresses:         addresses,
+		notificationPrefs: notificationPrefs,
+		orders:            orders,
+		loginLimiter: auth.NewLoginLimiter(
+			int(config.Envs.LoginMaxAttempts),
+			time.Second*time.Duration(config.Envs.LoginLockoutDuration),
+		),
+	}
 }
 
 // RegisterRoutes sets up all the user-related routes
@@ -35,6 +58,42 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 
 	// Register the registration endpoint - will handle POST requests to /api/v1/register
 	router.HandleFunc("/register", h.handleRegister)
+
+	// Register the login history endpoint - will handle GET requests to /api/v1/user/login-history
+	router.HandleFunc("/user/login-history", h.handleGetLoginHistory).Methods(http.MethodGet)
+
+	// Register the profile update endpoint - will handle PUT requests to /api/v1/user/profile
+	router.HandleFunc("/user/profile", h.handleUpdateProfile).Methods(http.MethodPut)
+
+	// Register the avatar upload endpoint - will handle POST requests to /api/v1/user/avatar
+	router.HandleFunc("/user/avatar", h.handleUploadAvatar).Methods(http.MethodPost)
+
+	// Register the API key endpoints - will handle requests to /api/v1/user/api-keys
+	router.HandleFunc("/user/api-keys", h.handleCreateAPIKey).Methods(http.MethodPost)
+	router.HandleFunc("/user/api-keys/{id}", h.handleRevokeAPIKey).Methods(http.MethodDelete)
+
+	// Register the address book endpoints - will handle requests to /api/v1/user/addresses
+	router.HandleFunc("/user/addresses", h.handleCreateAddress).Methods(http.MethodPost)
+	router.HandleFunc("/user/addresses", h.handleGetAddresses).Methods(http.MethodGet)
+	router.HandleFunc("/user/addresses/{id}", h.handleDeleteAddress).Methods(http.MethodDelete)
+
+	// Register the notification preference endpoints - will handle requests to /api/v1/user/notification-preferences
+	router.HandleFunc("/user/notification-preferences", h.handleGetNotificationPrefs).Methods(http.MethodGet)
+	router.HandleFunc("/user/notification-preferences", h.handleUpdateNotificationPrefs).Methods(http.MethodPut)
+
+	// Register the purchase history endpoint - will handle GET requests to /api/v1/user/me/purchases
+	router.HandleFunc("/user/me/purchases", h.handleGetPurchasedProducts).Methods(http.MethodGet)
+
+	// Register the admin-only user listing endpoint - will handle GET requests to /api/v1/users
+	requireAdmin := utils.RequireRole(h.store, types.RoleAdmin)
+	router.Handle("/users", requireAdmin(http.HandlerFunc(h.handleListUsers))).Methods(http.MethodGet)
+
+	// Register the admin-only activation endpoints - will handle PUT requests to /api/v1/admin/users/{id}/...
+	router.Handle("/admin/users/{id}/activate", requireAdmin(http.HandlerFunc(h.handleActivateUser))).Methods(http.MethodPut)
+	router.Handle("/admin/users/{id}/deactivate", requireAdmin(http.HandlerFunc(h.handleDeactivateUser))).Methods(http.MethodPut)
+
+	// Register the admin-only order lookup - will handle GET requests to /api/v1/admin/users/{id}/orders
+	router.Handle("/admin/users/{id}/orders", requireAdmin(http.HandlerFunc(h.handleGetUserOrders))).Methods(http.MethodGet)
 }
 
 // handleLogin processes user login requests
@@ -42,6 +101,7 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 // r is the HTTP request containing the login data
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var payload types.LoginUserPayload
+	r.Body = http.MaxBytesReader(w, r.Body, config.Envs.LoginMaxBodyBytes)
 	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
@@ -53,9 +113,18 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject the attempt early if the account is locked after too many failures
+	if h.loginLimiter.IsLocked(payload.Email) {
+		utils.WriteError(w, http.StatusTooManyRequests, fmt.Errorf("account temporarily locked"))
+		return
+	}
+
 	// Get user by email
-	user, err := h.store.GetUserByEmail(payload.Email)
+	user, err := h.store.GetUserByEmail(r.Context(), payload.Email)
 	if err == sql.ErrNoRows {
+		// Spend as long as a wrong password would so response times don't reveal which emails are registered
+		dummyCompare()
+		h.loginLimiter.RecordFailure(payload.Email)
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid email or password"))
 		return
 	}
@@ -64,12 +133,29 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify password
-	if !auth.ComparePasswords(user.Password, payload.Password) {
+	// Verify password and record the attempt either way
+	passwordMatches := auth.ComparePasswords(user.Password, payload.Password)
+	h.recordLoginAttempt(r, user.ID, passwordMatches)
+	if !passwordMatches {
+		h.loginLimiter.RecordFailure(payload.Email)
 		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid email or password"))
 		return
 	}
 
+	// Successful login clears any previous failures
+	h.loginLimiter.Reset(payload.Email)
+
+	// The plain password is only known now, so this is when a hash from an old algorithm can be replaced
+	if auth.NeedsRehash(user.Password) {
+		h.rehashPassword(r.Context(), user.ID, payload.Password)
+	}
+
+	// Banned users keep their data but may not log in
+	if !user.IsActive {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("account is deactivated"))
+		return
+	}
+
 	secret := []byte(config.Envs.JWTSecret)
 	token, err := auth.CreateJWT(secret, user.ID)
 	if err != nil {
@@ -93,6 +179,487 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// rehashPassword stores the password hashed with the configured algorithm
+// Failures are logged but never block the login itself, the old hash keeps working
+func (h *Handler) rehashPassword(ctx context.Context, userID int, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %d: %v", userID, err)
+		return
+	}
+	if err := h.store.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		log.Printf("Error saving rehashed password for user %d: %v", userID, err)
+	}
+}
+
+// recordLoginAttempt stores a login event for the user
+// Failures are logged but never block the login itself
+func (h *Handler) recordLoginAttempt(r *http.Request, userID int, success bool) {
+	event := &types.LoginEvent{
+		UserID:    userID,
+		IPAddress: utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		LoginAt:   time.Now(),
+		Success:   success,
+	}
+	if err := h.store.RecordLoginAttempt(r.Context(), event); err != nil {
+		log.Printf("Error recording login attempt for user %d: %v", userID, err)
+	}
+}
+
+// handleGetLoginHistory returns a paginated list of login events for the authenticated user
+// w is the response writer to send back HTTP responses
+// r is the HTTP request, optionally carrying page and limit query parameters
+func (h *Handler) handleGetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, total, err := h.store.GetLoginEvents(r.Context(), userId, page, limit)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "success",
+		"message":    "login history fetched successfully",
+		"data":       events,
+		"pagination": utils.NewPagination(page, limit, total),
+	})
+}
+
+// handleUpdateProfile changes the name and email of the authenticated user
+// Returns 409 when the email already belongs to another account
+func (h *Handler) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload types.UpdateProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	user, err := h.store.GetUserByID(r.Context(), userId)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user.FirstName = payload.FirstName
+	user.LastName = payload.LastName
+	user.Email = payload.Email
+	if err := h.store.UpdateUser(r.Context(), user); err != nil {
+		if errors.Is(err, ErrEmailTaken) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("error updating user: %w", err))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "profile updated successfully",
+		"data": map[string]interface{}{
+			"id":        user.ID,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"email":     user.Email,
+		},
+	})
+}
+
+// handleCreateAPIKey creates an API key for the authenticated user
+// The key itself is only returned in this response, afterwards only its hash is known
+func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload types.CreateAPIKeyPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	apiKey := &types.APIKey{
+		UserID:  userId,
+		KeyHash: auth.HashAPIKey(key),
+		Label:   utils.SanitizeString(payload.Label),
+	}
+	if err := h.apiKeys.CreateAPIKey(r.Context(), apiKey); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "api key created successfully, store it now as it won't be shown again",
+		"data": map[string]interface{}{
+			"apiKey": apiKey,
+			"key":    key,
+		},
+	})
+}
+
+// handleRevokeAPIKey revokes one of the authenticated user's API keys
+func (h *Handler) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid api key ID"))
+		return
+	}
+
+	err = h.apiKeys.RevokeAPIKey(r.Context(), id, userId)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("api key not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "api key revoked successfully",
+	})
+}
+
+// handleCreateAddress saves an address to the authenticated user's address book
+func (h *Handler) handleCreateAddress(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload types.CreateAddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	address := &types.SavedAddress{
+		UserID:  userId,
+		Line:    utils.SanitizeString(payload.Line),
+		Country: strings.ToUpper(payload.Country),
+	}
+	if err := h.addresses.CreateAddress(r.Context(), address); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"status":  "success",
+		"message": "address saved successfully",
+		"data":    address,
+	})
+}
+
+// handleGetAddresses lists the authenticated user's saved addresses
+func (h *Handler) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	addresses, err := h.addresses.GetAddresses(r.Context(), userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "addresses fetched successfully",
+		"data":    addresses,
+	})
+}
+
+// handleDeleteAddress removes one of the authenticated user's saved addresses
+func (h *Handler) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+		return
+	}
+
+	err = h.addresses.DeleteAddress(r.Context(), id, userId)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("address not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "address deleted successfully",
+	})
+}
+
+// handleGetNotificationPrefs returns the notifications the authenticated user opted in to
+func (h *Handler) handleGetNotificationPrefs(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	prefs, err := h.notificationPrefs.GetPrefs(r.Context(), userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "notification preferences fetched successfully",
+		"data":    prefs,
+	})
+}
+
+// handleUpdateNotificationPrefs replaces the authenticated user's notification preferences
+// Every preference must be sent, so a client can't turn one on by leaving it out
+func (h *Handler) handleUpdateNotificationPrefs(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload types.UpdateNotificationPrefsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ValidationError(err))
+		return
+	}
+
+	prefs := &types.NotificationPrefs{
+		UserID:       userId,
+		OrderUpdates: *payload.OrderUpdates,
+		PriceAlerts:  *payload.PriceAlerts,
+		Newsletter:   *payload.Newsletter,
+	}
+	if err := h.notificationPrefs.UpdatePrefs(r.Context(), prefs); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "notification preferences updated successfully",
+		"data":    prefs,
+	})
+}
+
+// handleGetPurchasedProducts lists every product the authenticated user has ordered once, for "buy again" features
+func (h *Handler) handleGetPurchasedProducts(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	products, err := h.orders.GetPurchasedProducts(r.Context(), userId)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "purchased products fetched successfully",
+		"data":    products,
+	})
+}
+
+// handleListUsers returns a page of users for administrators
+// Accepts optional limit and offset query parameters
+func (h *Handler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.GetIntParam(r, "limit", utils.DefaultPageLimit)
+	if err != nil || limit < 1 || limit > utils.MaxPageLimit {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", utils.MaxPageLimit))
+		return
+	}
+	offset, err := utils.GetIntParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("offset must be a non-negative integer"))
+		return
+	}
+
+	users, err := h.store.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	total, err := h.store.CountUsers(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := make([]types.UserResponse, len(users))
+	for i, user := range users {
+		response[i] = types.NewUserResponse(user)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "users fetched successfully",
+		"data":    response,
+		"pagination": map[string]int{
+			"limit":  limit,
+			"offset": offset,
+			"total":  total,
+		},
+	})
+}
+
+// handleActivateUser lets an admin re-enable a deactivated user
+func (h *Handler) handleActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, true)
+}
+
+// handleDeactivateUser lets an admin block a user from logging in without deleting their data
+func (h *Handler) handleDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, false)
+}
+
+// setUserActive updates the active flag of the user identified by the id path variable
+func (h *Handler) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	adminId, err := utils.AuthenticateRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+		return
+	}
+	if !active && id == adminId {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("you cannot deactivate your own account"))
+		return
+	}
+
+	user, err := h.store.GetUserByID(r.Context(), id)
+	if err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if active {
+		err = h.store.ActivateUser(r.Context(), id)
+	} else {
+		err = h.store.DeactivateUser(r.Context(), id)
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	user.IsActive = active
+
+	message := "user activated successfully"
+	if !active {
+		message = "user deactivated successfully"
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": message,
+		"data":    types.NewUserResponse(*user),
+	})
+}
+
+// handleGetUserOrders lets an admin see another user's orders, for example when handling a support request
+func (h *Handler) handleGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id < 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user ID"))
+		return
+	}
+
+	if _, err := h.store.GetUserByID(r.Context(), id); err == sql.ErrNoRows {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	orders, err := h.orders.GetOrders(r.Context(), id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"message": "user orders fetched successfully",
+		"data":    orders,
+	})
+}
+
 // validateLoginPayload validates the login payload
 // Returns an error if any required field is missing or invalid
 func validateLoginPayload(payload types.LoginUserPayload) error {
@@ -117,9 +684,23 @@ func validateLoginPayload(payload types.LoginUserPayload) error {
 }
 
 // handleRegister processes user registration requests
+// An email that is already registered is rejected with 400, also when two registrations of it race past the existence check,
+// since the unique email index lets only one of them through. ?upsert=false is the default and only supported mode
 // w is the response writer to send back HTTP responses
 // r is the HTTP request containing the registration data
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if upsert := r.URL.Query().Get("upsert"); upsert != "" {
+		enabled, err := strconv.ParseBool(upsert)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("upsert must be true or false"))
+			return
+		}
+		if enabled {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("registration can't update an existing account, upsert must be false"))
+			return
+		}
+	}
+
 	var payload types.RegisterUserPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
@@ -133,13 +714,14 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user already exists
-	existingUser, err := h.store.GetUserByEmail(payload.Email)
+	existingUser, err := h.store.GetUserByEmail(r.Context(), payload.Email)
 	if err != nil && err != sql.ErrNoRows {
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("error checking user existence: %w", err))
 		return
 	}
-	if existingUser != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", payload.Email))
+	// a guest checkout's account is claimed by registering its email rather than blocking it
+	if existingUser != nil && !existingUser.IsGuest {
+		writeEmailExists(w, payload.Email)
 		return
 	}
 
@@ -150,17 +732,32 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create new user
+	// Create new user, recording when the terms of service were accepted
+	now := time.Now()
 	user := &types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
 		Password:  hashedPassword,
-		CreatedAt: time.Now(),
+		Role:      types.RoleUser,
+		IsActive:  true,
+		CreatedAt: now,
+
+		TermsAcceptedAt: &now,
 	}
 
-	// Save user to database
-	if err := h.store.CreateUser(user); err != nil {
+	// Save user to database, converting the guest account in place so its orders stay with the email
+	save := h.store.CreateUser
+	if existingUser != nil {
+		user.ID = existingUser.ID
+		save = h.store.ClaimGuestUser
+	}
+	if err := save(r.Context(), user); err != nil {
+		// another registration of the email won the race since the existence check
+		if errors.Is(err, ErrEmailTaken) {
+			writeEmailExists(w, payload.Email)
+			return
+		}
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("error creating user: %w", err))
 		return
 	}
@@ -188,6 +785,54 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// writeEmailExists rejects a registration of an email that already has an account
+// The same response is sent whether the existence check or the unique email index caught the duplicate
+func writeEmailExists(w http.ResponseWriter, email string) {
+	utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", email))
+}
+
+// validatePasswordComplexity checks a new password against the configured complexity rules
+// Length limits and the special character requirement come from config, so messages reflect them
+func validatePasswordComplexity(password string) error {
+	minLength := int(config.Envs.PasswordMinLength)
+	maxLength := int(config.Envs.PasswordMaxLength)
+
+	if len(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+	if len(password) > maxLength {
+		return fmt.Errorf("password must not exceed %d characters", maxLength)
+	}
+	// Check for at least one number and one letter
+	hasNumber := regexp.MustCompile(`[0-9]`).MatchString(password)
+	hasLetter := regexp.MustCompile(`[a-zA-Z]`).MatchString(password)
+	if !hasNumber || !hasLetter {
+		return fmt.Errorf("password must contain at least one number and one letter")
+	}
+	if config.Envs.PasswordRequireSpecial && !regexp.MustCompile(`[^a-zA-Z0-9]`).MatchString(password) {
+		return fmt.Errorf("password must contain at least one special character")
+	}
+	if config.Envs.RejectCommonPasswords && auth.IsCommonPassword(password) {
+		return fmt.Errorf("password is too common")
+	}
+	return nil
+}
+
+// emailDomainAllowed reports whether an email's domain is in REGISTER_ALLOWED_DOMAINS, ignoring case
+// Every domain is allowed when the list is empty
+func emailDomainAllowed(email string) bool {
+	if len(config.Envs.RegisterAllowedDomains) == 0 {
+		return true
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range config.Envs.RegisterAllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
 // validateRegisterPayload validates the registration payload
 // Returns an error if any required field is missing or invalid
 func (h *Handler) validateRegisterPayload(payload types.RegisterUserPayload) error {
@@ -199,22 +844,19 @@ func (h *Handler) validateRegisterPayload(payload types.RegisterUserPayload) err
 	if !emailRegex.MatchString(payload.Email) {
 		return fmt.Errorf("invalid email format")
 	}
+	if !emailDomainAllowed(payload.Email) {
+		return fmt.Errorf("email domain not allowed")
+	}
+	if config.Envs.RejectDisposableEmails && isDisposableEmail(payload.Email) {
+		return fmt.Errorf("disposable email addresses are not allowed")
+	}
 
 	// Password validation
 	if payload.Password == "" {
 		return fmt.Errorf("password is required")
 	}
-	if len(payload.Password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters long")
-	}
-	if len(payload.Password) > 32 {
-		return fmt.Errorf("password must not exceed 32 characters")
-	}
-	// Check for at least one number and one letter
-	hasNumber := regexp.MustCompile(`[0-9]`).MatchString(payload.Password)
-	hasLetter := regexp.MustCompile(`[a-zA-Z]`).MatchString(payload.Password)
-	if !hasNumber || !hasLetter {
-		return fmt.Errorf("password must contain at least one number and one letter")
+	if err := validatePasswordComplexity(payload.Password); err != nil {
+		return err
 	}
 
 	// First name validation
@@ -247,5 +889,10 @@ func (h *Handler) validateRegisterPayload(payload types.RegisterUserPayload) err
 		return fmt.Errorf("last name contains invalid characters")
 	}
 
+	// Terms of service must be explicitly accepted
+	if !payload.AcceptsTerms {
+		return fmt.Errorf("you must accept the terms of service")
+	}
+
 	return nil
 }
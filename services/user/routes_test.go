@@ -3,16 +3,29 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Asif-Faizal/Gommerce/config"
 	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/services/testutil"
 	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -22,7 +35,7 @@ func TestUserServiceHandlers(t *testing.T) {
 	// Create a mock user store for testing
 	userStore := &mockUserStore{}
 	// Create a new handler with the mock store
-	handler := NewHandler(userStore)
+	handler := NewHandler(userStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
 
 	// Test case: Invalid user registration payload
 	t.Run("Should fail if payload is invalid", func(t *testing.T) {
@@ -208,44 +221,37 @@ func TestUserServiceHandlers(t *testing.T) {
 				},
 				wantErr: "last name contains invalid characters",
 			},
+
+			// Terms of service validation cases
+			{
+				name: "terms not accepted",
+				payload: types.RegisterUserPayload{
+					FirstName:    "John",
+					LastName:     "Doe",
+					Email:        "test@example.com",
+					Password:     "password123",
+					AcceptsTerms: false,
+				},
+				wantErr: "you must accept the terms of service",
+			},
 		}
 
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
-				// Marshal the payload to JSON
-				marshaled, err := json.Marshal(tc.payload)
-				if err != nil {
-					t.Fatalf("Failed to marshal payload: %v", err)
-				}
-
-				// Create a new HTTP request with the JSON payload
-				req, err := http.NewRequest(http.MethodPost, "/user/register", bytes.NewBuffer(marshaled))
-				if err != nil {
-					t.Fatalf("Failed to create request: %v", err)
-				}
-
-				// Create a response recorder to capture the response
-				rr := httptest.NewRecorder()
-
 				// Set up the router and register the handler
 				router := mux.NewRouter()
 				router.HandleFunc("/user/register", handler.handleRegister).Methods(http.MethodPost)
 
-				// Serve the request
-				router.ServeHTTP(rr, req)
+				rr := testutil.MakeRequest(t, router, http.MethodPost, "/user/register", tc.payload)
 
 				// Check if the response status code is 400 (Bad Request)
 				if rr.Code != http.StatusBadRequest {
 					t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
 				}
 
-				var response map[string]string
-				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-					t.Fatalf("Failed to decode response: %v", err)
-				}
-
-				if response["error"] != tc.wantErr {
-					t.Errorf("Expected error %q, got %q", tc.wantErr, response["error"])
+				response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+				if response.Error.Message != tc.wantErr {
+					t.Errorf("Expected error %q, got %q", tc.wantErr, response.Error.Message)
 				}
 			})
 		}
@@ -265,50 +271,37 @@ func TestUserServiceHandlers(t *testing.T) {
 			},
 		}
 
-		handler := NewHandler(mockStore)
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
 		payload := types.RegisterUserPayload{
-			FirstName: "John",
-			LastName:  "Doe",
-			Email:     "test@example.com",
-			Password:  "password123",
-		}
-
-		marshaled, err := json.Marshal(payload)
-		if err != nil {
-			t.Fatalf("Failed to marshal payload: %v", err)
-		}
-
-		req, err := http.NewRequest(http.MethodPost, "/user/register", bytes.NewBuffer(marshaled))
-		if err != nil {
-			t.Fatalf("Failed to create request: %v", err)
+			FirstName:    "John",
+			LastName:     "Doe",
+			Email:        "test@example.com",
+			Password:     "password123",
+			AcceptsTerms: true,
 		}
 
-		rr := httptest.NewRecorder()
 		router := mux.NewRouter()
 		router.HandleFunc("/user/register", handler.handleRegister).Methods(http.MethodPost)
-		router.ServeHTTP(rr, req)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/user/register", payload)
 
 		if rr.Code != http.StatusBadRequest {
 			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
 		}
 
-		var response map[string]string
-		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-			t.Fatalf("Failed to decode response: %v", err)
-		}
-
+		response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
 		expectedErr := fmt.Sprintf("user with email %s already exists", payload.Email)
-		if response["error"] != expectedErr {
-			t.Errorf("Expected error %q, got %q", expectedErr, response["error"])
+		if response.Error.Message != expectedErr {
+			t.Errorf("Expected error %q, got %q", expectedErr, response.Error.Message)
 		}
 	})
 	t.Run("Should create a new user if payload is valid", func(t *testing.T) {
 		// Create a valid payload
 		payload := types.RegisterUserPayload{
-			FirstName: "John",
-			LastName:  "Doe",
-			Email:     "test@example.com",
-			Password:  "password123",
+			FirstName:    "John",
+			LastName:     "Doe",
+			Email:        "test@example.com",
+			Password:     "password123",
+			AcceptsTerms: true,
 		}
 
 		// Set up mock functions
@@ -322,41 +315,25 @@ func TestUserServiceHandlers(t *testing.T) {
 
 		userStore.createUserFunc = func(user *types.User) error {
 			createUserCalled = true
+			if user.TermsAcceptedAt == nil {
+				t.Error("Expected TermsAcceptedAt to be set")
+			}
 			user.ID = 1 // Set an ID for the created user
 			return nil
 		}
 
-		// Marshal the payload to JSON
-		marshaled, err := json.Marshal(payload)
-		if err != nil {
-			t.Fatalf("Failed to marshal payload: %v", err)
-		}
-
-		// Create a new HTTP request with the JSON payload
-		req, err := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(marshaled))
-		if err != nil {
-			t.Fatalf("Failed to create request: %v", err)
-		}
-
-		// Create a response recorder to capture the response
-		rr := httptest.NewRecorder()
-
 		// Set up the router and register the handler
 		router := mux.NewRouter()
 		router.HandleFunc("/register", handler.handleRegister).Methods(http.MethodPost)
 
-		// Serve the request
-		router.ServeHTTP(rr, req)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/register", payload)
 
 		// Check if the response status code is 201 (Created)
 		if rr.Code != http.StatusCreated {
 			t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
 		}
 
-		var response map[string]interface{}
-		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-			t.Fatalf("Failed to decode response: %v", err)
-		}
+		response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
 
 		// Verify success message
 		if response["message"] != "user created successfully" {
@@ -372,6 +349,69 @@ func TestUserServiceHandlers(t *testing.T) {
 		}
 	})
 
+	t.Run("Should claim the guest account of the email", func(t *testing.T) {
+		payload := types.RegisterUserPayload{
+			FirstName:    "John",
+			LastName:     "Doe",
+			Email:        "guest@example.com",
+			Password:     "password123",
+			AcceptsTerms: true,
+		}
+
+		var claimed *types.User
+		mockStore := &mockUserStore{
+			getUserByEmailFunc: func(email string) (*types.User, error) {
+				return &types.User{ID: 7, Email: email, IsGuest: true, CreatedAt: time.Now()}, nil
+			},
+			createUserFunc: func(user *types.User) error {
+				t.Error("Expected the guest account to be claimed rather than a new user created")
+				return nil
+			},
+			claimGuestUserFunc: func(user *types.User) error {
+				claimed = user
+				return nil
+			},
+		}
+
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+		router := mux.NewRouter()
+		router.HandleFunc("/register", handler.handleRegister).Methods(http.MethodPost)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/register", payload)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		if claimed == nil || claimed.ID != 7 || claimed.Password == "" || claimed.TermsAcceptedAt == nil {
+			t.Errorf("Expected the guest account 7 to be claimed with a password and accepted terms, got %+v", claimed)
+		}
+	})
+
+	t.Run("Should fail if the guest account is claimed concurrently", func(t *testing.T) {
+		mockStore := &mockUserStore{
+			getUserByEmailFunc: func(email string) (*types.User, error) {
+				return &types.User{ID: 7, Email: email, IsGuest: true}, nil
+			},
+			claimGuestUserFunc: func(user *types.User) error {
+				return ErrEmailTaken
+			},
+		}
+
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+		router := mux.NewRouter()
+		router.HandleFunc("/register", handler.handleRegister).Methods(http.MethodPost)
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/register", types.RegisterUserPayload{
+			FirstName:    "John",
+			LastName:     "Doe",
+			Email:        "guest@example.com",
+			Password:     "password123",
+			AcceptsTerms: true,
+		})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
 	// Test login functionality
 	t.Run("Login Tests", func(t *testing.T) {
 		// Create a test password and hash it
@@ -401,6 +441,7 @@ func TestUserServiceHandlers(t *testing.T) {
 					LastName:  "Doe",
 					Email:     "test@example.com",
 					Password:  hashedPassword,
+					IsActive:  true,
 				},
 				expectedCode: http.StatusOK,
 			},
@@ -426,6 +467,7 @@ func TestUserServiceHandlers(t *testing.T) {
 					LastName:  "Doe",
 					Email:     "test@example.com",
 					Password:  hashedPassword,
+					IsActive:  true,
 				},
 				expectedCode:  http.StatusUnauthorized,
 				expectedError: "invalid email or password",
@@ -480,28 +522,13 @@ func TestUserServiceHandlers(t *testing.T) {
 					},
 				}
 
-				handler := NewHandler(mockStore)
-
-				// Create request
-				payload, err := json.Marshal(tc.payload)
-				if err != nil {
-					t.Fatalf("Failed to marshal payload: %v", err)
-				}
-
-				req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(payload))
-				if err != nil {
-					t.Fatalf("Failed to create request: %v", err)
-				}
-
-				// Create response recorder
-				rr := httptest.NewRecorder()
+				handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
 
 				// Create router and register handler
 				router := mux.NewRouter()
 				router.HandleFunc("/login", handler.handleLogin).Methods(http.MethodPost)
 
-				// Serve request
-				router.ServeHTTP(rr, req)
+				rr := testutil.MakeRequest(t, router, http.MethodPost, "/login", tc.payload)
 
 				// Check status code
 				if rr.Code != tc.expectedCode {
@@ -509,14 +536,12 @@ func TestUserServiceHandlers(t *testing.T) {
 				}
 
 				// Check response body
-				var response map[string]interface{}
-				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
-					t.Fatalf("Failed to decode response: %v", err)
-				}
+				response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
 
 				if tc.expectedError != "" {
-					if response["error"] != tc.expectedError {
-						t.Errorf("Expected error %q, got %q", tc.expectedError, response["error"])
+					apiErr, _ := response["error"].(map[string]interface{})
+					if apiErr["message"] != tc.expectedError {
+						t.Errorf("Expected error %q, got %q", tc.expectedError, apiErr["message"])
 					}
 				} else {
 					// Check success response structure
@@ -541,28 +566,1310 @@ func TestUserServiceHandlers(t *testing.T) {
 			})
 		}
 	})
+
+	// Test account lockout after repeated failed logins
+	t.Run("Should lock account after repeated failed logins", func(t *testing.T) {
+		hashedPassword, err := auth.HashPassword("password123")
+		if err != nil {
+			t.Fatalf("Failed to hash test password: %v", err)
+		}
+
+		mockStore := &mockUserStore{
+			getUserByEmailFunc: func(email string) (*types.User, error) {
+				return &types.User{ID: 1, Email: email, Password: hashedPassword, IsActive: true}, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+		handler.loginLimiter = auth.NewLoginLimiter(3, time.Minute)
+
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin).Methods(http.MethodPost)
+
+		login := func(password string) *httptest.ResponseRecorder {
+			return testutil.MakeRequest(t, router, http.MethodPost, "/login", types.LoginUserPayload{Email: "test@example.com", Password: password})
+		}
+
+		for i := 0; i < 3; i++ {
+			if rr := login("wrongpassword"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		}
+
+		// Even the correct password is rejected while the account is locked
+		rr := login("password123")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+		if response.Error.Message != "account temporarily locked" {
+			t.Errorf("Expected error %q, got %q", "account temporarily locked", response.Error.Message)
+		}
+	})
+
+	// Test login history recording and retrieval
+	t.Run("Login History Tests", func(t *testing.T) {
+		hashedPassword, err := auth.HashPassword("password123")
+		if err != nil {
+			t.Fatalf("Failed to hash test password: %v", err)
+		}
+
+		var recorded []*types.LoginEvent
+		mockStore := &mockUserStore{
+			getUserByEmailFunc: func(email string) (*types.User, error) {
+				return &types.User{ID: 7, Email: email, Password: hashedPassword, IsActive: true}, nil
+			},
+			recordLoginAttemptFunc: func(event *types.LoginEvent) error {
+				recorded = append(recorded, event)
+				return nil
+			},
+			getLoginEventsFunc: func(userID, page, limit int) ([]types.LoginEvent, int, error) {
+				if userID != 7 {
+					t.Errorf("Expected user ID 7, got %d", userID)
+				}
+				return []types.LoginEvent{{ID: 1, UserID: userID, Success: true}}, 11, nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+
+		router := mux.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin).Methods(http.MethodPost)
+		router.HandleFunc("/user/login-history", handler.handleGetLoginHistory).Methods(http.MethodGet)
+
+		for _, password := range []string{"wrongpassword", "password123"} {
+			payload := types.LoginUserPayload{Email: "test@example.com", Password: password}
+			testutil.MakeRequest(t, router, http.MethodPost, "/login", payload, http.Header{"User-Agent": {"test-agent"}})
+		}
+
+		if len(recorded) != 2 {
+			t.Fatalf("Expected 2 recorded login events, got %d", len(recorded))
+		}
+		if recorded[0].Success || !recorded[1].Success {
+			t.Error("Expected a failed attempt followed by a successful one")
+		}
+		if recorded[1].UserID != 7 || recorded[1].UserAgent != "test-agent" {
+			t.Errorf("Unexpected login event: %+v", recorded[1])
+		}
+
+		rr := testutil.MakeRequest(t, router, http.MethodGet, "/user/login-history?page=2&limit=5", nil, authorized(t, 7))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
+		pagination, ok := response["pagination"].(map[string]interface{})
+		if !ok {
+			t.Fatal("Expected pagination object in response")
+		}
+		if pagination["page"] != float64(2) || pagination["limit"] != float64(5) || pagination["totalPages"] != float64(3) {
+			t.Errorf("Unexpected pagination metadata: %v", pagination)
+		}
+	})
+
+	// Test admin-only user listing
+	t.Run("List Users Tests", func(t *testing.T) {
+		users := make([]types.User, 25)
+		for i := range users {
+			users[i] = types.User{
+				ID:        i + 1,
+				FirstName: "User",
+				LastName:  "Test",
+				Email:     fmt.Sprintf("user%d@example.com", i+1),
+				Password:  "hashedpassword",
+				Role:      types.RoleUser,
+			}
+		}
+
+		testCases := []struct {
+			name           string
+			query          string
+			role           string
+			expectedCode   int
+			expectedLimit  int
+			expectedOffset int
+		}{
+			{
+				name:           "default page",
+				role:           types.RoleAdmin,
+				expectedCode:   http.StatusOK,
+				expectedLimit:  10,
+				expectedOffset: 0,
+			},
+			{
+				name:           "custom page",
+				query:          "?limit=5&offset=20",
+				role:           types.RoleAdmin,
+				expectedCode:   http.StatusOK,
+				expectedLimit:  5,
+				expectedOffset: 20,
+			},
+			{
+				name:         "invalid limit",
+				query:        "?limit=abc",
+				role:         types.RoleAdmin,
+				expectedCode: http.StatusBadRequest,
+			},
+			{
+				name:         "negative offset",
+				query:        "?offset=-1",
+				role:         types.RoleAdmin,
+				expectedCode: http.StatusBadRequest,
+			},
+			{
+				name:         "non-admin is forbidden",
+				role:         types.RoleUser,
+				expectedCode: http.StatusForbidden,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				mockStore := &mockUserStore{
+					getUserByIDFunc: func(id int) (*types.User, error) {
+						return &types.User{ID: id, Role: tc.role, IsActive: true}, nil
+					},
+					listUsersFunc: func(limit, offset int) ([]types.User, error) {
+						if limit != tc.expectedLimit || offset != tc.expectedOffset {
+							t.Errorf("Expected limit %d and offset %d, got %d and %d", tc.expectedLimit, tc.expectedOffset, limit, offset)
+						}
+						end := offset + limit
+						if end > len(users) {
+							end = len(users)
+						}
+						return users[offset:end], nil
+					},
+					countUsersFunc: func() (int, error) {
+						return len(users), nil
+					},
+				}
+				handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+				router := mux.NewRouter()
+				handler.RegisterRoutes(router)
+
+				rr := testutil.MakeRequest(t, router, http.MethodGet, "/users"+tc.query, nil, authorized(t, 1))
+				if rr.Code != tc.expectedCode {
+					t.Fatalf("Expected status %d, got %d", tc.expectedCode, rr.Code)
+				}
+				if tc.expectedCode != http.StatusOK {
+					return
+				}
+
+				response := testutil.DecodeJSON[map[string]interface{}](t, rr.Body)
+				data, ok := response["data"].([]interface{})
+				if !ok {
+					t.Fatal("Expected data to be an array of users")
+				}
+				if len(data) != tc.expectedLimit {
+					t.Errorf("Expected %d users, got %d", tc.expectedLimit, len(data))
+				}
+				for _, item := range data {
+					if _, hasPassword := item.(map[string]interface{})["password"]; hasPassword {
+						t.Error("Expected users to be returned without passwords")
+					}
+				}
+				pagination, ok := response["pagination"].(map[string]interface{})
+				if !ok {
+					t.Fatal("Expected pagination object in response")
+				}
+				if pagination["total"] != float64(len(users)) {
+					t.Errorf("Expected total %d, got %v", len(users), pagination["total"])
+				}
+			})
+		}
+	})
+
+	// Test user deactivation
+	t.Run("Deactivation Tests", func(t *testing.T) {
+		hashedPassword, err := auth.HashPassword("password123")
+		if err != nil {
+			t.Fatalf("Failed to hash test password: %v", err)
+		}
+
+		users := map[int]*types.User{
+			1: {ID: 1, Email: "admin@example.com", Role: types.RoleAdmin, IsActive: true},
+			2: {ID: 2, Email: "test@example.com", Password: hashedPassword, Role: types.RoleUser, IsActive: true},
+		}
+		mockStore := &mockUserStore{
+			getUserByIDFunc: func(id int) (*types.User, error) {
+				if user, ok := users[id]; ok {
+					copied := *user
+					return &copied, nil
+				}
+				return nil, sql.ErrNoRows
+			},
+			getUserByEmailFunc: func(email string) (*types.User, error) {
+				for _, user := range users {
+					if user.Email == email {
+						copied := *user
+						return &copied, nil
+					}
+				}
+				return nil, sql.ErrNoRows
+			},
+			deactivateUserFunc: func(id int) error {
+				users[id].IsActive = false
+				return nil
+			},
+		}
+		handler := NewHandler(mockStore, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+		router := mux.NewRouter()
+		handler.RegisterRoutes(router)
+
+		serve := func(method, path string, body any, userID int) *httptest.ResponseRecorder {
+			header := http.Header{}
+			if userID != 0 {
+				header.Set("Authorization", authHeader(t, userID))
+			}
+			return testutil.MakeRequest(t, router, method, path, body, header)
+		}
+
+		if rr := serve(http.MethodPut, "/admin/users/1/deactivate", nil, 2); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected non-admin to get status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if rr := serve(http.MethodPut, "/admin/users/99/deactivate", nil, 1); rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for unknown user, got %d", http.StatusNotFound, rr.Code)
+		}
+		if rr := serve(http.MethodPut, "/admin/users/2/deactivate", nil, 1); rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr := serve(http.MethodPost, "/login", types.LoginUserPayload{Email: "test@example.com", Password: "password123"}, 0)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+		if response.Error.Message != "account is deactivated" {
+			t.Errorf("Expected error %q, got %q", "account is deactivated", response.Error.Message)
+		}
+	})
 }
 
 // mockUserStore implements the types.UserStore interface for testing
 type mockUserStore struct {
-	getUserByEmailFunc func(email string) (*types.User, error)
-	createUserFunc     func(user *types.User) error
+	getUserByEmailFunc     func(email string) (*types.User, error)
+	createUserFunc         func(user *types.User) error
+	claimGuestUserFunc     func(user *types.User) error
+	recordLoginAttemptFunc func(event *types.LoginEvent) error
+	getLoginEventsFunc     func(userID, page, limit int) ([]types.LoginEvent, int, error)
+	getUserByIDFunc        func(id int) (*types.User, error)
+	listUsersFunc          func(limit, offset int) ([]types.User, error)
+	countUsersFunc         func() (int, error)
+	deactivateUserFunc     func(id int) error
+	activateUserFunc       func(id int) error
+	updateAvatarFunc       func(userID int, path string) error
+	updatePasswordFunc     func(userID int, hashedPassword string) error
+	updateUserFunc         func(user *types.User) error
 }
 
-func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 	if m.getUserByEmailFunc != nil {
 		return m.getUserByEmailFunc(email)
 	}
 	return nil, fmt.Errorf("user not found")
 }
 
-func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	if m.getUserByIDFunc != nil {
+		return m.getUserByIDFunc(id)
+	}
 	return nil, nil
 }
 
-func (m *mockUserStore) CreateUser(user *types.User) error {
+func (m *mockUserStore) CreateUser(ctx context.Context, user *types.User) error {
 	if m.createUserFunc != nil {
 		return m.createUserFunc(user)
 	}
 	return nil
 }
+
+func (m *mockUserStore) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	if m.claimGuestUserFunc != nil {
+		return m.claimGuestUserFunc(user)
+	}
+	return nil
+}
+
+func (m *mockUserStore) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	if m.recordLoginAttemptFunc != nil {
+		return m.recordLoginAttemptFunc(event)
+	}
+	return nil
+}
+
+func (m *mockUserStore) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	if m.getLoginEventsFunc != nil {
+		return m.getLoginEventsFunc(userID, page, limit)
+	}
+	return []types.LoginEvent{}, 0, nil
+}
+
+func (m *mockUserStore) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	if m.listUsersFunc != nil {
+		return m.listUsersFunc(limit, offset)
+	}
+	return []types.User{}, nil
+}
+
+func (m *mockUserStore) CountUsers(ctx context.Context) (int, error) {
+	if m.countUsersFunc != nil {
+		return m.countUsersFunc()
+	}
+	return 0, nil
+}
+
+func (m *mockUserStore) DeactivateUser(ctx context.Context, id int) error {
+	if m.deactivateUserFunc != nil {
+		return m.deactivateUserFunc(id)
+	}
+	return nil
+}
+
+func (m *mockUserStore) ActivateUser(ctx context.Context, id int) error {
+	if m.activateUserFunc != nil {
+		return m.activateUserFunc(id)
+	}
+	return nil
+}
+
+func (m *mockUserStore) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	if m.updateAvatarFunc != nil {
+		return m.updateAvatarFunc(userID, path)
+	}
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	if m.updatePasswordFunc != nil {
+		return m.updatePasswordFunc(userID, hashedPassword)
+	}
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(ctx context.Context, user *types.User) error {
+	if m.updateUserFunc != nil {
+		return m.updateUserFunc(user)
+	}
+	return nil
+}
+
+// mockAPIKeyStore implements the types.APIKeyStore interface for testing
+// Keys are kept in memory so they can be created, used and revoked within a test
+type mockAPIKeyStore struct {
+	keys []types.APIKey
+}
+
+func (m *mockAPIKeyStore) CreateAPIKey(ctx context.Context, key *types.APIKey) error {
+	key.ID = len(m.keys) + 1
+	key.CreatedAt = time.Now()
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *mockAPIKeyStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*types.APIKey, error) {
+	for i := range m.keys {
+		if m.keys[i].KeyHash == keyHash {
+			return &m.keys[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAPIKeyStore) MarkAPIKeyUsed(ctx context.Context, id int) error {
+	for i := range m.keys {
+		if m.keys[i].ID == id {
+			now := time.Now()
+			m.keys[i].LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockAPIKeyStore) RevokeAPIKey(ctx context.Context, id, userID int) error {
+	for i, key := range m.keys {
+		if key.ID == id && key.UserID == userID {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// mockOrderStore implements the types.OrderStore interface, returning the orders and purchases held for each user
+type mockOrderStore struct {
+	orders    map[int][]types.Order
+	purchases map[int][]types.PurchasedProduct
+}
+
+func (m *mockOrderStore) CreateOrders(ctx context.Context, orders []*types.Order) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateReservedOrder(ctx context.Context, order *types.Order, reservationID int) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrders(ctx context.Context, userID int) ([]types.Order, error) {
+	return m.orders[userID], nil
+}
+
+func (m *mockOrderStore) GetOrdersByStatus(ctx context.Context, userID int, status string, page, limit int) ([]types.Order, int, error) {
+	var orders []types.Order
+	for _, order := range m.orders[userID] {
+		if status == "" || order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+	start := min((page-1)*limit, len(orders))
+	end := min(start+limit, len(orders))
+	return orders[start:end], len(orders), nil
+}
+
+func (m *mockOrderStore) GetOrderByID(ctx context.Context, id int) (*types.Order, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) GetOrderItems(ctx context.Context, orderIDs []int) (map[int][]types.OrderItem, error) {
+	return map[int][]types.OrderItem{}, nil
+}
+
+func (m *mockOrderStore) GetOrdersByProductID(ctx context.Context, productID, page, limit int) ([]types.Order, int, error) {
+	return []types.Order{}, 0, nil
+}
+
+func (m *mockOrderStore) UpdateOrderItem(ctx context.Context, orderID, productID int, variantID *int, newQuantity int) error {
+	return nil
+}
+
+func (m *mockOrderStore) ExportOrders(ctx context.Context, userID int, from, to time.Time, fn func(types.OrderSummary) error) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetPurchasedProducts(ctx context.Context, userID int) ([]types.PurchasedProduct, error) {
+	if purchases, ok := m.purchases[userID]; ok {
+		return purchases, nil
+	}
+	return []types.PurchasedProduct{}, nil
+}
+
+// mockAddressStore implements the types.AddressStore interface in memory
+type mockAddressStore struct {
+	addresses []types.SavedAddress
+}
+
+func (m *mockAddressStore) CreateAddress(ctx context.Context, address *types.SavedAddress) error {
+	address.ID = len(m.addresses) + 1
+	address.CreatedAt = time.Now()
+	m.addresses = append(m.addresses, *address)
+	return nil
+}
+
+func (m *mockAddressStore) GetAddresses(ctx context.Context, userID int) ([]types.SavedAddress, error) {
+	addresses := []types.SavedAddress{}
+	for _, address := range m.addresses {
+		if address.UserID == userID {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(ctx context.Context, id, userID int) (*types.SavedAddress, error) {
+	for i := range m.addresses {
+		if m.addresses[i].ID == id && m.addresses[i].UserID == userID {
+			return &m.addresses[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) DeleteAddress(ctx context.Context, id, userID int) error {
+	for i, address := range m.addresses {
+		if address.ID == id && address.UserID == userID {
+			m.addresses = append(m.addresses[:i], m.addresses[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+type mockNotificationPrefsStore struct {
+	prefs map[int]types.NotificationPrefs
+}
+
+func (m *mockNotificationPrefsStore) GetPrefs(ctx context.Context, userID int) (*types.NotificationPrefs, error) {
+	if prefs, ok := m.prefs[userID]; ok {
+		return &prefs, nil
+	}
+	return types.DefaultNotificationPrefs(userID), nil
+}
+
+func (m *mockNotificationPrefsStore) UpdatePrefs(ctx context.Context, prefs *types.NotificationPrefs) error {
+	if m.prefs == nil {
+		m.prefs = make(map[int]types.NotificationPrefs)
+	}
+	now := time.Now()
+	prefs.UpdatedAt = &now
+	m.prefs[prefs.UserID] = *prefs
+	return nil
+}
+
+// authHeader returns a valid Authorization header value for the given user ID
+func authHeader(t *testing.T, userID int) string {
+	t.Helper()
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), userID)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+// authorized returns request headers authenticating as the given user ID
+func authorized(t *testing.T, userID int) http.Header {
+	t.Helper()
+	return http.Header{"Authorization": {authHeader(t, userID)}}
+}
+
+// TestValidatePasswordComplexity checks the password rules under the default and a stricter config
+func TestValidatePasswordComplexity(t *testing.T) {
+	original := config.Envs
+	defer func() { config.Envs = original }()
+
+	testCases := []struct {
+		name           string
+		minLength      int64
+		maxLength      int64
+		requireSpecial bool
+		rejectCommon   bool
+		password       string
+		wantErr        string
+	}{
+		{name: "default accepts letters and numbers", minLength: 8, maxLength: 32, password: "password123"},
+		{name: "default rejects short password", minLength: 8, maxLength: 32, password: "pass1", wantErr: "password must be at least 8 characters long"},
+		{name: "default does not require special character", minLength: 8, maxLength: 32, password: "abcdefg1"},
+		{name: "strict rejects missing special character", minLength: 12, maxLength: 64, requireSpecial: true, password: "password123456", wantErr: "password must contain at least one special character"},
+		{name: "strict accepts special character", minLength: 12, maxLength: 64, requireSpecial: true, password: "password123!#"},
+		{name: "strict builds length message from config", minLength: 12, maxLength: 64, requireSpecial: true, password: "pass123!", wantErr: "password must be at least 12 characters long"},
+		{name: "strict builds max message from config", minLength: 4, maxLength: 10, password: "password12345", wantErr: "password must not exceed 10 characters"},
+		{name: "common password allowed when check disabled", minLength: 8, maxLength: 32, password: "password123"},
+		{name: "common password rejected when check enabled", minLength: 8, maxLength: 32, rejectCommon: true, password: "password123", wantErr: "password is too common"},
+		{name: "strong password passes common check", minLength: 8, maxLength: 32, rejectCommon: true, password: "t7Vq9zLm2xKp"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Envs.PasswordMinLength = tc.minLength
+			config.Envs.PasswordMaxLength = tc.maxLength
+			config.Envs.PasswordRequireSpecial = tc.requireSpecial
+			config.Envs.RejectCommonPasswords = tc.rejectCommon
+
+			err := validatePasswordComplexity(tc.password)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestRegisterConcurrentDuplicates checks registrations of one email that race past the existence check create exactly one account
+// The other registrations get the same 400 as a sequential duplicate. Run it with -race
+func TestRegisterConcurrentDuplicates(t *testing.T) {
+	var mu sync.Mutex
+	users := map[string]*types.User{}
+	store := &mockUserStore{
+		// every registration races past the existence check
+		getUserByEmailFunc: func(email string) (*types.User, error) {
+			return nil, sql.ErrNoRows
+		},
+		// the unique email index lets only the first insert through
+		createUserFunc: func(user *types.User) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, ok := users[user.Email]; ok {
+				return ErrEmailTaken
+			}
+			user.ID = len(users) + 1
+			users[user.Email] = user
+			return nil
+		},
+	}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	body := `{"firstName":"John","lastName":"Doe","email":"race@example.com","password":"password123","acceptsTerms":true}`
+	const attempts = 8
+	codes := make([]int, attempts)
+	messages := make([]string, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/register?upsert=false", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var response struct {
+				Error types.APIError `json:"error"`
+			}
+			json.NewDecoder(rr.Body).Decode(&response)
+			codes[i] = rr.Code
+			messages[i] = response.Error.Message
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusBadRequest:
+			if messages[i] != "user with email race@example.com already exists" {
+				t.Errorf("Unexpected error for a duplicate registration: %q", messages[i])
+			}
+		default:
+			t.Errorf("Expected status %d or %d, got %d", http.StatusCreated, http.StatusBadRequest, code)
+		}
+	}
+	if created != 1 || len(users) != 1 {
+		t.Errorf("Expected exactly one account to be created, got %d (%d stored)", created, len(users))
+	}
+
+	rr := testutil.MakeRequest(t, router, http.MethodPost, "/register?upsert=true", body)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for upsert=true, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestRegisterAllowedDomains checks REGISTER_ALLOWED_DOMAINS restricts registration to the listed email domains
+func TestRegisterAllowedDomains(t *testing.T) {
+	original := config.Envs.RegisterAllowedDomains
+	defer func() { config.Envs.RegisterAllowedDomains = original }()
+
+	handler := NewHandler(&mockUserStore{}, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	testCases := []struct {
+		name    string
+		allowed []string
+		email   string
+		wantErr string
+	}{
+		{name: "allowed domain", allowed: []string{"example.com", "corp.example"}, email: "jane@corp.example"},
+		{name: "allowed domain in another case", allowed: []string{"example.com"}, email: "jane@Example.COM"},
+		{name: "rejected domain", allowed: []string{"example.com"}, email: "jane@gmail.com", wantErr: "email domain not allowed"},
+		{name: "subdomain of an allowed domain", allowed: []string{"example.com"}, email: "jane@mail.example.com", wantErr: "email domain not allowed"},
+		{name: "unset allows every domain", allowed: nil, email: "jane@gmail.com"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Envs.RegisterAllowedDomains = tc.allowed
+			err := handler.validateRegisterPayload(types.RegisterUserPayload{
+				FirstName:    "Jane",
+				LastName:     "Doe",
+				Email:        tc.email,
+				Password:     "password123",
+				AcceptsTerms: true,
+			})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestRegisterDisposableEmails checks REJECT_DISPOSABLE_EMAILS rejects registration with disposable-email domains
+func TestRegisterDisposableEmails(t *testing.T) {
+	original := config.Envs.RejectDisposableEmails
+	defer func() { config.Envs.RejectDisposableEmails = original }()
+
+	handler := NewHandler(&mockUserStore{}, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	testCases := []struct {
+		name    string
+		reject  bool
+		email   string
+		wantErr string
+	}{
+		{name: "disposable domain rejected", reject: true, email: "jane@mailinator.com", wantErr: "disposable email addresses are not allowed"},
+		{name: "disposable domain in another case rejected", reject: true, email: "jane@YopMail.COM", wantErr: "disposable email addresses are not allowed"},
+		{name: "normal domain passes", reject: true, email: "jane@gmail.com"},
+		{name: "disposable domain allowed when check disabled", reject: false, email: "jane@mailinator.com"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Envs.RejectDisposableEmails = tc.reject
+			err := handler.validateRegisterPayload(types.RegisterUserPayload{
+				FirstName:    "Jane",
+				LastName:     "Doe",
+				Email:        tc.email,
+				Password:     "password123",
+				AcceptsTerms: true,
+			})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("Expected error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestAdminUserOrders checks admins can list another user's orders and other users can't
+func TestAdminUserOrders(t *testing.T) {
+	users := map[int]*types.User{
+		1: {ID: 1, Email: "admin@example.com", Role: types.RoleAdmin, IsActive: true},
+		2: {ID: 2, Email: "test@example.com", Role: types.RoleUser, IsActive: true},
+	}
+	store := &mockUserStore{
+		getUserByIDFunc: func(id int) (*types.User, error) {
+			if user, ok := users[id]; ok {
+				return user, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+	orders := &mockOrderStore{orders: map[int][]types.Order{
+		2: {{ID: 7, UserID: 2, Total: 42, Status: "pending"}},
+	}}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, orders)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	serve := func(path string, userID int) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, http.MethodGet, path, nil, authorized(t, userID))
+	}
+
+	rr := serve("/admin/users/2/orders", 1)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	response := testutil.DecodeJSON[struct {
+		Data []types.Order `json:"data"`
+	}](t, rr.Body)
+	if len(response.Data) != 1 || response.Data[0].ID != 7 {
+		t.Errorf("Expected user 2's order, got %+v", response.Data)
+	}
+
+	if rr := serve("/admin/users/1/orders", 2); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected non-admin to get status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := serve("/admin/users/99/orders", 1); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown user, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := serve("/admin/users/abc/orders", 1); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid ID, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestAPIKeys walks an API key through creation, authentication and revocation
+func TestAPIKeys(t *testing.T) {
+	apiKeys := &mockAPIKeyStore{}
+	utils.SetAPIKeyStore(apiKeys)
+	t.Cleanup(func() { utils.SetAPIKeyStore(nil) })
+
+	handler := NewHandler(&mockUserStore{}, apiKeys, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	serve := func(method, path, authorization string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		header := http.Header{}
+		if authorization != "" {
+			header.Set("Authorization", authorization)
+		}
+		return testutil.MakeRequest(t, router, method, path, body, header)
+	}
+
+	// Create a key while logged in with a JWT
+	rr := serve(http.MethodPost, "/user/api-keys", authHeader(t, 1), `{"label":"billing service"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	response := testutil.DecodeJSON[struct {
+		Data struct {
+			APIKey types.APIKey `json:"apiKey"`
+			Key    string       `json:"key"`
+		} `json:"data"`
+	}](t, rr.Body)
+	key := response.Data.Key
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) {
+		t.Fatalf("Expected key with prefix %q, got %q", auth.APIKeyPrefix, key)
+	}
+	if len(apiKeys.keys) != 1 || apiKeys.keys[0].KeyHash != auth.HashAPIKey(key) {
+		t.Fatal("Expected only the SHA-256 hash of the key to be stored")
+	}
+
+	// A missing label is rejected
+	rr = serve(http.MethodPost, "/user/api-keys", authHeader(t, 1), `{}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a missing label, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// The key authenticates requests as its owner
+	userID, err := utils.AuthenticateRequest(&http.Request{Header: http.Header{"Authorization": {"ApiKey " + key}}})
+	if err != nil || userID != 1 {
+		t.Errorf("Expected the key to authenticate user 1, got %d (%v)", userID, err)
+	}
+	if apiKeys.keys[0].LastUsedAt == nil {
+		t.Error("Expected the key's last use to be recorded")
+	}
+	if _, err := utils.AuthenticateRequest(&http.Request{Header: http.Header{"Authorization": {"ApiKey gmk_unknown"}}}); err == nil {
+		t.Error("Expected an unknown key to be rejected")
+	}
+
+	// Other users can't revoke the key
+	path := fmt.Sprintf("/user/api-keys/%d", response.Data.APIKey.ID)
+	if rr := serve(http.MethodDelete, path, authHeader(t, 2), nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d revoking another user's key, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// The owner can revoke the key, using the key itself
+	if rr := serve(http.MethodDelete, path, "ApiKey "+key, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if _, err := utils.AuthenticateRequest(&http.Request{Header: http.Header{"Authorization": {"ApiKey " + key}}}); err == nil {
+		t.Error("Expected a revoked key to be rejected")
+	}
+}
+
+// TestLoginRehashesPassword checks a password hashed with an old algorithm is moved to the configured one on login
+func TestLoginRehashesPassword(t *testing.T) {
+	bcryptHash, err := auth.HashPassword("password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if err := auth.SetPasswordHasher(auth.Argon2IDHasher{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}); err != nil {
+		t.Fatalf("Failed to set password hasher: %v", err)
+	}
+	t.Cleanup(func() { auth.SetPasswordHasher(auth.BCryptHasher{}) })
+
+	user := &types.User{ID: 4, Email: "old@example.com", Password: bcryptHash, IsActive: true}
+	updates := 0
+	store := &mockUserStore{
+		getUserByEmailFunc: func(email string) (*types.User, error) {
+			return user, nil
+		},
+		updatePasswordFunc: func(userID int, hashedPassword string) error {
+			updates++
+			if userID != 4 || !strings.HasPrefix(hashedPassword, "$argon2id$") {
+				t.Errorf("Unexpected rehash of user %d to %q", userID, hashedPassword)
+			}
+			user.Password = hashedPassword
+			return nil
+		},
+	}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	login := func() {
+		t.Helper()
+		rr := testutil.MakeRequest(t, router, http.MethodPost, "/login", `{"email":"old@example.com","password":"password123"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	}
+
+	login()
+	if updates != 1 {
+		t.Fatalf("Expected the bcrypt hash to be replaced once, got %d updates", updates)
+	}
+	// The new hash is already argon2id, so the next login verifies against it and leaves it alone
+	login()
+	if updates != 1 {
+		t.Errorf("Expected no rehash of an argon2id hash, got %d updates", updates)
+	}
+}
+
+// TestLoginUnknownEmail checks unknown emails get the generic error after a dummy bcrypt comparison
+func TestLoginUnknownEmail(t *testing.T) {
+	compares := 0
+	dummyCompare = func() { compares++ }
+	t.Cleanup(func() { dummyCompare = auth.DummyCompare })
+
+	store := &mockUserStore{
+		getUserByEmailFunc: func(email string) (*types.User, error) {
+			return nil, sql.ErrNoRows
+		},
+	}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, http.MethodPost, "/login", body)
+	}
+
+	rr := serve(`{"email":"nobody@example.com","password":"password123"}`)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusUnauthorized, rr.Code, rr.Body.String())
+	}
+	response := testutil.DecodeJSON[testutil.ErrorResponse](t, rr.Body)
+	if response.Error.Message != "invalid email or password" {
+		t.Errorf("Expected the generic login error, got %q", response.Error.Message)
+	}
+	if compares != 1 {
+		t.Errorf("Expected one dummy comparison, got %d", compares)
+	}
+
+	// Bodies over the configured limit are rejected before any lookup
+	padding := strings.Repeat("a", int(config.Envs.LoginMaxBodyBytes))
+	rr = serve(`{"email":"nobody@example.com","password":"` + padding + `"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an oversized body, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if compares != 1 {
+		t.Errorf("Expected no dummy comparison for an oversized body, got %d", compares)
+	}
+}
+
+// TestAvatarUpload checks avatars are validated, resized and saved, and replace the previous one
+func TestAvatarUpload(t *testing.T) {
+	avatarDir := config.Envs.AvatarDir
+	config.Envs.AvatarDir = t.TempDir()
+	defer func() { config.Envs.AvatarDir = avatarDir }()
+
+	user := &types.User{ID: 1}
+	store := &mockUserStore{
+		getUserByIDFunc: func(id int) (*types.User, error) {
+			current := *user
+			return &current, nil
+		},
+		updateAvatarFunc: func(userID int, path string) error {
+			user.AvatarURL = path
+			return nil
+		},
+	}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	upload := func(data []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("avatar", "avatar")
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write(data)
+		form.Close()
+
+		header := http.Header{"Content-Type": {form.FormDataContentType()}, "Authorization": {authHeader(t, 1)}}
+		return testutil.MakeRequest(t, router, http.MethodPost, "/user/avatar", body.Bytes(), header)
+	}
+	encode := func(encoder func(*bytes.Buffer, image.Image) error, width, height int) []byte {
+		t.Helper()
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			img.Set(x, 0, color.RGBA{R: 255, A: 255})
+		}
+		var buf bytes.Buffer
+		if err := encoder(&buf, img); err != nil {
+			t.Fatalf("Failed to encode image: %v", err)
+		}
+		return buf.Bytes()
+	}
+	encodePNG := func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+	encodeJPEG := func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+
+	rr := upload(encode(encodePNG, 600, 400))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	response := testutil.DecodeJSON[struct {
+		Data struct {
+			AvatarURL string `json:"avatarUrl"`
+		} `json:"data"`
+	}](t, rr.Body)
+	if response.Data.AvatarURL != config.Envs.BaseURL()+user.AvatarURL || !strings.HasSuffix(user.AvatarURL, ".png") {
+		t.Fatalf("Unexpected avatar URL %q for stored path %q", response.Data.AvatarURL, user.AvatarURL)
+	}
+	first := filepath.Join(config.Envs.AvatarDir, filepath.Base(user.AvatarURL))
+	saved, err := os.Open(first)
+	if err != nil {
+		t.Fatalf("Expected the avatar to be saved: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(saved)
+	saved.Close()
+	if err != nil || format != "png" || cfg.Width != 256 || cfg.Height != 256 {
+		t.Errorf("Expected a 256x256 png, got %dx%d %s (%v)", cfg.Width, cfg.Height, format, err)
+	}
+
+	if rr := upload(encode(encodeJPEG, 100, 300)); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if !strings.HasSuffix(user.AvatarURL, ".jpg") {
+		t.Errorf("Expected a jpg avatar, got %q", user.AvatarURL)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("Expected the replaced avatar to be removed, got %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		data           []byte
+		expectedStatus int
+	}{
+		{name: "not an image", data: []byte("GIF89a not really"), expectedStatus: http.StatusBadRequest},
+		{name: "corrupt png", data: encode(encodePNG, 10, 10)[:40], expectedStatus: http.StatusBadRequest},
+		{name: "too large", data: append(encode(encodePNG, 10, 10), make([]byte, 2<<20)...), expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rr := upload(tc.data); rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestAvatarHandler checks saved avatars are served but the directories holding them can't be listed
+func TestAvatarHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "1-1.png"), []byte("avatar"), 0o644); err != nil {
+		t.Fatalf("Failed to write avatar: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	handler := AvatarHandler(dir)
+
+	testCases := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: AvatarPath + "1-1.png", expectedStatus: http.StatusOK},
+		{path: AvatarPath, expectedStatus: http.StatusNotFound},
+		{path: AvatarPath + "nested/", expectedStatus: http.StatusNotFound},
+		{path: AvatarPath + "missing.png", expectedStatus: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusOK && rr.Body.String() != "avatar" {
+				t.Errorf("Expected the avatar to be served, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestAddressBook walks an address through being saved, listed and deleted
+func TestAddressBook(t *testing.T) {
+	addresses := &mockAddressStore{}
+	handler := NewHandler(&mockUserStore{}, &mockAPIKeyStore{}, addresses, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	serve := func(method, path string, userID int, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, method, path, body, authorized(t, userID))
+	}
+
+	rr := serve(http.MethodPost, "/user/addresses", 1, `{"line":"1 Main St","country":"us"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if len(addresses.addresses) != 1 || addresses.addresses[0].Country != "US" || addresses.addresses[0].UserID != 1 {
+		t.Fatalf("Expected one US address for user 1, got %+v", addresses.addresses)
+	}
+
+	// Invalid addresses are rejected
+	if rr := serve(http.MethodPost, "/user/addresses", 1, `{"country":"US"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a missing line, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := serve(http.MethodPost, "/user/addresses", 1, `{"line":"1 Main St","country":"USA"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a three letter country, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// Each user only sees their own addresses
+	rr = serve(http.MethodGet, "/user/addresses", 2, nil)
+	response := testutil.DecodeJSON[struct {
+		Data []types.SavedAddress `json:"data"`
+	}](t, rr.Body)
+	if len(response.Data) != 0 {
+		t.Errorf("Expected no addresses for user 2, got %d", len(response.Data))
+	}
+
+	// Other users can't delete the address, its owner can
+	if rr := serve(http.MethodDelete, "/user/addresses/1", 2, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d deleting another user's address, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := serve(http.MethodDelete, "/user/addresses/1", 1, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if len(addresses.addresses) != 0 {
+		t.Error("Expected the address to be deleted")
+	}
+}
+
+// TestNotificationPrefs checks users get the defaults until they save their own, and can only replace all of them at once
+func TestNotificationPrefs(t *testing.T) {
+	prefs := &mockNotificationPrefsStore{}
+	handler := NewHandler(&mockUserStore{}, &mockAPIKeyStore{}, &mockAddressStore{}, prefs, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	type prefsResponse struct {
+		Data types.NotificationPrefs `json:"data"`
+	}
+	serve := func(method string, userID int, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, method, "/user/notification-preferences", body, authorized(t, userID))
+	}
+
+	if rr := testutil.MakeRequest(t, router, http.MethodGet, "/user/notification-preferences", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := serve(http.MethodGet, 1, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	got := testutil.DecodeJSON[prefsResponse](t, rr.Body).Data
+	if !got.OrderUpdates || !got.PriceAlerts || got.Newsletter || got.UpdatedAt != nil {
+		t.Errorf("Expected the defaults for a user without preferences, got %+v", got)
+	}
+
+	rr = serve(http.MethodPut, 1, `{"orderUpdates":true,"priceAlerts":false,"newsletter":true}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	got = testutil.DecodeJSON[prefsResponse](t, rr.Body).Data
+	if got.UserID != 1 || !got.OrderUpdates || got.PriceAlerts || !got.Newsletter || got.UpdatedAt == nil {
+		t.Errorf("Expected the saved preferences, got %+v", got)
+	}
+
+	// A partial update is rejected rather than resetting the missing preferences
+	if rr := serve(http.MethodPut, 1, `{"orderUpdates":false}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for missing preferences, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	got = testutil.DecodeJSON[prefsResponse](t, serve(http.MethodGet, 1, nil).Body).Data
+	if !got.OrderUpdates || got.PriceAlerts || !got.Newsletter {
+		t.Errorf("Expected the saved preferences to be returned, got %+v", got)
+	}
+
+	// Other users keep the defaults
+	got = testutil.DecodeJSON[prefsResponse](t, serve(http.MethodGet, 2, nil).Body).Data
+	if got.UserID != 2 || !got.PriceAlerts || got.Newsletter {
+		t.Errorf("Expected the defaults for user 2, got %+v", got)
+	}
+}
+
+// TestPurchasedProducts checks users only see the products they bought themselves
+func TestPurchasedProducts(t *testing.T) {
+	lastPurchase := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	orders := &mockOrderStore{purchases: map[int][]types.PurchasedProduct{
+		1: {{ProductID: 7, Name: "Coffee Beans", Price: 12.5, Currency: "USD", LastPurchasedAt: lastPurchase}},
+	}}
+	handler := NewHandler(&mockUserStore{}, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, orders)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	type purchasesResponse struct {
+		Data []types.PurchasedProduct `json:"data"`
+	}
+
+	if rr := testutil.MakeRequest(t, router, http.MethodGet, "/user/me/purchases", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr := testutil.MakeRequest(t, router, http.MethodGet, "/user/me/purchases", nil, authorized(t, 1))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	purchases := testutil.DecodeJSON[purchasesResponse](t, rr.Body).Data
+	if len(purchases) != 1 || purchases[0].ProductID != 7 || !purchases[0].LastPurchasedAt.Equal(lastPurchase) {
+		t.Errorf("Expected the coffee beans bought on %v, got %+v", lastPurchase, purchases)
+	}
+
+	rr = testutil.MakeRequest(t, router, http.MethodGet, "/user/me/purchases", nil, authorized(t, 2))
+	if !strings.Contains(rr.Body.String(), `"data":[]`) {
+		t.Errorf("Expected an empty list for a user without purchases, got %s", rr.Body.String())
+	}
+}
+
+// TestUpdateProfile checks two users can't end up with the same email
+func TestUpdateProfile(t *testing.T) {
+	users := map[int]*types.User{
+		1: {ID: 1, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", IsActive: true},
+		2: {ID: 2, FirstName: "John", LastName: "Doe", Email: "john@example.com", IsActive: true},
+	}
+	store := &mockUserStore{
+		getUserByIDFunc: func(id int) (*types.User, error) {
+			if user, ok := users[id]; ok {
+				stored := *user
+				return &stored, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+		updateUserFunc: func(user *types.User) error {
+			for _, other := range users {
+				if other.ID != user.ID && other.Email == user.Email {
+					return ErrEmailTaken
+				}
+			}
+			users[user.ID] = user
+			return nil
+		},
+	}
+	handler := NewHandler(store, &mockAPIKeyStore{}, &mockAddressStore{}, &mockNotificationPrefsStore{}, &mockOrderStore{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	serve := func(userID int, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return testutil.MakeRequest(t, router, http.MethodPut, "/user/profile", body, authorized(t, userID))
+	}
+
+	// Jane moves to a new email
+	rr := serve(1, `{"firstName":"Jane","lastName":"Smith","email":"shared@example.com"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if users[1].Email != "shared@example.com" || users[1].LastName != "Smith" {
+		t.Errorf("Expected user 1 to be updated, got %+v", users[1])
+	}
+
+	// Saving her profile again with her own email is fine
+	if rr := serve(1, `{"firstName":"Jane","lastName":"Smith","email":"shared@example.com"}`); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d keeping the same email, got %d", http.StatusOK, rr.Code)
+	}
+
+	// John can't claim the same email
+	rr = serve(2, `{"firstName":"John","lastName":"Doe","email":"shared@example.com"}`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+	if users[2].Email != "john@example.com" {
+		t.Errorf("Expected user 2's email to be unchanged, got %q", users[2].Email)
+	}
+
+	if rr := serve(2, `{"firstName":"John","lastName":"Doe","email":"not-an-email"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid email, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -2,37 +2,95 @@
 package user
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Asif-Faizal/Gommerce/db"
+	"github.com/Asif-Faizal/Gommerce/tracing"
 	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
 )
 
+// ErrEmailTaken is returned when a user tries to take an email that belongs to another user
+var ErrEmailTaken = errors.New("email is already in use by another account")
+
 // Store represents the user data store
 // It implements the types.UserStore interface
 type Store struct {
-	db *sql.DB // Database connection
+	db      *sql.DB               // Database connection
+	breaker *utils.CircuitBreaker // Fails calls fast while the database is unreachable
 }
 
 // NewStore creates a new instance of the user Store
-// Takes a database connection as a parameter
-func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+// Every call to the database connection goes through breaker, usually the one from utils.NewDBCircuitBreaker
+func NewStore(db *sql.DB, breaker *utils.CircuitBreaker) *Store {
+	return &Store{db: db, breaker: breaker}
+}
+
+// exec runs a statement through the circuit breaker
+func (s *Store) exec(query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := s.breaker.Execute(func() error {
+		var err error
+		result, err = s.db.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// query runs a query through the circuit breaker
+func (s *Store) query(query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := s.breaker.Execute(func() error {
+		var err error
+		rows, err = s.db.Query(query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// queryRow prepares a single row query, it runs through the circuit breaker when the row is scanned
+func (s *Store) queryRow(query string, args ...any) row {
+	return row{breaker: s.breaker, query: func() *sql.Row { return s.db.QueryRow(query, args...) }}
+}
+
+// row is a single row query that runs when it is scanned, like *sql.Row
+type row struct {
+	breaker *utils.CircuitBreaker
+	query   func() *sql.Row
+}
+
+func (r row) Scan(dest ...any) error {
+	return r.breaker.Execute(func() error {
+		return r.query().Scan(dest...)
+	})
 }
 
 // GetUserByEmail retrieves a user from the database by their email
 // Returns the user if found, or an error if not found or if there's a database error
-func (s *Store) GetUserByEmail(email string) (*types.User, error) {
-	query := "SELECT id, firstName, lastName, email, password, createdAt FROM users WHERE email = ?"
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	defer tracing.StartDBSpan(ctx, "GetUserByEmail").End()
+
+	query := "SELECT id, firstName, lastName, email, password, role, isActive, isGuest, avatarUrl, createdAt, termsAcceptedAt FROM users WHERE email = ?"
 	user := &types.User{}
 
-	err := s.db.QueryRow(query, email).Scan(
+	err := s.queryRow(query, email).Scan(
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&user.IsActive,
+		&user.IsGuest,
+		&user.AvatarURL,
 		&user.CreatedAt,
+		&user.TermsAcceptedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -46,53 +104,622 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 }
 
 // GetUserByID retrieves a user from the database by their ID
-// Returns the user if found, or an error if not found or if there's a database error
-func (s *Store) GetUserByID(id int) (*types.User, error) {
-	rows, err := s.db.Query("SELECT * FROM users WHERE id = ?", id)
+// Returns the user if found, sql.ErrNoRows if not found, or an error if there's a database error
+func (s *Store) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	defer tracing.StartDBSpan(ctx, "GetUserByID").End()
+
+	query := "SELECT id, firstName, lastName, email, password, role, isActive, isGuest, avatarUrl, createdAt, termsAcceptedAt FROM users WHERE id = ?"
+	user := &types.User{}
+
+	err := s.queryRow(query, id).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password,
+		&user.Role,
+		&user.IsActive,
+		&user.IsGuest,
+		&user.AvatarURL,
+		&user.CreatedAt,
+		&user.TermsAcceptedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error querying user: %w", err)
 	}
-	u := new(types.User)
+
+	return user, nil
+}
+
+// ListUsers retrieves a page of users ordered by ID
+// The password hash is not selected, so returned users never carry it
+func (s *Store) ListUsers(ctx context.Context, limit, offset int) ([]types.User, error) {
+	defer tracing.StartDBSpan(ctx, "ListUsers").End()
+
+	query := `
+		SELECT id, firstName, lastName, email, role, isActive, avatarUrl, createdAt
+		FROM users
+		ORDER BY id ASC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []types.User{}
 	for rows.Next() {
-		u, err = scanRowsIntoUser(rows)
-		if err != nil {
+		var user types.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.Role,
+			&user.IsActive,
+			&user.AvatarURL,
+			&user.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CountUsers returns the total number of users in the database
+func (s *Store) CountUsers(ctx context.Context) (int, error) {
+	defer tracing.StartDBSpan(ctx, "CountUsers").End()
+
+	var total int
+	if err := s.queryRow("SELECT COUNT(*) FROM users").Scan(&total); err != nil {
+		return 0, fmt.Errorf("error counting users: %w", err)
+	}
+	return total, nil
+}
+
+// CreateUser inserts a new user into the database and sets its ID
+// A user_created audit entry is written in the same transaction, so the user isn't created if the entry can't be recorded
+// Returns ErrEmailTaken if the unique email index rejects the insert, so concurrent registrations of one email can't both succeed
+func (s *Store) CreateUser(ctx context.Context, user *types.User) error {
+	defer tracing.StartDBSpan(ctx, "CreateUser").End()
+
+	query := `
+		INSERT INTO users (firstName, lastName, email, password, role, isActive, createdAt, termsAcceptedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if user.Role == "" {
+		user.Role = types.RoleUser
+	}
+	err := s.breaker.Execute(func() error {
+		var id int64
+		err := db.WithTransaction(s.db, func(tx *sql.Tx) error {
+			result, err := tx.Exec(query, user.FirstName, user.LastName, user.Email, user.Password, user.Role, user.IsActive, user.CreatedAt, user.TermsAcceptedAt)
+			if err != nil {
+				return err
+			}
+			if id, err = result.LastInsertId(); err != nil {
+				return err
+			}
+
+			// the entry's userId identifies the account, personal data such as the email isn't copied into the log
+			metadata := map[string]interface{}{"role": user.Role}
+			if err := recordAudit(tx, types.AuditUserCreated, int(id), metadata); err != nil {
+				return fmt.Errorf("error recording audit log: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		user.ID = int(id)
+		return nil
+	})
+	if db.IsDuplicateEntry(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// ClaimGuestUser turns the guest account with the user's ID and email into a registered account
+// The account keeps its ID, and with it the guest's orders, and takes the user's name, password, role and terms acceptance.
+// A user_created audit entry is written in the same transaction, like CreateUser
+// Returns ErrEmailTaken if the account is no longer a guest with that email, e.g. because a concurrent registration claimed it
+func (s *Store) ClaimGuestUser(ctx context.Context, user *types.User) error {
+	defer tracing.StartDBSpan(ctx, "ClaimGuestUser").End()
+
+	query := `
+		UPDATE users
+		SET firstName = ?, lastName = ?, password = ?, role = ?, isActive = ?, isGuest = FALSE, termsAcceptedAt = ?
+		WHERE id = ? AND email = ? AND isGuest = TRUE
+	`
+	if user.Role == "" {
+		user.Role = types.RoleUser
+	}
+	return s.breaker.Execute(func() error {
+		return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+			result, err := tx.Exec(query, user.FirstName, user.LastName, user.Password, user.Role, user.IsActive, user.TermsAcceptedAt, user.ID, user.Email)
+			if err != nil {
+				return err
+			}
+			claimed, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if claimed == 0 {
+				return ErrEmailTaken
+			}
+			user.IsGuest = false
+
+			metadata := map[string]interface{}{"role": user.Role}
+			if err := recordAudit(tx, types.AuditUserCreated, user.ID, metadata); err != nil {
+				return fmt.Errorf("error recording audit log: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// Record writes an entry to the audit log
+func (s *Store) Record(ctx context.Context, event string, userID int, metadata map[string]interface{}) error {
+	defer tracing.StartDBSpan(ctx, "Record").End()
+
+	return s.breaker.Execute(func() error {
+		return recordAudit(s.db, event, userID, metadata)
+	})
+}
+
+// execer runs statements, it is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// recordAudit inserts an audit log entry, within a transaction when conn is a *sql.Tx
+func recordAudit(conn execer, event string, userID int, metadata map[string]interface{}) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec("INSERT INTO audit_log (event, userId, metadata) VALUES (?, ?, ?)", event, userID, string(encoded))
+	return err
+}
+
+// CreateGuestUser inserts a passwordless account for a guest checkout and sets its ID
+func (s *Store) CreateGuestUser(ctx context.Context, user *types.User) error {
+	defer tracing.StartDBSpan(ctx, "CreateGuestUser").End()
+
+	query := `
+		INSERT INTO users (firstName, lastName, email, password, role, isActive, isGuest, createdAt)
+		VALUES (?, ?, ?, '', ?, TRUE, TRUE, ?)
+	`
+	user.Role = types.RoleUser
+	user.IsActive = true
+	user.IsGuest = true
+	result, err := s.exec(query, user.FirstName, user.LastName, user.Email, user.Role, user.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	return nil
+}
+
+// PurgeGuestUsers cleans up guest accounts created before createdBefore and returns how many were affected
+// Guests without orders are deleted along with their reservations
+// Guests with orders keep their account so the orders stay intact, but their contact details are erased
+func (s *Store) PurgeGuestUsers(ctx context.Context, createdBefore time.Time) (int, error) {
+	defer tracing.StartDBSpan(ctx, "PurgeGuestUsers").End()
+
+	var purged int64
+	err := s.breaker.Execute(func() error {
+		return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+			// guests who never completed an order, e.g. because the checkout failed
+			rows, err := tx.Query(`
+				SELECT id FROM users
+				WHERE isGuest = TRUE AND createdAt < ?
+				AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.userId = users.id)
+			`, createdBefore)
+			if err != nil {
+				return err
+			}
+			var ids []any
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return err
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			var deletedCount int64
+			if len(ids) > 0 {
+				placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+				if _, err := tx.Exec(`
+					DELETE reservation_items FROM reservation_items
+					JOIN reservations ON reservations.id = reservation_items.reservationId
+					WHERE reservations.userId IN (`+placeholders+`)
+				`, ids...); err != nil {
+					return err
+				}
+				if _, err := tx.Exec("DELETE FROM reservations WHERE userId IN ("+placeholders+")", ids...); err != nil {
+					return err
+				}
+				deleted, err := tx.Exec("DELETE FROM users WHERE id IN ("+placeholders+")", ids...)
+				if err != nil {
+					return err
+				}
+				if deletedCount, err = deleted.RowsAffected(); err != nil {
+					return err
+				}
+			}
+
+			anonymized, err := tx.Exec(`
+				UPDATE users SET firstName = 'Guest', lastName = '', email = CONCAT('guest-', id, '@guest.invalid')
+				WHERE isGuest = TRUE AND createdAt < ? AND email <> CONCAT('guest-', id, '@guest.invalid')
+			`, createdBefore)
+			if err != nil {
+				return err
+			}
+
+			anonymizedCount, err := anonymized.RowsAffected()
+			if err != nil {
+				return err
+			}
+			purged = deletedCount + anonymizedCount
+
+			// tokens expire on their own, their rows only need clearing away
+			_, err = tx.Exec("DELETE FROM guest_order_tokens WHERE expiresAt <= ?", time.Now())
+			return err
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error purging guest users: %w", err)
+	}
+	return int(purged), nil
+}
+
+// CreateGuestOrderToken stores the hash of a token that lets a guest view an order until expiresAt
+func (s *Store) CreateGuestOrderToken(ctx context.Context, orderID int, tokenHash string, expiresAt time.Time) error {
+	defer tracing.StartDBSpan(ctx, "CreateGuestOrderToken").End()
+
+	_, err := s.exec("INSERT INTO guest_order_tokens (orderId, tokenHash, expiresAt) VALUES (?, ?, ?)", orderID, tokenHash, expiresAt)
+	return err
+}
+
+// RotateGuestOrderToken uses up the unexpired guest order token with the given hash and returns its order ID
+// The token is replaced by one with newTokenHash and the same expiry in the same transaction, so each token works once
+// Returns sql.ErrNoRows if there is no such token, e.g. because it expired or was already used
+func (s *Store) RotateGuestOrderToken(ctx context.Context, tokenHash, newTokenHash string) (int, error) {
+	defer tracing.StartDBSpan(ctx, "RotateGuestOrderToken").End()
+
+	var orderID int
+	err := s.breaker.Execute(func() error {
+		return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+			var id int
+			var expiresAt time.Time
+			err := tx.QueryRow(
+				"SELECT id, orderId, expiresAt FROM guest_order_tokens WHERE tokenHash = ? AND expiresAt > ? FOR UPDATE",
+				tokenHash, time.Now(),
+			).Scan(&id, &orderID, &expiresAt)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("DELETE FROM guest_order_tokens WHERE id = ?", id); err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				"INSERT INTO guest_order_tokens (orderId, tokenHash, expiresAt) VALUES (?, ?, ?)",
+				orderID, newTokenHash, expiresAt,
+			)
+			return err
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return orderID, nil
+}
+
+// UpdateAvatar sets the path the user's profile picture is served from
+func (s *Store) UpdateAvatar(ctx context.Context, userID int, path string) error {
+	defer tracing.StartDBSpan(ctx, "UpdateAvatar").End()
+
+	_, err := s.exec("UPDATE users SET avatarUrl = ? WHERE id = ?", path, userID)
+	return err
+}
+
+// UpdatePassword replaces the stored password hash of a user
+func (s *Store) UpdatePassword(ctx context.Context, userID int, hashedPassword string) error {
+	defer tracing.StartDBSpan(ctx, "UpdatePassword").End()
+
+	_, err := s.exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, userID)
+	return err
+}
+
+// UpdateUser saves the name and email of an existing user
+// Returns ErrEmailTaken if the email belongs to another user, either found up front or rejected by the unique email index
+func (s *Store) UpdateUser(ctx context.Context, user *types.User) error {
+	defer tracing.StartDBSpan(ctx, "UpdateUser").End()
+
+	existing, err := s.GetUserByEmail(ctx, user.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return ErrEmailTaken
 	}
-	if u.ID == 0 {
-		return nil, fmt.Errorf("user not found")
+
+	_, err = s.exec("UPDATE users SET firstName = ?, lastName = ?, email = ? WHERE id = ?", user.FirstName, user.LastName, user.Email, user.ID)
+	// another request may have claimed the email between the lookup and the update
+	if db.IsDuplicateEntry(err) {
+		return ErrEmailTaken
 	}
-	return u, nil
+	return err
 }
 
-// CreateUser inserts a new user into the database
-// Takes a user object and returns any potential error
-func (s *Store) CreateUser(user *types.User) error {
+// DeactivateUser marks a user as inactive so they can no longer log in
+// The user's data is kept intact
+func (s *Store) DeactivateUser(ctx context.Context, id int) error {
+	defer tracing.StartDBSpan(ctx, "DeactivateUser").End()
+
+	_, err := s.exec("UPDATE users SET isActive = FALSE WHERE id = ?", id)
+	return err
+}
+
+// ActivateUser marks a previously deactivated user as active again
+func (s *Store) ActivateUser(ctx context.Context, id int) error {
+	defer tracing.StartDBSpan(ctx, "ActivateUser").End()
+
+	_, err := s.exec("UPDATE users SET isActive = TRUE WHERE id = ?", id)
+	return err
+}
+
+// RecordLoginAttempt inserts a login event for a user into the database
+// Takes a login event and returns any potential error
+func (s *Store) RecordLoginAttempt(ctx context.Context, event *types.LoginEvent) error {
+	defer tracing.StartDBSpan(ctx, "RecordLoginAttempt").End()
+
 	query := `
-		INSERT INTO users (firstName, lastName, email, password, createdAt)
+		INSERT INTO login_events (userId, ipAddress, userAgent, success, loginAt)
 		VALUES (?, ?, ?, ?, ?)
 	`
-	_, err := s.db.Exec(query, user.FirstName, user.LastName, user.Email, user.Password, user.CreatedAt)
+	result, err := s.exec(query, event.UserID, event.IPAddress, event.UserAgent, event.Success, event.LoginAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = int(id)
+	return nil
+}
+
+// GetLoginEvents retrieves a page of login events for a user, newest first
+// Returns the events along with the total number of events for the user
+func (s *Store) GetLoginEvents(ctx context.Context, userID, page, limit int) ([]types.LoginEvent, int, error) {
+	defer tracing.StartDBSpan(ctx, "GetLoginEvents").End()
+
+	var total int
+	if err := s.queryRow("SELECT COUNT(*) FROM login_events WHERE userId = ?", userID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting login events: %w", err)
+	}
+
+	query := `
+		SELECT id, userId, ipAddress, userAgent, success, loginAt
+		FROM login_events
+		WHERE userId = ?
+		ORDER BY loginAt DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.query(query, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying login events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []types.LoginEvent{}
+	for rows.Next() {
+		var event types.LoginEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.UserID,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.Success,
+			&event.LoginAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// CreateAPIKey stores a new API key for a user
+// Only the key hash is stored; sets the ID and creation time on the key
+func (s *Store) CreateAPIKey(ctx context.Context, key *types.APIKey) error {
+	defer tracing.StartDBSpan(ctx, "CreateAPIKey").End()
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	query := "INSERT INTO api_keys (userId, keyHash, label, createdAt) VALUES (?, ?, ?, ?)"
+	result, err := s.exec(query, key.UserID, key.KeyHash, key.Label, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	key.ID = int(id)
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash
+// Returns sql.ErrNoRows if no key has the hash, e.g. because it was revoked
+func (s *Store) GetAPIKeyByHash(ctx context.Context, keyHash string) (*types.APIKey, error) {
+	defer tracing.StartDBSpan(ctx, "GetAPIKeyByHash").End()
+
+	key := &types.APIKey{}
+	var lastUsedAt sql.NullTime
+	query := "SELECT id, userId, keyHash, label, lastUsedAt, createdAt FROM api_keys WHERE keyHash = ?"
+	err := s.queryRow(query, keyHash).Scan(&key.ID, &key.UserID, &key.KeyHash, &key.Label, &lastUsedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
+
+// MarkAPIKeyUsed records that an API key has just authenticated a request
+func (s *Store) MarkAPIKeyUsed(ctx context.Context, id int) error {
+	defer tracing.StartDBSpan(ctx, "MarkAPIKeyUsed").End()
+
+	_, err := s.exec("UPDATE api_keys SET lastUsedAt = ? WHERE id = ?", time.Now(), id)
 	return err
 }
 
-// scanRowsIntoUser is a helper function that scans database rows into a User struct
-// Returns the user and any potential error
-func scanRowsIntoUser(rows *sql.Rows) (*types.User, error) {
-	if !rows.Next() {
-		return nil, nil
+// RevokeAPIKey deletes one of a user's API keys so it can no longer authenticate
+// Returns sql.ErrNoRows if the user has no key with the given ID
+func (s *Store) RevokeAPIKey(ctx context.Context, id, userID int) error {
+	defer tracing.StartDBSpan(ctx, "RevokeAPIKey").End()
+
+	result, err := s.exec("DELETE FROM api_keys WHERE id = ? AND userId = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
 
-	user := &types.User{}
-	if err := rows.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-	); err != nil {
+// CreateAddress saves an address to a user's address book
+// Sets the ID and creation time on the address
+func (s *Store) CreateAddress(ctx context.Context, address *types.SavedAddress) error {
+	defer tracing.StartDBSpan(ctx, "CreateAddress").End()
+
+	if address.CreatedAt.IsZero() {
+		address.CreatedAt = time.Now()
+	}
+	query := "INSERT INTO user_addresses (userId, line, country, createdAt) VALUES (?, ?, ?, ?)"
+	result, err := s.exec(query, address.UserID, address.Line, address.Country, address.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	address.ID = int(id)
+	return nil
+}
+
+// GetAddresses retrieves every address in a user's address book, oldest first
+func (s *Store) GetAddresses(ctx context.Context, userID int) ([]types.SavedAddress, error) {
+	defer tracing.StartDBSpan(ctx, "GetAddresses").End()
+
+	rows, err := s.query("SELECT id, userId, line, country, createdAt FROM user_addresses WHERE userId = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying addresses: %w", err)
+	}
+	defer rows.Close()
+
+	addresses := []types.SavedAddress{}
+	for rows.Next() {
+		var address types.SavedAddress
+		if err := rows.Scan(&address.ID, &address.UserID, &address.Line, &address.Country, &address.CreatedAt); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+// GetAddressByID retrieves one of a user's saved addresses
+// Returns sql.ErrNoRows if the user has no address with the given ID
+func (s *Store) GetAddressByID(ctx context.Context, id, userID int) (*types.SavedAddress, error) {
+	defer tracing.StartDBSpan(ctx, "GetAddressByID").End()
+
+	address := &types.SavedAddress{}
+	query := "SELECT id, userId, line, country, createdAt FROM user_addresses WHERE id = ? AND userId = ?"
+	err := s.queryRow(query, id, userID).Scan(&address.ID, &address.UserID, &address.Line, &address.Country, &address.CreatedAt)
+	if err != nil {
 		return nil, err
 	}
-	return user, nil
+	return address, nil
+}
+
+// DeleteAddress removes one of a user's saved addresses
+// Orders keep their own copy of the address, so deleting it doesn't affect them
+// Returns sql.ErrNoRows if the user has no address with the given ID
+func (s *Store) DeleteAddress(ctx context.Context, id, userID int) error {
+	defer tracing.StartDBSpan(ctx, "DeleteAddress").End()
+
+	result, err := s.exec("DELETE FROM user_addresses WHERE id = ? AND userId = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetPrefs retrieves a user's notification preferences
+// Users who never saved preferences get the defaults
+func (s *Store) GetPrefs(ctx context.Context, userID int) (*types.NotificationPrefs, error) {
+	defer tracing.StartDBSpan(ctx, "GetPrefs").End()
+
+	prefs := &types.NotificationPrefs{}
+	query := "SELECT userId, orderUpdates, priceAlerts, newsletter, updatedAt FROM notification_preferences WHERE userId = ?"
+	err := s.queryRow(query, userID).Scan(&prefs.UserID, &prefs.OrderUpdates, &prefs.PriceAlerts, &prefs.Newsletter, &prefs.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.DefaultNotificationPrefs(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// UpdatePrefs saves a user's notification preferences, creating the row on first save
+// It sets prefs.UpdatedAt to the time of the save
+func (s *Store) UpdatePrefs(ctx context.Context, prefs *types.NotificationPrefs) error {
+	defer tracing.StartDBSpan(ctx, "UpdatePrefs").End()
+
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	query := "INSERT INTO notification_preferences (userId, orderUpdates, priceAlerts, newsletter, updatedAt) VALUES (?, ?, ?, ?, ?) " +
+		"ON DUPLICATE KEY UPDATE orderUpdates = VALUES(orderUpdates), priceAlerts = VALUES(priceAlerts), newsletter = VALUES(newsletter), updatedAt = VALUES(updatedAt)"
+	if _, err := s.exec(query, prefs.UserID, prefs.OrderUpdates, prefs.PriceAlerts, prefs.Newsletter, updatedAt); err != nil {
+		return fmt.Errorf("error saving notification preferences: %w", err)
+	}
+	prefs.UpdatedAt = &updatedAt
+	return nil
 }
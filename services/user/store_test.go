@@ -0,0 +1,315 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/Asif-Faizal/Gommerce/utils"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+// TestCreateUser checks a user is only created along with its user_created audit entry, and a duplicate email is reported as ErrEmailTaken
+func TestCreateUser(t *testing.T) {
+	newUser := func() *types.User {
+		return &types.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: "hash", IsActive: true, CreatedAt: time.Now()}
+	}
+
+	t.Run("records the creation in the audit log", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db, utils.NewDBCircuitBreaker())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO audit_log").
+			WithArgs(types.AuditUserCreated, 7, `{"role":"user"}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		user := newUser()
+		if err := store.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if user.ID != 7 {
+			t.Errorf("Expected user ID 7, got %d", user.ID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("rolls back the user when the audit entry fails", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db, utils.NewDBCircuitBreaker())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO audit_log").
+			WillReturnError(fmt.Errorf("table is read only"))
+		mock.ExpectRollback()
+
+		user := newUser()
+		if err := store.CreateUser(context.Background(), user); err == nil {
+			t.Fatal("Expected an error when the audit entry can't be written")
+		}
+		if user.ID != 0 {
+			t.Errorf("Expected no user ID to be set, got %d", user.ID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("reports a duplicate email as ErrEmailTaken", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db, utils.NewDBCircuitBreaker())
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'jane@example.com' for key 'users.email'"})
+		mock.ExpectRollback()
+
+		if err := store.CreateUser(context.Background(), newUser()); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("Expected ErrEmailTaken, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestClaimGuestUser checks only a guest row of the email is converted, and a row claimed first is reported as ErrEmailTaken
+func TestClaimGuestUser(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		affected int64
+		expected error
+	}{
+		{name: "converts the guest account", affected: 1},
+		{name: "reports an account that is no longer a guest", affected: 0, expected: ErrEmailTaken},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			store := NewStore(db, utils.NewDBCircuitBreaker())
+
+			now := time.Now()
+			user := &types.User{ID: 7, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: "hash", IsActive: true, IsGuest: true, TermsAcceptedAt: &now}
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE users SET .* WHERE id = \\? AND email = \\? AND isGuest = TRUE").
+				WithArgs("Jane", "Doe", "hash", types.RoleUser, true, &now, 7, "jane@example.com").
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+			if tc.expected == nil {
+				mock.ExpectExec("INSERT INTO audit_log").
+					WithArgs(types.AuditUserCreated, 7, `{"role":"user"}`).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err = store.ClaimGuestUser(context.Background(), user)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && user.IsGuest {
+				t.Error("Expected the claimed user to no longer be a guest")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestRotateGuestOrderToken checks a token is replaced by a new one with the same expiry, and an unknown or expired token finds nothing
+func TestRotateGuestOrderToken(t *testing.T) {
+	t.Run("replaces the token", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db, utils.NewDBCircuitBreaker())
+
+		expiresAt := time.Now().Add(time.Hour)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, orderId, expiresAt FROM guest_order_tokens WHERE tokenHash = \\? AND expiresAt > \\? FOR UPDATE").
+			WithArgs("old", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "orderId", "expiresAt"}).AddRow(3, 42, expiresAt))
+		mock.ExpectExec("DELETE FROM guest_order_tokens WHERE id = \\?").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO guest_order_tokens").
+			WithArgs(42, "new", expiresAt).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectCommit()
+
+		orderID, err := store.RotateGuestOrderToken(context.Background(), "old", "new")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if orderID != 42 {
+			t.Errorf("Expected order 42, got %d", orderID)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("finds no unknown or expired token", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Failed to create sqlmock: %v", err)
+		}
+		defer db.Close()
+		store := NewStore(db, utils.NewDBCircuitBreaker())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, orderId, expiresAt FROM guest_order_tokens").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "orderId", "expiresAt"}))
+		mock.ExpectRollback()
+
+		if _, err := store.RotateGuestOrderToken(context.Background(), "old", "new"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestUpdateUser checks an email that belongs to another user is never written
+func TestUpdateUser(t *testing.T) {
+	userColumns := []string{"id", "firstName", "lastName", "email", "password", "role", "isActive", "isGuest", "avatarUrl", "createdAt", "termsAcceptedAt"}
+	user := &types.User{ID: 1, FirstName: "Jane", LastName: "Doe", Email: "john@example.com"}
+
+	testCases := []struct {
+		name        string
+		setupMock   func(mock sqlmock.Sqlmock)
+		expectedErr error
+	}{
+		{
+			name: "updates when the email is free",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .* FROM users WHERE email = ?").
+					WithArgs("john@example.com").
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec("UPDATE users SET firstName = \\?, lastName = \\?, email = \\? WHERE id = \\?").
+					WithArgs("Jane", "Doe", "john@example.com", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "rejects an email of another user",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .* FROM users WHERE email = ?").
+					WithArgs("john@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns).
+						AddRow(2, "John", "Doe", "john@example.com", "hash", types.RoleUser, true, false, "", time.Now(), nil))
+			},
+			expectedErr: ErrEmailTaken,
+		},
+		{
+			name: "maps a duplicate entry from a concurrent update",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT .* FROM users WHERE email = ?").
+					WithArgs("john@example.com").
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec("UPDATE users").
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'john@example.com' for key 'users.email'"})
+			},
+			expectedErr: ErrEmailTaken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create sqlmock: %v", err)
+			}
+			defer db.Close()
+			tc.setupMock(mock)
+
+			if err := NewStore(db, utils.NewDBCircuitBreaker()).UpdateUser(context.Background(), user); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestNotificationPrefsStore checks users without a row get the defaults and saving upserts the row
+func TestNotificationPrefsStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db, utils.NewDBCircuitBreaker())
+
+	mock.ExpectQuery("SELECT userId, orderUpdates, priceAlerts, newsletter, updatedAt FROM notification_preferences").
+		WithArgs(3).
+		WillReturnError(sql.ErrNoRows)
+	prefs, err := store.GetPrefs(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *prefs != *types.DefaultNotificationPrefs(3) {
+		t.Errorf("Expected the defaults, got %+v", prefs)
+	}
+
+	mock.ExpectExec("INSERT INTO notification_preferences .* ON DUPLICATE KEY UPDATE").
+		WithArgs(3, false, true, true, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prefs = &types.NotificationPrefs{UserID: 3, PriceAlerts: true, Newsletter: true}
+	if err := store.UpdatePrefs(context.Background(), prefs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prefs.UpdatedAt == nil {
+		t.Error("Expected UpdatedAt to be set")
+	}
+
+	updatedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT userId, orderUpdates, priceAlerts, newsletter, updatedAt FROM notification_preferences").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"userId", "orderUpdates", "priceAlerts", "newsletter", "updatedAt"}).
+			AddRow(3, false, true, true, updatedAt))
+	prefs, err = store.GetPrefs(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prefs.OrderUpdates || !prefs.PriceAlerts || !prefs.Newsletter || prefs.UpdatedAt == nil || !prefs.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected the saved preferences, got %+v", prefs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
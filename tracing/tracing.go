@@ -0,0 +1,85 @@
+// Package tracing sets up OpenTelemetry distributed tracing for the application
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the name the application reports to the tracing backend
+const ServiceName = "gommerce"
+
+// TraceIDHeader is the response header carrying the trace ID of the request
+const TraceIDHeader = "X-Trace-Id"
+
+// tracer is the application-wide tracer used for manual spans
+var tracer = otel.Tracer("github.com/Asif-Faizal/Gommerce")
+
+// InitTracer configures the global tracer provider to export spans to the given OTLP/HTTP endpoint
+// When endpoint is empty tracing stays disabled and the returned shutdown function is a no-op
+// The returned shutdown function flushes any buffered spans and should be called on exit
+func InitTracer(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// StartDBSpan starts a "db.Query" span for the named store operation
+// The span is a child of the span in ctx, so queries show up under the request that ran them
+// Callers must end the returned span, usually with defer
+func StartDBSpan(ctx context.Context, operation string) trace.Span {
+	_, span := tracer.Start(ctx, "db.Query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+	return span
+}
+
+// Middleware copies the trace ID of the current request span into the response headers
+// It must run inside the otelhttp handler so the span is already present in the request context
+// utils.WriteError reads this header to add a trace_id to error responses
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			w.Header().Set(TraceIDHeader, spanContext.TraceID().String())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
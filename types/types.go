@@ -1,58 +1,386 @@
 // Package types contains all the shared types and interfaces used across the application
 package types
 
-import "time"
+import (
+	"context"
+	"strconv"
+	"time"
+)
 
 // UserStore defines the interface for user data operations
 // Any struct that implements these methods can be used as a user store
 type UserStore interface {
-	GetUserByEmail(email string) (*User, error)
-	GetUserByID(id int) (*User, error)
-	CreateUser(user *User) error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	ClaimGuestUser(ctx context.Context, user *User) error
+	RecordLoginAttempt(ctx context.Context, event *LoginEvent) error
+	GetLoginEvents(ctx context.Context, userID, page, limit int) ([]LoginEvent, int, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]User, error)
+	CountUsers(ctx context.Context) (int, error)
+	DeactivateUser(ctx context.Context, id int) error
+	ActivateUser(ctx context.Context, id int) error
+	UpdateAvatar(ctx context.Context, userID int, path string) error
+	UpdatePassword(ctx context.Context, userID int, hashedPassword string) error
+	UpdateUser(ctx context.Context, user *User) error
+}
+
+// GuestStore defines the interface for the accounts created by guest checkouts
+// GetUserByEmail finds an earlier guest account, or the registered account a guest's email belongs to
+// Guest order tokens are only ever stored and looked up by their SHA-256 hash
+type GuestStore interface {
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	CreateGuestUser(ctx context.Context, user *User) error
+	PurgeGuestUsers(ctx context.Context, createdBefore time.Time) (int, error)
+	CreateGuestOrderToken(ctx context.Context, orderID int, tokenHash string, expiresAt time.Time) error
+	RotateGuestOrderToken(ctx context.Context, tokenHash, newTokenHash string) (int, error)
+}
+
+// APIKeyStore defines the interface for API key data operations
+// Keys are only ever stored and looked up by their SHA-256 hash
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	MarkAPIKeyUsed(ctx context.Context, id int) error
+	RevokeAPIKey(ctx context.Context, id, userID int) error
+}
+
+// AddressStore defines the interface for a user's saved addresses
+// Lookups and deletes are scoped to the owning user
+type AddressStore interface {
+	CreateAddress(ctx context.Context, address *SavedAddress) error
+	GetAddresses(ctx context.Context, userID int) ([]SavedAddress, error)
+	GetAddressByID(ctx context.Context, id, userID int) (*SavedAddress, error)
+	DeleteAddress(ctx context.Context, id, userID int) error
+}
+
+// NotificationPrefsStore defines the interface for the notifications users opted in to
+type NotificationPrefsStore interface {
+	GetPrefs(ctx context.Context, userID int) (*NotificationPrefs, error)
+	UpdatePrefs(ctx context.Context, prefs *NotificationPrefs) error
+}
+
+// AuditStore defines the interface for the compliance audit log
+// Metadata is stored as JSON alongside the event, it must not hold personal data such as emails as entries outlive accounts
+type AuditStore interface {
+	Record(ctx context.Context, event string, userID int, metadata map[string]interface{}) error
+}
+
+// Audit log events
+const (
+	AuditUserCreated = "user_created" // A user registered an account
+)
+
+// FeatureFlagStore defines the interface for feature flag data operations
+// Flags that have never been set are reported as disabled
+type FeatureFlagStore interface {
+	GetFlag(ctx context.Context, name string) (bool, error)
+	GetFlags(ctx context.Context) ([]FeatureFlag, error)
+	SetFlag(ctx context.Context, name string, enabled bool) error
+}
+
+// MetricsStore defines the interface for API usage analytics
+// Hits are counted per route template, method and day; AddHits adds each count to the stored count of its day
+type MetricsStore interface {
+	AddHits(ctx context.Context, hits []APIMetrics) error
+	GetTopRoutes(ctx context.Context, date string, limit int) ([]APIMetrics, error)
 }
 
 type ProductStore interface {
-	GetProducts() ([]Product, error)
-	CreateProduct(product *Product) error
-	GetProductsByIDs(ids []int) ([]Product, error)
+	GetProducts(ctx context.Context, filter ProductFilter) ([]Product, error)
+	GetProductByID(ctx context.Context, id int) (*Product, error)
+	GetProductByName(ctx context.Context, name string) (*Product, error)
+	GetProductBySKU(ctx context.Context, sku string) (*Product, error)
+	GetProductStock(ctx context.Context, id int) (int, error)
+	GetRelatedProducts(ctx context.Context, productID, limit int) ([]Product, error)
+	SearchProducts(ctx context.Context, query string, page, limit int) ([]Product, int, error)
+	GetProductSummaries(ctx context.Context, page, limit int) ([]ProductSummary, int, error)
+	GetFeaturedProducts(ctx context.Context, limit int) ([]Product, error)
+	SetFeatured(ctx context.Context, productID int, featured bool) error
+	CreateProduct(ctx context.Context, product *Product) error
+	CreateProducts(ctx context.Context, products []*Product) error
+	AdjustStockBatch(ctx context.Context, adjustments []StockAdjustment) error
+	GetProductsByIDs(ctx context.Context, ids []int) ([]Product, error)
+	UpdateProductPrice(ctx context.Context, id int, price Price) error
+}
+
+// ReviewStore defines the interface for product review data operations
+type ReviewStore interface {
+	CreateReview(ctx context.Context, review *Review) error
+	GetReviewsByProduct(ctx context.Context, productID int) ([]Review, error)
+	GetAverageRating(ctx context.Context, productID int) (float64, error)
+}
+
+// ImageStore defines the interface for a product's image gallery
+// Images are returned in their sort order and each product has at most one primary image
+type ImageStore interface {
+	AddImage(ctx context.Context, image *ProductImage) error
+	DeleteImage(ctx context.Context, productID, imageID int) error
+	ReorderImages(ctx context.Context, productID int, imageIDs []int) error
+	GetImagesByProduct(ctx context.Context, productID int) ([]ProductImage, error)
+}
+
+// PriceAlertStore defines the interface for users' price drop alerts
+// A user has at most one alert per product
+type PriceAlertStore interface {
+	CreateAlert(ctx context.Context, alert *PriceAlert) error
+	DeleteAlert(ctx context.Context, userID, productID int) error
+	GetAlertsForProduct(ctx context.Context, productID int, newPrice float64) ([]PriceAlert, error)
+	MarkAlertsNotified(ctx context.Context, ids []int) error
+}
+
+// WarehouseStore defines the interface for looking up stock held at warehouses
+type WarehouseStore interface {
+	GetProductsNearby(ctx context.Context, latitude, longitude, radiusKm float64) ([]NearbyProduct, error)
+}
+
+// VariantStore defines the interface for product variant data operations
+type VariantStore interface {
+	CreateVariant(ctx context.Context, variant *ProductVariant) error
+	GetVariantByID(ctx context.Context, id int) (*ProductVariant, error)
+	GetVariantsByProductID(ctx context.Context, productID int) ([]ProductVariant, error)
+	GetVariantsByIDs(ctx context.Context, ids []int) ([]ProductVariant, error)
+	UpdateVariant(ctx context.Context, variant *ProductVariant) error
+	DeleteVariant(ctx context.Context, id int) error
 }
 
 type OrderStore interface {
-	CreateOrder(order *Order) (int, error)
-	CreateOrderItem(orderItem *OrderItem) error
-	GetOrders(userID int) ([]Order, error)
+	CreateOrders(ctx context.Context, orders []*Order) error
+	CreateReservedOrder(ctx context.Context, order *Order, reservationID int) error
+	GetOrders(ctx context.Context, userID int) ([]Order, error)
+	GetOrdersByStatus(ctx context.Context, userID int, status string, page, limit int) ([]Order, int, error)
+	GetOrderByID(ctx context.Context, id int) (*Order, error)
+	GetOrderItems(ctx context.Context, orderIDs []int) (map[int][]OrderItem, error)
+	GetOrdersByProductID(ctx context.Context, productID, page, limit int) ([]Order, int, error)
+	UpdateOrderItem(ctx context.Context, orderID, productID int, variantID *int, newQuantity int) error
+	ExportOrders(ctx context.Context, userID int, from, to time.Time, fn func(OrderSummary) error) error
+	GetPurchasedProducts(ctx context.Context, userID int) ([]PurchasedProduct, error)
+}
+
+// ReservationStore defines the interface for stock reservation operations
+// Reservations hold product stock for a user until they check out or the reservation expires
+type ReservationStore interface {
+	CreateReservation(ctx context.Context, userID int, items []CartItem, ttl time.Duration) (*Reservation, error)
+	GetReservation(ctx context.Context, reservationID, userID int) (*Reservation, error)
+	ReleaseReservation(ctx context.Context, reservationID, userID int) error
+	ReleaseExpired(ctx context.Context) (int, error)
 }
 
+// PriceDecimals is the number of decimal places prices are rounded to when marshalled to JSON
+// It is set from config at startup
+var PriceDecimals = 2
+
+// Price is an amount of money stored as a float
+// It is rounded to PriceDecimals places in JSON so float drift such as 99.98999999 isn't shown to clients
+type Price float64
+
+// MarshalJSON writes the price as a JSON number rounded to PriceDecimals places
+func (p Price) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(p), 'f', PriceDecimals, 64), nil
+}
+
+// Currencies are the ISO 4217 codes prices may be in
+var Currencies = map[string]bool{
+	"AUD": true, "CAD": true, "CHF": true, "CNY": true, "EUR": true,
+	"GBP": true, "INR": true, "JPY": true, "NZD": true, "SEK": true, "USD": true,
+}
+
+// DefaultCurrency is the currency of products created without one
+// It is set from config at startup
+var DefaultCurrency = "USD"
+
+// OrderStatuses are the statuses an order can have
+var OrderStatuses = map[string]bool{"pending": true, "completed": true, "cancelled": true}
+
 type Order struct {
-	ID        int         `json:"id"`        // Unique identifier for the order
-	UserID    int         `json:"userID"`    // User ID associated with the order
-	Total     float64     `json:"total"`     // Total amount of the order
-	Status    string      `json:"status"`    // Status of the order
-	Address   string      `json:"address"`   // Address of the order
-	CreatedAt time.Time   `json:"createdAt"` // Timestamp when the order was created
-	Items     []OrderItem `json:"items"`     // List of items in the order
+	ID             int         `json:"id"`             // Unique identifier for the order
+	UserID         int         `json:"userID"`         // User ID associated with the order
+	Total          Price       `json:"total"`          // Total amount of the order
+	Currency       string      `json:"currency"`       // ISO 4217 currency of the order's amounts
+	Status         string      `json:"status"`         // Status of the order
+	Address        string      `json:"address"`        // Address of the order
+	Country        string      `json:"country"`        // ISO 3166-1 alpha-2 destination country, empty for orders placed before it was recorded
+	ShippingCost   Price       `json:"shippingCost"`   // Shipping cost included in the total
+	ShippingMethod string      `json:"shippingMethod"` // Name of the shipping method, empty for orders placed before it was recorded
+	TaxRate        float64     `json:"taxRate"`        // Tax rate applied to the item subtotal
+	TaxAmount      Price       `json:"taxAmount"`      // Tax charged, included in the total
+	CreatedAt      time.Time   `json:"createdAt"`      // Timestamp when the order was created
+	Items          []OrderItem `json:"items"`          // List of items in the order
+}
+
+// OrderSummary is a single line of an order export, without the order's items
+type OrderSummary struct {
+	ID        int       // Unique identifier for the order
+	CreatedAt time.Time // Timestamp when the order was created
+	Status    string    // Status of the order
+	Total     Price     // Total amount of the order
+	ItemCount int       // Number of units across the order's items
+}
+
+// PurchasedProduct is a product a user has ordered, listed once however often it was bought, for "buy again" lists
+// The name, image and price are the product's current ones, not those at the time of purchase
+type PurchasedProduct struct {
+	ProductID       int       `json:"productID"`       // Unique identifier for the product
+	Name            string    `json:"name"`            // Product name
+	Image           string    `json:"image"`           // Product image URL
+	Price           Price     `json:"price"`           // Current price of the product
+	Currency        string    `json:"currency"`        // ISO 4217 currency of the price
+	LastPurchasedAt time.Time `json:"lastPurchasedAt"` // Timestamp of the user's most recent order containing the product
 }
 
 type OrderItem struct {
-	ID        int       `json:"id"`        // Unique identifier for the order item
-	OrderID   int       `json:"orderID"`   // Order ID associated with the order item
-	ProductID int       `json:"productID"` // Product ID associated with the order item
-	Quantity  int       `json:"quantity"`  // Quantity of the product in the order item
-	Price     float64   `json:"price"`     // Price of the product in the order item
-	CreatedAt time.Time `json:"createdAt"` // Timestamp when the order item was created
-	Product   *Product  `json:"product"`   // Product details
+	ID           int       `json:"id"`                  // Unique identifier for the order item
+	OrderID      int       `json:"orderID"`             // Order ID associated with the order item
+	ProductID    int       `json:"productID"`           // Product ID associated with the order item
+	VariantID    *int      `json:"variantID,omitempty"` // Variant of the product ordered, nil for the product itself
+	ProductName  string    `json:"productName"`         // Product name at the time of purchase
+	ProductImage string    `json:"productImage"`        // Product image at the time of purchase
+	Quantity     int       `json:"quantity"`            // Quantity of the product in the order item
+	Price        Price     `json:"price"`               // Price of the product in the order item
+	CreatedAt    time.Time `json:"createdAt"`           // Timestamp when the order item was created
+	Product      *Product  `json:"product"`             // Current product details, nil if the product was deleted
+}
+
+// ProductFilter holds the optional filters for listing products
+// The zero value returns every product
+type ProductFilter struct {
+	InStock bool           // Only return products with quantity greater than 0
+	After   *ProductCursor // Only return products listed after this position, nil starts with the newest product
+	Limit   int            // Maximum number of products to return, 0 returns all of them
+}
+
+// ProductCursor is a position in the product listing, which is ordered newest first
+type ProductCursor struct {
+	CreatedAt time.Time // Creation time of the last product seen
+	ID        int       // ID of the last product seen, breaks ties between products created at the same time
 }
 
 type Product struct {
-	ID          int       `json:"id"`          // Unique identifier for the product
-	Name        string    `json:"name"`        // Product name
-	Description string    `json:"description"` // Product description
-	Image       string    `json:"image"`       // Product image
-	Price       float64   `json:"price"`       // Product price
-	Quantity    int       `json:"quantity"`    // Product quantity
-	CreatedAt   time.Time `json:"createdAt"`   // Timestamp when the product was created
+	ID            int            `json:"id"`               // Unique identifier for the product
+	Name          string         `json:"name"`             // Product name
+	SKU           string         `json:"sku"`              // Stock keeping unit, unique across products, empty if the product has none
+	Category      string         `json:"category"`         // Category the product is listed under, empty if it is uncategorized
+	IsFeatured    bool           `json:"isFeatured"`       // Whether marketing highlights the product in the featured listing
+	Description   string         `json:"description"`      // Product description
+	Image         string         `json:"image"`            // Product image
+	Price         Price          `json:"price"`            // Product price
+	Currency      string         `json:"currency"`         // ISO 4217 currency of the price
+	Quantity      int            `json:"quantity"`         // Product quantity
+	CreatedAt     time.Time      `json:"createdAt"`        // Timestamp when the product was created
+	AverageRating float64        `json:"averageRating"`    // Average review rating, 0 if the product has no reviews
+	ReviewCount   int            `json:"reviewCount"`      // Number of reviews of the product
+	Images        []ProductImage `json:"images,omitempty"` // Image gallery, only loaded for a single product
+}
+
+// ProductSummary is the ID and name of a product, for lightweight listings such as dropdowns
+type ProductSummary struct {
+	ID   int    `json:"id"`   // Unique identifier for the product
+	Name string `json:"name"` // Product name
+}
+
+// ProductStock is how many units of a product are left, for clients polling stock without the full product
+type ProductStock struct {
+	ProductID int  `json:"productID"` // Unique identifier for the product
+	Quantity  int  `json:"quantity"`  // Units in stock
+	InStock   bool `json:"inStock"`   // Whether at least one unit is in stock
+}
+
+// ProductImage is one image in a product's gallery
+type ProductImage struct {
+	ID        int    `json:"id"`        // Unique identifier for the image
+	ProductID int    `json:"productID"` // Product the image belongs to
+	URL       string `json:"url"`       // Location of the image
+	SortOrder int    `json:"sortOrder"` // Position of the image in the gallery, starting at 0
+	IsPrimary bool   `json:"isPrimary"` // Whether this is the image shown in listings
+}
+
+// CreateProductPayload is a new product with an optional image gallery given as URLs
+// Image stays the product's primary image and defaults to the first of Images when omitted
+type CreateProductPayload struct {
+	Product
+	Images []string `json:"images"` // Gallery image URLs in display order, shadows the embedded Product's gallery
+}
+
+// BatchCreateProductsPayload is a batch of products for admins to create at once
+type BatchCreateProductsPayload struct {
+	Products []CreateProductPayload `json:"products"`
+}
+
+// BatchCreateProductsResult reports the products created by a batch and the errors of those that weren't
+// Batches are all or nothing, so at most one of the two lists is non-empty
+type BatchCreateProductsResult struct {
+	Created []int      `json:"created"` // IDs of the created products, in batch order
+	Errors  []APIError `json:"errors"`  // Why products were rejected, each with the product's index
+}
+
+// StockAdjustment changes a product's stock by Delta units, as part of a batch
+type StockAdjustment struct {
+	ProductID int `json:"productID" validate:"required,min=1"` // Product whose stock is adjusted
+	Delta     int `json:"delta" validate:"required"`           // Units to add to the stock, or take out of it when negative
+	Quantity  int `json:"quantity"`                            // Units in stock after the adjustment, filled in once it is applied
+}
+
+// AddProductImagePayload represents the data required to add an image to a product's gallery
+type AddProductImagePayload struct {
+	URL       string `json:"url" validate:"required,url,max=2048"`
+	IsPrimary bool   `json:"isPrimary"`
+}
+
+// ReorderProductImagesPayload lists every image ID of a product in its new order
+type ReorderProductImagesPayload struct {
+	ImageIDs []int `json:"imageIDs" validate:"required,min=1,unique"`
+}
+
+// Warehouse is a location products are stocked at
+type Warehouse struct {
+	ID        int       `json:"id"`        // Unique identifier for the warehouse
+	Name      string    `json:"name"`      // Name of the warehouse
+	Latitude  float64   `json:"latitude"`  // Latitude in degrees
+	Longitude float64   `json:"longitude"` // Longitude in degrees
+	CreatedAt time.Time `json:"createdAt"` // Timestamp when the warehouse was added
+}
+
+// WarehouseProduct is the stock of one product held at one warehouse
+type WarehouseProduct struct {
+	WarehouseID int `json:"warehouseID"` // Warehouse holding the stock
+	ProductID   int `json:"productID"`   // Product being stocked
+	Quantity    int `json:"quantity"`    // Units in stock at the warehouse
+}
+
+// NearbyProduct is a product in stock at a warehouse within a search radius
+// Products stocked at several nearby warehouses are listed once, with the nearest warehouse
+type NearbyProduct struct {
+	Product
+	Warehouse  Warehouse `json:"warehouse"`  // Nearest warehouse with the product in stock
+	DistanceKm float64   `json:"distanceKm"` // Great-circle distance to the warehouse
+}
+
+// PriceAlert asks for an email when a product's price drops to TargetPrice or below
+type PriceAlert struct {
+	ID          int       `json:"id"`          // Unique identifier for the alert
+	UserID      int       `json:"userID"`      // User to notify
+	ProductID   int       `json:"productID"`   // Product being watched
+	TargetPrice Price     `json:"targetPrice"` // Price the product has to drop to
+	Notified    bool      `json:"notified"`    // Whether the user has been emailed, so they are only emailed once
+	CreatedAt   time.Time `json:"createdAt"`   // Timestamp when the alert was created
+}
+
+// CreatePriceAlertPayload represents the data required to watch a product's price
+type CreatePriceAlertPayload struct {
+	TargetPrice float64 `json:"targetPrice" validate:"required,gt=0"`
 }
 
+// UpdateProductPricePayload represents a product's new price
+type UpdateProductPricePayload struct {
+	Price float64 `json:"price" validate:"required,gt=0"`
+}
+
+// Roles a user can hold
+const (
+	RoleUser  = "user"  // Regular customer account
+	RoleAdmin = "admin" // Administrator with access to management endpoints
+)
+
 // User represents a user in the system
 // Contains all the user-related fields
 type User struct {
@@ -61,9 +389,130 @@ type User struct {
 	LastName  string    `json:"lastName"`  // User's last name
 	Email     string    `json:"email"`     // User's email address (unique)
 	Password  string    `json:"password"`  // Hashed password
+	Role      string    `json:"role"`      // User's role (user or admin)
+	IsActive  bool      `json:"isActive"`  // Whether the user may log in (false when banned by an admin)
+	IsGuest   bool      `json:"isGuest"`   // Whether the user was created by a guest checkout and has no password
+	AvatarURL string    `json:"avatarUrl"` // Path the user's profile picture is served from, empty if they have none
+	CreatedAt time.Time `json:"createdAt"` // Timestamp when the user was created
+
+	TermsAcceptedAt *time.Time `json:"termsAcceptedAt"` // When the user accepted the terms of service
+}
+
+// UserResponse represents the public view of a user
+// Used whenever users are returned to clients, so the password hash is never exposed
+type UserResponse struct {
+	ID        int       `json:"id"`        // Unique identifier for the user
+	FirstName string    `json:"firstName"` // User's first name
+	LastName  string    `json:"lastName"`  // User's last name
+	Email     string    `json:"email"`     // User's email address
+	Role      string    `json:"role"`      // User's role
+	IsActive  bool      `json:"isActive"`  // Whether the user may log in
+	AvatarURL string    `json:"avatarUrl"` // Path the user's profile picture is served from
 	CreatedAt time.Time `json:"createdAt"` // Timestamp when the user was created
 }
 
+// NewUserResponse converts a User into its public representation
+func NewUserResponse(user User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Role:      user.Role,
+		IsActive:  user.IsActive,
+		AvatarURL: user.AvatarURL,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// LoginEvent represents a single login attempt against a user account
+// Both successful and failed attempts are recorded for auditing
+type LoginEvent struct {
+	ID        int       `json:"id"`        // Unique identifier for the login event
+	UserID    int       `json:"userID"`    // User ID the attempt was made against
+	IPAddress string    `json:"ipAddress"` // Remote address of the client
+	UserAgent string    `json:"userAgent"` // User agent reported by the client
+	LoginAt   time.Time `json:"loginAt"`   // Timestamp of the attempt
+	Success   bool      `json:"success"`   // Whether the attempt succeeded
+}
+
+// APIKey is a long-lived credential that lets server-to-server clients act as a user
+type APIKey struct {
+	ID         int        `json:"id"`                   // Unique identifier for the key
+	UserID     int        `json:"userID"`               // User the key authenticates as
+	KeyHash    string     `json:"-"`                    // SHA-256 hash of the key, the key itself is never stored
+	Label      string     `json:"label"`                // Name given to the key by its owner
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"` // When the key last authenticated a request
+	CreatedAt  time.Time  `json:"createdAt"`            // Timestamp when the key was created
+}
+
+// FeatureFlag toggles a feature on or off without a redeployment
+type FeatureFlag struct {
+	Name      string    `json:"name"`      // Unique name of the flag, e.g. "reviews"
+	Enabled   bool      `json:"enabled"`   // Whether the feature is turned on
+	UpdatedAt time.Time `json:"updatedAt"` // Timestamp when the flag was last changed
+}
+
+// APIMetrics is how many times a route was requested on one day
+type APIMetrics struct {
+	Route    string `json:"route"`    // Route template, e.g. /api/v1/products/{id}
+	Method   string `json:"method"`   // HTTP method
+	Date     string `json:"date"`     // Day the hits were counted on, YYYY-MM-DD
+	HitCount int    `json:"hitCount"` // Number of requests that day
+}
+
+// SetFeatureFlagPayload represents the data required to turn a feature flag on or off
+type SetFeatureFlagPayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// SetMaintenancePayload represents the data required to turn maintenance mode on or off
+type SetMaintenancePayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// CreateAPIKeyPayload represents the data required to create an API key
+type CreateAPIKeyPayload struct {
+	Label string `json:"label" validate:"required,max=100"`
+}
+
+// Pagination describes the page of results returned by a paginated endpoint
+type Pagination struct {
+	Page       int `json:"page"`       // Current page number (1-based)
+	Limit      int `json:"limit"`      // Maximum number of items per page
+	Total      int `json:"total"`      // Total number of items across all pages
+	TotalPages int `json:"totalPages"` // Total number of pages
+}
+
+// Error codes returned in the Code field of an APIError
+const (
+	ErrCodeBadRequest      = "bad_request"
+	ErrCodeValidation      = "validation_failed"
+	ErrCodeUnauthorized    = "unauthorized"
+	ErrCodeForbidden       = "forbidden"
+	ErrCodeNotFound        = "not_found"
+	ErrCodeConflict        = "conflict"
+	ErrCodeTooManyRequests = "too_many_requests"
+	ErrCodeInternal        = "internal_error"
+
+	ErrCodeServiceUnavailable = "service_unavailable"
+)
+
+// APIError is the body of every error response
+// It implements error so handlers can pass it straight to utils.WriteError
+type APIError struct {
+	Code       string     `json:"code"`                 // Machine-readable error code, one of the ErrCode constants
+	Message    string     `json:"message"`              // Human-readable description of the error
+	Details    []string   `json:"details,omitempty"`    // Optional specifics, e.g. one entry per invalid field
+	Index      *int       `json:"index,omitempty"`      // Position of the failing entry of a batch request
+	Errors     []APIError `json:"errors,omitempty"`     // Errors of the individual entries of a batch request, each with its Index
+	ProductIDs []int      `json:"productIDs,omitempty"` // Products the error is about, e.g. those a reorder can't get
+}
+
+func (e APIError) Error() string {
+	return e.Message
+}
+
 // RegisterUserPayload represents the data required for user registration
 // Used to validate and process registration requests
 type RegisterUserPayload struct {
@@ -71,6 +520,8 @@ type RegisterUserPayload struct {
 	LastName  string `json:"lastName" validate:"required,min=2,max=30"`          // User's last name
 	Email     string `json:"email" validate:"required,email"`                    // User's email address
 	Password  string `json:"password" validate:"required,min=8,max=16,alphanum"` // User's password (will be hashed)
+
+	AcceptsTerms bool `json:"acceptsTerms"` // Whether the user accepts the terms of service (must be true)
 }
 
 // LoginUserPayload represents the data required for user login
@@ -80,12 +531,164 @@ type LoginUserPayload struct {
 	Password string `json:"password"` // User's password
 }
 
+// UpdateProfilePayload represents the data a user can change on their own profile
+type UpdateProfilePayload struct {
+	FirstName string `json:"firstName" validate:"required,min=2,max=30"` // User's first name
+	LastName  string `json:"lastName" validate:"required,min=2,max=30"`  // User's last name
+	Email     string `json:"email" validate:"required,email"`            // User's email address
+}
+
 type CartItem struct {
-	ProductID int `json:"productID"`
-	Quantity  int `json:"quantity"`
+	ProductID int  `json:"productID"`
+	VariantID *int `json:"variantID,omitempty"` // Optional variant of the product, e.g. a size or color
+	Quantity  int  `json:"quantity"`
 }
 
 type CartCheckoutPayload struct {
-	Items   []CartItem `json:"items" validate:"required,min=1"`
-	Address string     `json:"address" validate:"required"`
+	Items          []CartItem `json:"items" validate:"required_without=ReservationID,omitempty,min=1"`
+	Address        string     `json:"address" validate:"required_without=AddressID"`
+	AddressID      *int       `json:"addressID,omitempty"`                          // Optional saved address to ship to instead of Address
+	ReservationID  *int       `json:"reservationID,omitempty"`                      // Optional reservation to consume instead of Items
+	Country        string     `json:"country,omitempty" validate:"omitempty,len=2"` // ISO 3166-1 alpha-2 destination country
+	ShippingMethod string     `json:"shippingMethod,omitempty"`                     // Name of the shipping method, defaults to standard
+}
+
+// GuestCheckoutPayload is a checkout by a customer without an account
+// The contact details are optional, an email lets the guest's later checkouts share one guest account
+type GuestCheckoutPayload struct {
+	CartCheckoutPayload
+	Email     string `json:"email" validate:"omitempty,email"`
+	FirstName string `json:"firstName" validate:"omitempty,max=50"`
+	LastName  string `json:"lastName" validate:"omitempty,max=50"`
+}
+
+// CartSummary is the cost breakdown of a cart before it is checked out
+type CartSummary struct {
+	Items          []CartSummaryItem `json:"items"`          // Priced items of the cart
+	Subtotal       Price             `json:"subtotal"`       // Sum of the item totals
+	TaxRate        float64           `json:"taxRate"`        // Tax rate for the destination country
+	Tax            Price             `json:"tax"`            // Tax charged on the subtotal
+	ShippingMethod string            `json:"shippingMethod"` // Shipping method the estimate is for
+	ShippingCost   Price             `json:"shippingCost"`   // Estimated shipping cost
+	Total          Price             `json:"total"`          // Subtotal plus tax and shipping
+	Currency       string            `json:"currency"`       // ISO 4217 currency shared by every item
+}
+
+// CartSummaryItem is one priced item of a cart summary
+type CartSummaryItem struct {
+	ProductID int    `json:"productID"`
+	VariantID *int   `json:"variantID,omitempty"`
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	Quantity  int    `json:"quantity"`
+	Price     Price  `json:"price"` // Unit price, the variant's price for variants
+	Total     Price  `json:"total"` // Price times quantity
+}
+
+// UpdateOrderItemPayload represents the new quantity of a product in a pending order
+type UpdateOrderItemPayload struct {
+	ProductID int  `json:"productID" validate:"required"`
+	VariantID *int `json:"variantID,omitempty"` // Variant of the product ordered, nil for the product itself
+	Quantity  int  `json:"quantity" validate:"required,min=1"`
+}
+
+// Review is a user's rating of a product, each user can review a product once
+type Review struct {
+	ID        int       `json:"id"`        // Unique identifier for the review
+	UserID    int       `json:"userID"`    // User who wrote the review
+	ProductID int       `json:"productID"` // Product the review is about
+	Rating    int       `json:"rating"`    // Rating from 1 to 5
+	Comment   string    `json:"comment"`   // Optional review text
+	CreatedAt time.Time `json:"createdAt"` // Timestamp when the review was created
+}
+
+// CreateReviewPayload represents the data required to review a product
+type CreateReviewPayload struct {
+	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
+	Comment string `json:"comment" validate:"max=1000"`
+}
+
+// ProductVariant is a purchasable variation of a product, such as a size or color
+// Its price and quantity take the place of the product's own when it is ordered
+type ProductVariant struct {
+	ID         int               `json:"id"`         // Unique identifier for the variant
+	ProductID  int               `json:"productID"`  // Product the variant belongs to
+	SKU        string            `json:"sku"`        // Stock keeping unit, unique across variants
+	Attributes map[string]string `json:"attributes"` // Variant attributes, e.g. {"size": "M", "color": "red"}
+	Price      Price             `json:"price"`      // Variant price
+	Quantity   int               `json:"quantity"`   // Variant quantity in stock
+	CreatedAt  time.Time         `json:"createdAt"`  // Timestamp when the variant was created
+}
+
+// Address is the destination an order is shipped to
+type Address struct {
+	Line    string `json:"line"`    // Free-form street address
+	Country string `json:"country"` // ISO 3166-1 alpha-2 country code
+}
+
+// SavedAddress is an address in a user's address book that checkout can reference by ID
+type SavedAddress struct {
+	ID        int       `json:"id"`        // Unique identifier for the address
+	UserID    int       `json:"userID"`    // User the address belongs to
+	Line      string    `json:"line"`      // Free-form street address
+	Country   string    `json:"country"`   // ISO 3166-1 alpha-2 country code
+	CreatedAt time.Time `json:"createdAt"` // Timestamp when the address was saved
+}
+
+// NotificationPrefs are the notifications a user opted in to
+// Users who never saved preferences get DefaultNotificationPrefs
+type NotificationPrefs struct {
+	UserID       int        `json:"userID"`       // User the preferences belong to
+	OrderUpdates bool       `json:"orderUpdates"` // Emails and pushes about the user's orders
+	PriceAlerts  bool       `json:"priceAlerts"`  // Emails when a product drops to a price alert's target
+	Newsletter   bool       `json:"newsletter"`   // Marketing newsletter
+	UpdatedAt    *time.Time `json:"updatedAt"`    // Timestamp when the preferences were last saved, null until they are
+}
+
+// DefaultNotificationPrefs returns the preferences of a user who hasn't saved any
+// Transactional notifications are on and marketing is off until the user opts in
+func DefaultNotificationPrefs(userID int) *NotificationPrefs {
+	return &NotificationPrefs{UserID: userID, OrderUpdates: true, PriceAlerts: true}
+}
+
+// UpdateNotificationPrefsPayload represents the data required to replace a user's notification preferences
+type UpdateNotificationPrefsPayload struct {
+	OrderUpdates *bool `json:"orderUpdates" validate:"required"`
+	PriceAlerts  *bool `json:"priceAlerts" validate:"required"`
+	Newsletter   *bool `json:"newsletter" validate:"required"`
+}
+
+// CreateAddressPayload represents the data required to save an address
+type CreateAddressPayload struct {
+	Line    string `json:"line" validate:"required,max=500"`
+	Country string `json:"country" validate:"omitempty,len=2"`
+}
+
+// ShippingMethod is a delivery option available for an address
+type ShippingMethod struct {
+	Name          string `json:"name"`          // Name of the method, e.g. standard or express
+	EstimatedDays int    `json:"estimatedDays"` // Estimated delivery time in days
+	Price         Price  `json:"price"`         // Shipping cost for the order
+}
+
+// Reservation represents stock held for a user until checkout or expiry
+type Reservation struct {
+	ID        int               `json:"id"`        // Unique identifier for the reservation
+	UserID    int               `json:"userID"`    // User ID holding the reservation
+	Status    string            `json:"status"`    // active, consumed or released
+	ExpiresAt time.Time         `json:"expiresAt"` // When the held stock is returned
+	CreatedAt time.Time         `json:"createdAt"` // Timestamp when the reservation was created
+	Items     []ReservationItem `json:"items"`     // Products and quantities held
+}
+
+// ReservationItem represents the quantity of a single product held by a reservation
+type ReservationItem struct {
+	ProductID int  `json:"productID"`           // Product ID being held
+	VariantID *int `json:"variantID,omitempty"` // Variant of the product being held, nil for the product itself
+	Quantity  int  `json:"quantity"`            // Quantity being held
+}
+
+// ReservationPayload represents the data required to reserve stock
+type ReservationPayload struct {
+	Items []CartItem `json:"items" validate:"required,min=1"`
 }
@@ -0,0 +1,44 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPriceMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		price    Price
+		expected string
+	}{
+		{name: "exact price", price: 99.99, expected: "99.99"},
+		{name: "drifted price", price: 99.98999999, expected: "99.99"},
+		{name: "sum with float error", price: 0.1 + 0.2, expected: "0.30"},
+		{name: "whole price", price: 10, expected: "10.00"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			marshaled, err := json.Marshal(tc.price)
+			if err != nil {
+				t.Fatalf("Failed to marshal price: %v", err)
+			}
+			if string(marshaled) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, marshaled)
+			}
+		})
+	}
+
+	// prices nested in responses are rounded too, and still decode as numbers
+	marshaled, err := json.Marshal(Product{Price: 99.98999999})
+	if err != nil {
+		t.Fatalf("Failed to marshal product: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(marshaled, &decoded); err != nil {
+		t.Fatalf("Failed to decode product: %v", err)
+	}
+	if decoded["price"] != 99.99 {
+		t.Errorf("Expected price 99.99, got %v", decoded["price"])
+	}
+}
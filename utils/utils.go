@@ -2,45 +2,354 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/db"
 	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
 	"github.com/go-playground/validator/v10"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var Validate = validator.New()
 
+// APIPrefix is the path prefix all versioned API routes are mounted under
+const APIPrefix = "/api/v1"
+
+// MsgpackContentType is the media type of MessagePack request and response bodies
+const MsgpackContentType = "application/msgpack"
+
+func init() {
+	// Prices are rounded to PriceDecimals places in MessagePack as they are in JSON
+	msgpack.Register(types.Price(0), func(enc *msgpack.Encoder, v reflect.Value) error {
+		rounded, err := strconv.ParseFloat(strconv.FormatFloat(v.Float(), 'f', types.PriceDecimals, 64), 64)
+		if err != nil {
+			return err
+		}
+		return enc.EncodeFloat64(rounded)
+	}, nil)
+}
+
 // ParseJSON parses the JSON body of an HTTP request into the provided payload
+// Bodies sent with Content-Type: application/msgpack are decoded as MessagePack instead, using the same field names
 // Returns an error if the body is nil or if JSON parsing fails
+// Decode errors are reworded so clients see which field was wrong rather than Go type names
 func ParseJSON(r *http.Request, payload any) error {
 	if r.Body == nil {
 		return fmt.Errorf("request body is nil")
 	}
 
-	return json.NewDecoder(r.Body).Decode(payload)
+	if isMsgpack(r.Header.Get("Content-Type")) {
+		return parseMsgpack(r.Body, payload)
+	}
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		return jsonDecodeError(err)
+	}
+	return nil
+}
+
+// isMsgpack reports whether contentType is the MessagePack media type, ignoring any parameters
+func isMsgpack(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == MsgpackContentType
+}
+
+// parseMsgpack decodes a MessagePack body into payload, reading field names from the json struct tags
+// MessagePack decode errors name Go types and codes, so apart from an empty or oversized body they are all reported alike
+func parseMsgpack(body io.Reader, payload any) error {
+	decoder := msgpack.NewDecoder(body)
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(payload); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, io.EOF):
+			return fmt.Errorf("request body is empty")
+		case errors.As(err, &maxBytesErr):
+			return fmt.Errorf("request body must not exceed %d bytes", maxBytesErr.Limit)
+		}
+		return fmt.Errorf("request body is not valid MessagePack")
+	}
+	return nil
+}
+
+// jsonDecodeError turns an error from decoding a request body into a message that is safe to show clients
+func jsonDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntaxErr):
+		return fmt.Errorf("request body is not valid JSON")
+	case errors.As(err, &maxBytesErr):
+		return fmt.Errorf("request body must not exceed %d bytes", maxBytesErr.Limit)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fmt.Errorf("request body must be %s", jsonKind(typeErr.Type))
+		}
+		return fmt.Errorf("field '%s' must be %s", typeErr.Field, jsonKind(typeErr.Type))
+	}
+	return err
+}
+
+// jsonKind describes the JSON value expected for a Go type, e.g. "a number" for an int
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
 }
 
 // WriteJSON writes a JSON response to the HTTP response writer
-// Sets the content type to application/json and the provided status code
+// Sets the content type to application/json, the content length and the provided status code
+// When NegotiateContent found the client prefers MessagePack, the response is encoded as application/msgpack instead
 // Returns any potential error during JSON encoding
 func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	if wantsMsgpack(w) {
+		return writeMsgpack(w, status, v)
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
+
+// writeMsgpack writes v as a MessagePack response, with the field names it would have in JSON
+func writeMsgpack(w http.ResponseWriter, status int, v any) error {
+	var body bytes.Buffer
+	encoder := msgpack.NewEncoder(&body)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", MsgpackContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
 	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(v)
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// NegotiateContent makes WriteJSON answer in MessagePack when the Accept header prefers application/msgpack over JSON
+// Responses vary on Accept so caches keep the two encodings apart
+func NegotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if prefersMsgpack(r.Header.Get("Accept")) {
+			w = &msgpackResponseWriter{w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prefersMsgpack reports whether an Accept header ranks application/msgpack above application/json
+// JSON stays the default, so wildcards and equal ranks are answered in JSON
+func prefersMsgpack(accept string) bool {
+	var msgpackQ, jsonQ float64
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case MsgpackContentType:
+			msgpackQ = max(msgpackQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return msgpackQ > jsonQ
+}
+
+// msgpackResponseWriter marks a response the client asked to receive as MessagePack
+type msgpackResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Unwrap returns the wrapped response writer, as http.ResponseController expects
+func (w *msgpackResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to the handler, as WebSocket upgrades need
+func (w *msgpackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// wantsMsgpack reports whether w, or a response writer it wraps, is a msgpackResponseWriter
+func wantsMsgpack(w http.ResponseWriter) bool {
+	for {
+		switch inner := w.(type) {
+		case *msgpackResponseWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = inner.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// AllowHead lets a GET handler answer HEAD requests as well
+// The handler runs as usual so the status and headers, including Content-Length, match the GET response,
+// but nothing it writes to the body is sent
+func AllowHead(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w = headResponseWriter{w}
+		}
+		next(w, r)
+	}
+}
+
+// headResponseWriter discards the body of a response to a HEAD request
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// Unwrap returns the wrapped response writer, as http.ResponseController expects
+func (w headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // WriteError writes an error response to the HTTP response writer
-// Formats the error message into a JSON response with the provided status code
+// The body is {"error": APIError}; pass a types.APIError to choose the code and details,
+// any other error becomes an APIError with the code matching the status
+// When the request is traced, the trace ID is included so errors can be matched to their trace
+// Errors wrapping ErrServiceUnavailable are always sent as 503 Service Unavailable with their own code
 // Returns any potential error during JSON encoding
 func WriteError(w http.ResponseWriter, status int, err error) error {
-	return WriteJSON(w, status, map[string]string{"error": err.Error()})
+	var apiErr types.APIError
+	if errors.Is(err, ErrServiceUnavailable) {
+		status = http.StatusServiceUnavailable
+		apiErr = types.APIError{Code: types.ErrCodeServiceUnavailable, Message: err.Error()}
+	} else if !errors.As(err, &apiErr) {
+		apiErr = types.APIError{Code: ErrorCodeForStatus(status), Message: err.Error()}
+	}
+
+	response := map[string]interface{}{"error": apiErr}
+	if traceID := w.Header().Get(tracing.TraceIDHeader); traceID != "" {
+		response["trace_id"] = traceID
+	}
+	return WriteJSON(w, status, response)
 }
 
-// authenticateRequest is a helper function to authenticate requests
+// ErrorCodeForStatus returns the default APIError code for an HTTP status
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return types.ErrCodeBadRequest
+	case http.StatusUnauthorized:
+		return types.ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return types.ErrCodeForbidden
+	case http.StatusNotFound:
+		return types.ErrCodeNotFound
+	case http.StatusConflict:
+		return types.ErrCodeConflict
+	case http.StatusTooManyRequests:
+		return types.ErrCodeTooManyRequests
+	default:
+		if status >= 400 && status < 500 {
+			return types.ErrCodeBadRequest
+		}
+		return types.ErrCodeInternal
+	}
+}
+
+// ValidationError converts a validator error into an APIError listing each invalid field
+// Errors that aren't validation errors are returned as a plain bad request
+func ValidationError(err error) types.APIError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return types.APIError{Code: types.ErrCodeBadRequest, Message: err.Error()}
+	}
+
+	details := make([]string, len(validationErrs))
+	for i, fieldErr := range validationErrs {
+		details[i] = fmt.Sprintf("%s failed the %q check", fieldErr.Field(), fieldErr.Tag())
+	}
+	return types.APIError{Code: types.ErrCodeValidation, Message: "invalid payload", Details: details}
+}
+
+// SanitizeString escapes HTML special characters so user-provided text is safe to render in a browser
+// Apply it to free-text fields before they are stored
+func SanitizeString(s string) string {
+	return html.EscapeString(s)
+}
+
+// apiKeys looks up API keys during authentication, API keys are rejected while it is nil
+var apiKeys types.APIKeyStore
+
+// SetAPIKeyStore enables API key authentication, looking keys up in the given store
+func SetAPIKeyStore(store types.APIKeyStore) {
+	apiKeys = store
+}
+
+// AuthenticateRequest returns the ID of the user a request is made by
+// Accepts either "Authorization: Bearer <jwt>" or "Authorization: ApiKey <key>"
 func AuthenticateRequest(r *http.Request) (int, error) {
 	// Get the Authorization header
 	authHeader := r.Header.Get("Authorization")
@@ -48,18 +357,532 @@ func AuthenticateRequest(r *http.Request) (int, error) {
 		return 0, fmt.Errorf("authorization header is required")
 	}
 
-	// Check if it's a Bearer token
 	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
+	if len(parts) != 2 {
 		return 0, fmt.Errorf("invalid authorization header format")
 	}
 
-	// Verify the token
-	secret := []byte(config.Envs.JWTSecret)
-	userId, err := auth.VerifyJWT(parts[1], secret)
+	switch parts[0] {
+	case "Bearer":
+		// Verify the token
+		secret := []byte(config.Envs.JWTSecret)
+		userId, err := auth.VerifyJWT(parts[1], secret)
+		if err != nil {
+			return 0, fmt.Errorf("invalid token: %w", err)
+		}
+		return userId, nil
+	case "ApiKey":
+		return authenticateAPIKey(r.Context(), parts[1])
+	default:
+		return 0, fmt.Errorf("invalid authorization header format")
+	}
+}
+
+// authenticateAPIKey returns the owner of an API key and records that the key was used
+func authenticateAPIKey(ctx context.Context, key string) (int, error) {
+	if apiKeys == nil {
+		return 0, fmt.Errorf("api key authentication is not enabled")
+	}
+
+	apiKey, err := apiKeys.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("invalid api key")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error looking up api key: %w", err)
+	}
+
+	// Failing to record usage shouldn't fail the request
+	if err := apiKeys.MarkAPIKeyUsed(ctx, apiKey.ID); err != nil {
+		log.Printf("Error recording use of api key %d: %v", apiKey.ID, err)
+	}
+	return apiKey.UserID, nil
+}
+
+// FlagCacheTTL is how long a feature flag value is served from memory before it is read again
+const FlagCacheTTL = 30 * time.Second
+
+// flags is where feature flags are read from, every flag is disabled while it is nil
+var flags types.FeatureFlagStore
+
+// flagCache holds recently read flag values so checking a flag doesn't cost a query per request
+// generation changes whenever cached values are dropped, so a lookup that started before then isn't cached
+var flagCache = struct {
+	sync.Mutex
+	entries    map[string]cachedFlag
+	generation uint64
+}{entries: make(map[string]cachedFlag)}
+
+type cachedFlag struct {
+	enabled   bool
+	expiresAt time.Time
+}
+
+// SetFeatureFlagStore sets the store feature flags are read from and clears the cache
+func SetFeatureFlagStore(store types.FeatureFlagStore) {
+	flagCache.Lock()
+	defer flagCache.Unlock()
+	flags = store
+	flagCache.entries = make(map[string]cachedFlag)
+	flagCache.generation++
+}
+
+// GetFlag reports whether the named feature is enabled, caching the answer for FlagCacheTTL
+// The cache isn't locked during the store lookup, so a slow query only holds up the requests reading that flag
+// Unknown flags, lookup errors and cancelled contexts all count as disabled
+func GetFlag(ctx context.Context, name string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	flagCache.Lock()
+	store, generation := flags, flagCache.generation
+	entry, ok := flagCache.entries[name]
+	flagCache.Unlock()
+	if store == nil {
+		return false
+	}
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.enabled
+	}
+
+	enabled, err := store.GetFlag(ctx, name)
+	if err != nil {
+		log.Printf("Error reading feature flag %q: %v", name, err)
+		return false
+	}
+
+	// a value invalidated while it was being read may already be stale, so it is returned but not cached
+	flagCache.Lock()
+	defer flagCache.Unlock()
+	if flagCache.generation == generation {
+		flagCache.entries[name] = cachedFlag{enabled: enabled, expiresAt: time.Now().Add(FlagCacheTTL)}
+	}
+	return enabled
+}
+
+// InvalidateFlag drops the cached value of a flag so the next GetFlag reads it from the store
+func InvalidateFlag(name string) {
+	flagCache.Lock()
+	defer flagCache.Unlock()
+	delete(flagCache.entries, name)
+	flagCache.generation++
+}
+
+// MaintenancePath is the route admins toggle maintenance mode with
+// It stays reachable during maintenance so maintenance can be turned off again
+const MaintenancePath = "/admin/maintenance"
+
+// maintenance is whether the API is in maintenance mode
+// It is atomic as every request reads it while admins may flip it at any time
+var maintenance atomic.Bool
+
+// SetMaintenance turns maintenance mode on or off, taking effect from the next request
+func SetMaintenance(enabled bool) {
+	maintenance.Store(enabled)
+}
+
+// MaintenanceEnabled reports whether the API is in maintenance mode
+func MaintenanceEnabled() bool {
+	return maintenance.Load()
+}
+
+// MaintenanceMiddleware responds 503 Service Unavailable to every request while maintenance mode is on,
+// except for the route at MaintenancePath
+func MaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if MaintenanceEnabled() && !isMaintenanceRoute(r) {
+			WriteError(w, http.StatusServiceUnavailable, types.APIError{Code: types.ErrCodeServiceUnavailable, Message: "the API is down for maintenance, please try again later"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isMaintenanceRoute reports whether the request was matched to the route at MaintenancePath, with or without APIPrefix
+func isMaintenanceRoute(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	return err == nil && strings.TrimPrefix(template, APIPrefix) == MaintenancePath
+}
+
+// RequireRole returns a middleware that only lets through authenticated users holding the given role
+// Responds with 401 when the request is not authenticated or its user no longer exists, 403 when the user lacks the role
+// and 500 when the user can't be loaded
+func RequireRole(users types.UserStore, role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userId, err := AuthenticateRequest(r)
+			if err != nil {
+				WriteError(w, http.StatusUnauthorized, err)
+				return
+			}
+
+			user, err := users.GetUserByID(r.Context(), userId)
+			if errors.Is(err, sql.ErrNoRows) || (err == nil && user == nil) {
+				WriteError(w, http.StatusUnauthorized, fmt.Errorf("user not found"))
+				return
+			}
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !user.IsActive || user.Role != role {
+				WriteError(w, http.StatusForbidden, fmt.Errorf("insufficient permissions"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeHit is what MetricsMiddleware counts requests by
+type routeHit struct {
+	route, method, date string
+}
+
+// MetricsMiddleware returns a middleware counting every request handled by the router it is attached to in store,
+// labelled with the route template, e.g. /api/v1/products/{id}, so IDs don't create new rows
+// Hits are counted in memory and the counts written to store in one batch every interval, so requests never
+// wait on the database and no hit is dropped under load; counts that fail to be written are kept for the next batch
+// The returned function stops the writer once the remaining counts are written, the middleware must not be used after it
+func MetricsMiddleware(store types.MetricsStore, interval time.Duration) (func(http.Handler) http.Handler, func()) {
+	var mu sync.Mutex
+	counts := make(map[routeHit]int)
+
+	flush := func() {
+		mu.Lock()
+		pending := counts
+		counts = make(map[routeHit]int)
+		mu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+
+		hits := make([]types.APIMetrics, 0, len(pending))
+		for hit, count := range pending {
+			hits = append(hits, types.APIMetrics{Route: hit.route, Method: hit.method, Date: hit.date, HitCount: count})
+		}
+		// every batch writes its rows in the same order, so API instances flushing at once don't deadlock
+		sort.Slice(hits, func(i, j int) bool {
+			a, b := hits[i], hits[j]
+			if a.Date != b.Date {
+				return a.Date < b.Date
+			}
+			if a.Route != b.Route {
+				return a.Route < b.Route
+			}
+			return a.Method < b.Method
+		})
+		if err := store.AddHits(context.Background(), hits); err != nil {
+			log.Printf("Failed to record %d route hit counts, retrying with the next batch: %v", len(hits), err)
+			mu.Lock()
+			for hit, count := range pending {
+				counts[hit] += count
+			}
+			mu.Unlock()
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-stop:
+				flush()
+				return
+			}
+		}
+	}()
+
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			// the day is taken from the server's clock so it matches the default of GetTopRoutes
+			hit := routeHit{route: route, method: r.Method, date: time.Now().Format(time.DateOnly)}
+			mu.Lock()
+			counts[hit]++
+			mu.Unlock()
+		})
+	}
+	return middleware, func() {
+		close(stop)
+		<-done
+	}
+}
+
+// Typed query parameter getters
+// Each returns defaultVal when the parameter is missing or empty, and an error naming the parameter when it can't be parsed
+// Handlers wrap range checks around them and write any error as a 400
+
+// GetIntParam reads the query parameter key as an integer
+func GetIntParam(r *http.Request, key string, defaultVal int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultVal, nil
+	}
+	n, err := strconv.Atoi(value)
 	if err != nil {
-		return 0, fmt.Errorf("invalid token: %w", err)
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+	return n, nil
+}
+
+// GetStringParam reads the query parameter key with surrounding whitespace removed
+func GetStringParam(r *http.Request, key string, defaultVal string) string {
+	value := strings.TrimSpace(r.URL.Query().Get(key))
+	if value == "" {
+		return defaultVal
 	}
+	return value
+}
 
-	return userId, nil
+// GetFloatParam reads the query parameter key as a finite number
+func GetFloatParam(r *http.Request, key string, defaultVal float64) (float64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultVal, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return f, nil
+}
+
+// ClientIP returns the IP address of the client that made the request
+// With TRUST_PROXY set and the connection coming from one of TRUSTED_PROXIES, X-Forwarded-For is read
+// from the right, skipping the hops added by trusted proxies, and the first other address is the client.
+// Entries further left were sent by the client and could be spoofed, so they are only reached through
+// trusted hops. X-Real-IP is used when there is no X-Forwarded-For. Otherwise both headers are ignored
+// and the address of the connection is used
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !config.Envs.TrustProxy || !trustedProxy(net.ParseIP(remote)) {
+		return remote
+	}
+
+	// the header may be sent several times, each proxy appending to the last one
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			continue
+		}
+		client = ip.String()
+		if !trustedProxy(ip) {
+			return client
+		}
+	}
+	if len(hops) > 0 {
+		return client
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+// trustedProxy reports whether ip belongs to one of the configured TRUSTED_PROXIES
+func trustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range config.Envs.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Default and maximum page sizes for paginated endpoints
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 50
+)
+
+// ParsePagination reads the page and limit query parameters from the request
+// Missing values fall back to page 1 and DefaultPageLimit
+// Returns an error if either value is not a positive integer or limit exceeds MaxPageLimit
+func ParsePagination(r *http.Request) (int, int, error) {
+	page, err := GetIntParam(r, "page", 1)
+	if err != nil || page < 1 {
+		return 0, 0, fmt.Errorf("page must be a positive integer")
+	}
+
+	limit, err := GetIntParam(r, "limit", DefaultPageLimit)
+	if err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("limit must be a positive integer")
+	}
+	if limit > MaxPageLimit {
+		return 0, 0, fmt.Errorf("limit must not exceed %d", MaxPageLimit)
+	}
+
+	return page, limit, nil
+}
+
+// NewPagination builds the pagination metadata for a page of results
+func NewPagination(page, limit, total int) types.Pagination {
+	totalPages := 0
+	if limit > 0 {
+		totalPages = (total + limit - 1) / limit
+	}
+	return types.Pagination{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+}
+
+// Stores retry statements that fail with a transient error this many times, waiting TransientRetryBackoff between attempts
+const (
+	TransientRetryAttempts = 3
+	TransientRetryBackoff  = 100 * time.Millisecond
+)
+
+// RetryOnTransient calls fn until it succeeds, returns an error that isn't transient, or has been called maxAttempts times
+// It waits backoff between attempts and returns the last error
+// fn must run a whole transaction that is rolled back when it fails, see db.IsTransient
+func RetryOnTransient(fn func() error, maxAttempts int, backoff time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = fn(); err == nil || !db.IsTransient(err) {
+			return err
+		}
+		if attempt < maxAttempts {
+			log.Printf("Transient database error on attempt %d/%d, retrying in %s: %v", attempt, maxAttempts, backoff, err)
+			time.Sleep(backoff)
+		}
+	}
+	return err
+}
+
+// ErrServiceUnavailable is returned instead of calling the database while its circuit breaker is open
+var ErrServiceUnavailable = errors.New("service temporarily unavailable")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Calls go through, failures are counted
+	CircuitOpen                         // Calls fail straight away with ErrServiceUnavailable
+	CircuitHalfOpen                     // A single trial call goes through to test whether the database has recovered
+)
+
+// CircuitBreaker stops calling the database after failureThreshold consecutive failures
+// so requests fail fast instead of each waiting for a timeout
+// After recoveryTimeout it lets one trial call through, which closes the circuit again if it succeeds
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	state            CircuitState
+	failures         int // Consecutive failures while closed
+	failureThreshold int
+	recoveryTimeout  time.Duration
+	openedAt         time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, recoveryTimeout time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{failureThreshold: failureThreshold, recoveryTimeout: recoveryTimeout}
+}
+
+// NewDBCircuitBreaker creates the circuit breaker guarding the database connection shared by the API
+// It reads DB_CIRCUIT_FAILURE_THRESHOLD and DB_CIRCUIT_RECOVERY_TIMEOUT from config.Envs, so it must be called after config.InitConfig
+func NewDBCircuitBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(
+		int(config.Envs.DBCircuitFailureThreshold),
+		time.Second*time.Duration(config.Envs.DBCircuitRecoveryTimeout),
+	)
+}
+
+// State returns the current state of the circuit
+// An open circuit whose recovery timeout has passed is reported as half-open
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.recoveryTimeout {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Execute calls fn unless the circuit is open, in which case it returns ErrServiceUnavailable
+// Errors showing the database answered, such as sql.ErrNoRows or a MySQL error, don't count as failures
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if !cb.allow() {
+		return ErrServiceUnavailable
+	}
+	err := fn()
+	cb.record(err == nil || errors.Is(err, sql.ErrNoRows) || errors.As(err, new(*mysql.MySQLError)))
+	return err
+}
+
+// allow reports whether a call may go through, moving an open circuit to half-open once it has recovered
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.recoveryTimeout {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		return true
+	case CircuitHalfOpen:
+		return false // the trial call is still running
+	default:
+		return true
+	}
+}
+
+// record updates the circuit with the outcome of a call
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if success {
+		cb.state = CircuitClosed
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.failureThreshold {
+		if cb.state != CircuitOpen {
+			log.Printf("Database circuit breaker opened after %d consecutive failures", cb.failures)
+		}
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
 }
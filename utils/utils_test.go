@@ -0,0 +1,920 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Asif-Faizal/Gommerce/config"
+	"github.com/Asif-Faizal/Gommerce/services/auth"
+	"github.com/Asif-Faizal/Gommerce/tracing"
+	"github.com/Asif-Faizal/Gommerce/types"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestWriteError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        int
+		err           error
+		traceID       string
+		expected      types.APIError
+		writtenStatus int // Status sent to the client, the status passed in when 0
+	}{
+		{
+			name:     "plain error gets the code for its status",
+			status:   http.StatusNotFound,
+			err:      fmt.Errorf("product with ID 1 not found"),
+			expected: types.APIError{Code: types.ErrCodeNotFound, Message: "product with ID 1 not found"},
+		},
+		{
+			name:     "unknown server error",
+			status:   http.StatusServiceUnavailable,
+			err:      fmt.Errorf("database unavailable"),
+			expected: types.APIError{Code: types.ErrCodeInternal, Message: "database unavailable"},
+		},
+		{
+			name:     "APIError is written as is",
+			status:   http.StatusBadRequest,
+			err:      types.APIError{Code: types.ErrCodeValidation, Message: "invalid payload", Details: []string{"Address failed the \"required\" check"}},
+			expected: types.APIError{Code: types.ErrCodeValidation, Message: "invalid payload", Details: []string{"Address failed the \"required\" check"}},
+		},
+		{
+			name:     "wrapped APIError",
+			status:   http.StatusConflict,
+			err:      fmt.Errorf("creating order: %w", types.APIError{Code: types.ErrCodeConflict, Message: "out of stock"}),
+			expected: types.APIError{Code: types.ErrCodeConflict, Message: "out of stock"},
+		},
+		{
+			name:          "open circuit is always unavailable",
+			status:        http.StatusInternalServerError,
+			err:           fmt.Errorf("error checking user: %w", ErrServiceUnavailable),
+			expected:      types.APIError{Code: types.ErrCodeServiceUnavailable, Message: "error checking user: service temporarily unavailable"},
+			writtenStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:     "trace ID is included",
+			status:   http.StatusUnauthorized,
+			err:      fmt.Errorf("missing token"),
+			traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			expected: types.APIError{Code: types.ErrCodeUnauthorized, Message: "missing token"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			if tc.traceID != "" {
+				rr.Header().Set(tracing.TraceIDHeader, tc.traceID)
+			}
+			if err := WriteError(rr, tc.status, tc.err); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expectedStatus := tc.status
+			if tc.writtenStatus != 0 {
+				expectedStatus = tc.writtenStatus
+			}
+			if rr.Code != expectedStatus {
+				t.Errorf("Expected status %d, got %d", expectedStatus, rr.Code)
+			}
+			var response struct {
+				Error   types.APIError `json:"error"`
+				TraceID string         `json:"trace_id"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(response.Error, tc.expected) {
+				t.Errorf("Expected error %+v, got %+v", tc.expected, response.Error)
+			}
+			if response.TraceID != tc.traceID {
+				t.Errorf("Expected trace ID %q, got %q", tc.traceID, response.TraceID)
+			}
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := Validate.Struct(types.CartCheckoutPayload{})
+	apiErr := ValidationError(err)
+
+	if apiErr.Code != types.ErrCodeValidation {
+		t.Errorf("Expected code %q, got %q", types.ErrCodeValidation, apiErr.Code)
+	}
+	expected := []string{`Items failed the "required_without" check`, `Address failed the "required_without" check`}
+	if !reflect.DeepEqual(apiErr.Details, expected) {
+		t.Errorf("Expected details %v, got %v", expected, apiErr.Details)
+	}
+}
+
+// countingFlagStore counts lookups so tests can tell cached reads from store reads
+type countingFlagStore struct {
+	enabled bool
+	lookups int
+}
+
+func (s *countingFlagStore) GetFlag(ctx context.Context, name string) (bool, error) {
+	s.lookups++
+	return s.enabled, nil
+}
+
+func (s *countingFlagStore) GetFlags(ctx context.Context) ([]types.FeatureFlag, error) {
+	return nil, nil
+}
+
+func (s *countingFlagStore) SetFlag(ctx context.Context, name string, enabled bool) error {
+	s.enabled = enabled
+	return nil
+}
+
+func TestGetFlag(t *testing.T) {
+	store := &countingFlagStore{enabled: true}
+	SetFeatureFlagStore(store)
+	defer SetFeatureFlagStore(nil)
+
+	if !GetFlag(context.Background(), "reviews") || !GetFlag(context.Background(), "reviews") {
+		t.Fatal("Expected the reviews flag to be enabled")
+	}
+	if store.lookups != 1 {
+		t.Errorf("Expected the second read to be cached, got %d lookups", store.lookups)
+	}
+
+	// a changed flag is served from the cache until it is invalidated
+	store.enabled = false
+	if !GetFlag(context.Background(), "reviews") {
+		t.Error("Expected the cached value before invalidation")
+	}
+	InvalidateFlag("reviews")
+	if GetFlag(context.Background(), "reviews") {
+		t.Error("Expected the flag to be disabled after invalidation")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store.enabled = true
+	InvalidateFlag("reviews")
+	if GetFlag(ctx, "reviews") {
+		t.Error("Expected a cancelled context to report the flag as disabled")
+	}
+}
+
+// blockingFlagStore holds every lookup of the slow flag until release is closed
+type blockingFlagStore struct {
+	countingFlagStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingFlagStore) GetFlag(ctx context.Context, name string) (bool, error) {
+	if name == "slow" {
+		close(s.started)
+		<-s.release
+		return true, nil
+	}
+	return s.countingFlagStore.GetFlag(ctx, name)
+}
+
+// TestGetFlagSlowLookup checks a slow lookup doesn't block reads of other flags, and its value isn't cached once invalidated
+func TestGetFlagSlowLookup(t *testing.T) {
+	store := &blockingFlagStore{countingFlagStore: countingFlagStore{enabled: true}, started: make(chan struct{}), release: make(chan struct{})}
+	SetFeatureFlagStore(store)
+	defer SetFeatureFlagStore(nil)
+
+	done := make(chan bool)
+	go func() { done <- GetFlag(context.Background(), "slow") }()
+	<-store.started
+
+	if !GetFlag(context.Background(), "reviews") {
+		t.Error("Expected the reviews flag to be read while the slow lookup is running")
+	}
+	InvalidateFlag("slow")
+	close(store.release)
+	if !<-done {
+		t.Error("Expected the slow flag to be enabled")
+	}
+
+	flagCache.Lock()
+	_, cached := flagCache.entries["slow"]
+	flagCache.Unlock()
+	if cached {
+		t.Error("Expected the value read before the invalidation not to be cached")
+	}
+}
+
+// roleUserStore returns the user or error set on it from GetUserByID
+type roleUserStore struct {
+	types.UserStore
+	user *types.User
+	err  error
+}
+
+func (s *roleUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	return s.user, s.err
+}
+
+func TestRequireRole(t *testing.T) {
+	token, err := auth.CreateJWT([]byte(config.Envs.JWTSecret), 1)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		store          *roleUserStore
+		expectedStatus int
+	}{
+		{name: "admin", authorization: "Bearer " + token, store: &roleUserStore{user: &types.User{ID: 1, Role: types.RoleAdmin, IsActive: true}}, expectedStatus: http.StatusOK},
+		{name: "missing token", store: &roleUserStore{}, expectedStatus: http.StatusUnauthorized},
+		{name: "deleted user", authorization: "Bearer " + token, store: &roleUserStore{err: sql.ErrNoRows}, expectedStatus: http.StatusUnauthorized},
+		{name: "customer", authorization: "Bearer " + token, store: &roleUserStore{user: &types.User{ID: 1, Role: types.RoleUser, IsActive: true}}, expectedStatus: http.StatusForbidden},
+		{name: "store error", authorization: "Bearer " + token, store: &roleUserStore{err: fmt.Errorf("error querying user: connection refused")}, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := RequireRole(tc.store, types.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// batchMetricsStore records the batches of hits written to it, failing the first failures of them
+// written receives every batch that was recorded
+type batchMetricsStore struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]types.APIMetrics
+	written  chan []types.APIMetrics
+}
+
+func (s *batchMetricsStore) AddHits(ctx context.Context, hits []types.APIMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("database unavailable")
+	}
+	s.batches = append(s.batches, hits)
+	if s.written != nil {
+		s.written <- hits
+	}
+	return nil
+}
+
+func (s *batchMetricsStore) GetTopRoutes(ctx context.Context, date string, limit int) ([]types.APIMetrics, error) {
+	return nil, nil
+}
+
+// serveMetricsRequests sends a few requests through a router counting hits with countHits
+func serveMetricsRequests(t *testing.T, countHits func(http.Handler) http.Handler) {
+	t.Helper()
+	router := mux.NewRouter()
+	router.Use(countHits)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc("/products", ok).Methods(http.MethodGet)
+	router.HandleFunc("/products/{id}", ok).Methods(http.MethodGet, http.MethodDelete)
+
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/products/1"},
+		{http.MethodGet, "/products/2"},
+		{http.MethodDelete, "/products/2"},
+		{http.MethodGet, "/products"},
+	} {
+		req := httptest.NewRequest(request.method, request.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %s %s, got %d", http.StatusOK, request.method, request.path, rr.Code)
+		}
+	}
+}
+
+// expectedMetricsBatch is the batch serveMetricsRequests' hits are written in, counted by route template and sorted
+func expectedMetricsBatch() []types.APIMetrics {
+	today := time.Now().Format(time.DateOnly)
+	return []types.APIMetrics{
+		{Route: "/products", Method: http.MethodGet, Date: today, HitCount: 1},
+		{Route: "/products/{id}", Method: http.MethodDelete, Date: today, HitCount: 1},
+		{Route: "/products/{id}", Method: http.MethodGet, Date: today, HitCount: 2},
+	}
+}
+
+// TestMetricsMiddleware checks hits are counted in memory and written in a single batch when the writer stops
+func TestMetricsMiddleware(t *testing.T) {
+	store := &batchMetricsStore{}
+	countHits, stop := MetricsMiddleware(store, time.Hour)
+
+	serveMetricsRequests(t, countHits)
+	if len(store.batches) != 0 {
+		t.Fatalf("Expected no batch before the interval has passed, got %v", store.batches)
+	}
+	stop()
+
+	if len(store.batches) != 1 || !reflect.DeepEqual(store.batches[0], expectedMetricsBatch()) {
+		t.Errorf("Expected the single batch %v, got %v", expectedMetricsBatch(), store.batches)
+	}
+}
+
+// TestMetricsMiddlewareRetries checks counts that fail to be written are kept for the next batch
+func TestMetricsMiddlewareRetries(t *testing.T) {
+	store := &batchMetricsStore{failures: 1, written: make(chan []types.APIMetrics, 1)}
+	countHits, stop := MetricsMiddleware(store, 10*time.Millisecond)
+	defer stop()
+
+	serveMetricsRequests(t, countHits)
+	select {
+	case batch := <-store.written:
+		if !reflect.DeepEqual(batch, expectedMetricsBatch()) {
+			t.Errorf("Expected the failed batch to be retried as %v, got %v", expectedMetricsBatch(), batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the hits to be written once the store recovered")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	type address struct {
+		Zip int `json:"zip"`
+	}
+	type payload struct {
+		Name    string   `json:"name"`
+		Price   float64  `json:"price"`
+		Tags    []string `json:"tags"`
+		Address address  `json:"address"`
+	}
+
+	testCases := []struct {
+		name        string
+		body        string
+		expectedErr string
+	}{
+		{name: "valid body", body: `{"name":"Mug","price":9.5,"tags":["kitchen"],"address":{"zip":560001}}`},
+		{name: "type mismatch", body: `{"name":"Mug","price":"cheap"}`, expectedErr: "field 'price' must be a number"},
+		{name: "nested type mismatch", body: `{"address":{"zip":"560001"}}`, expectedErr: "field 'address.zip' must be a number"},
+		{name: "array expected", body: `{"tags":"kitchen"}`, expectedErr: "field 'tags' must be an array"},
+		{name: "wrong top level value", body: `[1,2]`, expectedErr: "request body must be an object"},
+		{name: "malformed JSON", body: `{"name":"Mug",}`, expectedErr: "request body is not valid JSON"},
+		{name: "truncated JSON", body: `{"name":"Mug"`, expectedErr: "request body is not valid JSON"},
+		{name: "empty body", body: ``, expectedErr: "request body is empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			var p payload
+			err := ParseJSON(r, &p)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.expectedErr {
+				t.Fatalf("Expected error %q, got %v", tc.expectedErr, err)
+			}
+			if strings.Contains(err.Error(), "float64") || strings.Contains(err.Error(), "Go struct") {
+				t.Errorf("Expected no Go type names in %q", err.Error())
+			}
+		})
+	}
+}
+
+// TestParseMsgpack checks MessagePack bodies are decoded with the JSON field names and their errors are reworded
+func TestParseMsgpack(t *testing.T) {
+	type payload struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+		Stock *int    `json:"stock" validate:"required"`
+	}
+	encode := func(v any) string {
+		t.Helper()
+		body, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode body: %v", err)
+		}
+		return string(body)
+	}
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    payload
+		expectedErr string
+	}{
+		{name: "valid body", contentType: "application/msgpack", body: encode(map[string]any{"name": "Mug", "price": 9.5, "stock": 3}), expected: payload{Name: "Mug", Price: 9.5}},
+		{name: "media type parameters", contentType: "application/msgpack; charset=binary", body: encode(map[string]any{"name": "Mug"}), expected: payload{Name: "Mug"}},
+		{name: "type mismatch", contentType: "application/msgpack", body: encode(map[string]any{"price": "cheap"}), expectedErr: "request body is not valid MessagePack"},
+		{name: "JSON sent as MessagePack", contentType: "application/msgpack", body: `{"name":"Mug"}`, expectedErr: "request body is not valid MessagePack"},
+		{name: "empty body", contentType: "application/msgpack", body: ``, expectedErr: "request body is empty"},
+		{name: "JSON content type", contentType: "application/json", body: `{"name":"Mug"}`, expected: payload{Name: "Mug"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			var p payload
+			err := ParseJSON(r, &p)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if p.Name != tc.expected.Name || p.Price != tc.expected.Price {
+				t.Errorf("Expected %+v, got %+v", tc.expected, p)
+			}
+		})
+	}
+
+	t.Run("oversized body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(encode(map[string]any{"name": strings.Repeat("a", 100)})))
+		r.Header.Set("Content-Type", "application/msgpack")
+		r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, 10)
+		var p payload
+		if err := ParseJSON(r, &p); err == nil || err.Error() != "request body must not exceed 10 bytes" {
+			t.Errorf("Expected the size limit error, got %v", err)
+		}
+	})
+}
+
+// TestNegotiateContent checks responses are only sent as MessagePack when the client prefers it,
+// with the same field names, hidden fields and price rounding as JSON
+func TestNegotiateContent(t *testing.T) {
+	type account struct {
+		Email    string      `json:"email"`
+		Password string      `json:"-"`
+		Balance  types.Price `json:"balance"`
+	}
+	handler := NegotiateContent(AllowHead(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"data":   account{Email: "jane@example.com", Password: "hash", Balance: 99.98999999},
+		})
+	}))
+
+	testCases := []struct {
+		accept      string
+		wantMsgpack bool
+	}{
+		{accept: "", wantMsgpack: false},
+		{accept: "*/*", wantMsgpack: false},
+		{accept: "application/json", wantMsgpack: false},
+		{accept: "application/msgpack", wantMsgpack: true},
+		{accept: "application/json;q=0.5, application/msgpack", wantMsgpack: true},
+		{accept: "application/msgpack;q=0.5, application/json", wantMsgpack: false},
+		{accept: "application/json, application/msgpack", wantMsgpack: false},
+		{accept: "application/msgpack;q=0", wantMsgpack: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tc.accept)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if vary := rr.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", vary)
+			}
+			var response struct {
+				Data map[string]any `json:"data"`
+			}
+			if tc.wantMsgpack {
+				if contentType := rr.Header().Get("Content-Type"); contentType != MsgpackContentType {
+					t.Fatalf("Expected Content-Type %q, got %q", MsgpackContentType, contentType)
+				}
+				decoder := msgpack.NewDecoder(rr.Body)
+				decoder.SetCustomStructTag("json")
+				if err := decoder.Decode(&response); err != nil {
+					t.Fatalf("Failed to decode MessagePack response: %v", err)
+				}
+			} else {
+				if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+					t.Fatalf("Expected Content-Type %q, got %q", "application/json", contentType)
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to decode JSON response: %v", err)
+				}
+			}
+
+			if response.Data["email"] != "jane@example.com" || response.Data["balance"] != 99.99 {
+				t.Errorf("Expected the JSON field names and a rounded balance, got %v", response.Data)
+			}
+			if _, ok := response.Data["Password"]; ok || len(response.Data) != 2 {
+				t.Errorf("Expected the password to be left out, got %v", response.Data)
+			}
+		})
+	}
+
+	t.Run("HEAD", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodHead, "/", nil)
+		r.Header.Set("Accept", MsgpackContentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		if contentType := rr.Header().Get("Content-Type"); contentType != MsgpackContentType {
+			t.Errorf("Expected Content-Type %q through AllowHead, got %q", MsgpackContentType, contentType)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("Expected no body, got %d bytes", rr.Body.Len())
+		}
+	})
+}
+
+// BenchmarkWriteJSON compares encoding a listing of 100 products as JSON and as MessagePack
+func BenchmarkWriteJSON(b *testing.B) {
+	products := make([]types.Product, 100)
+	for i := range products {
+		products[i] = types.Product{
+			ID:          i + 1,
+			Name:        fmt.Sprintf("Product %d", i+1),
+			SKU:         fmt.Sprintf("SKU-%04d", i+1),
+			Category:    "Kitchen",
+			Description: "A sturdy product for everyday use, with a description of typical length",
+			Image:       "https://example.com/images/product.jpg",
+			Price:       types.Price(9.99 + float64(i)),
+			Currency:    "USD",
+			Quantity:    42,
+			CreatedAt:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		}
+	}
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "products fetched successfully",
+		"data":    products,
+	}
+
+	for _, accept := range []string{"application/json", MsgpackContentType} {
+		b.Run(accept, func(b *testing.B) {
+			handler := NegotiateContent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				WriteJSON(w, http.StatusOK, response)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", accept)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, r)
+				b.SetBytes(int64(rr.Body.Len()))
+			}
+		})
+	}
+}
+
+func TestGetIntParam(t *testing.T) {
+	testCases := []struct {
+		name        string
+		query       string
+		expected    int
+		expectedErr string
+	}{
+		{name: "valid", query: "page=3", expected: 3},
+		{name: "negative", query: "page=-2", expected: -2},
+		{name: "missing uses the default", query: "", expected: 7},
+		{name: "empty uses the default", query: "page=", expected: 7},
+		{name: "not a number", query: "page=abc", expectedErr: "page must be an integer"},
+		{name: "decimal", query: "page=1.5", expectedErr: "page must be an integer"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil)
+			value, err := GetIntParam(r, "page", 7)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestGetStringParam(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "valid", query: "sort=price", expected: "price"},
+		{name: "trims whitespace", query: "sort=%20price%20", expected: "price"},
+		{name: "missing uses the default", query: "", expected: "name"},
+		{name: "blank uses the default", query: "sort=%20%20", expected: "name"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil)
+			if value := GetStringParam(r, "sort", "name"); value != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestGetFloatParam(t *testing.T) {
+	testCases := []struct {
+		name        string
+		query       string
+		expected    float64
+		expectedErr string
+	}{
+		{name: "valid", query: "minPrice=19.99", expected: 19.99},
+		{name: "integer", query: "minPrice=20", expected: 20},
+		{name: "missing uses the default", query: "", expected: 5},
+		{name: "not a number", query: "minPrice=cheap", expectedErr: "minPrice must be a number"},
+		{name: "NaN", query: "minPrice=NaN", expectedErr: "minPrice must be a number"},
+		{name: "infinity", query: "minPrice=Inf", expectedErr: "minPrice must be a number"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil)
+			value, err := GetFloatParam(r, "minPrice", 5)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Fatalf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if value != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	original, originalProxies := config.Envs.TrustProxy, config.Envs.TrustedProxies
+	defer func() { config.Envs.TrustProxy, config.Envs.TrustedProxies = original, originalProxies }()
+
+	testCases := []struct {
+		name           string
+		trustProxy     bool
+		trustedProxies []string // CIDR ranges, the private networks when empty
+		remoteAddr     string
+		header         http.Header
+		expected       string
+	}{
+		{name: "direct connection", remoteAddr: "203.0.113.7:52114", expected: "203.0.113.7"},
+		{name: "direct IPv6 connection", remoteAddr: "[2001:db8::1]:52114", expected: "2001:db8::1"},
+		{
+			name:       "single proxy",
+			trustProxy: true,
+			remoteAddr: "10.0.0.2:41000",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			expected:   "203.0.113.7",
+		},
+		{
+			// 198.51.100.4 isn't a trusted proxy, so it is the client and whatever it forwarded can't be believed
+			name:       "chained proxies",
+			trustProxy: true,
+			remoteAddr: "10.0.0.3:41000",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7, 198.51.100.4", "10.0.0.2"}},
+			expected:   "198.51.100.4",
+		},
+		{
+			name:           "chained trusted proxies",
+			trustProxy:     true,
+			trustedProxies: []string{"10.0.0.0/8", "198.51.100.4/32"},
+			remoteAddr:     "10.0.0.3:41000",
+			header:         http.Header{"X-Forwarded-For": {"203.0.113.7, 198.51.100.4", "10.0.0.2"}},
+			expected:       "203.0.113.7",
+		},
+		{
+			name:       "spoofed entries left of the client are ignored",
+			trustProxy: true,
+			remoteAddr: "10.0.0.2:41000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.99, 203.0.113.7"}},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "invalid forwarded entries are skipped",
+			trustProxy: true,
+			remoteAddr: "10.0.0.2:41000",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7, unknown"}},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "every hop trusted",
+			trustProxy: true,
+			remoteAddr: "10.0.0.3:41000",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.1, 10.0.0.2"}},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "X-Real-IP",
+			trustProxy: true,
+			remoteAddr: "10.0.0.2:41000",
+			header:     http.Header{"X-Real-Ip": {"203.0.113.7"}},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy without forwarding headers",
+			trustProxy: true,
+			remoteAddr: "10.0.0.2:41000",
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "headers from an untrusted peer ignored",
+			trustProxy: true,
+			remoteAddr: "203.0.113.9:52114",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.4"}, "X-Real-Ip": {"198.51.100.5"}},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "spoofed headers ignored without proxy trust",
+			remoteAddr: "203.0.113.7:52114",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.4"}, "X-Real-Ip": {"198.51.100.5"}},
+			expected:   "203.0.113.7",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Envs.TrustProxy = tc.trustProxy
+			config.Envs.TrustedProxies = nil
+			cidrs := tc.trustedProxies
+			if len(cidrs) == 0 {
+				cidrs = strings.Split(config.DefaultTrustedProxies, ",")
+			}
+			for _, cidr := range cidrs {
+				_, network, err := net.ParseCIDR(cidr)
+				if err != nil {
+					t.Fatalf("Invalid CIDR %q: %v", cidr, err)
+				}
+				config.Envs.TrustedProxies = append(config.Envs.TrustedProxies, network)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for key, values := range tc.header {
+				r.Header[key] = values
+			}
+			if ip := ClientIP(r); ip != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, ip)
+			}
+		})
+	}
+}
+
+func TestRetryOnTransient(t *testing.T) {
+	lockWait := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+
+	testCases := []struct {
+		name          string
+		errs          []error // returned by successive calls, nil once they run out
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "succeeds after two transient errors", errs: []error{lockWait, &mysql.MySQLError{Number: 1213}}, expectedCalls: 3},
+		{name: "gives up after the last attempt", errs: []error{lockWait, lockWait, lockWait, lockWait}, expectedCalls: 3, expectedErr: lockWait},
+		{name: "does not retry other errors", errs: []error{&mysql.MySQLError{Number: 1062}}, expectedCalls: 1, expectedErr: &mysql.MySQLError{Number: 1062}},
+		{name: "does not retry a lost connection", errs: []error{&mysql.MySQLError{Number: 2006}}, expectedCalls: 1, expectedErr: &mysql.MySQLError{Number: 2006}},
+		{name: "does not retry non MySQL errors", errs: []error{fmt.Errorf("wrapped: %w", context.Canceled)}, expectedCalls: 1, expectedErr: context.Canceled},
+		{name: "retries wrapped transient errors", errs: []error{fmt.Errorf("insert: %w", lockWait)}, expectedCalls: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			err := RetryOnTransient(func() error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			}, 3, time.Millisecond)
+
+			if calls != tc.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tc.expectedCalls, calls)
+			}
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	dbDown := errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+	fail := func() error { return dbDown }
+	succeed := func() error { return nil }
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		cb := NewCircuitBreaker(3, time.Hour)
+		for i := 0; i < 3; i++ {
+			if state := cb.State(); state != CircuitClosed {
+				t.Fatalf("Expected the circuit to be closed after %d failures, got %v", i, state)
+			}
+			if err := cb.Execute(fail); !errors.Is(err, dbDown) {
+				t.Fatalf("Expected the database error, got %v", err)
+			}
+		}
+		if state := cb.State(); state != CircuitOpen {
+			t.Fatalf("Expected the circuit to be open, got %v", state)
+		}
+
+		called := false
+		err := cb.Execute(func() error { called = true; return nil })
+		if !errors.Is(err, ErrServiceUnavailable) || called {
+			t.Errorf("Expected ErrServiceUnavailable without a call, got %v (called %v)", err, called)
+		}
+	})
+
+	t.Run("successes and answered queries reset the count", func(t *testing.T) {
+		cb := NewCircuitBreaker(2, time.Hour)
+		cb.Execute(fail)
+		cb.Execute(succeed)
+		cb.Execute(fail)
+		cb.Execute(func() error { return sql.ErrNoRows })
+		cb.Execute(func() error { return &mysql.MySQLError{Number: 1062} })
+		cb.Execute(fail)
+		if state := cb.State(); state != CircuitClosed {
+			t.Errorf("Expected the circuit to stay closed, got %v", state)
+		}
+	})
+
+	t.Run("the database breaker uses the loaded failure threshold", func(t *testing.T) {
+		defaults := config.Envs
+		defer func() { config.Envs = defaults }()
+		for key, value := range map[string]string{
+			"DB_USER": "gommerce", "DB_PASSWORD": "s3cret", "DB_NAME": "gommerce", "JWT_SECRET": "a-long-random-secret",
+			"DB_CIRCUIT_FAILURE_THRESHOLD": "1",
+		} {
+			t.Setenv(key, value)
+		}
+		if err := config.InitConfig(); err != nil {
+			t.Fatalf("Unexpected config error: %v", err)
+		}
+
+		cb := NewDBCircuitBreaker()
+		cb.Execute(fail)
+		if state := cb.State(); state != CircuitOpen {
+			t.Errorf("Expected one failure to open the circuit with DB_CIRCUIT_FAILURE_THRESHOLD=1, got %v", state)
+		}
+	})
+
+	t.Run("a trial call after the recovery timeout closes or reopens the circuit", func(t *testing.T) {
+		cb := NewCircuitBreaker(1, 10*time.Millisecond)
+		cb.Execute(fail)
+		time.Sleep(15 * time.Millisecond)
+		if state := cb.State(); state != CircuitHalfOpen {
+			t.Fatalf("Expected the circuit to be half-open, got %v", state)
+		}
+		if err := cb.Execute(fail); !errors.Is(err, dbDown) {
+			t.Fatalf("Expected the trial call to run, got %v", err)
+		}
+		if err := cb.Execute(succeed); !errors.Is(err, ErrServiceUnavailable) {
+			t.Fatalf("Expected a failed trial to reopen the circuit, got %v", err)
+		}
+
+		time.Sleep(15 * time.Millisecond)
+		if err := cb.Execute(succeed); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if state := cb.State(); state != CircuitClosed {
+			t.Errorf("Expected a successful trial to close the circuit, got %v", state)
+		}
+	})
+}